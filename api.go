@@ -59,14 +59,26 @@ type API_Request struct {
 	KeyValue map[string]interface{} `json:"keyvalue,omitempty"`
 	// If KeyValueReplace is true, previous KeyValue will be replaced with KeyValue
 	KeyValueReplace bool `json:"keyvalue-replace,omitempty"`
+	// KeyValueOps are atomic operations on a single key, see API_KeyValueOp
+	// our operations are applied in order after our KeyValue, like our KeyValue they're only applied if our CAS is valid
+	// our operations are versioned by key, so CAS should be left empty unless our entire state must be unmodified
+	KeyValueOps []*API_KeyValueOp `json:"keyvalue-ops,omitempty"`
 	// Secret is required to access the /api GET and POST endpoints
 	Secret string `json:"secret,omitempty"`
+	// Token is an API Token that is authorized by our Config.Tokens
+	// If Token is set, our Secret is ignored
+	Token string `json:"token,omitempty"`
 	// CAS IS OPTIONAL
 	// if CAS is NOT set: we will ignore it and we will override all of our values and state!!!
 	// if CAS IS SET: we will only override values if our CAS is correct!
 	// HOWEVER, we will ALWAYS update our PING/LastSeen value REGARDLESS OF CAS!!!
 	// updating `Ping, LastSeen, or PID` will cause our CAS to be incremented!!!
 	CAS uint64 `json:"cas,omitempty"`
+	// identities are set by our HTTP API from a verified client certificate
+	// these can't be set from our request body
+	identities []string
+	// signed is set by our UDP API once our API_UDPEnvelope is verified
+	signed bool
 }
 
 func (self *API_Request) IsValid() bool {
@@ -80,7 +92,7 @@ func (self *API_Request) IsValid() bool {
 // If any values change or CAS is incremented, they will STILL reference the premodification state!
 //
 // When using UDP, we won't be able to respond with all of our data, we're going to have to limit our response size
-// We're going to limit our response to: `id, group, pid, started, lastseen, disabled, restart, run-once, shutdown`
+// We're going to limit our response to: `id, group, keepalive, pid, started, lastseen, disabled, restart, run-once, shutdown`
 // We'll have to ignore `history, keyvalue, and errors`, if they're needed the HTTP endpoint should be used instead
 type API_Response struct {
 	// Unique Identifier
@@ -91,6 +103,8 @@ type API_Response struct {
 	Group string `json:"group,omitempty"`
 	// Display Name
 	Name string `json:"name,omitempty"`
+	// App KeepAlive Method by name, ie: `pid-patrol`, Services do not have a KeepAlive
+	KeepAlive KeepAlive `json:"keepalive,omitempty"`
 	// App Process ID
 	PID uint32 `json:"pid,omitempty"`
 	// Timestamp App or Service started at
@@ -109,8 +123,14 @@ type API_Response struct {
 	History []*History `json:"history,omitempty"`
 	// Current state's KeyValue
 	KeyValue map[string]interface{} `json:"keyvalue,omitempty"`
+	// Current version of each of our keys, see API_KeyValueOp
+	KeyValueVersions map[string]uint64 `json:"keyvalue-versions,omitempty"`
+	// Current expiry of each of our keys that will expire
+	KeyValueExpires map[string]*Timestamp `json:"keyvalue-expires,omitempty"`
 	// Does this App or Service require a Secret to modify?
 	Secret bool `json:"secret,omitempty"`
+	// Does this App or Service accept a Token?
+	Token bool `json:"token,omitempty"`
 	// Did any Errors occur?
 	Errors []string `json:"errors,omitempty"`
 	// like all of our other values, CAS is a snapshot of our PREVIOUS state
@@ -127,6 +147,9 @@ type API_Response struct {
 	// We need to know if our CAS was successful or not!
 	// I prefer to have this as invalid and not valid as most requests without a CAS will be valid!
 	CASInvalid bool `json:"cas-invalid,omitempty"`
+	// KeyValueOps are the results of our API_Request.KeyValueOps, in order
+	// like CASInvalid, our results are NOT a snapshot of our previous state
+	KeyValueOps []*API_KeyValueResult `json:"keyvalue-ops,omitempty"`
 	// this is for unmarshal only
 	patrol *Patrol
 }
@@ -136,23 +159,28 @@ type API_Response struct {
 // we will temporarily use json.RawMessage and then we will create a History object for each result
 // this really isn't that aesthetic but it works well!
 type api_response struct {
-	ID         string                 `json:"id,omitempty"`
-	InstanceID string                 `json:"instance-id,omitempty"`
-	Group      string                 `json:"group,omitempty"`
-	Name       string                 `json:"name,omitempty"`
-	PID        uint32                 `json:"pid,omitempty"`
-	Started    *Timestamp             `json:"started,omitempty"`
-	LastSeen   *Timestamp             `json:"lastseen,omitempty"`
-	Disabled   bool                   `json:"disabled,omitempty"`
-	Restart    bool                   `json:"restart,omitempty"`
-	RunOnce    bool                   `json:"run-once,omitempty"`
-	Shutdown   bool                   `json:"shutdown,omitempty"`
-	History    []json.RawMessage      `json:"history,omitempty"`
-	KeyValue   map[string]interface{} `json:"keyvalue,omitempty"`
-	Secret     bool                   `json:"secret,omitempty"`
-	Errors     []string               `json:"errors,omitempty"`
-	CAS        uint64                 `json:"cas,omitempty"`
-	CASInvalid bool                   `json:"cas-invalid,omitempty"`
+	ID               string                 `json:"id,omitempty"`
+	InstanceID       string                 `json:"instance-id,omitempty"`
+	Group            string                 `json:"group,omitempty"`
+	Name             string                 `json:"name,omitempty"`
+	KeepAlive        KeepAlive              `json:"keepalive,omitempty"`
+	PID              uint32                 `json:"pid,omitempty"`
+	Started          *Timestamp             `json:"started,omitempty"`
+	LastSeen         *Timestamp             `json:"lastseen,omitempty"`
+	Disabled         bool                   `json:"disabled,omitempty"`
+	Restart          bool                   `json:"restart,omitempty"`
+	RunOnce          bool                   `json:"run-once,omitempty"`
+	Shutdown         bool                   `json:"shutdown,omitempty"`
+	History          []json.RawMessage      `json:"history,omitempty"`
+	KeyValue         map[string]interface{} `json:"keyvalue,omitempty"`
+	KeyValueVersions map[string]uint64      `json:"keyvalue-versions,omitempty"`
+	KeyValueExpires  map[string]*Timestamp  `json:"keyvalue-expires,omitempty"`
+	Secret           bool                   `json:"secret,omitempty"`
+	Token            bool                   `json:"token,omitempty"`
+	Errors           []string               `json:"errors,omitempty"`
+	CAS              uint64                 `json:"cas,omitempty"`
+	CASInvalid       bool                   `json:"cas-invalid,omitempty"`
+	KeyValueOps      []*API_KeyValueResult  `json:"keyvalue-ops,omitempty"`
 }
 
 func (self *API_Response) IsValid() bool {
@@ -161,6 +189,14 @@ func (self *API_Response) IsValid() bool {
 	}
 	return true
 }
+
+// LastHistory will return our most recent History, or nil if we've never closed
+func (self *API_Response) LastHistory() *History {
+	if len(self.History) == 0 {
+		return nil
+	}
+	return self.History[len(self.History)-1]
+}
 func (self *API_Response) UnmarshalJSON(
 	data []byte,
 ) error {
@@ -190,6 +226,7 @@ func (self *API_Response) UnmarshalJSON(
 	self.InstanceID = result.InstanceID
 	self.Group = result.Group
 	self.Name = result.Name
+	self.KeepAlive = result.KeepAlive
 	self.PID = result.PID
 	self.Started = result.Started
 	self.LastSeen = result.LastSeen
@@ -198,10 +235,14 @@ func (self *API_Response) UnmarshalJSON(
 	self.RunOnce = result.RunOnce
 	self.Shutdown = result.Shutdown
 	self.KeyValue = result.KeyValue
+	self.KeyValueVersions = result.KeyValueVersions
+	self.KeyValueExpires = result.KeyValueExpires
 	self.Secret = result.Secret
+	self.Token = result.Token
 	self.Errors = result.Errors
 	self.CAS = result.CAS
 	self.CASInvalid = result.CASInvalid
+	self.KeyValueOps = result.KeyValueOps
 	return nil
 }
 func (self *API_Response) NewAPITimestamp() *Timestamp {
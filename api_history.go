@@ -0,0 +1,93 @@
+package patrol
+
+const (
+	// API_HISTORY_LIMIT_DEFAULT is how many History entries are returned when our request has no Limit
+	API_HISTORY_LIMIT_DEFAULT = 100
+	// API_HISTORY_LIMIT_MAX is the most History entries that will be returned at once
+	API_HISTORY_LIMIT_MAX = HISTORY_MAX
+)
+
+// API_HistoryRequest is a query of our History, see Patrol.APIHistory()
+// Our History is returned newest first, across every App and Service that matches our request
+type API_HistoryRequest struct {
+	// Group: `app`, `service`, or empty for every App and Service
+	Group string `json:"group,omitempty"`
+	// Unique Identifier, or empty for every App or Service in our Group
+	// Group is required if ID is set
+	ID string `json:"id,omitempty"`
+	// Since and Until will only match History that stopped at or after Since, and before Until
+	Since *Timestamp `json:"since,omitempty"`
+	Until *Timestamp `json:"until,omitempty"`
+	// ExitCodes will only match History that exited with one of these exit codes
+	// History that was terminated by a signal has no exit code and will never match
+	ExitCodes []uint8 `json:"exit-codes,omitempty"`
+	// If Unexpected is true, we will only match History that closed unexpectedly, see History.IsUnexpected()
+	Unexpected bool `json:"unexpected,omitempty"`
+	// Limit is how many entries are returned, see API_HISTORY_LIMIT_DEFAULT and API_HISTORY_LIMIT_MAX
+	Limit int `json:"limit,omitempty"`
+	// Cursor is our previous API_HistoryResponse.Cursor, our next page starts after our previous page
+	Cursor string `json:"cursor,omitempty"`
+	// Secret is only compared when we request a single App or Service by ID
+	Secret string `json:"secret,omitempty"`
+	// Token must be authorized with TOKEN_SCOPE_READ for each App or Service
+	// If Token is set or Tokens are required, Apps and Services our Token isn't authorized for are excluded
+	Token string `json:"token,omitempty"`
+	// identities are set by our HTTP API from a verified client certificate
+	identities []string
+}
+
+func (self *API_HistoryRequest) IsValid() bool {
+	if self == nil {
+		return false
+	}
+	return true
+}
+
+// API_HistoryResponse is the result of our API_HistoryRequest
+type API_HistoryResponse struct {
+	History []*API_HistoryEntry `json:"history,omitempty"`
+	// Stats are computed from every History entry that matched our request, regardless of our Limit and Cursor
+	// every App and Service that was queried is included, even if none of its History matched
+	Stats []*API_HistoryStats `json:"stats,omitempty"`
+	// Cursor is only set if there are more entries, it should be sent as our next API_HistoryRequest.Cursor
+	Cursor string `json:"cursor,omitempty"`
+	// Did any Errors occur?
+	Errors []string `json:"errors,omitempty"`
+}
+
+func (self *API_HistoryResponse) IsValid() bool {
+	if self == nil {
+		return false
+	}
+	return true
+}
+
+// API_HistoryEntry is a single History entry of an App or Service
+type API_HistoryEntry struct {
+	Group   string   `json:"group"`
+	ID      string   `json:"id"`
+	History *History `json:"history"`
+}
+
+// API_HistoryStats are how stable a single App or Service has been
+// our durations are in seconds
+type API_HistoryStats struct {
+	Group string `json:"group"`
+	ID    string `json:"id"`
+	Name  string `json:"name,omitempty"`
+	// Count is how many History entries matched our request
+	Count int `json:"count"`
+	// Restarts are how many times we were closed and started again, either unexpectedly or because we were restarted
+	Restarts int `json:"restarts"`
+	// Failures are how many times we were closed unexpectedly, see History.IsUnexpected()
+	Failures int `json:"failures"`
+	// Uptime is how long each of our History entries ran for, from Started until Stopped
+	UptimeTotal  float64 `json:"uptime-total"`
+	UptimeMean   float64 `json:"uptime-mean"`
+	UptimeMedian float64 `json:"uptime-median"`
+	// MTBF is our mean time between failures, our total uptime divided by our failures
+	// MTBF is 0 if we've never failed
+	MTBF float64 `json:"mtbf,omitempty"`
+	// LastFailure is our most recent unexpected close
+	LastFailure *History `json:"last-failure,omitempty"`
+}
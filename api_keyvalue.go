@@ -0,0 +1,192 @@
+package patrol
+
+import (
+	"sabey.co/patrol/cas"
+	"time"
+)
+
+const (
+	API_KEYVALUE_OP_SET             = "set"
+	API_KEYVALUE_OP_COMPARE_AND_SET = "compare-and-set"
+	API_KEYVALUE_OP_DELETE          = "delete"
+	API_KEYVALUE_OP_INCREMENT       = "increment"
+	API_KEYVALUE_OP_APPEND          = "append"
+)
+
+// API_KeyValueOp is an atomic operation on a single key of our KeyValue
+// every key has its own version, our version is only modified when our key is modified
+// our operations never require our CAS, so a Ping or a write to another key will never invalidate our operation
+type API_KeyValueOp struct {
+	// Op: `set`, `compare-and-set`, `delete`, `increment` or `append`
+	//
+	// API_KEYVALUE_OP_SET: Set our key to Value
+	// API_KEYVALUE_OP_COMPARE_AND_SET: Set our key to Value only if our key's version is Version
+	// API_KEYVALUE_OP_DELETE: Delete our key
+	// API_KEYVALUE_OP_INCREMENT: Add Delta to our number, a key that does not exist is 0
+	// API_KEYVALUE_OP_APPEND: Append Value to our list, a key that does not exist is an empty list
+	Op string `json:"op,omitempty"`
+	// Key is required
+	Key string `json:"key,omitempty"`
+	// Value is used by `set`, `compare-and-set` and `append`
+	// if our Value is a list, `append` will append each of our values
+	Value interface{} `json:"value,omitempty"`
+	// Delta is used by `increment`
+	Delta float64 `json:"delta,omitempty"`
+	// Version is used by `compare-and-set`, a Version of 0 will only set a key that does not exist
+	Version uint64 `json:"version,omitempty"`
+	// TTL is how many seconds until our key expires, expired keys are deleted on our next check
+	// if our TTL is 0, `set` and `compare-and-set` will never expire, `increment` and `append` will keep our previous expiry
+	TTL int64 `json:"ttl,omitempty"`
+}
+
+func (self *API_KeyValueOp) IsValid() bool {
+	if self == nil {
+		return false
+	}
+	if self.Key == "" {
+		return false
+	}
+	if self.TTL < 0 {
+		return false
+	}
+	if self.Op != API_KEYVALUE_OP_SET &&
+		self.Op != API_KEYVALUE_OP_COMPARE_AND_SET &&
+		self.Op != API_KEYVALUE_OP_DELETE &&
+		self.Op != API_KEYVALUE_OP_INCREMENT &&
+		self.Op != API_KEYVALUE_OP_APPEND {
+		return false
+	}
+	return true
+}
+
+// API_KeyValueResult is the result of our API_KeyValueOp
+// unlike the rest of our API_Response our results are NOT a snapshot of our previous state
+type API_KeyValueResult struct {
+	Op  string `json:"op,omitempty"`
+	Key string `json:"key,omitempty"`
+	// Value is our new value, our number for `increment` and our list for `append`
+	Value interface{} `json:"value,omitempty"`
+	// Version is our key's new version, our Version is 0 once our key is deleted
+	Version uint64 `json:"version,omitempty"`
+	// Expires is when our key will expire
+	Expires *Timestamp `json:"expires,omitempty"`
+	// Error: `Key Version Invalid`, `Key Not Number`, `Key Not List` or `Unknown Key`
+	Error string `json:"error,omitempty"`
+}
+
+// keyValueOps is our cas.App or cas.Service, our object must be write locked
+type keyValueOps interface {
+	SetKey(string, interface{}, time.Time) uint64
+	CompareAndSetKey(string, interface{}, uint64, time.Time) (uint64, error)
+	DeleteKey(string) bool
+	IncrementKey(string, float64, time.Time) (float64, uint64, error)
+	AppendKey(string, []interface{}, time.Time) ([]interface{}, uint64, error)
+	GetKeyExpire(string) (time.Time, bool)
+	ExpireKeyValue(time.Time) []string
+}
+
+// apiKeyValueOps will apply our operations in order, our operations must be valid
+// an operation that fails is returned with an error, our remaining operations are still applied
+func (self *Patrol) apiKeyValueOps(
+	o keyValueOps,
+	ops []*API_KeyValueOp,
+) []*API_KeyValueResult {
+	now := self.now()
+	// our operations must never act on a key that has expired, even if our App or Service has not been checked since
+	o.ExpireKeyValue(now)
+	results := make([]*API_KeyValueResult, 0, len(ops))
+	for _, op := range ops {
+		result := &API_KeyValueResult{
+			Op:  op.Op,
+			Key: op.Key,
+		}
+		results = append(results, result)
+		var expires time.Time
+		if op.TTL > 0 {
+			expires = now.Add(time.Duration(op.TTL) * time.Second)
+		}
+		var err error
+		switch op.Op {
+		case API_KEYVALUE_OP_SET:
+			result.Version = o.SetKey(op.Key, op.Value, expires)
+			result.Value = op.Value
+		case API_KEYVALUE_OP_COMPARE_AND_SET:
+			if result.Version, err = o.CompareAndSetKey(op.Key, op.Value, op.Version, expires); err == nil {
+				result.Value = op.Value
+			}
+		case API_KEYVALUE_OP_DELETE:
+			if !o.DeleteKey(op.Key) {
+				result.Error = "Unknown Key"
+			}
+			continue
+		case API_KEYVALUE_OP_INCREMENT:
+			var n float64
+			if n, result.Version, err = o.IncrementKey(op.Key, op.Delta, expires); err == nil {
+				result.Value = n
+			}
+		case API_KEYVALUE_OP_APPEND:
+			values, ok := op.Value.([]interface{})
+			if !ok {
+				values = []interface{}{op.Value}
+			}
+			var list []interface{}
+			if list, result.Version, err = o.AppendKey(op.Key, values, expires); err == nil {
+				result.Value = list
+			}
+		}
+		if err != nil {
+			if err == cas.ERR_KEY_VERSION_INVALID {
+				result.Error = "Key Version Invalid"
+			} else if err == cas.ERR_KEY_NOT_NUMBER {
+				result.Error = "Key Not Number"
+			} else if err == cas.ERR_KEY_NOT_LIST {
+				result.Error = "Key Not List"
+			} else {
+				result.Error = err.Error()
+			}
+			continue
+		}
+		if e, ok := o.GetKeyExpire(op.Key); ok {
+			result.Expires = &Timestamp{
+				Time:            e,
+				TimestampFormat: self.config.Timestamp,
+			}
+		}
+	}
+	return results
+}
+
+// unexpiredKeyValue will remove every key that has expired by now from our KeyValue, versions and expiries
+// our expired keys are only deleted once our App or Service is checked, a key must never be returned once it has expired
+// our maps must be dereferenced, a nil map is ignored
+func unexpiredKeyValue(
+	now time.Time,
+	kv map[string]interface{},
+	versions map[string]uint64,
+	expires map[string]time.Time,
+) {
+	for k, e := range expires {
+		if !now.Before(e) {
+			delete(kv, k)
+			delete(versions, k)
+			delete(expires, k)
+		}
+	}
+}
+
+// apiKeyValueExpires will return the expiry of our keys, or nil if none of our keys expire
+func (self *Patrol) apiKeyValueExpires(
+	expires map[string]time.Time,
+) map[string]*Timestamp {
+	if len(expires) == 0 {
+		return nil
+	}
+	timestamps := make(map[string]*Timestamp, len(expires))
+	for k, e := range expires {
+		timestamps[k] = &Timestamp{
+			Time:            e,
+			TimestampFormat: self.config.Timestamp,
+		}
+	}
+	return timestamps
+}
@@ -40,3 +40,30 @@ func (self *Patrol) GetStatus() *API_Status {
 	}
 	return result
 }
+
+// GetTokenStatus will return our status for our Token
+// if our Token is not presented and not required, every App and Service is returned, the same as GetStatus()
+// otherwise only the Apps and Services our Token may read are returned, nil is returned if our Token is unauthorized
+func (self *Patrol) GetTokenStatus(
+	token string,
+) *API_Status {
+	if token == "" &&
+		!self.config.TokenRequired {
+		return self.GetStatus()
+	}
+	if self.verifyToken(token) == nil {
+		return nil
+	}
+	result := self.GetStatus()
+	for id := range result.Apps {
+		if !self.IsTokenAuthorized(token, "app", id, TOKEN_SCOPE_READ) {
+			delete(result.Apps, id)
+		}
+	}
+	for id := range result.Services {
+		if !self.IsTokenAuthorized(token, "service", id, TOKEN_SCOPE_READ) {
+			delete(result.Services, id)
+		}
+	}
+	return result
+}
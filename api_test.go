@@ -1,6 +1,7 @@
 package patrol
 
 import (
+	"bytes"
 	"encoding/json"
 	"log"
 	"sabey.co/unittest"
@@ -15,10 +16,11 @@ func TestAPIResponse(t *testing.T) {
 
 	log.Println("marshal")
 	response := &API_Response{
-		ID:    "id",
-		Group: "group",
-		Name:  "name",
-		PID:   1,
+		ID:        "id",
+		Group:     "group",
+		Name:      "name",
+		KeepAlive: APP_KEEPALIVE_HTTP,
+		PID:       1,
 		Started: &Timestamp{
 			Time: now,
 		},
@@ -65,6 +67,8 @@ func TestAPIResponse(t *testing.T) {
 	unittest.IsNil(t, err)
 	unittest.Equals(t, len(body) > 0, true)
 	log.Printf("response: \"%s\"\n", body)
+	// our keepalive is marshalled as its name
+	unittest.Equals(t, bytes.Contains(body, []byte(`"keepalive": "http"`)), true)
 
 	log.Println("unmarshal")
 	result := &API_Response{}
@@ -73,6 +77,7 @@ func TestAPIResponse(t *testing.T) {
 	unittest.Equals(t, response.ID, result.ID)
 	unittest.Equals(t, response.Group, result.Group)
 	unittest.Equals(t, response.Name, result.Name)
+	unittest.Equals(t, response.KeepAlive, result.KeepAlive)
 	unittest.Equals(t, response.PID, result.PID)
 	unittest.Equals(t, response.Started.String(), result.Started.String())   // we can't use Equal due to response having being a monotonic timestamp
 	unittest.Equals(t, response.LastSeen.String(), result.LastSeen.String()) // we can't use Equal due to response having being a monotonic timestamp
@@ -30,6 +30,7 @@ const (
 	APP_ENV_PID         = `PATROL_PID`
 	APP_ENV_LISTEN_HTTP = `PATROL_HTTP`
 	APP_ENV_LISTEN_UDP  = `PATROL_UDP`
+	APP_ENV_LISTEN_UNIX = `PATROL_UNIX`
 )
 
 // there are multiple methods of process management, none of them are perfect! they all have their tradeoffs!!!
@@ -66,6 +67,7 @@ var (
 	ERR_APP_KEEPALIVE_PATROL_NOTRUNNING = fmt.Errorf("App KeepAlive Patrol Method not running")
 	ERR_APP_PIDFILE_NOTFOUND            = fmt.Errorf("App PID File not found")
 	ERR_APP_PIDFILE_INVALID             = fmt.Errorf("App PID File was invalid")
+	ERR_APP_PID_EXITED                  = fmt.Errorf("App PID has exited")
 )
 
 type App struct {
@@ -80,6 +82,20 @@ type App struct {
 	// history is NOT included in our cas Object because we didn't want to restructure Patrol
 	history []*History
 	o       *cas.App
+	// watch is our watch of our `pid-path` PID, our check is woken as soon as our PID exits
+	// our PID is only watched if our Executor is an ExecutorWatcher
+	watch *appWatch
+	// exited is the last PID our watch saw exit
+	// a PID that has exited may still answer `kill -0` until it has been reaped by its parent
+	exited uint32
+	// exit_status is how our waited on process exited, it's copied to our History once we're closed
+	// this is only supported by APP_KEEPALIVE_PID_PATROL, same as our exit code
+	exit_status *ExitStatus
+	// stdout_tail and stderr_tail are the last lines of our running App, see ConfigApp.CrashTail
+	stdout_tail *crashTail
+	stderr_tail *crashTail
+	// triggers calls our triggers, see ConfigApp.TriggerOptions
+	triggers triggers
 }
 
 func (self *App) IsValid() bool {
@@ -100,8 +116,40 @@ func (self *App) GetPatrol() *Patrol {
 	return self.patrol
 }
 func (self *App) GetConfig() *ConfigApp {
+	self.patrol.reload_mu.RLock()
+	defer self.patrol.reload_mu.RUnlock()
 	return self.config.Clone()
 }
+
+// getSecret will return our resolved Secret, our Secret may be modified by Patrol.Reload()
+func (self *App) getSecret() string {
+	self.patrol.reload_mu.RLock()
+	defer self.patrol.reload_mu.RUnlock()
+	return self.config.getSecret()
+}
+
+// getUDPKeys will return our resolved UDPKeys, our UDPKeys may be modified by Patrol.Reload()
+func (self *App) getUDPKeys() map[string]string {
+	self.patrol.reload_mu.RLock()
+	defer self.patrol.reload_mu.RUnlock()
+	return self.config.getUDPKeys()
+}
+
+// getEnvFile will return our env file, our env file may be modified by Patrol.Reload()
+func (self *App) getEnvFile() []string {
+	self.patrol.reload_mu.RLock()
+	defer self.patrol.reload_mu.RUnlock()
+	return self.config.env_file
+}
+
+// IsAuthorized will compare our Secret and the identities of a verified client certificate
+// See ClientIdentities()
+func (self *App) IsAuthorized(
+	secret string,
+	identities []string,
+) bool {
+	return isAuthorized(self.getSecret(), self.config.ClientIdentities, self.config.ClientIdentityRequired, secret, identities)
+}
 func (self *App) GetCAS() uint64 {
 	self.o.RLock()
 	defer self.o.RUnlock()
@@ -129,7 +177,7 @@ func (self *App) GetLastSeen() time.Time {
 		// if our app is running lastseen should exist
 		if !self.o.GetStarted().IsZero() {
 			// we're running
-			return time.Now()
+			return self.patrol.now()
 		}
 	}
 	return self.o.GetLastSeen()
@@ -189,7 +237,10 @@ func (self *App) DisableRunOnce() {
 func (self *App) GetKeyValue() map[string]interface{} {
 	self.o.RLock()
 	defer self.o.RUnlock()
-	return self.o.GetKeyValue()
+	kv := self.o.GetKeyValue()
+	// our expired keys may not have been deleted yet
+	unexpiredKeyValue(self.patrol.now(), kv, nil, self.o.GetKeyExpires())
+	return kv
 }
 func (self *App) SetKeyValue(
 	kv map[string]interface{},
@@ -219,8 +270,12 @@ func (self *App) getHistory() []*History {
 	return history
 }
 func (self *App) close() {
+	// our PID is no longer ours to watch
+	self.unwatchPID()
 	if !self.o.GetStarted().IsZero() {
-		now := time.Now()
+		now := self.patrol.now()
+		// our History must never snapshot a key that has expired
+		self.o.ExpireKeyValue(now)
 		// save history
 		self.o.Increment() // we have to increment for modifying History
 		if len(self.history) >= self.patrol.config.History {
@@ -245,6 +300,13 @@ func (self *App) close() {
 			ExitCode: self.o.GetExitCode(),
 			KeyValue: self.o.GetKeyValue(),
 		}
+		// our signal, core dump, wait status and resource usage
+		h.setExitStatus(self.exit_status)
+		if h.IsUnexpected() {
+			// our crash tail is only kept if we didn't expect to close
+			h.StdoutTail = self.stdout_tail.Lines()
+			h.StderrTail = self.stderr_tail.Lines()
+		}
 		if !self.o.GetStarted().IsZero() {
 			h.Started = &Timestamp{
 				Time:            self.o.GetStarted(),
@@ -270,6 +332,8 @@ func (self *App) close() {
 			}
 		}
 		self.history = append(self.history, h)
+		// send webhooks
+		self.patrol.webhook(WEBHOOK_EVENT_APP_CLOSED, "app", self.id, self.config.Name, h, nil)
 		// reset values
 		self.instance_id = ""
 		self.o.SetStarted(time.Time{})
@@ -282,6 +346,9 @@ func (self *App) close() {
 		}
 		self.o.SetPID(0)
 		self.o.SetExitCode(0)
+		self.exit_status = nil
+		self.stdout_tail = nil
+		self.stderr_tail = nil
 		if self.config.KeyValueClear {
 			// clear keyvalues
 			self.o.ReplaceKeyValue(nil)
@@ -291,13 +358,17 @@ func (self *App) close() {
 		// we're going to unlock and then relock so that we can call our trigger
 		if self.config.TriggerClosed != nil {
 			self.o.Unlock()
-			self.config.TriggerClosed(self, h)
+			self.trigger(TRIGGER_CLOSED, func() {
+				self.config.TriggerClosed(self, h)
+			})
 			self.o.Lock()
 		}
 	}
 }
 func (self *App) startApp() error {
-	now := time.Now()
+	now := self.patrol.now()
+	// our new PID may reuse a PID that we've already seen exit
+	self.exited = 0
 	// consume restart
 	self.o.SetRestart(false)
 	// consume runonce
@@ -336,6 +407,10 @@ func (self *App) startApp() error {
 		// include parents environment variables
 		cmd.Env = os.Environ()
 	}
+	// our env file is prepended so that our Env may overwrite it
+	if env_file := self.getEnvFile(); len(env_file) > 0 {
+		cmd.Env = append(cmd.Env, env_file...)
+	}
 	if len(self.config.Env) > 0 {
 		cmd.Env = append(cmd.Env, self.config.Env...)
 	}
@@ -361,6 +436,11 @@ func (self *App) startApp() error {
 		bs, _ := json.Marshal(self.patrol.config.ListenUDP)
 		cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%s", APP_ENV_LISTEN_UDP, bs))
 	}
+	if len(self.patrol.config.ListenUnix) > 0 {
+		// unix listeners
+		bs, _ := json.Marshal(self.patrol.config.ListenUnix)
+		cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%s", APP_ENV_LISTEN_UNIX, bs))
+	}
 	// STD in/out/err
 	if self.config.Stdin != nil {
 		cmd.Stdin = self.config.Stdin
@@ -453,6 +533,20 @@ func (self *App) startApp() error {
 		// we are passing this file handler to the app we are executing
 		// our executed app will handle closing this file descriptor on close
 	}
+	// crash tail
+	var stdout_tail, stderr_tail *crashTail
+	var tail_files []*os.File
+	if self.config.CrashTail > 0 {
+		var err error
+		stdout_tail, stderr_tail, tail_files, err = self.tailSTD(cmd, std_merge)
+		if err != nil {
+			log.Printf("./patrol.startApp(): App ID: %s failed to create our Crash Tail pipes Err: \"%s\"\n", self.id, err)
+			closeFiles(tail_files)
+			return err
+		}
+		// our App holds our write ends once it has started, our pipes are drained once our App has exited
+		defer closeFiles(tail_files)
+	}
 	// extra files
 	if self.config.ExtraFiles != nil {
 		if e := self.config.ExtraFiles(self.id); len(e) > 0 {
@@ -497,7 +591,9 @@ func (self *App) startApp() error {
 		cmd.SysProcAttr.Pdeathsig = 0
 	}
 	// start will start our process but will not wait for execute to finish running
-	if err := cmd.Start(); err != nil {
+	executor := self.patrol.executor()
+	pid, err := executor.Start(cmd)
+	if err != nil {
 		// failed to start
 		return err
 	}
@@ -505,10 +601,12 @@ func (self *App) startApp() error {
 	self.instance_id = uuidMust(uuidV4())
 	self.o.SetStarted(now)
 	self.o.SetStartedLog(now)
+	self.stdout_tail = stdout_tail
+	self.stderr_tail = stderr_tail
 	if self.config.KeepAlive == APP_KEEPALIVE_PID_PATROL {
 		// we're going to copy our PID from our process
 		// any other keep alive method we're just going to ignore the process PID and assume it's wrong
-		self.o.SetPID(uint32(cmd.Process.Pid))
+		self.o.SetPID(pid)
 	}
 	// we have to call Wait() on our process and read the exit code
 	// if we don't we will end up with a zombie process
@@ -521,29 +619,36 @@ func (self *App) startApp() error {
 		// we can either wrap our context? or use os.Process.Kill
 		// ideally we would want to use our context, because we're not sure what we would be signalling a kill to if this stopped before the kill
 		// context seems like the most ideal path to choose
-		err := cmd.Wait()
+		// our error is ignored, we will still close our App if we failed to wait
+		status, _ := executor.Wait(cmd)
+		// our last lines may not have been read from our pipes yet
+		deadline := time.Now().Add(APP_CRASH_TAIL_WAIT)
+		stdout_tail.wait(deadline)
+		stderr_tail.wait(deadline)
 		var exit_code uint8 = 0
-		if err != nil && self.config.KeepAlive == APP_KEEPALIVE_PID_PATROL {
-			// we're going to copy our exit code from our result
+		if self.config.KeepAlive != APP_KEEPALIVE_PID_PATROL {
+			// we're only going to copy our exit code for APP_KEEPALIVE_PID_PATROL
 			// any other keep alive method we're just going to ignore the exit code and assume it's wrong
-			if exiterr, ok := err.(*exec.ExitError); ok {
-				// The program has exited with an exit code != 0
-				// This works on both Unix and Windows.
-				// Although package syscall is generally platform dependent,
-				// WaitStatus is defined for both Unix and Windows and in both cases has an ExitStatus() method with the same signature.
-				if status, ok := exiterr.Sys().(syscall.WaitStatus); ok {
-					exit_code = uint8(status.ExitStatus())
-				}
-			}
+			status = nil
+		} else if status != nil &&
+			status.WaitStatus.Exited() {
+			// a process terminated by a signal has an ExitStatus() of -1, this is NOT an exit code of 255
+			// our signal is saved to our History from our ExitStatus
+			exit_code = uint8(status.WaitStatus.ExitStatus())
 		}
 		// currently this can't race because we ALWAYS check isAppRunning() before startApp() AND we only use tick() to start services
 		// this logic should never change, so it's not something to worry about right now
 		self.o.Lock()
 		// set exit code
 		self.o.SetExitCode(exit_code)
+		self.exit_status = status
 		// close app
 		self.close()
 		self.o.Unlock()
+		if self.config.KeepAlive == APP_KEEPALIVE_PID_PATROL {
+			// we're not going to wait for our next check to restart our App
+			self.patrol.wake(self)
+		}
 	}()
 	return nil
 }
@@ -555,7 +660,7 @@ func (self *App) isAppRunning() error {
 		// if lastseen + ping timeout is NOT after now we know that we've timedout
 		if self.o.GetLastSeen().IsZero() {
 			// use started timestamp
-			if time.Now().After(self.o.GetStarted().Add(time.Duration(self.patrol.config.PingTimeout) * time.Second)) {
+			if self.patrol.now().After(self.o.GetStarted().Add(self.pingTimeout())) {
 				// expired
 				// close app
 				self.close()
@@ -563,7 +668,7 @@ func (self *App) isAppRunning() error {
 			}
 		} else {
 			// use lastseen
-			if time.Now().After(self.o.GetLastSeen().Add(time.Duration(self.patrol.config.PingTimeout) * time.Second)) {
+			if self.patrol.now().After(self.o.GetLastSeen().Add(self.pingTimeout())) {
 				// expired
 				// close app
 				self.close()
@@ -592,17 +697,16 @@ func (self *App) isAppRunning() error {
 		self.close()
 		return err
 	}
-	// TODO: we should add PID verification here
-	// either before or after we signal to kill, it's unsure how this will work
-	process, err := os.FindProcess(int(pid))
-	if err != nil {
-		// NOT running!
+	if pid == self.exited {
+		// our watch has already seen our PID exit
 		// close app
 		self.close()
-		return err
+		return ERR_APP_PID_EXITED
 	}
+	// TODO: we should add PID verification here
+	// either before or after we signal to kill, it's unsure how this will work
 	// kill -0 PID
-	err = process.Signal(syscall.Signal(0))
+	err = self.patrol.executor().Status(pid)
 	if err != nil {
 		// NOT running!
 		// close app
@@ -610,7 +714,9 @@ func (self *App) isAppRunning() error {
 		return err
 	}
 	// running!
-	now := time.Now()
+	// this includes a PID we've adopted from our `pid-path` that we didn't execute
+	self.watchPID(pid)
+	now := self.patrol.now()
 	// compare our PID
 	if self.o.GetPID() > 0 {
 		// App PID exists
@@ -626,7 +732,9 @@ func (self *App) isAppRunning() error {
 			// we need to call our started trigger
 			if self.config.TriggerStarted != nil {
 				self.o.Unlock()
-				self.config.TriggerStarted(self)
+				self.trigger(TRIGGER_STARTED, func() {
+					self.config.TriggerStarted(self)
+				})
 				self.o.Lock()
 			}
 		} else {
@@ -645,7 +753,9 @@ func (self *App) isAppRunning() error {
 			// we need to call our started trigger
 			if self.config.TriggerStarted != nil {
 				self.o.Unlock()
-				self.config.TriggerStarted(self)
+				self.trigger(TRIGGER_STARTED, func() {
+					self.config.TriggerStarted(self)
+				})
 				self.o.Lock()
 			}
 		} else {
@@ -655,17 +765,61 @@ func (self *App) isAppRunning() error {
 	}
 	return nil
 }
+
+// watchPID will wake our App's check as soon as our PID exits, instead of waiting for our next check
+// this function is only used by APP_KEEPALIVE_PID_APP, APP_KEEPALIVE_PID_PATROL is woken once cmd.Wait() returns
+func (self *App) watchPID(
+	pid uint32,
+) {
+	if self.watch != nil &&
+		self.watch.pid == pid {
+		// already watching
+		return
+	}
+	self.unwatchPID()
+	watcher, ok := self.patrol.executor().(ExecutorWatcher)
+	if !ok {
+		// we will only find out that we've exited on our next check
+		return
+	}
+	w := &appWatch{
+		pid: pid,
+	}
+	self.watch = w
+	w.unwatch = watcher.Watch(pid, func() {
+		self.o.Lock()
+		if self.watch != w {
+			// we've stopped watching this PID
+			self.o.Unlock()
+			return
+		}
+		self.exited = pid
+		self.o.Unlock()
+		self.patrol.wake(self)
+	})
+}
+func (self *App) unwatchPID() {
+	if self.watch != nil {
+		self.watch.unwatch()
+		self.watch = nil
+	}
+}
+
+// appWatch is our watch of a single PID, our exited func will ignore a watch that has been replaced
+type appWatch struct {
+	pid     uint32
+	unwatch func()
+}
+
 func (self *App) signalStop() {
 	// we're signalling to our App that we're either disabled or Patrol is shutting down
 	//
 	// we can only do this if we have a PID, we don't care what keepalive method we use so long as a PID exists
 	// we're going to discard any errors
 	if self.o.GetPID() > 0 {
-		if process, err := os.FindProcess(int(self.o.GetPID())); err == nil {
-			// we're going to keep our signals different than syscall.SIGTERM
-			// we're going to leave syscall.SIGTERM to be reserved for Patrol ACTUALLY closing!
-			process.Signal(syscall.SIGUSR1)
-		}
+		// we're going to keep our signals different than syscall.SIGTERM
+		// we're going to leave syscall.SIGTERM to be reserved for Patrol ACTUALLY closing!
+		self.patrol.executor().Signal(self.o.GetPID(), syscall.SIGUSR1)
 	}
 }
 func (self *App) signalRestart() {
@@ -675,13 +829,11 @@ func (self *App) signalRestart() {
 	// we can only do this if we have a PID, we don't care what keepalive method we use so long as a PID exists
 	// we're going to discard any errors
 	if self.o.GetPID() > 0 {
-		if process, err := os.FindProcess(int(self.o.GetPID())); err == nil {
-			// we're going to keep our signals different than syscall.SIGTERM
-			// we're going to leave syscall.SIGTERM to be reserved for Patrol ACTUALLY closing!
-			//
-			// we're also going to keep this different than syscall.SIGUSR1 as that is reserved for closing Apps
-			process.Signal(syscall.SIGUSR2)
-		}
+		// we're going to keep our signals different than syscall.SIGTERM
+		// we're going to leave syscall.SIGTERM to be reserved for Patrol ACTUALLY closing!
+		//
+		// we're also going to keep this different than syscall.SIGUSR1 as that is reserved for closing Apps
+		self.patrol.executor().Signal(self.o.GetPID(), syscall.SIGUSR2)
 	}
 }
 func (self *App) getPID() (
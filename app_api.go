@@ -1,13 +1,9 @@
 package patrol
 
-import (
-	"time"
-)
-
 func (self *App) apiRequest(
 	request *API_Request,
 ) bool {
-	now := time.Now()
+	now := self.patrol.now()
 	// CAS / Non-Ping Attributes:
 	//
 	// we have to update our CAS BEFORE we update `lastseen, started, pid` and other ping values
@@ -60,7 +56,9 @@ func (self *App) apiRequest(
 				if self.config.TriggerStartedPinged != nil {
 					// we're going to unlock and call our trigger
 					self.o.Unlock()
-					self.config.TriggerStartedPinged(self)
+					self.trigger(TRIGGER_STARTED_PINGED, func() {
+						self.config.TriggerStartedPinged(self)
+					})
 					self.o.Lock()
 				}
 			} else {
@@ -71,7 +69,9 @@ func (self *App) apiRequest(
 				if self.config.TriggerPinged != nil {
 					// we're going to unlock and call our trigger
 					self.o.Unlock()
-					self.config.TriggerPinged(self)
+					self.trigger(TRIGGER_PINGED, func() {
+						self.config.TriggerPinged(self)
+					})
 					self.o.Lock()
 				}
 			}
@@ -87,7 +87,9 @@ func (self *App) apiRequest(
 				if self.config.TriggerStartedPinged != nil {
 					// we're going to unlock and call our trigger
 					self.o.Unlock()
-					self.config.TriggerStartedPinged(self)
+					self.trigger(TRIGGER_STARTED_PINGED, func() {
+						self.config.TriggerStartedPinged(self)
+					})
 					self.o.Lock()
 				}
 			} else {
@@ -98,7 +100,9 @@ func (self *App) apiRequest(
 				if self.config.TriggerPinged != nil {
 					// we're going to unlock and call our trigger
 					self.o.Unlock()
-					self.config.TriggerPinged(self)
+					self.trigger(TRIGGER_PINGED, func() {
+						self.config.TriggerPinged(self)
+					})
 					self.o.Lock()
 				}
 			}
@@ -112,7 +116,9 @@ func (self *App) apiRequest(
 			if self.config.TriggerPinged != nil {
 				// we're going to unlock and call our trigger
 				self.o.Unlock()
-				self.config.TriggerPinged(self)
+				self.trigger(TRIGGER_PINGED, func() {
+					self.config.TriggerPinged(self)
+				})
 				self.o.Lock()
 			}
 		}
@@ -167,11 +173,13 @@ func (self *App) apiResponse(
 	result := &API_Response{
 		InstanceID: self.instance_id,
 		Name:       self.config.Name,
+		KeepAlive:  self.config.KeepAlive,
 		PID:        self.o.GetPID(),
 		Disabled:   self.o.IsDisabled(),
 		Restart:    self.o.IsRestart(),
 		RunOnce:    self.o.IsRunOnce(),
-		Secret:     self.config.Secret != "",
+		Secret:     self.getSecret() != "",
+		Token:      self.patrol.isTokenAccepted("app", self.id),
 		CAS:        self.o.GetCAS(),
 	}
 	if endpoint != api_endpoint_status {
@@ -191,7 +199,16 @@ func (self *App) apiResponse(
 		if endpoint != api_endpoint_snapshot {
 			result.History = self.getHistory()
 		}
-		result.KeyValue = self.o.GetKeyValue()
+		kv := self.o.GetKeyValue()
+		versions := self.o.GetKeyVersions()
+		expires := self.o.GetKeyExpires()
+		// we may only be read locked, so our expired keys are filtered instead of deleted
+		unexpiredKeyValue(self.patrol.now(), kv, versions, expires)
+		result.KeyValue = kv
+		if len(versions) > 0 {
+			result.KeyValueVersions = versions
+		}
+		result.KeyValueExpires = self.patrol.apiKeyValueExpires(expires)
 	}
 	if !self.o.GetStarted().IsZero() {
 		result.Started = &Timestamp{
@@ -206,7 +223,7 @@ func (self *App) apiResponse(
 				// we should set lastseen to now
 				// we're responsible for this service to always be running
 				result.LastSeen = &Timestamp{
-					Time:            time.Now(),
+					Time:            self.patrol.now(),
 					TimestampFormat: self.patrol.config.Timestamp,
 				}
 			}
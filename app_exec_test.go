@@ -113,17 +113,24 @@ func TestAppExecPatrolPID(t *testing.T) {
 	// we can't use []interface{}{map[string]struct{}{} because when we scan over our map it isn't deterministic
 	result := []interface{}{
 		struct {
-			InstanceID string `json:"instance-id,omitempty"`
-			PID        uint32 `json:"pid,omitempty"`
-			Started    string `json:"started,omitempty"`
-			Lastseen   string `json:"lastseen,omitempty"`
-			Stopped    string `json:"stopped,omitempty"`
+			InstanceID string  `json:"instance-id,omitempty"`
+			PID        uint32  `json:"pid,omitempty"`
+			Started    string  `json:"started,omitempty"`
+			Lastseen   string  `json:"lastseen,omitempty"`
+			Stopped    string  `json:"stopped,omitempty"`
+			MaxRSS     int64   `json:"max-rss,omitempty"`
+			UserTime   float64 `json:"user-time,omitempty"`
+			SystemTime float64 `json:"system-time,omitempty"`
 		}{
 			InstanceID: app.history[0].InstanceID,
 			PID:        pid,
 			Started:    app.history[0].Started.Format(app.patrol.config.Timestamp),
 			Lastseen:   app.history[0].LastSeen.Format(app.patrol.config.Timestamp),
 			Stopped:    app.history[0].Stopped.Format(app.patrol.config.Timestamp),
+			// our resource usage is never deterministic
+			MaxRSS:     app.history[0].MaxRSS,
+			UserTime:   app.history[0].UserTime,
+			SystemTime: app.history[0].SystemTime,
 		},
 	}
 	bs2, _ := json.MarshalIndent(result, "", "\t")
@@ -213,6 +220,10 @@ func TestAppExecPatrolShutdown(t *testing.T) {
 	unittest.Equals(t, app.history[0].Shutdown, true)
 	// check that we were notified - SIGUSR1
 	unittest.Equals(t, app.history[0].ExitCode, 10)
+	// we exited, we weren't terminated by a signal
+	unittest.Equals(t, app.history[0].Signal, "")
+	unittest.Equals(t, app.history[0].WaitStatus, 10<<8)
+	unittest.Equals(t, app.history[0].MaxRSS > 0, true)
 	app.o.Unlock()
 }
 func TestAppExecPatrolDisable(t *testing.T) {
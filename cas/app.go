@@ -12,7 +12,7 @@ type App struct {
 	// our original App struct inside of patrol included everything here but History
 	// we have NO INTEREST in ever including history here, we don't want to completely restructure our project
 	// when we append History we WILL call Increment() just incase
-	keyvalue    map[string]interface{}
+	keyvalue    keyValue
 	started     time.Time
 	started_log time.Time
 	lastseen    time.Time
@@ -63,7 +63,7 @@ func CreateApp(
 	disabled bool,
 ) *App {
 	return &App{
-		keyvalue: make(map[string]interface{}),
+		keyvalue: createKeyValue(),
 		disabled: disabled,
 		cas:      uint64(rand.Intn(cas_init_max_range)) + 1,
 	}
@@ -133,12 +133,7 @@ func (self *App) GetKeyValue() map[string]interface{} {
 	if !self.locked_read {
 		log.Panicln("./patrol/cas.App.GetKeyValue(): not locked_read!")
 	}
-	// dereference
-	kv := make(map[string]interface{})
-	for k, v := range self.keyvalue {
-		kv[k] = v
-	}
-	return kv
+	return self.keyvalue.get()
 }
 func (self *App) SetKeyValue(
 	kv map[string]interface{},
@@ -151,10 +146,8 @@ func (self *App) SetKeyValue(
 	// we're not going to use compare, we will ALWAYS increment here!!
 	// if we don't want to increment, use len before calling this function
 	self.increment()
-	// dereference
-	for k, v := range kv {
-		self.keyvalue[k] = v
-	}
+	// our keys are versioned by our CAS, any previous expiry is removed
+	self.keyvalue.merge(kv, self.cas)
 }
 func (self *App) ReplaceKeyValue(
 	kv map[string]interface{},
@@ -167,11 +160,199 @@ func (self *App) ReplaceKeyValue(
 	// we're not going to use compare, we will ALWAYS increment here!!
 	// if we don't want to increment, use len before calling this function
 	self.increment()
-	self.keyvalue = make(map[string]interface{})
+	// our versions and expiries are replaced with our keys
+	self.keyvalue.replace(kv, self.cas)
+}
+func (self *App) GetKeyVersions() map[string]uint64 {
+	self.mu_internal.RLock()
+	defer self.mu_internal.RUnlock()
+	if !self.locked_read {
+		log.Panicln("./patrol/cas.App.GetKeyVersions(): not locked_read!")
+	}
+	return self.keyvalue.getVersions()
+}
+
+// GetKeyVersion will return the version of our key, or 0 if our key does not exist
+func (self *App) GetKeyVersion(
+	key string,
+) uint64 {
+	self.mu_internal.RLock()
+	defer self.mu_internal.RUnlock()
+	if !self.locked_read {
+		log.Panicln("./patrol/cas.App.GetKeyVersion(): not locked_read!")
+	}
+	return self.keyvalue.versions[key]
+}
+
+// GetKeyExpires will return the expiry of every key that expires
+func (self *App) GetKeyExpires() map[string]time.Time {
+	self.mu_internal.RLock()
+	defer self.mu_internal.RUnlock()
+	if !self.locked_read {
+		log.Panicln("./patrol/cas.App.GetKeyExpires(): not locked_read!")
+	}
+	return self.keyvalue.getExpires()
+}
+
+// GetKeyExpire will return the expiry of our key, false is returned if our key never expires or does not exist
+func (self *App) GetKeyExpire(
+	key string,
+) (
+	time.Time,
+	bool,
+) {
+	self.mu_internal.RLock()
+	defer self.mu_internal.RUnlock()
+	if !self.locked_read {
+		log.Panicln("./patrol/cas.App.GetKeyExpire(): not locked_read!")
+	}
+	expires, ok := self.keyvalue.expires[key]
+	return expires, ok
+}
+
+// SetKey will set our key and return its new version
+// if expires is zero our key will never expire
+func (self *App) SetKey(
+	key string,
+	value interface{},
+	expires time.Time,
+) uint64 {
+	self.mu_internal.Lock()
+	defer self.mu_internal.Unlock()
+	if !self.locked_write {
+		log.Panicln("./patrol/cas.App.SetKey(): not locked_write!")
+	}
+	self.increment()
+	self.keyvalue.set(key, value, self.cas)
+	self.keyvalue.expire(key, expires)
+	return self.cas
+}
+
+// CompareAndSetKey will only set our key if our version matches, a version of 0 requires that our key does not exist
+// our CAS is only incremented if our key was set
+func (self *App) CompareAndSetKey(
+	key string,
+	value interface{},
+	version uint64,
+	expires time.Time,
+) (
+	uint64,
+	error,
+) {
+	self.mu_internal.Lock()
+	defer self.mu_internal.Unlock()
+	if !self.locked_write {
+		log.Panicln("./patrol/cas.App.CompareAndSetKey(): not locked_write!")
+	}
+	if self.keyvalue.versions[key] != version {
+		return 0, ERR_KEY_VERSION_INVALID
+	}
+	self.increment()
+	self.keyvalue.set(key, value, self.cas)
+	self.keyvalue.expire(key, expires)
+	return self.cas, nil
+}
+
+// DeleteKey will return false if our key did not exist, our CAS is only incremented if our key existed
+func (self *App) DeleteKey(
+	key string,
+) bool {
+	self.mu_internal.Lock()
+	defer self.mu_internal.Unlock()
+	if !self.locked_write {
+		log.Panicln("./patrol/cas.App.DeleteKey(): not locked_write!")
+	}
+	if !self.keyvalue.remove(key) {
+		// NOOP
+		return false
+	}
+	self.increment()
+	return true
+}
+
+// IncrementKey will add delta to our number and return our number and its new version, a key that does not exist is 0
+// if expires is zero our previous expiry is kept
+func (self *App) IncrementKey(
+	key string,
+	delta float64,
+	expires time.Time,
+) (
+	float64,
+	uint64,
+	error,
+) {
+	self.mu_internal.Lock()
+	defer self.mu_internal.Unlock()
+	if !self.locked_write {
+		log.Panicln("./patrol/cas.App.IncrementKey(): not locked_write!")
+	}
+	n, err := self.keyvalue.incremented(key, delta)
+	if err != nil {
+		return 0, 0, err
+	}
+	self.increment()
+	previous, ok := self.keyvalue.expires[key]
+	self.keyvalue.set(key, n, self.cas)
+	if !expires.IsZero() {
+		self.keyvalue.expire(key, expires)
+	} else if ok {
+		self.keyvalue.expire(key, previous)
+	}
+	return n, self.cas, nil
+}
+
+// AppendKey will append values to our list and return our list and its new version, a key that does not exist is an empty list
+// if expires is zero our previous expiry is kept
+func (self *App) AppendKey(
+	key string,
+	values []interface{},
+	expires time.Time,
+) (
+	[]interface{},
+	uint64,
+	error,
+) {
+	self.mu_internal.Lock()
+	defer self.mu_internal.Unlock()
+	if !self.locked_write {
+		log.Panicln("./patrol/cas.App.AppendKey(): not locked_write!")
+	}
+	list, err := self.keyvalue.appended(key, values)
+	if err != nil {
+		return nil, 0, err
+	}
+	self.increment()
+	previous, ok := self.keyvalue.expires[key]
+	self.keyvalue.set(key, list, self.cas)
+	if !expires.IsZero() {
+		self.keyvalue.expire(key, expires)
+	} else if ok {
+		self.keyvalue.expire(key, previous)
+	}
 	// dereference
-	for k, v := range kv {
-		self.keyvalue[k] = v
+	return append([]interface{}{}, list...), self.cas, nil
+}
+
+// ExpireKeyValue will delete every key that has expired by now and return our deleted keys
+// our CAS is only incremented if a key expired
+func (self *App) ExpireKeyValue(
+	now time.Time,
+) []string {
+	self.mu_internal.Lock()
+	defer self.mu_internal.Unlock()
+	if !self.locked_write {
+		log.Panicln("./patrol/cas.App.ExpireKeyValue(): not locked_write!")
+	}
+	keys := self.keyvalue.expired(now)
+	if len(keys) == 0 {
+		// NOOP
+		return keys
+	}
+	self.increment()
+	for _, k := range keys {
+		self.keyvalue.remove(k)
 	}
+	return keys
 }
 func (self *App) GetStarted() time.Time {
 	self.mu_internal.RLock()
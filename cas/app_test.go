@@ -174,7 +174,7 @@ func TestAppPanic(t *testing.T) {
 	}()
 
 	var wg sync.WaitGroup
-	c := 23
+	c := 33
 	wg.Add(c)
 
 	i := 0
@@ -438,6 +438,117 @@ func TestAppPanic(t *testing.T) {
 		a.SetExitCode(0)
 	}()
 
+	go func() {
+		defer func() {
+			defer wg.Done()
+			if r := recover(); r != nil {
+				i_mu.Lock()
+				i++
+				i_mu.Unlock()
+			}
+		}()
+		a.GetKeyVersions()
+	}()
+	go func() {
+		defer func() {
+			defer wg.Done()
+			if r := recover(); r != nil {
+				i_mu.Lock()
+				i++
+				i_mu.Unlock()
+			}
+		}()
+		a.GetKeyVersion("key")
+	}()
+	go func() {
+		defer func() {
+			defer wg.Done()
+			if r := recover(); r != nil {
+				i_mu.Lock()
+				i++
+				i_mu.Unlock()
+			}
+		}()
+		a.GetKeyExpires()
+	}()
+	go func() {
+		defer func() {
+			defer wg.Done()
+			if r := recover(); r != nil {
+				i_mu.Lock()
+				i++
+				i_mu.Unlock()
+			}
+		}()
+		a.GetKeyExpire("key")
+	}()
+	go func() {
+		defer func() {
+			defer wg.Done()
+			if r := recover(); r != nil {
+				i_mu.Lock()
+				i++
+				i_mu.Unlock()
+			}
+		}()
+		a.SetKey("key", nil, time.Time{})
+	}()
+	go func() {
+		defer func() {
+			defer wg.Done()
+			if r := recover(); r != nil {
+				i_mu.Lock()
+				i++
+				i_mu.Unlock()
+			}
+		}()
+		a.CompareAndSetKey("key", nil, 0, time.Time{})
+	}()
+	go func() {
+		defer func() {
+			defer wg.Done()
+			if r := recover(); r != nil {
+				i_mu.Lock()
+				i++
+				i_mu.Unlock()
+			}
+		}()
+		a.DeleteKey("key")
+	}()
+	go func() {
+		defer func() {
+			defer wg.Done()
+			if r := recover(); r != nil {
+				i_mu.Lock()
+				i++
+				i_mu.Unlock()
+			}
+		}()
+		a.IncrementKey("key", 1, time.Time{})
+	}()
+	go func() {
+		defer func() {
+			defer wg.Done()
+			if r := recover(); r != nil {
+				i_mu.Lock()
+				i++
+				i_mu.Unlock()
+			}
+		}()
+		a.AppendKey("key", nil, time.Time{})
+	}()
+	go func() {
+		defer func() {
+			defer wg.Done()
+			if r := recover(); r != nil {
+				i_mu.Lock()
+				i++
+				i_mu.Unlock()
+			}
+		}()
+		a.ExpireKeyValue(time.Time{})
+	}()
+
 	// wait
 	wg.Wait()
 	unittest.Equals(t, i, c)
@@ -457,7 +568,7 @@ func TestAppSetPanic(t *testing.T) {
 	}()
 
 	var wg sync.WaitGroup
-	c := 12
+	c := 18
 	wg.Add(c)
 
 	i := 0
@@ -602,7 +713,184 @@ func TestAppSetPanic(t *testing.T) {
 		a.SetExitCode(0)
 	}()
 
+	go func() {
+		defer func() {
+			defer wg.Done()
+			if r := recover(); r != nil {
+				i_mu.Lock()
+				i++
+				i_mu.Unlock()
+			}
+		}()
+		a.SetKey("key", nil, time.Time{})
+	}()
+	go func() {
+		defer func() {
+			defer wg.Done()
+			if r := recover(); r != nil {
+				i_mu.Lock()
+				i++
+				i_mu.Unlock()
+			}
+		}()
+		a.CompareAndSetKey("key", nil, 0, time.Time{})
+	}()
+	go func() {
+		defer func() {
+			defer wg.Done()
+			if r := recover(); r != nil {
+				i_mu.Lock()
+				i++
+				i_mu.Unlock()
+			}
+		}()
+		a.DeleteKey("key")
+	}()
+	go func() {
+		defer func() {
+			defer wg.Done()
+			if r := recover(); r != nil {
+				i_mu.Lock()
+				i++
+				i_mu.Unlock()
+			}
+		}()
+		a.IncrementKey("key", 1, time.Time{})
+	}()
+	go func() {
+		defer func() {
+			defer wg.Done()
+			if r := recover(); r != nil {
+				i_mu.Lock()
+				i++
+				i_mu.Unlock()
+			}
+		}()
+		a.AppendKey("key", nil, time.Time{})
+	}()
+	go func() {
+		defer func() {
+			defer wg.Done()
+			if r := recover(); r != nil {
+				i_mu.Lock()
+				i++
+				i_mu.Unlock()
+			}
+		}()
+		a.ExpireKeyValue(time.Time{})
+	}()
+
 	// wait
 	wg.Wait()
 	unittest.Equals(t, i, c)
 }
+func TestAppKeyValue(t *testing.T) {
+	log.Println("TestAppKeyValue")
+
+	a := CreateApp(false)
+	a.Lock()
+	defer a.Unlock()
+	// our keys are versioned by our CAS
+	a.SetKeyValue(map[string]interface{}{
+		"a": "a",
+	})
+	unittest.Equals(t, a.GetKeyVersion("a"), a.cas)
+	unittest.Equals(t, a.GetKeyVersion("unknown"), uint64(0))
+	a.incremented = false
+	cas := a.cas
+	now := time.Now()
+	version := a.SetKey("b", "b", now.Add(time.Minute))
+	unittest.Equals(t, version, cas+1)
+	unittest.Equals(t, a.GetKeyVersions(), map[string]uint64{"a": cas, "b": cas + 1})
+	unittest.Equals(t, a.GetKeyExpires(), map[string]time.Time{"b": now.Add(time.Minute)})
+	expires, ok := a.GetKeyExpire("b")
+	unittest.Equals(t, ok, true)
+	unittest.Equals(t, expires, now.Add(time.Minute))
+	_, ok = a.GetKeyExpire("a")
+	unittest.Equals(t, ok, false)
+
+	// compare and set
+	a.incremented = false
+	cas = a.cas
+	_, err := a.CompareAndSetKey("a", "aa", cas-2, time.Time{})
+	unittest.Equals(t, err, ERR_KEY_VERSION_INVALID)
+	unittest.Equals(t, a.cas, cas)
+	_, err = a.CompareAndSetKey("b", "bb", 0, time.Time{})
+	unittest.Equals(t, err, ERR_KEY_VERSION_INVALID)
+	version, err = a.CompareAndSetKey("b", "bb", cas, time.Time{})
+	unittest.IsNil(t, err)
+	unittest.Equals(t, version, cas+1)
+	// a new value never inherits our previous expiry
+	unittest.Equals(t, len(a.GetKeyExpires()), 0)
+	// a version of 0 requires that our key does not exist
+	_, err = a.CompareAndSetKey("c", "c", 0, time.Time{})
+	unittest.IsNil(t, err)
+	unittest.Equals(t, a.GetKeyValue()["c"], "c")
+
+	// delete
+	a.incremented = false
+	cas = a.cas
+	unittest.Equals(t, a.DeleteKey("unknown"), false)
+	unittest.Equals(t, a.cas, cas)
+	unittest.Equals(t, a.DeleteKey("c"), true)
+	unittest.Equals(t, a.cas, cas+1)
+	unittest.Equals(t, a.GetKeyVersion("c"), uint64(0))
+	_, ok = a.GetKeyValue()["c"]
+	unittest.Equals(t, ok, false)
+
+	// increment
+	a.incremented = false
+	n, _, err := a.IncrementKey("counter", 2, now.Add(time.Minute))
+	unittest.IsNil(t, err)
+	unittest.Equals(t, n, float64(2))
+	a.SetKeyValue(map[string]interface{}{
+		"int": 1,
+	})
+	n, _, err = a.IncrementKey("int", -1.5, time.Time{})
+	unittest.IsNil(t, err)
+	unittest.Equals(t, n, -0.5)
+	a.incremented = false
+	cas = a.cas
+	_, _, err = a.IncrementKey("a", 1, time.Time{})
+	unittest.Equals(t, err, ERR_KEY_NOT_NUMBER)
+	unittest.Equals(t, a.cas, cas)
+	// our previous expiry is kept
+	n, version, err = a.IncrementKey("counter", 1, time.Time{})
+	unittest.IsNil(t, err)
+	unittest.Equals(t, n, float64(3))
+	unittest.Equals(t, version, cas+1)
+	unittest.Equals(t, a.GetKeyExpires()["counter"], now.Add(time.Minute))
+
+	// append
+	list, _, err := a.AppendKey("list", []interface{}{"a"}, time.Time{})
+	unittest.IsNil(t, err)
+	unittest.Equals(t, list, []interface{}{"a"})
+	kv := a.GetKeyValue()
+	list, _, err = a.AppendKey("list", []interface{}{"b", 1.0}, time.Time{})
+	unittest.IsNil(t, err)
+	unittest.Equals(t, list, []interface{}{"a", "b", 1.0})
+	// our previous list was never modified
+	unittest.Equals(t, kv["list"], []interface{}{"a"})
+	_, _, err = a.AppendKey("counter", []interface{}{"a"}, time.Time{})
+	unittest.Equals(t, err, ERR_KEY_NOT_LIST)
+
+	// expire
+	a.SetKey("d", "d", now.Add(time.Second))
+	a.incremented = false
+	cas = a.cas
+	unittest.Equals(t, a.ExpireKeyValue(now), []string{})
+	unittest.Equals(t, a.cas, cas)
+	unittest.Equals(t, a.ExpireKeyValue(now.Add(time.Minute)), []string{"counter", "d"})
+	unittest.Equals(t, a.cas, cas+1)
+	unittest.Equals(t, a.GetKeyValue(), map[string]interface{}{"a": "a", "b": "bb", "int": -0.5, "list": []interface{}{"a", "b", 1.0}})
+	unittest.Equals(t, len(a.GetKeyVersions()), 4)
+	unittest.Equals(t, len(a.GetKeyExpires()), 0)
+
+	// replace
+	a.SetKey("e", "e", now.Add(time.Minute))
+	a.ReplaceKeyValue(map[string]interface{}{
+		"f": "f",
+	})
+	unittest.Equals(t, a.GetKeyVersions(), map[string]uint64{"f": a.cas})
+	unittest.Equals(t, len(a.GetKeyExpires()), 0)
+}
@@ -0,0 +1,195 @@
+package cas
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+)
+
+var (
+	ERR_KEY_VERSION_INVALID = fmt.Errorf("Key Version does not match")
+	ERR_KEY_NOT_NUMBER      = fmt.Errorf("Key is not a Number")
+	ERR_KEY_NOT_LIST        = fmt.Errorf("Key is not a List")
+)
+
+// keyValue is our KeyValue and the version and expiry of each of our keys
+// our version is our CAS at the time our key was last modified
+// our CAS only ever increases, so a version is never reused, even if our key is deleted and set again
+// a zero version is a key that does not exist, a zero expiry is a key that never expires
+// keyValue is unsafe, it's owned and locked by either an App or a Service
+type keyValue struct {
+	values   map[string]interface{}
+	versions map[string]uint64
+	expires  map[string]time.Time
+}
+
+func createKeyValue() keyValue {
+	return keyValue{
+		values:   make(map[string]interface{}),
+		versions: make(map[string]uint64),
+		expires:  make(map[string]time.Time),
+	}
+}
+
+func (self *keyValue) get() map[string]interface{} {
+	// dereference
+	kv := make(map[string]interface{})
+	for k, v := range self.values {
+		kv[k] = v
+	}
+	return kv
+}
+func (self *keyValue) getVersions() map[string]uint64 {
+	// dereference
+	versions := make(map[string]uint64)
+	for k, v := range self.versions {
+		versions[k] = v
+	}
+	return versions
+}
+func (self *keyValue) getExpires() map[string]time.Time {
+	// dereference
+	expires := make(map[string]time.Time)
+	for k, v := range self.expires {
+		expires[k] = v
+	}
+	return expires
+}
+func (self *keyValue) set(
+	key string,
+	value interface{},
+	version uint64,
+) {
+	self.values[key] = value
+	self.versions[key] = version
+	// a new value never inherits our previous expiry
+	delete(self.expires, key)
+}
+func (self *keyValue) merge(
+	kv map[string]interface{},
+	version uint64,
+) {
+	for k, v := range kv {
+		self.set(k, v, version)
+	}
+}
+func (self *keyValue) replace(
+	kv map[string]interface{},
+	version uint64,
+) {
+	*self = createKeyValue()
+	self.merge(kv, version)
+}
+func (self *keyValue) expire(
+	key string,
+	expires time.Time,
+) {
+	if expires.IsZero() {
+		delete(self.expires, key)
+	} else {
+		self.expires[key] = expires
+	}
+}
+func (self *keyValue) remove(
+	key string,
+) bool {
+	if _, ok := self.values[key]; !ok {
+		return false
+	}
+	delete(self.values, key)
+	delete(self.versions, key)
+	delete(self.expires, key)
+	return true
+}
+
+// expired will return our keys that have expired by now, sorted
+func (self *keyValue) expired(
+	now time.Time,
+) []string {
+	keys := []string{}
+	for k, expires := range self.expires {
+		if !now.Before(expires) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// incremented will return our key incremented by delta, a key that does not exist is 0
+// our number is a float64, the same as any number unmarshaled from JSON
+func (self *keyValue) incremented(
+	key string,
+	delta float64,
+) (
+	float64,
+	error,
+) {
+	v, ok := self.values[key]
+	if !ok {
+		return delta, nil
+	}
+	n, ok := toFloat64(v)
+	if !ok {
+		return 0, ERR_KEY_NOT_NUMBER
+	}
+	return n + delta, nil
+}
+
+// appended will return a new list of our key with our values appended, a key that does not exist is an empty list
+// we never modify our previous list, it may have been dereferenced by GetKeyValue()
+func (self *keyValue) appended(
+	key string,
+	values []interface{},
+) (
+	[]interface{},
+	error,
+) {
+	var previous []interface{}
+	if v, ok := self.values[key]; ok {
+		if previous, ok = v.([]interface{}); !ok {
+			return nil, ERR_KEY_NOT_LIST
+		}
+	}
+	list := make([]interface{}, 0, len(previous)+len(values))
+	list = append(list, previous...)
+	return append(list, values...), nil
+}
+func toFloat64(
+	v interface{},
+) (
+	float64,
+	bool,
+) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case int8:
+		return float64(n), true
+	case int16:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case uint:
+		return float64(n), true
+	case uint8:
+		return float64(n), true
+	case uint16:
+		return float64(n), true
+	case uint32:
+		return float64(n), true
+	case uint64:
+		return float64(n), true
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	}
+	return 0, false
+}
@@ -141,7 +141,7 @@ func TestServicePanic(t *testing.T) {
 	}()
 
 	var wg sync.WaitGroup
-	c := 17
+	c := 27
 	wg.Add(c)
 
 	i := 0
@@ -339,6 +339,117 @@ func TestServicePanic(t *testing.T) {
 		s.SetRunOnceConsumed(false)
 	}()
 
+	go func() {
+		defer func() {
+			defer wg.Done()
+			if r := recover(); r != nil {
+				i_mu.Lock()
+				i++
+				i_mu.Unlock()
+			}
+		}()
+		s.GetKeyVersions()
+	}()
+	go func() {
+		defer func() {
+			defer wg.Done()
+			if r := recover(); r != nil {
+				i_mu.Lock()
+				i++
+				i_mu.Unlock()
+			}
+		}()
+		s.GetKeyVersion("key")
+	}()
+	go func() {
+		defer func() {
+			defer wg.Done()
+			if r := recover(); r != nil {
+				i_mu.Lock()
+				i++
+				i_mu.Unlock()
+			}
+		}()
+		s.GetKeyExpires()
+	}()
+	go func() {
+		defer func() {
+			defer wg.Done()
+			if r := recover(); r != nil {
+				i_mu.Lock()
+				i++
+				i_mu.Unlock()
+			}
+		}()
+		s.GetKeyExpire("key")
+	}()
+	go func() {
+		defer func() {
+			defer wg.Done()
+			if r := recover(); r != nil {
+				i_mu.Lock()
+				i++
+				i_mu.Unlock()
+			}
+		}()
+		s.SetKey("key", nil, time.Time{})
+	}()
+	go func() {
+		defer func() {
+			defer wg.Done()
+			if r := recover(); r != nil {
+				i_mu.Lock()
+				i++
+				i_mu.Unlock()
+			}
+		}()
+		s.CompareAndSetKey("key", nil, 0, time.Time{})
+	}()
+	go func() {
+		defer func() {
+			defer wg.Done()
+			if r := recover(); r != nil {
+				i_mu.Lock()
+				i++
+				i_mu.Unlock()
+			}
+		}()
+		s.DeleteKey("key")
+	}()
+	go func() {
+		defer func() {
+			defer wg.Done()
+			if r := recover(); r != nil {
+				i_mu.Lock()
+				i++
+				i_mu.Unlock()
+			}
+		}()
+		s.IncrementKey("key", 1, time.Time{})
+	}()
+	go func() {
+		defer func() {
+			defer wg.Done()
+			if r := recover(); r != nil {
+				i_mu.Lock()
+				i++
+				i_mu.Unlock()
+			}
+		}()
+		s.AppendKey("key", nil, time.Time{})
+	}()
+	go func() {
+		defer func() {
+			defer wg.Done()
+			if r := recover(); r != nil {
+				i_mu.Lock()
+				i++
+				i_mu.Unlock()
+			}
+		}()
+		s.ExpireKeyValue(time.Time{})
+	}()
+
 	// wait
 	wg.Wait()
 	unittest.Equals(t, i, c)
@@ -358,7 +469,7 @@ func TestServiceSetPanic(t *testing.T) {
 	}()
 
 	var wg sync.WaitGroup
-	c := 9
+	c := 15
 	wg.Add(c)
 
 	i := 0
@@ -470,7 +581,184 @@ func TestServiceSetPanic(t *testing.T) {
 		s.SetRunOnceConsumed(false)
 	}()
 
+	go func() {
+		defer func() {
+			defer wg.Done()
+			if r := recover(); r != nil {
+				i_mu.Lock()
+				i++
+				i_mu.Unlock()
+			}
+		}()
+		s.SetKey("key", nil, time.Time{})
+	}()
+	go func() {
+		defer func() {
+			defer wg.Done()
+			if r := recover(); r != nil {
+				i_mu.Lock()
+				i++
+				i_mu.Unlock()
+			}
+		}()
+		s.CompareAndSetKey("key", nil, 0, time.Time{})
+	}()
+	go func() {
+		defer func() {
+			defer wg.Done()
+			if r := recover(); r != nil {
+				i_mu.Lock()
+				i++
+				i_mu.Unlock()
+			}
+		}()
+		s.DeleteKey("key")
+	}()
+	go func() {
+		defer func() {
+			defer wg.Done()
+			if r := recover(); r != nil {
+				i_mu.Lock()
+				i++
+				i_mu.Unlock()
+			}
+		}()
+		s.IncrementKey("key", 1, time.Time{})
+	}()
+	go func() {
+		defer func() {
+			defer wg.Done()
+			if r := recover(); r != nil {
+				i_mu.Lock()
+				i++
+				i_mu.Unlock()
+			}
+		}()
+		s.AppendKey("key", nil, time.Time{})
+	}()
+	go func() {
+		defer func() {
+			defer wg.Done()
+			if r := recover(); r != nil {
+				i_mu.Lock()
+				i++
+				i_mu.Unlock()
+			}
+		}()
+		s.ExpireKeyValue(time.Time{})
+	}()
+
 	// wait
 	wg.Wait()
 	unittest.Equals(t, i, c)
 }
+func TestServiceKeyValue(t *testing.T) {
+	log.Println("TestServiceKeyValue")
+
+	s := CreateService(false)
+	s.Lock()
+	defer s.Unlock()
+	// our keys are versioned by our CAS
+	s.SetKeyValue(map[string]interface{}{
+		"a": "a",
+	})
+	unittest.Equals(t, s.GetKeyVersion("a"), s.cas)
+	unittest.Equals(t, s.GetKeyVersion("unknown"), uint64(0))
+	s.incremented = false
+	cas := s.cas
+	now := time.Now()
+	version := s.SetKey("b", "b", now.Add(time.Minute))
+	unittest.Equals(t, version, cas+1)
+	unittest.Equals(t, s.GetKeyVersions(), map[string]uint64{"a": cas, "b": cas + 1})
+	unittest.Equals(t, s.GetKeyExpires(), map[string]time.Time{"b": now.Add(time.Minute)})
+	expires, ok := s.GetKeyExpire("b")
+	unittest.Equals(t, ok, true)
+	unittest.Equals(t, expires, now.Add(time.Minute))
+	_, ok = s.GetKeyExpire("a")
+	unittest.Equals(t, ok, false)
+
+	// compare and set
+	s.incremented = false
+	cas = s.cas
+	_, err := s.CompareAndSetKey("a", "aa", cas-2, time.Time{})
+	unittest.Equals(t, err, ERR_KEY_VERSION_INVALID)
+	unittest.Equals(t, s.cas, cas)
+	_, err = s.CompareAndSetKey("b", "bb", 0, time.Time{})
+	unittest.Equals(t, err, ERR_KEY_VERSION_INVALID)
+	version, err = s.CompareAndSetKey("b", "bb", cas, time.Time{})
+	unittest.IsNil(t, err)
+	unittest.Equals(t, version, cas+1)
+	// a new value never inherits our previous expiry
+	unittest.Equals(t, len(s.GetKeyExpires()), 0)
+	// a version of 0 requires that our key does not exist
+	_, err = s.CompareAndSetKey("c", "c", 0, time.Time{})
+	unittest.IsNil(t, err)
+	unittest.Equals(t, s.GetKeyValue()["c"], "c")
+
+	// delete
+	s.incremented = false
+	cas = s.cas
+	unittest.Equals(t, s.DeleteKey("unknown"), false)
+	unittest.Equals(t, s.cas, cas)
+	unittest.Equals(t, s.DeleteKey("c"), true)
+	unittest.Equals(t, s.cas, cas+1)
+	unittest.Equals(t, s.GetKeyVersion("c"), uint64(0))
+	_, ok = s.GetKeyValue()["c"]
+	unittest.Equals(t, ok, false)
+
+	// increment
+	s.incremented = false
+	n, _, err := s.IncrementKey("counter", 2, now.Add(time.Minute))
+	unittest.IsNil(t, err)
+	unittest.Equals(t, n, float64(2))
+	s.SetKeyValue(map[string]interface{}{
+		"int": 1,
+	})
+	n, _, err = s.IncrementKey("int", -1.5, time.Time{})
+	unittest.IsNil(t, err)
+	unittest.Equals(t, n, -0.5)
+	s.incremented = false
+	cas = s.cas
+	_, _, err = s.IncrementKey("a", 1, time.Time{})
+	unittest.Equals(t, err, ERR_KEY_NOT_NUMBER)
+	unittest.Equals(t, s.cas, cas)
+	// our previous expiry is kept
+	n, version, err = s.IncrementKey("counter", 1, time.Time{})
+	unittest.IsNil(t, err)
+	unittest.Equals(t, n, float64(3))
+	unittest.Equals(t, version, cas+1)
+	unittest.Equals(t, s.GetKeyExpires()["counter"], now.Add(time.Minute))
+
+	// append
+	list, _, err := s.AppendKey("list", []interface{}{"a"}, time.Time{})
+	unittest.IsNil(t, err)
+	unittest.Equals(t, list, []interface{}{"a"})
+	kv := s.GetKeyValue()
+	list, _, err = s.AppendKey("list", []interface{}{"b", 1.0}, time.Time{})
+	unittest.IsNil(t, err)
+	unittest.Equals(t, list, []interface{}{"a", "b", 1.0})
+	// our previous list was never modified
+	unittest.Equals(t, kv["list"], []interface{}{"a"})
+	_, _, err = s.AppendKey("counter", []interface{}{"a"}, time.Time{})
+	unittest.Equals(t, err, ERR_KEY_NOT_LIST)
+
+	// expire
+	s.SetKey("d", "d", now.Add(time.Second))
+	s.incremented = false
+	cas = s.cas
+	unittest.Equals(t, s.ExpireKeyValue(now), []string{})
+	unittest.Equals(t, s.cas, cas)
+	unittest.Equals(t, s.ExpireKeyValue(now.Add(time.Minute)), []string{"counter", "d"})
+	unittest.Equals(t, s.cas, cas+1)
+	unittest.Equals(t, s.GetKeyValue(), map[string]interface{}{"a": "a", "b": "bb", "int": -0.5, "list": []interface{}{"a", "b", 1.0}})
+	unittest.Equals(t, len(s.GetKeyVersions()), 4)
+	unittest.Equals(t, len(s.GetKeyExpires()), 0)
+
+	// replace
+	s.SetKey("e", "e", now.Add(time.Minute))
+	s.ReplaceKeyValue(map[string]interface{}{
+		"f": "f",
+	})
+	unittest.Equals(t, s.GetKeyVersions(), map[string]uint64{"f": s.cas})
+	unittest.Equals(t, len(s.GetKeyExpires()), 0)
+}
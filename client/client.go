@@ -0,0 +1,319 @@
+// Package client is used by Apps to communicate with Patrol
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"sabey.co/patrol"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// these values are never set by Patrol, they may be set by our App's `env`
+	ENV_SECRET     = `PATROL_SECRET`
+	ENV_TOKEN      = `PATROL_TOKEN`
+	ENV_UDP_KEY_ID = `PATROL_UDP_KEY_ID`
+	ENV_UDP_KEY    = `PATROL_UDP_KEY`
+)
+
+const (
+	PING_EVERY_DEFAULT = time.Second * 5
+	TIMEOUT_DEFAULT    = time.Second * 5
+	// CAS_RETRIES_DEFAULT is how many times we will attempt to modify our KeyValue before giving up
+	CAS_RETRIES_DEFAULT = 10
+)
+
+var (
+	ERR_ID_EMPTY            = fmt.Errorf("Client ID was empty, Set ENV %s=ID", patrol.APP_ENV_APP_ID)
+	ERR_KEEPALIVE_INVALID   = fmt.Errorf("Client KeepAlive was invalid, Set ENV %s=KEEPALIVE", patrol.APP_ENV_KEEPALIVE)
+	ERR_LISTENERS_EMPTY     = fmt.Errorf("Client Listeners were empty")
+	ERR_PING_NOT_SUPPORTED  = fmt.Errorf("Client KeepAlive does not support Ping")
+	ERR_NO_RESPONSE         = fmt.Errorf("Client did not receive a response")
+	ERR_CAS_RETRIES         = fmt.Errorf("Client exhausted CAS retries")
+	ERR_STATUS_CODE_INVALID = fmt.Errorf("Client received an unexpected Status Code")
+)
+
+type Config struct {
+	// ID is our App ID
+	ID string
+	// KeepAlive is our App KeepAlive, ie: patrol.APP_KEEPALIVE_HTTP
+	KeepAlive int
+	// HTTP/UDP are our listeners, these may be prefixed with `unix:` or `unixgram:`
+	// Listeners are attempted in order, if a listener fails we will fail over to our next listener
+	HTTP []string
+	UDP  []string
+	// Secret/Token are optional, see patrol.API_Request
+	Secret string
+	Token  string
+	// UDPKeyID/UDPKey will sign our UDP requests, see patrol.API_UDPEnvelope
+	UDPKeyID string
+	UDPKey   string
+	// TLS is optional, if set our HTTP listeners will use https
+	TLS *tls.Config
+	// PingEvery is how often Run() will ping
+	// Value of 0 Defaults to 5 seconds
+	PingEvery time.Duration
+	// Timeout is how long we will wait for each request
+	// Value of 0 Defaults to 5 seconds
+	Timeout time.Duration
+}
+
+// ConfigFromEnv will read our config from the environment variables Patrol sets when executing our App
+// Our Secret, Token and UDP Key are read from ENV_SECRET, ENV_TOKEN, ENV_UDP_KEY_ID and ENV_UDP_KEY if they exist
+func ConfigFromEnv() (
+	*Config,
+	error,
+) {
+	config := &Config{
+		ID:       os.Getenv(patrol.APP_ENV_APP_ID),
+		Secret:   os.Getenv(ENV_SECRET),
+		Token:    os.Getenv(ENV_TOKEN),
+		UDPKeyID: os.Getenv(ENV_UDP_KEY_ID),
+		UDPKey:   os.Getenv(ENV_UDP_KEY),
+	}
+	if config.ID == "" {
+		return nil, ERR_ID_EMPTY
+	}
+	keepalive, err := strconv.Atoi(os.Getenv(patrol.APP_ENV_KEEPALIVE))
+	if err != nil {
+		return nil, ERR_KEEPALIVE_INVALID
+	}
+	config.KeepAlive = keepalive
+	for _, key := range []string{patrol.APP_ENV_LISTEN_HTTP, patrol.APP_ENV_LISTEN_UDP, patrol.APP_ENV_LISTEN_UNIX} {
+		v := os.Getenv(key)
+		if v == "" {
+			continue
+		}
+		listeners := []string{}
+		if err := json.Unmarshal([]byte(v), &listeners); err != nil {
+			return nil, fmt.Errorf("Client failed to unmarshal %s: \"%s\"", key, err)
+		}
+		for _, l := range listeners {
+			if l == "" {
+				continue
+			}
+			if key == patrol.APP_ENV_LISTEN_UDP ||
+				strings.HasPrefix(l, patrol.LISTEN_UNIXGRAM_PREFIX) {
+				config.UDP = append(config.UDP, l)
+			} else {
+				config.HTTP = append(config.HTTP, l)
+			}
+		}
+	}
+	return config, nil
+}
+
+type Client struct {
+	config *Config
+	// our http clients are created once for each listener
+	http []*http.Client
+	// unsafe
+	// these are the index of our last successful listener
+	http_listener int
+	udp_listener  int
+	mu            sync.Mutex
+}
+
+// New will create a Client from our Config
+func New(
+	config *Config,
+) (
+	*Client,
+	error,
+) {
+	if config.ID == "" {
+		return nil, ERR_ID_EMPTY
+	}
+	if len(config.HTTP) == 0 &&
+		len(config.UDP) == 0 {
+		return nil, ERR_LISTENERS_EMPTY
+	}
+	c := &Client{
+		config: config,
+	}
+	for _, l := range config.HTTP {
+		transport := &http.Transport{
+			TLSClientConfig: config.TLS,
+		}
+		if network, address := patrol.ParseListen(l, "tcp"); network == "unix" {
+			transport.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", address)
+			}
+		}
+		c.http = append(c.http, &http.Client{
+			Transport: transport,
+		})
+	}
+	return c, nil
+}
+
+// NewFromEnv will create a Client from ConfigFromEnv()
+func NewFromEnv() (
+	*Client,
+	error,
+) {
+	config, err := ConfigFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	return New(config)
+}
+func (self *Client) GetConfig() *Config {
+	return self.config
+}
+func (self *Client) getTimeout() time.Duration {
+	if self.config.Timeout == 0 {
+		return TIMEOUT_DEFAULT
+	}
+	return self.config.Timeout
+}
+
+// Request will send our request to Patrol and return our response
+// Our ID, Group, Secret and Token are set from our Config
+// If HTTP listeners exist we will always use HTTP, otherwise we will use UDP
+func (self *Client) Request(
+	ctx context.Context,
+	request *patrol.API_Request,
+) (
+	*patrol.API_Response,
+	error,
+) {
+	r := self.prepare(request)
+	if len(self.config.HTTP) > 0 {
+		return responseErrors(self.requestHTTP(ctx, r))
+	}
+	return responseErrors(self.requestUDP(ctx, r))
+}
+func (self *Client) prepare(
+	request *patrol.API_Request,
+) *patrol.API_Request {
+	r := *request
+	r.ID = self.config.ID
+	r.Group = "app"
+	if r.Secret == "" {
+		r.Secret = self.config.Secret
+	}
+	if r.Token == "" {
+		r.Token = self.config.Token
+	}
+	return &r
+}
+
+// responseErrors will return our response errors as an error
+func responseErrors(
+	response *patrol.API_Response,
+	err error,
+) (
+	*patrol.API_Response,
+	error,
+) {
+	if err != nil {
+		return nil, err
+	}
+	if len(response.Errors) > 0 {
+		return response, fmt.Errorf("Patrol responded with Errors: \"%s\"", strings.Join(response.Errors, "\", \""))
+	}
+	return response, nil
+}
+
+// Get will return the current state of our App
+func (self *Client) Get(
+	ctx context.Context,
+) (
+	*patrol.API_Response,
+	error,
+) {
+	return self.Request(ctx, &patrol.API_Request{})
+}
+func (self *Client) requestHTTP(
+	ctx context.Context,
+	request *patrol.API_Request,
+) (
+	*patrol.API_Response,
+	error,
+) {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+	self.mu.Lock()
+	start := self.http_listener
+	self.mu.Unlock()
+	var last error
+	for i := 0; i < len(self.config.HTTP); i++ {
+		index := (start + i) % len(self.config.HTTP)
+		response, err := self.postHTTP(ctx, index, body)
+		if err == nil {
+			self.mu.Lock()
+			self.http_listener = index
+			self.mu.Unlock()
+			return response, nil
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		last = err
+	}
+	return nil, last
+}
+func (self *Client) postHTTP(
+	ctx context.Context,
+	index int,
+	body []byte,
+) (
+	*patrol.API_Response,
+	error,
+) {
+	ctx, cancel := context.WithTimeout(ctx, self.getTimeout())
+	defer cancel()
+	scheme := "http"
+	if self.config.TLS != nil {
+		scheme = "https"
+	}
+	host := self.config.HTTP[index]
+	if patrol.IsListenUnix(host) {
+		// our host is ignored by our unix dialer
+		host = "unix"
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", fmt.Sprintf("%s://%s/api/", scheme, host), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := self.http[index].Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	bs, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	response := &patrol.API_Response{}
+	if err := json.Unmarshal(bs, response); err != nil {
+		if resp.StatusCode != 200 {
+			return nil, ERR_STATUS_CODE_INVALID
+		}
+		return nil, err
+	}
+	if len(response.Errors) > 0 {
+		// patrol responded, we're not going to fail over to another listener
+		// our errors are returned with our response
+		return response, nil
+	}
+	if resp.StatusCode != 200 {
+		return nil, ERR_STATUS_CODE_INVALID
+	}
+	return response, nil
+}
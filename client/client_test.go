@@ -0,0 +1,118 @@
+package client
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sabey.co/patrol"
+	"sabey.co/unittest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testPatrol(
+	t *testing.T,
+	keepalive int,
+) *patrol.Patrol {
+	p, err := patrol.CreatePatrol(&patrol.Config{
+		Apps: map[string]*patrol.ConfigApp{
+			"testapp": &patrol.ConfigApp{
+				KeepAlive:        patrol.KeepAlive(keepalive),
+				Name:             "testapp",
+				Binary:           "testapp",
+				WorkingDirectory: "/testapp",
+				LogDirectory:     "logs",
+				Secret:           "secret",
+			},
+		},
+		ListenHTTP: []string{"127.0.0.1:8421"},
+		ListenUDP:  []string{"127.0.0.1:1248"},
+	})
+	unittest.IsNil(t, err)
+	return p
+}
+func TestConfigFromEnv(t *testing.T) {
+	log.Println("TestConfigFromEnv")
+
+	os.Setenv(patrol.APP_ENV_APP_ID, "")
+	_, err := ConfigFromEnv()
+	unittest.Equals(t, err, ERR_ID_EMPTY)
+
+	os.Setenv(patrol.APP_ENV_APP_ID, "testapp")
+	os.Setenv(patrol.APP_ENV_KEEPALIVE, "")
+	_, err = ConfigFromEnv()
+	unittest.Equals(t, err, ERR_KEEPALIVE_INVALID)
+
+	os.Setenv(patrol.APP_ENV_KEEPALIVE, "3")
+	os.Setenv(patrol.APP_ENV_LISTEN_HTTP, `["127.0.0.1:8421"]`)
+	os.Setenv(patrol.APP_ENV_LISTEN_UDP, `["127.0.0.1:1248"]`)
+	os.Setenv(patrol.APP_ENV_LISTEN_UNIX, `["unix:/tmp/patrol.sock","unixgram:/tmp/patrol-udp.sock"]`)
+	os.Setenv(ENV_SECRET, "secret")
+	defer func() {
+		for _, key := range []string{patrol.APP_ENV_APP_ID, patrol.APP_ENV_KEEPALIVE, patrol.APP_ENV_LISTEN_HTTP, patrol.APP_ENV_LISTEN_UDP, patrol.APP_ENV_LISTEN_UNIX, ENV_SECRET} {
+			os.Unsetenv(key)
+		}
+	}()
+	config, err := ConfigFromEnv()
+	unittest.IsNil(t, err)
+	unittest.Equals(t, config.ID, "testapp")
+	unittest.Equals(t, config.KeepAlive, patrol.APP_KEEPALIVE_HTTP)
+	unittest.Equals(t, config.HTTP, []string{"127.0.0.1:8421", "unix:/tmp/patrol.sock"})
+	unittest.Equals(t, config.UDP, []string{"127.0.0.1:1248", "unixgram:/tmp/patrol-udp.sock"})
+	unittest.Equals(t, config.Secret, "secret")
+
+	os.Setenv(patrol.APP_ENV_LISTEN_HTTP, `127.0.0.1:8421`)
+	_, err = ConfigFromEnv()
+	unittest.NotNil(t, err)
+
+	_, err = New(&Config{ID: "testapp"})
+	unittest.Equals(t, err, ERR_LISTENERS_EMPTY)
+}
+func TestClientHTTP(t *testing.T) {
+	log.Println("TestClientHTTP")
+
+	p := testPatrol(t, patrol.APP_KEEPALIVE_HTTP)
+	server := httptest.NewServer(http.HandlerFunc(p.ServeHTTPAPI))
+	defer server.Close()
+
+	// our first listener is dead, we will fail over to our server
+	c, err := New(&Config{
+		ID:        "testapp",
+		KeepAlive: patrol.APP_KEEPALIVE_HTTP,
+		HTTP:      []string{"127.0.0.1:1", strings.TrimPrefix(server.URL, "http://")},
+		Secret:    "secret",
+		Timeout:   time.Second,
+	})
+	unittest.IsNil(t, err)
+
+	response, err := c.Ping(context.Background())
+	unittest.IsNil(t, err)
+	unittest.Equals(t, response.ID, "testapp")
+	unittest.Equals(t, p.GetApp("testapp").GetPID(), uint32(os.Getpid()))
+	// we remember our last successful listener
+	unittest.Equals(t, c.http_listener, 1)
+
+	// errors are returned
+	c.config.Secret = "invalid"
+	response, err = c.Get(context.Background())
+	unittest.NotNil(t, err)
+	unittest.Equals(t, len(response.Errors) > 0, true)
+	c.config.Secret = "secret"
+
+	// run until our context is done
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+	defer cancel()
+	c.config.PingEvery = time.Millisecond * 10
+	unittest.Equals(t, c.Run(ctx, func(err error) {
+		t.Errorf("Run failed: %s", err)
+	}), context.DeadlineExceeded)
+
+	// our keepalive doesn't ping
+	c.config.KeepAlive = patrol.APP_KEEPALIVE_PID_PATROL
+	_, err = c.Ping(context.Background())
+	unittest.Equals(t, err, ERR_PING_NOT_SUPPORTED)
+	unittest.Equals(t, c.Run(context.Background(), nil), ERR_PING_NOT_SUPPORTED)
+}
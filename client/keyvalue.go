@@ -0,0 +1,96 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"sabey.co/patrol"
+)
+
+// GetKeyValue will unmarshal the value of our key into value
+// If our key does not exist, value is not modified and false is returned
+func (self *Client) GetKeyValue(
+	ctx context.Context,
+	key string,
+	value interface{},
+) (
+	bool,
+	error,
+) {
+	response, err := self.Get(ctx)
+	if err != nil {
+		return false, err
+	}
+	return decodeKeyValue(response, key, value)
+}
+
+// SetKeyValue will set our key to value, any other keys are not modified
+func (self *Client) SetKeyValue(
+	ctx context.Context,
+	key string,
+	value interface{},
+) error {
+	_, err := self.Request(ctx, &patrol.API_Request{
+		KeyValue: map[string]interface{}{
+			key: value,
+		},
+	})
+	return err
+}
+
+// UpdateKeyValue will read our key into value, call update, and then write value using our CAS
+// If our App was modified between reading and writing, we will read our key and call update again
+// We will give up after CAS_RETRIES_DEFAULT attempts
+func (self *Client) UpdateKeyValue(
+	ctx context.Context,
+	key string,
+	value interface{},
+	update func() error,
+) error {
+	for i := 0; i < CAS_RETRIES_DEFAULT; i++ {
+		response, err := self.Get(ctx)
+		if err != nil {
+			return err
+		}
+		if _, err := decodeKeyValue(response, key, value); err != nil {
+			return err
+		}
+		if err := update(); err != nil {
+			return err
+		}
+		response, err = self.Request(ctx, &patrol.API_Request{
+			KeyValue: map[string]interface{}{
+				key: value,
+			},
+			CAS: response.CAS,
+		})
+		if err != nil {
+			return err
+		}
+		if !response.CASInvalid {
+			return nil
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+	}
+	return ERR_CAS_RETRIES
+}
+func decodeKeyValue(
+	response *patrol.API_Response,
+	key string,
+	value interface{},
+) (
+	bool,
+	error,
+) {
+	v, ok := response.KeyValue[key]
+	if !ok {
+		return false, nil
+	}
+	// our value was unmarshaled as an interface{}, we're going to marshal it again to unmarshal our type
+	bs, err := json.Marshal(v)
+	if err != nil {
+		return false, err
+	}
+	return true, json.Unmarshal(bs, value)
+}
@@ -0,0 +1,62 @@
+package client
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"sabey.co/patrol"
+	"sabey.co/unittest"
+	"strings"
+	"testing"
+)
+
+func TestClientKeyValue(t *testing.T) {
+	log.Println("TestClientKeyValue")
+
+	p := testPatrol(t, patrol.APP_KEEPALIVE_HTTP)
+	server := httptest.NewServer(http.HandlerFunc(p.ServeHTTPAPI))
+	defer server.Close()
+
+	c, err := New(&Config{
+		ID:     "testapp",
+		HTTP:   []string{strings.TrimPrefix(server.URL, "http://")},
+		Secret: "secret",
+	})
+	unittest.IsNil(t, err)
+	ctx := context.Background()
+
+	type counter struct {
+		Count int `json:"count"`
+	}
+	value := &counter{}
+	exists, err := c.GetKeyValue(ctx, "counter", value)
+	unittest.IsNil(t, err)
+	unittest.Equals(t, exists, false)
+
+	unittest.IsNil(t, c.SetKeyValue(ctx, "counter", &counter{Count: 1}))
+	exists, err = c.GetKeyValue(ctx, "counter", value)
+	unittest.IsNil(t, err)
+	unittest.Equals(t, exists, true)
+	unittest.Equals(t, value.Count, 1)
+
+	// our App is modified during our first update, we will retry
+	updates := 0
+	unittest.IsNil(t, c.UpdateKeyValue(ctx, "counter", value, func() error {
+		updates++
+		if updates == 1 {
+			unittest.IsNil(t, c.SetKeyValue(ctx, "other", "value"))
+		}
+		value.Count++
+		return nil
+	}))
+	unittest.Equals(t, updates, 2)
+	exists, err = c.GetKeyValue(ctx, "counter", value)
+	unittest.IsNil(t, err)
+	unittest.Equals(t, value.Count, 2)
+
+	// our App is always modified
+	unittest.Equals(t, c.UpdateKeyValue(ctx, "counter", value, func() error {
+		return c.SetKeyValue(ctx, "other", "value")
+	}), ERR_CAS_RETRIES)
+}
@@ -0,0 +1,60 @@
+package client
+
+import (
+	"context"
+	"os"
+	"sabey.co/patrol"
+	"time"
+)
+
+// Ping will ping Patrol with our PID
+// We will use HTTP or UDP depending on our KeepAlive
+func (self *Client) Ping(
+	ctx context.Context,
+) (
+	*patrol.API_Response,
+	error,
+) {
+	request := self.prepare(&patrol.API_Request{
+		Ping: true,
+		PID:  uint32(os.Getpid()),
+	})
+	if self.config.KeepAlive == patrol.APP_KEEPALIVE_HTTP {
+		return responseErrors(self.requestHTTP(ctx, request))
+	} else if self.config.KeepAlive == patrol.APP_KEEPALIVE_UDP {
+		return responseErrors(self.requestUDP(ctx, request))
+	}
+	return nil, ERR_PING_NOT_SUPPORTED
+}
+func (self *Client) getPingEvery() time.Duration {
+	if self.config.PingEvery == 0 {
+		return PING_EVERY_DEFAULT
+	}
+	return self.config.PingEvery
+}
+
+// Run will Ping immediately and then every PingEvery until our context is done
+// A failed Ping will not stop Run, our optional callback will be called with each error
+func (self *Client) Run(
+	ctx context.Context,
+	errors func(error),
+) error {
+	if self.config.KeepAlive != patrol.APP_KEEPALIVE_HTTP &&
+		self.config.KeepAlive != patrol.APP_KEEPALIVE_UDP {
+		return ERR_PING_NOT_SUPPORTED
+	}
+	ticker := time.NewTicker(self.getPingEvery())
+	defer ticker.Stop()
+	for {
+		if _, err := self.Ping(ctx); err != nil &&
+			ctx.Err() == nil &&
+			errors != nil {
+			errors(err)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
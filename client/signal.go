@@ -0,0 +1,38 @@
+package client
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// HandleSignals will call our callbacks when Patrol signals our App
+// Patrol will send SIGUSR1 once our App is disabled or Patrol is shutting down, our App should stop
+// Patrol will send SIGUSR2 once our App is restarted, our App should either fork or stop
+// Either callback may be nil, our signals are handled until our context is done
+func HandleSignals(
+	ctx context.Context,
+	stop func(),
+	restart func(),
+) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGUSR1, syscall.SIGUSR2)
+	go func() {
+		defer signal.Stop(signals)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case sig := <-signals:
+				if sig == syscall.SIGUSR1 &&
+					stop != nil {
+					stop()
+				} else if sig == syscall.SIGUSR2 &&
+					restart != nil {
+					restart()
+				}
+			}
+		}
+	}()
+}
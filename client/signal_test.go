@@ -0,0 +1,36 @@
+package client
+
+import (
+	"context"
+	"log"
+	"sabey.co/unittest"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestHandleSignals(t *testing.T) {
+	log.Println("TestHandleSignals")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stop := make(chan struct{}, 1)
+	restart := make(chan struct{}, 1)
+	HandleSignals(ctx, func() {
+		stop <- struct{}{}
+	}, func() {
+		restart <- struct{}{}
+	})
+	wait := func(c chan struct{}) bool {
+		select {
+		case <-c:
+			return true
+		case <-time.After(time.Second):
+			return false
+		}
+	}
+	unittest.IsNil(t, syscall.Kill(syscall.Getpid(), syscall.SIGUSR1))
+	unittest.Equals(t, wait(stop), true)
+	unittest.IsNil(t, syscall.Kill(syscall.Getpid(), syscall.SIGUSR2))
+	unittest.Equals(t, wait(restart), true)
+}
@@ -0,0 +1,127 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sabey.co/patrol"
+	"time"
+)
+
+// SignUDP will wrap our request in a signed envelope for our UDP API
+// Our key ID and key must exist in our App's `udp-keys`
+// Our Secret is never required once our envelope is signed, so we're going to remove it from our request
+func SignUDP(
+	key_id string,
+	key string,
+	request *patrol.API_Request,
+) (
+	[]byte,
+	error,
+) {
+	r := *request
+	r.Secret = ""
+	envelope, err := patrol.NewUDPEnvelope(key_id, key, &r)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(envelope)
+}
+func (self *Client) requestUDP(
+	ctx context.Context,
+	request *patrol.API_Request,
+) (
+	*patrol.API_Response,
+	error,
+) {
+	if len(self.config.UDP) == 0 {
+		return nil, ERR_LISTENERS_EMPTY
+	}
+	var body []byte
+	var err error
+	if self.config.UDPKey != "" {
+		body, err = SignUDP(self.config.UDPKeyID, self.config.UDPKey, request)
+	} else {
+		body, err = json.Marshal(request)
+	}
+	if err != nil {
+		return nil, err
+	}
+	self.mu.Lock()
+	start := self.udp_listener
+	self.mu.Unlock()
+	var last error
+	for i := 0; i < len(self.config.UDP); i++ {
+		index := (start + i) % len(self.config.UDP)
+		response, err := self.sendUDP(ctx, index, body)
+		if err == nil {
+			self.mu.Lock()
+			self.udp_listener = index
+			self.mu.Unlock()
+			return response, nil
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		last = err
+	}
+	return nil, last
+}
+
+// sendUDP will write our body and wait for a response
+// Patrol will never respond with errors over UDP, if we don't receive a response we will return ERR_NO_RESPONSE
+func (self *Client) sendUDP(
+	ctx context.Context,
+	index int,
+	body []byte,
+) (
+	*patrol.API_Response,
+	error,
+) {
+	network, address := patrol.ParseListen(self.config.UDP[index], "udp")
+	var conn net.Conn
+	var err error
+	if network == "unixgram" {
+		// we have to bind to a path to receive a response
+		local := filepath.Join(os.TempDir(), fmt.Sprintf("patrol-client-%d-%d.sock", os.Getpid(), time.Now().UnixNano()))
+		defer os.Remove(local)
+		conn, err = net.DialUnix(
+			network,
+			&net.UnixAddr{Name: local, Net: network},
+			&net.UnixAddr{Name: address, Net: network},
+		)
+	} else {
+		var d net.Dialer
+		conn, err = d.DialContext(ctx, network, address)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	deadline := time.Now().Add(self.getTimeout())
+	if d, ok := ctx.Deadline(); ok &&
+		d.Before(deadline) {
+		deadline = d
+	}
+	conn.SetDeadline(deadline)
+	if _, err := conn.Write(body); err != nil {
+		return nil, err
+	}
+	bs := make([]byte, 65536)
+	n, err := conn.Read(bs)
+	if err != nil {
+		if e, ok := err.(net.Error); ok &&
+			e.Timeout() {
+			return nil, ERR_NO_RESPONSE
+		}
+		return nil, err
+	}
+	response := &patrol.API_Response{}
+	if err := json.Unmarshal(bs[:n], response); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
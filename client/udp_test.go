@@ -0,0 +1,81 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net"
+	"os"
+	"sabey.co/patrol"
+	"sabey.co/unittest"
+	"testing"
+	"time"
+)
+
+func TestSignUDP(t *testing.T) {
+	log.Println("TestSignUDP")
+
+	request := &patrol.API_Request{
+		ID:     "testapp",
+		Group:  "app",
+		Ping:   true,
+		PID:    1234,
+		Secret: "secret",
+	}
+	bs, err := SignUDP("key-1", "key", request)
+	unittest.IsNil(t, err)
+	// our request was not modified
+	unittest.Equals(t, request.Secret, "secret")
+
+	envelope := &patrol.API_UDPEnvelope{}
+	unittest.IsNil(t, json.Unmarshal(bs, envelope))
+	unittest.Equals(t, envelope.KeyID, "key-1")
+	unittest.Equals(t, len(envelope.Nonce), 32)
+	unittest.Equals(t, envelope.Timestamp <= time.Now().Unix(), true)
+	unittest.Equals(t, envelope.Signature, patrol.UDPEnvelopeSignature("key", envelope.KeyID, envelope.Timestamp, envelope.Nonce, envelope.Body))
+	unittest.Equals(t, envelope.Signature == patrol.UDPEnvelopeSignature("other", envelope.KeyID, envelope.Timestamp, envelope.Nonce, envelope.Body), false)
+
+	body := &patrol.API_Request{}
+	unittest.IsNil(t, json.Unmarshal(envelope.Body, body))
+	unittest.Equals(t, body.ID, "testapp")
+	unittest.Equals(t, body.PID, uint32(1234))
+	// our secret is never sent
+	unittest.Equals(t, body.Secret, "")
+
+	// every envelope has a unique nonce
+	bs, err = SignUDP("key-1", "key", request)
+	unittest.IsNil(t, err)
+	other := &patrol.API_UDPEnvelope{}
+	unittest.IsNil(t, json.Unmarshal(bs, other))
+	unittest.Equals(t, other.Nonce == envelope.Nonce, false)
+}
+func TestClientUDP(t *testing.T) {
+	log.Println("TestClientUDP")
+
+	p := testPatrol(t, patrol.APP_KEEPALIVE_UDP)
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	unittest.IsNil(t, err)
+	defer conn.Close()
+	go func() {
+		for p.HandleUDPConnection(conn) == nil {
+		}
+	}()
+
+	c, err := New(&Config{
+		ID:        "testapp",
+		KeepAlive: patrol.APP_KEEPALIVE_UDP,
+		UDP:       []string{conn.LocalAddr().String()},
+		Secret:    "secret",
+		Timeout:   time.Millisecond * 200,
+	})
+	unittest.IsNil(t, err)
+	response, err := c.Ping(context.Background())
+	unittest.IsNil(t, err)
+	unittest.Equals(t, response.ID, "testapp")
+	unittest.Equals(t, p.GetApp("testapp").GetPID(), uint32(os.Getpid()))
+
+	// patrol never responds with errors
+	c.config.Secret = "invalid"
+	_, err = c.Ping(context.Background())
+	unittest.Equals(t, err, ERR_NO_RESPONSE)
+}
@@ -0,0 +1,60 @@
+package patrol
+
+import (
+	"time"
+)
+
+// Clock is our source of time for our tick, our schedules, our ping timeouts and our History
+// SystemClock is our default, see patroltest.Clock for a Clock that is only advanced manually
+type Clock interface {
+	Now() time.Time
+	// NewTimer will return a Timer that fires once our duration has passed on our Clock
+	NewTimer(
+		d time.Duration,
+	) Timer
+}
+
+// Timer is a time.Timer of our Clock
+type Timer interface {
+	C() <-chan time.Time
+	// Stop will return false if our Timer has already fired or has already been stopped, the same as time.Timer.Stop()
+	Stop() bool
+}
+
+// SystemClock is our wall clock
+type SystemClock struct{}
+
+func (self SystemClock) Now() time.Time {
+	return time.Now()
+}
+func (self SystemClock) NewTimer(
+	d time.Duration,
+) Timer {
+	return &systemTimer{
+		t: time.NewTimer(d),
+	}
+}
+
+type systemTimer struct {
+	t *time.Timer
+}
+
+func (self *systemTimer) C() <-chan time.Time {
+	return self.t.C
+}
+func (self *systemTimer) Stop() bool {
+	return self.t.Stop()
+}
+
+// clock will return our Config.Clock, SystemClock is our default
+func (self *Patrol) clock() Clock {
+	if self.config.Clock != nil {
+		return self.config.Clock
+	}
+	return SystemClock{}
+}
+
+// now will return the time of our Clock
+func (self *Patrol) now() time.Time {
+	return self.clock().Now()
+}
@@ -3,7 +3,6 @@ package patrol
 import (
 	"encoding/json"
 	"fmt"
-	"os"
 	"strings"
 )
 
@@ -27,38 +26,14 @@ var (
 	ERR_SECRET_TOOLONG          = fmt.Errorf("Secret Longer than %d bytes", SECRET_MAX_LENGTH)
 )
 
-func LoadConfig(
-	path string,
-) (
-	*Config,
-	error,
-) {
-	file, err := os.Open(path)
-	if err != nil {
-		// couldn't open file
-		return nil, err
-	}
-	defer file.Close()
-	decoder := json.NewDecoder(file)
-	config := &Config{}
-	if err := decoder.Decode(config); err != nil {
-		// couldn't decode file as json
-		return nil, err
-	}
-	if config == nil {
-		// decoded config was nil
-		// while this would rarely occur in practice, it is technically possible for config to be nil after decode/unmarshal
-		// a json file with the value of "null" would cause this to occur
-		// the only time this really plays out in reality is if someone were to POST null to a JSON API
-		// this something that is sometimes overlooked
-		return nil, ERR_CONFIG_NIL
-	}
-	// we will NOT validate our config here!!!
-	// we can validate manually or on create
-	return config, nil
-}
-
 type Config struct {
+	// Include is a list of globs of config files that will be merged into our Apps and Services by LoadConfig()
+	// Globs are relative to our config file, ie: `conf.d/*.yaml`
+	// Included files are JSON, YAML or TOML and may only contain `apps` and `services`
+	Include []string `json:"include,omitempty"`
+	// Templates are partial Apps and Services that may be extended by our Apps and Services, see ConfigApp.Extends
+	// Templates are merged by LoadConfig() before our config is validated
+	Templates map[string]json.RawMessage `json:"templates,omitempty"`
 	// Apps/Services must contain a unique non empty key: ( 0-9 A-Z a-z - )
 	// ID MUST be usable as a valid hostname label, ie: len <= 63 AND no starting/ending -
 	// Keys are NOT our binary name
@@ -87,6 +62,9 @@ type Config struct {
 	// PingTimeout is an integer value in seconds of how often we require a Ping to be sent
 	// This only applies to App KeepAlives: APP_KEEPALIVE_HTTP and APP_KEEPALIVE_UDP
 	PingTimeout int `json:"ping-timeout,omitempty"`
+	// ShutdownTimeout is an integer value in seconds of how long Patrol.Run() will wait for our Apps to exit once we shutdown
+	// Our Apps are signalled with SIGTERM once half of our timeout has passed, and SIGKILL once our timeout has passed
+	ShutdownTimeout int `json:"shutdown-timeout,omitempty"`
 	// ListenHTTP/ListenUDP is our list of listeners
 	// These values are passed as Environment Variables to our executed Apps as JSON Arrays
 	//
@@ -97,11 +75,42 @@ type Config struct {
 	// When using APP_KEEPALIVE_HTTP and APP_KEEPALIVE_UDP, these are the addresses we MUST ping
 	ListenHTTP []string `json:"listen-http,omitempty"`
 	ListenUDP  []string `json:"listen-udp,omitempty"`
-	// HTTP/UDP currently only support the attribute `listen`
-	// This will allow us to overwrite our default listeners for HTTP and UDP
-	// In the future this will include additional options.
+	// ListenUnix is our list of unix domain socket listeners
+	// Each listener must be prefixed with either `unix:` for our HTTP API or `unixgram:` for our UDP API
+	// These values are passed as an Environment Variable to our executed Apps as a JSON Array
+	//
+	// Example Environment Variable:
+	// PATROL_UNIX=["unix:/run/patrol/http.sock","unixgram:/run/patrol/udp.sock"]
+	//
+	// When using APP_KEEPALIVE_HTTP and APP_KEEPALIVE_UDP, these may be pinged instead of ListenHTTP and ListenUDP
+	ListenUnix []string `json:"listen-unix,omitempty"`
+	// HTTP/UDP will allow us to overwrite our default listeners for HTTP and UDP
+	// Listeners prefixed with `unix:` or `unixgram:` will listen on a unix domain socket
 	HTTP *ConfigHTTP `json:"http,omitempty"`
 	UDP  *ConfigUDP  `json:"udp,omitempty"`
+	// Webhooks will POST a JSON body to a URL when App or Service lifecycle events occur
+	// See ConfigWebhook for our list of events
+	Webhooks []*ConfigWebhook `json:"webhooks,omitempty"`
+	// Tokens are hashed API tokens that are authorized for a list of scopes over App and Service IDs
+	// Tokens are accepted by our HTTP API, UDP API, and GUI in addition to our App and Service Secrets
+	// See ConfigToken for our list of scopes
+	Tokens []*ConfigToken `json:"tokens,omitempty"`
+	// If TokenRequired is true, every request MUST present an authorized Token
+	// App and Service Secrets and client identities will no longer be accepted, and requests without a Token will NOT be able to read our state
+	TokenRequired bool `json:"token-required,omitempty"`
+	// Executor starts and signals our Apps and runs our Service management commands
+	// Executor is only available when you extend Patrol as a library, SystemExecutor is our default
+	// See patroltest.Executor for an in-memory Executor that allows our App and Service lifecycles to be tested
+	Executor Executor `json:"-"`
+	// Clock is our source of time for our tick, our schedules, our ping timeouts and our History
+	// Clock is only available when you extend Patrol as a library, SystemClock is our default
+	// See patroltest.Clock for a Clock that allows our schedules and ping timeouts to be tested without waiting
+	Clock Clock `json:"-"`
+	// TriggerOptions are how each of our Triggers are called, our keys are our Trigger names such as TRIGGER_TICK
+	// Triggers without options are called inline and waited on, every Trigger is recovered if it panics
+	// TriggerStart is always called inline and a panic is returned from CreatePatrol() as a TriggerError
+	// TriggerOptions are only available when you extend Patrol as a library, see Patrol.GetTriggerErrors()
+	TriggerOptions map[string]*TriggerOptions `json:"-"`
 	// Triggers are only available when you extend Patrol as a library
 	// These values will NOT be able to be set from `config.json` - They must be set manually
 	//
@@ -129,6 +138,13 @@ type Config struct {
 	TriggerStopped func(
 		patrol *Patrol,
 	) `json:"-"`
+	// Reload will load our config again when Patrol.Reload() is called, see Patrol.Reload()
+	// Reload is only available when you extend Patrol as a library, our `patrol` binary reloads our config file and config directory
+	// If Reload is nil our config can not be reloaded
+	Reload func() (
+		*Config,
+		error,
+	) `json:"-"`
 	// Extra Unstructured Data
 	X json.RawMessage `json:"x,omitempty"`
 	// this is only used internally and checked once on creation
@@ -146,23 +162,40 @@ func (self *Config) Clone() *Config {
 		return nil
 	}
 	config := &Config{
+		Include:         make([]string, 0, len(self.Include)),
+		Templates:       make(map[string]json.RawMessage),
 		Apps:            make(map[string]*ConfigApp),
 		Services:        make(map[string]*ConfigService),
 		TickEvery:       self.TickEvery,
 		History:         self.History,
 		Timestamp:       self.Timestamp,
 		PingTimeout:     self.PingTimeout,
+		ShutdownTimeout: self.ShutdownTimeout,
 		ListenHTTP:      make([]string, 0, len(self.ListenHTTP)),
 		ListenUDP:       make([]string, 0, len(self.ListenUDP)),
+		ListenUnix:      make([]string, 0, len(self.ListenUnix)),
 		HTTP:            self.HTTP.Clone(),
 		UDP:             self.UDP.Clone(),
+		Webhooks:        make([]*ConfigWebhook, 0, len(self.Webhooks)),
+		Tokens:          make([]*ConfigToken, 0, len(self.Tokens)),
+		TokenRequired:   self.TokenRequired,
+		Executor:        self.Executor,
+		Clock:           self.Clock,
+		TriggerOptions:  cloneTriggerOptions(self.TriggerOptions),
 		TriggerStart:    self.TriggerStart,
 		TriggerShutdown: self.TriggerShutdown,
 		TriggerStarted:  self.TriggerStarted,
 		TriggerTick:     self.TriggerTick,
 		TriggerStopped:  self.TriggerStopped,
+		Reload:          self.Reload,
 		X:               dereference(self.X),
 	}
+	for _, i := range self.Include {
+		config.Include = append(config.Include, i)
+	}
+	for k, v := range self.Templates {
+		config.Templates[k] = dereference(v)
+	}
 	for k, v := range self.Apps {
 		config.Apps[k] = v.Clone()
 	}
@@ -175,6 +208,15 @@ func (self *Config) Clone() *Config {
 	for _, l := range self.ListenUDP {
 		config.ListenUDP = append(config.ListenUDP, l)
 	}
+	for _, l := range self.ListenUnix {
+		config.ListenUnix = append(config.ListenUnix, l)
+	}
+	for _, w := range self.Webhooks {
+		config.Webhooks = append(config.Webhooks, w.Clone())
+	}
+	for _, t := range self.Tokens {
+		config.Tokens = append(config.Tokens, t.Clone())
+	}
 	return config
 }
 func (self *Config) Validate() error {
@@ -219,14 +261,37 @@ func (self *Config) Validate() error {
 			udp = true
 		}
 	}
-	if http && len(self.ListenHTTP) == 0 {
+	// unix listeners may be used instead of http or udp listeners
+	unix := false
+	unixgram := false
+	for _, l := range self.ListenUnix {
+		if !isListenUnixValid(l) {
+			return ERR_LISTEN_UNIX_INVALID
+		}
+		if isListenUnixNetwork(l, "unix") {
+			unix = true
+		} else {
+			unixgram = true
+		}
+	}
+	if http && len(self.ListenHTTP) == 0 && !unix {
 		// no http servers
 		return ERR_LISTEN_HTTP_EMPTY
 	}
-	if udp && len(self.ListenUDP) == 0 {
+	if udp && len(self.ListenUDP) == 0 && !unixgram {
 		// no udp servers
 		return ERR_LISTEN_UDP_EMPTY
 	}
+	if self.HTTP.IsValid() {
+		if err := self.HTTP.Validate(); err != nil {
+			return err
+		}
+	}
+	if self.UDP.IsValid() {
+		if err := self.UDP.Validate(); err != nil {
+			return err
+		}
+	}
 	// overwrite apps
 	self.Apps = apps
 	// dereference and lowercase services
@@ -257,6 +322,47 @@ func (self *Config) Validate() error {
 	}
 	// overwrite services
 	self.Services = services
+	// check webhooks
+	webhooks := make([]*ConfigWebhook, 0, len(self.Webhooks))
+	for _, webhook := range self.Webhooks {
+		// dereference
+		webhook = webhook.Clone()
+		if !webhook.IsValid() {
+			return ERR_WEBHOOK_NIL
+		}
+		if err := webhook.Validate(); err != nil {
+			return err
+		}
+		webhooks = append(webhooks, webhook)
+	}
+	// overwrite webhooks
+	self.Webhooks = webhooks
+	// check tokens
+	tokens := make([]*ConfigToken, 0, len(self.Tokens))
+	token_ids := make(map[string]bool)
+	for _, token := range self.Tokens {
+		// dereference
+		token = token.Clone()
+		if !token.IsValid() {
+			return ERR_TOKEN_NIL
+		}
+		if err := token.Validate(); err != nil {
+			return err
+		}
+		if token.ID != "" {
+			if token_ids[token.ID] {
+				return ERR_TOKEN_ID_DUPLICATE
+			}
+			token_ids[token.ID] = true
+		}
+		tokens = append(tokens, token)
+	}
+	if self.TokenRequired &&
+		len(tokens) == 0 {
+		return ERR_TOKEN_REQUIRED_EMPTY
+	}
+	// overwrite tokens
+	self.Tokens = tokens
 	// config
 	if self.TickEvery == 0 {
 		self.TickEvery = TICKEVERY_DEFAULT
@@ -279,5 +385,145 @@ func (self *Config) Validate() error {
 	} else if self.PingTimeout > HISTORY_MAX {
 		self.PingTimeout = APP_PING_TIMEOUT_MAX
 	}
+	if self.ShutdownTimeout == 0 {
+		self.ShutdownTimeout = SHUTDOWN_TIMEOUT_DEFAULT
+	} else if self.ShutdownTimeout < SHUTDOWN_TIMEOUT_MIN {
+		self.ShutdownTimeout = SHUTDOWN_TIMEOUT_MIN
+	} else if self.ShutdownTimeout > SHUTDOWN_TIMEOUT_MAX {
+		self.ShutdownTimeout = SHUTDOWN_TIMEOUT_MAX
+	}
 	return nil
 }
+
+// ValidateAll will return every invalid field of our Apps, Services, Listeners, Webhooks and Tokens
+// Unlike Validate(), our config is not modified and our defaults are not set
+func (self *Config) ValidateAll() ValidationErrors {
+	v := &validation{}
+	if self == nil {
+		v.add("", nil, ERR_CONFIG_NIL)
+		return v.errors
+	}
+	if len(self.Apps) == 0 &&
+		len(self.Services) == 0 {
+		// no apps or services found
+		v.add("apps", nil, ERR_PATROL_EMPTY)
+	}
+	http := false
+	udp := false
+	ids := make(map[string]struct{})
+	for _, id := range sortedKeys(self.Apps) {
+		app := self.Apps[id]
+		v.group = VALIDATION_GROUP_APP
+		v.id = id
+		if id == "" {
+			v.add("", id, ERR_APPS_KEY_EMPTY)
+			continue
+		}
+		if !IsAppServiceID(id) {
+			v.add("", id, ERR_APPS_KEY_INVALID)
+			continue
+		}
+		if !app.IsValid() {
+			v.add("", nil, ERR_APPS_APP_NIL)
+			continue
+		}
+		// dereference, this will also expand our working directory
+		v.addAll(VALIDATION_GROUP_APP, id, app.Clone().ValidateAll())
+		if _, ok := ids[strings.ToLower(id)]; ok {
+			// ID already exists!!
+			v.add("", id, ERR_APP_LABEL_DUPLICATE)
+		}
+		ids[strings.ToLower(id)] = struct{}{}
+		if app.KeepAlive == APP_KEEPALIVE_HTTP {
+			http = true
+		} else if app.KeepAlive == APP_KEEPALIVE_UDP {
+			udp = true
+		}
+	}
+	v.group = VALIDATION_GROUP_CONFIG
+	v.id = ""
+	// unix listeners may be used instead of http or udp listeners
+	unix := false
+	unixgram := false
+	for i, l := range self.ListenUnix {
+		if !isListenUnixValid(l) {
+			v.add(fmt.Sprintf("listen-unix[%d]", i), l, ERR_LISTEN_UNIX_INVALID)
+		} else if isListenUnixNetwork(l, "unix") {
+			unix = true
+		} else {
+			unixgram = true
+		}
+	}
+	if http && len(self.ListenHTTP) == 0 && !unix {
+		// no http servers
+		v.add("listen-http", nil, ERR_LISTEN_HTTP_EMPTY)
+	}
+	if udp && len(self.ListenUDP) == 0 && !unixgram {
+		// no udp servers
+		v.add("listen-udp", nil, ERR_LISTEN_UDP_EMPTY)
+	}
+	if self.HTTP.IsValid() {
+		v.addValidate(VALIDATION_GROUP_HTTP, "", self.HTTP.Validate())
+	}
+	if self.UDP.IsValid() {
+		v.addValidate(VALIDATION_GROUP_UDP, "", self.UDP.Validate())
+	}
+	ids = make(map[string]struct{})
+	for _, id := range sortedKeys(self.Services) {
+		service := self.Services[id]
+		v.group = VALIDATION_GROUP_SERVICE
+		v.id = id
+		if id == "" {
+			v.add("", id, ERR_SERVICES_KEY_EMPTY)
+			continue
+		}
+		if !IsAppServiceID(id) {
+			v.add("", id, ERR_SERVICES_KEY_INVALID)
+			continue
+		}
+		if !service.IsValid() {
+			v.add("", nil, ERR_SERVICES_SERVICE_NIL)
+			continue
+		}
+		v.addAll(VALIDATION_GROUP_SERVICE, id, service.Clone().ValidateAll())
+		if _, ok := ids[strings.ToLower(id)]; ok {
+			// ID already exists!!
+			v.add("", id, ERR_SERVICE_LABEL_DUPLICATE)
+		}
+		ids[strings.ToLower(id)] = struct{}{}
+	}
+	for i, webhook := range self.Webhooks {
+		v.group = VALIDATION_GROUP_WEBHOOK
+		v.id = fmt.Sprintf("%d", i)
+		if !webhook.IsValid() {
+			v.add("", nil, ERR_WEBHOOK_NIL)
+			continue
+		}
+		// dereference, Validate() may normalize our webhook
+		v.addValidate(VALIDATION_GROUP_WEBHOOK, v.id, webhook.Clone().Validate())
+	}
+	token_ids := make(map[string]bool)
+	for i, token := range self.Tokens {
+		v.group = VALIDATION_GROUP_TOKEN
+		v.id = fmt.Sprintf("%d", i)
+		if !token.IsValid() {
+			v.add("", nil, ERR_TOKEN_NIL)
+			continue
+		}
+		// dereference, Validate() will lowercase our globs
+		v.addValidate(VALIDATION_GROUP_TOKEN, v.id, token.Clone().Validate())
+		if token.ID != "" {
+			if token_ids[token.ID] {
+				v.add("id", nil, ERR_TOKEN_ID_DUPLICATE)
+			}
+			token_ids[token.ID] = true
+		}
+	}
+	v.group = VALIDATION_GROUP_CONFIG
+	v.id = ""
+	if self.TokenRequired &&
+		len(self.Tokens) == 0 {
+		v.add("tokens", nil, ERR_TOKEN_REQUIRED_EMPTY)
+	}
+	return v.errors
+}
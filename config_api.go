@@ -2,13 +2,42 @@ package patrol
 
 import (
 	"encoding/json"
+	"fmt"
+)
+
+var (
+	ERR_HTTP_TLS_KEYPAIR        = fmt.Errorf("HTTP TLS Cert and Key must both be set")
+	ERR_HTTP_TLS_UNCLEAN        = fmt.Errorf("HTTP TLS path was unclean")
+	ERR_HTTP_TLS_CLIENTCA_NOTLS = fmt.Errorf("HTTP TLS Client CA requires a TLS Cert and Key")
 )
 
 type ConfigHTTP struct {
+	// Listen is our TCP address, ie: `127.0.0.1:8421`
+	// If Listen is prefixed with `unix:` we will listen on a unix domain socket instead, ie: `unix:/run/patrol/http.sock`
 	Listen string `json:"listen,omitempty"`
+	// SocketMode/SocketOwner/SocketGroup are only used by unix domain sockets
+	// SocketMode is an octal string, ie: "0660"
+	// SocketOwner and SocketGroup are either a name or a numeric ID
+	SocketMode  string `json:"socket-mode,omitempty"`
+	SocketOwner string `json:"socket-owner,omitempty"`
+	SocketGroup string `json:"socket-group,omitempty"`
+	// PeerUIDs/PeerGIDs are only used by unix domain sockets
+	// If either is set, we will only accept connections from a process whose SO_PEERCRED matches a UID or GID
+	PeerUIDs []uint32 `json:"peer-uids,omitempty"`
+	PeerGIDs []uint32 `json:"peer-gids,omitempty"`
+	// If TLSCert and TLSKey are set, we will serve HTTPS
+	// TLSCert and TLSKey are paths to PEM encoded files, they will be reloaded once modified
+	TLSCert string `json:"tls-cert,omitempty"`
+	TLSKey  string `json:"tls-key,omitempty"`
+	// If TLSClientCA is set, we will require clients to present a certificate signed by this PEM encoded CA (mTLS)
+	// The Common Name and Subject Alternative Names of a verified client certificate may be used as an identity
+	// See ConfigApp.ClientIdentities and ConfigService.ClientIdentities
+	TLSClientCA string `json:"tls-client-ca,omitempty"`
+	// If TLSClientOptional is true, clients without a certificate will still be accepted
+	// Any certificate that is presented must still be verified
+	TLSClientOptional bool `json:"tls-client-optional,omitempty"`
 	// Extra Unstructured Data
 	X json.RawMessage `json:"x,omitempty"`
-	// TODO: https?
 }
 
 func (self *ConfigHTTP) IsValid() bool {
@@ -22,14 +51,72 @@ func (self *ConfigHTTP) Clone() *ConfigHTTP {
 		return nil
 	}
 	config := &ConfigHTTP{
-		Listen: self.Listen,
-		X:      dereference(self.X),
+		Listen:            self.Listen,
+		SocketMode:        self.SocketMode,
+		SocketOwner:       self.SocketOwner,
+		SocketGroup:       self.SocketGroup,
+		PeerUIDs:          make([]uint32, 0, len(self.PeerUIDs)),
+		PeerGIDs:          make([]uint32, 0, len(self.PeerGIDs)),
+		TLSCert:           self.TLSCert,
+		TLSKey:            self.TLSKey,
+		TLSClientCA:       self.TLSClientCA,
+		TLSClientOptional: self.TLSClientOptional,
+		X:                 dereference(self.X),
+	}
+	for _, u := range self.PeerUIDs {
+		config.PeerUIDs = append(config.PeerUIDs, u)
+	}
+	for _, g := range self.PeerGIDs {
+		config.PeerGIDs = append(config.PeerGIDs, g)
 	}
 	return config
 }
+func (self *ConfigHTTP) Validate() error {
+	if IsListenUnix(self.Listen) &&
+		(!isListenUnixValid(self.Listen) ||
+			!isListenUnixNetwork(self.Listen, "unix")) {
+		return ERR_LISTEN_UNIX_INVALID
+	}
+	if self.SocketMode != "" {
+		if _, err := parseSocketMode(self.SocketMode); err != nil {
+			return err
+		}
+	}
+	if (self.TLSCert == "") != (self.TLSKey == "") {
+		// we require both a cert and key
+		return ERR_HTTP_TLS_KEYPAIR
+	}
+	if self.TLSCert != "" &&
+		(!IsPathClean(self.TLSCert) ||
+			!IsPathClean(self.TLSKey)) {
+		return ERR_HTTP_TLS_UNCLEAN
+	}
+	if self.TLSClientCA != "" {
+		if self.TLSCert == "" {
+			// we can't verify clients without TLS
+			return ERR_HTTP_TLS_CLIENTCA_NOTLS
+		}
+		if !IsPathClean(self.TLSClientCA) {
+			return ERR_HTTP_TLS_UNCLEAN
+		}
+	}
+	return nil
+}
+func (self *ConfigHTTP) IsTLS() bool {
+	return self.TLSCert != "" &&
+		self.TLSKey != ""
+}
 
 type ConfigUDP struct {
+	// Listen is our UDP address, ie: `127.0.0.1:1248`
+	// If Listen is prefixed with `unixgram:` we will listen on a unix datagram socket instead, ie: `unixgram:/run/patrol/udp.sock`
 	Listen string `json:"listen,omitempty"`
+	// SocketMode/SocketOwner/SocketGroup are only used by unix datagram sockets
+	// SocketMode is an octal string, ie: "0660"
+	// SocketOwner and SocketGroup are either a name or a numeric ID
+	SocketMode  string `json:"socket-mode,omitempty"`
+	SocketOwner string `json:"socket-owner,omitempty"`
+	SocketGroup string `json:"socket-group,omitempty"`
 	// Extra Unstructured Data
 	X json.RawMessage `json:"x,omitempty"`
 }
@@ -45,8 +132,24 @@ func (self *ConfigUDP) Clone() *ConfigUDP {
 		return nil
 	}
 	config := &ConfigUDP{
-		Listen: self.Listen,
-		X:      dereference(self.X),
+		Listen:      self.Listen,
+		SocketMode:  self.SocketMode,
+		SocketOwner: self.SocketOwner,
+		SocketGroup: self.SocketGroup,
+		X:           dereference(self.X),
 	}
 	return config
 }
+func (self *ConfigUDP) Validate() error {
+	if IsListenUnix(self.Listen) &&
+		(!isListenUnixValid(self.Listen) ||
+			!isListenUnixNetwork(self.Listen, "unixgram")) {
+		return ERR_LISTEN_UNIX_INVALID
+	}
+	if self.SocketMode != "" {
+		if _, err := parseSocketMode(self.SocketMode); err != nil {
+			return err
+		}
+	}
+	return nil
+}
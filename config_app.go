@@ -24,21 +24,40 @@ var (
 	ERR_APP_PIDPATH_EMPTY             = fmt.Errorf("App PIDPATH was empty")
 	ERR_APP_PIDPATH_UNCLEAN           = fmt.Errorf("App PIDPath was unclean")
 	ERR_APP_EXECUTETIMEOUT_INVALID    = fmt.Errorf("App Excute Timeout < 0")
+	ERR_APP_CHECKEVERY_INVALID        = fmt.Errorf("App Check Every < 0")
+	ERR_APP_PINGTIMEOUT_INVALID       = fmt.Errorf("App Ping Timeout < 0")
+	ERR_APP_CRASHTAIL_INVALID         = fmt.Errorf("App Crash Tail < 0 or > %d", APP_CRASH_TAIL_MAX)
+	ERR_APP_UDPKEY_ID_INVALID         = fmt.Errorf("App UDP Key ID was empty or longer than %d bytes", UDP_ENVELOPE_KEY_ID_MAX_LENGTH)
+	ERR_APP_UDPKEY_INVALID            = fmt.Errorf("App UDP Key was empty or longer than %d bytes", SECRET_MAX_LENGTH)
 )
 
 type ConfigApp struct {
+	// Extends is the name of a template in Config.Templates that our App will inherit from, templates are merged by LoadConfig()
+	// Our App's values always win: objects are merged and lists are appended to our template's lists
+	// ExtendsReplace is a list of keys whose lists will replace our template's lists instead, ie: `args`
+	Extends        string   `json:"extends,omitempty"`
+	ExtendsReplace []string `json:"extends-replace,omitempty"`
 	// KeepAlive Method
 	//
-	// APP_KEEPALIVE_PID_PATROL = 1
-	// APP_KEEPALIVE_PID_APP = 2
-	// APP_KEEPALIVE_HTTP = 3
-	// APP_KEEPALIVE_UDP = 4
+	// APP_KEEPALIVE_PID_PATROL = 1 = "pid-patrol"
+	// APP_KEEPALIVE_PID_APP = 2 = "pid-app"
+	// APP_KEEPALIVE_HTTP = 3 = "http"
+	// APP_KEEPALIVE_UDP = 4 = "udp"
+	//
+	// KeepAlive may be either our number or our name, it is always marshalled as our name
 	//
 	// PID_PATROL: Patrol will watch the execution of the Application. Apps will not be able to fork.
 	// PID_APP: The Application is required to write its CURRENT PID to our `pid-path`. Patrol will `kill -0 PID` to verify that the App is running. This option should be used for forking processes.
 	// HTTP: The Application must send a Ping request to our HTTP API.
 	// UDP: The Application must send a Ping request to our UDP API.
-	KeepAlive int `json:"keepalive,omitempty"`
+	KeepAlive KeepAlive `json:"keepalive,omitempty"`
+	// CheckEvery is an optional integer value in seconds of how often we will check the state of our App
+	// A Value of 0 will use Config.TickEvery, our value is limited to TICKEVERY_MIN and TICKEVERY_MAX
+	CheckEvery int `json:"check-every,omitempty"`
+	// PingTimeout is an optional integer value in seconds of how often we require a Ping, this only applies to APP_KEEPALIVE_HTTP and APP_KEEPALIVE_UDP
+	// A Value of 0 will use Config.PingTimeout, our value is limited to APP_PING_TIMEOUT_MIN and APP_PING_TIMEOUT_MAX
+	PingTimeout int `json:"ping-timeout,omitempty"`
+
 	// Name is used as our Display Name in our HTTP GUI.
 	// Name can contain any characters but must be less than 255 bytes in length.
 	Name string `json:"name,omitempty"`
@@ -74,7 +93,24 @@ type ConfigApp struct {
 	// If Secret is set, we will require a secret to be passed when pinging and modifying the state of our App from our HTTP and UDP API.
 	// We are not going to throttle comparing our secret. Choose a secret with enough bits of uniqueness and don't make your Patrol instance public!
 	// If you are worried about your secret being public, use TLS and HTTP, DO NOT USE UDP!!!
+	// Secret may be interpolated from our environment, ie: `${APP_SECRET}`
+	// Interpolated secrets are only resolved by LoadConfig() and are never echoed back by GetConfig() or our API
 	Secret string `json:"secret,omitempty"`
+	// SecretFile is a path to a file containing our Secret, our file is read by LoadConfig()
+	// A relative path is relative to the config file that defined our App
+	// A trailing newline is not included in our Secret, SecretFile and Secret may not both be set
+	SecretFile string `json:"secret-file,omitempty"`
+	// ClientIdentities are the Common Names and Subject Alternative Names of client certificates we will accept in place of our Secret.
+	// Client certificates are only verified if ConfigHTTP.TLSClientCA is set, our UDP API will never present an identity.
+	// If ClientIdentityRequired is true, we will require both an identity AND our Secret.
+	ClientIdentities       []string `json:"client-identities,omitempty"`
+	ClientIdentityRequired bool     `json:"client-identity-required,omitempty"`
+	// UDPKeys is a map of Key IDs to HMAC-SHA256 keys used to verify signed UDP envelopes.
+	// If UDPKeys is set, our UDP API will only accept signed envelopes for our App, unsigned UDP requests will be ignored.
+	// A verified envelope is authorized in place of our Secret, our Secret is never sent in clear text.
+	// Multiple keys may be set so that keys can be rotated.
+	// Keys may be interpolated from our environment the same as our Secret.
+	UDPKeys map[string]string `json:"udp-keys,omitempty"`
 	////////////
 	// os.Cmd //
 	////////////
@@ -93,6 +129,10 @@ type ConfigApp struct {
 	//
 	// We're going to include our own Patrol related environment variables, so EnvParent is required if we wish to include parent values.
 	Env []string `json:"env,omitempty"`
+	// EnvFile is a path to a dotenv file of "key=value" lines, our file is read by LoadConfig()
+	// A relative path is relative to the config file that defined our App
+	// Our EnvFile is prepended to Env, so that Env may overwrite it, our EnvFile values are never echoed back by GetConfig()
+	EnvFile string `json:"env-file,omitempty"`
 	// If EnvParent is true, we will prepend all of our Patrol environment variables to the execution of our process.
 	EnvParent bool `json:"env-parent,omitempty"`
 	// These options are only available when you extend Patrol as a library
@@ -141,17 +181,27 @@ type ConfigApp struct {
 	Stderr io.Writer `json:"-"`
 	// Merge Stdout and Stderr into a single file?
 	StdMerge bool `json:"std-merge,omitempty"`
+	// CrashTail is an optional number of lines of our Stdout and our Stderr that we will keep in memory, up to APP_CRASH_TAIL_MAX
+	// If our App closes unexpectedly, our last lines are saved to our History as StdoutTail and StderrTail
+	// Patrol will own the pipes of our Stdout and Stderr, our output is still written to our logs or to Stdout and Stderr
+	// If Patrol exits, our App will receive SIGPIPE once it writes to our pipes!
+	// A Value of 0 will disable this.
+	CrashTail int `json:"crash-tail,omitempty"`
 	// ExtraFiles specifies additional open files to be inherited by the
 	// new process. It does not include standard input, standard output, or
 	// standard error. If non-nil, entry i becomes file descriptor 3+i.
 	ExtraFiles func(
 		id string,
 	) []*os.File `json:"-"`
-	// TriggerStart is called from tick in runApps() before we attempt to execute an App.
+	// TriggerOptions are how each of our Triggers are called, our keys are our Trigger names such as TRIGGER_CLOSED
+	// Triggers without options are called inline and waited on, every Trigger is recovered if it panics
+	// TriggerOptions are only available when you extend Patrol as a library, see App.GetTriggerErrors()
+	TriggerOptions map[string]*TriggerOptions `json:"-"`
+	// TriggerStart is called from tick in runApp() before we attempt to execute an App.
 	TriggerStart func(
 		app *App,
 	) `json:"-"`
-	// TriggerStarted is called from tick in runApps() and isAppRunning()
+	// TriggerStarted is called from tick in runApp() and isAppRunning()
 	// This is called after we either execute a new App or we discover a newly running App.
 	TriggerStarted func(
 		app *App,
@@ -160,7 +210,7 @@ type ConfigApp struct {
 	TriggerStartedPinged func(
 		app *App,
 	) `json:"-"`
-	// TriggerStartFailed is called from tick in runApps() when we fail to execute a new App.
+	// TriggerStartFailed is called from tick in runApp() when we fail to execute a new App.
 	TriggerStartFailed func(
 		app *App,
 	) `json:"-"`
@@ -189,6 +239,11 @@ type ConfigApp struct {
 	) `json:"-"`
 	// Extra Unstructured Data
 	X json.RawMessage `json:"x,omitempty"`
+	// these are resolved by LoadConfig(), see resolveConfig()
+	secret   *string
+	udp_keys map[string]string
+	env_file []string
+	extended bool
 }
 
 func (self *ConfigApp) IsValid() bool {
@@ -202,42 +257,76 @@ func (self *ConfigApp) Clone() *ConfigApp {
 		return nil
 	}
 	o := &ConfigApp{
-		KeepAlive:            self.KeepAlive,
-		Name:                 self.Name,
-		Binary:               self.Binary,
-		WorkingDirectory:     self.WorkingDirectory,
-		LogDirectory:         self.LogDirectory,
-		PIDPath:              self.PIDPath,
-		PIDVerify:            self.PIDVerify,
-		Disabled:             self.Disabled,
-		KeyValue:             make(map[string]interface{}),
-		KeyValueClear:        self.KeyValueClear,
-		Secret:               self.Secret,
-		ExecuteTimeout:       self.ExecuteTimeout,
-		Args:                 make([]string, 0, len(self.Args)),
-		Env:                  make([]string, 0, len(self.Env)),
-		EnvParent:            self.EnvParent,
-		ExtraArgs:            self.ExtraArgs,
-		ExtraEnv:             self.ExtraEnv,
-		Stdin:                self.Stdin,
-		Stdout:               self.Stdout,
-		Stderr:               self.Stderr,
-		StdMerge:             self.StdMerge,
-		ExtraFiles:           self.ExtraFiles,
-		TriggerStart:         self.TriggerStart,
-		TriggerStarted:       self.TriggerStarted,
-		TriggerStartedPinged: self.TriggerStartedPinged,
-		TriggerStartFailed:   self.TriggerStartFailed,
-		TriggerRunning:       self.TriggerRunning,
-		TriggerDisabled:      self.TriggerDisabled,
-		TriggerClosed:        self.TriggerClosed,
-		TriggerPinged:        self.TriggerPinged,
-		TriggerShutdown:      self.TriggerShutdown,
-		X:                    dereference(self.X),
+		Extends:                self.Extends,
+		ExtendsReplace:         make([]string, 0, len(self.ExtendsReplace)),
+		KeepAlive:              self.KeepAlive,
+		CheckEvery:             self.CheckEvery,
+		PingTimeout:            self.PingTimeout,
+		Name:                   self.Name,
+		Binary:                 self.Binary,
+		WorkingDirectory:       self.WorkingDirectory,
+		LogDirectory:           self.LogDirectory,
+		PIDPath:                self.PIDPath,
+		PIDVerify:              self.PIDVerify,
+		Disabled:               self.Disabled,
+		KeyValue:               make(map[string]interface{}),
+		KeyValueClear:          self.KeyValueClear,
+		Secret:                 self.Secret,
+		SecretFile:             self.SecretFile,
+		ClientIdentities:       make([]string, 0, len(self.ClientIdentities)),
+		ClientIdentityRequired: self.ClientIdentityRequired,
+		UDPKeys:                make(map[string]string),
+		ExecuteTimeout:         self.ExecuteTimeout,
+		Args:                   make([]string, 0, len(self.Args)),
+		Env:                    make([]string, 0, len(self.Env)),
+		EnvFile:                self.EnvFile,
+		EnvParent:              self.EnvParent,
+		ExtraArgs:              self.ExtraArgs,
+		ExtraEnv:               self.ExtraEnv,
+		Stdin:                  self.Stdin,
+		Stdout:                 self.Stdout,
+		Stderr:                 self.Stderr,
+		StdMerge:               self.StdMerge,
+		CrashTail:              self.CrashTail,
+		ExtraFiles:             self.ExtraFiles,
+		TriggerOptions:         cloneTriggerOptions(self.TriggerOptions),
+		TriggerStart:           self.TriggerStart,
+		TriggerStarted:         self.TriggerStarted,
+		TriggerStartedPinged:   self.TriggerStartedPinged,
+		TriggerStartFailed:     self.TriggerStartFailed,
+		TriggerRunning:         self.TriggerRunning,
+		TriggerDisabled:        self.TriggerDisabled,
+		TriggerClosed:          self.TriggerClosed,
+		TriggerPinged:          self.TriggerPinged,
+		TriggerShutdown:        self.TriggerShutdown,
+		X:                      dereference(self.X),
+		secret:                 self.secret,
+		extended:               self.extended,
+	}
+	for _, k := range self.ExtendsReplace {
+		o.ExtendsReplace = append(o.ExtendsReplace, k)
 	}
 	for k, v := range self.KeyValue {
 		o.KeyValue[k] = v
 	}
+	if self.udp_keys != nil {
+		o.udp_keys = make(map[string]string)
+		for k, v := range self.udp_keys {
+			o.udp_keys[k] = v
+		}
+	}
+	if self.env_file != nil {
+		o.env_file = make([]string, 0, len(self.env_file))
+		for _, e := range self.env_file {
+			o.env_file = append(o.env_file, e)
+		}
+	}
+	for _, i := range self.ClientIdentities {
+		o.ClientIdentities = append(o.ClientIdentities, i)
+	}
+	for k, v := range self.UDPKeys {
+		o.UDPKeys[k] = v
+	}
 	for _, a := range self.Args {
 		o.Args = append(o.Args, a)
 	}
@@ -264,56 +353,115 @@ func (self *ConfigApp) Clone() *ConfigApp {
 	}
 	return o
 }
+
+// getSecret will return our resolved Secret if it was interpolated or read from our SecretFile
+func (self *ConfigApp) getSecret() string {
+	if self.secret != nil {
+		return *self.secret
+	}
+	return self.Secret
+}
+
+// getUDPKeys will return our resolved UDPKeys if any were interpolated
+func (self *ConfigApp) getUDPKeys() map[string]string {
+	if self.udp_keys != nil {
+		return self.udp_keys
+	}
+	return self.UDPKeys
+}
+
+// Validate will return the sentinel error of our first invalid field
 func (self *ConfigApp) Validate() error {
+	return self.ValidateAll().first()
+}
+
+// ValidateAll will return every invalid field, our ID is set by Config.ValidateAll()
+func (self *ConfigApp) ValidateAll() ValidationErrors {
+	v := &validation{
+		group: VALIDATION_GROUP_APP,
+	}
 	if self.KeepAlive < APP_KEEPALIVE_PID_PATROL ||
 		self.KeepAlive > APP_KEEPALIVE_UDP {
 		// unknown keep alive value
-		return ERR_APP_KEEPALIVE_INVALID
+		v.add("keepalive", self.KeepAlive, ERR_APP_KEEPALIVE_INVALID)
 	}
 	if self.Name == "" {
-		return ERR_APP_NAME_EMPTY
-	}
-	if len(self.Name) > APP_NAME_MAXLENGTH {
-		return ERR_APP_NAME_MAXLENGTH
+		v.add("name", self.Name, ERR_APP_NAME_EMPTY)
+	} else if len(self.Name) > APP_NAME_MAXLENGTH {
+		v.add("name", self.Name, ERR_APP_NAME_MAXLENGTH)
 	}
 	if self.WorkingDirectory == "" {
-		return ERR_APP_WORKINGDIRECTORY_EMPTY
-	}
-	if self.WorkingDirectory[0] != '/' {
+		v.add("working-directory", self.WorkingDirectory, ERR_APP_WORKINGDIRECTORY_EMPTY)
+	} else if self.WorkingDirectory[0] != '/' {
 		// working directory can not be relative
 		// we require that it is absolute, so that other paths may be relative to it
-		return ERR_APP_WORKINGDIRECTORY_RELATIVE
-	}
-	if !IsPathClean(self.WorkingDirectory) {
-		return ERR_APP_WORKINGDIRECTORY_UNCLEAN
+		v.add("working-directory", self.WorkingDirectory, ERR_APP_WORKINGDIRECTORY_RELATIVE)
+	} else if !IsPathClean(self.WorkingDirectory) {
+		v.add("working-directory", self.WorkingDirectory, ERR_APP_WORKINGDIRECTORY_UNCLEAN)
 	}
 	if self.Binary == "" {
-		return ERR_APP_BINARY_EMPTY
-	}
-	if !IsPathClean(self.Binary) {
-		return ERR_APP_BINARY_UNCLEAN
+		v.add("binary", self.Binary, ERR_APP_BINARY_EMPTY)
+	} else if !IsPathClean(self.Binary) {
+		v.add("binary", self.Binary, ERR_APP_BINARY_UNCLEAN)
 	}
 	if self.LogDirectory == "" {
-		return ERR_APP_LOGDIRECTORY_EMPTY
-	}
-	if !IsPathClean(self.LogDirectory) {
-		return ERR_APP_LOGDIRECTORY_UNCLEAN
+		v.add("log-directory", self.LogDirectory, ERR_APP_LOGDIRECTORY_EMPTY)
+	} else if !IsPathClean(self.LogDirectory) {
+		v.add("log-directory", self.LogDirectory, ERR_APP_LOGDIRECTORY_UNCLEAN)
 	}
 	if self.KeepAlive == APP_KEEPALIVE_PID_PATROL ||
 		self.KeepAlive == APP_KEEPALIVE_PID_APP {
 		// PID is required
 		if self.PIDPath == "" {
-			return ERR_APP_PIDPATH_EMPTY
+			v.add("pid-path", self.PIDPath, ERR_APP_PIDPATH_EMPTY)
+		} else if !IsPathClean(self.PIDPath) {
+			v.add("pid-path", self.PIDPath, ERR_APP_PIDPATH_UNCLEAN)
 		}
-		if !IsPathClean(self.PIDPath) {
-			return ERR_APP_PIDPATH_UNCLEAN
+	}
+	if len(self.getSecret()) > SECRET_MAX_LENGTH {
+		// we will never return our secret
+		v.add("secret", nil, ERR_SECRET_TOOLONG)
+	}
+	if self.SecretFile != "" {
+		if self.Secret != "" {
+			v.add("secret-file", self.SecretFile, ERR_SECRET_FILE_CONFLICT)
+		} else if self.secret == nil {
+			v.add("secret-file", self.SecretFile, ERR_SECRET_FILE_UNLOADED)
 		}
 	}
-	if len(self.Secret) > SECRET_MAX_LENGTH {
-		return ERR_SECRET_TOOLONG
+	if err := validateClientIdentities(self.ClientIdentities, self.ClientIdentityRequired); err != nil {
+		v.add("client-identities", self.ClientIdentities, err)
+	}
+	for k, key := range self.getUDPKeys() {
+		// our value is our key ID, we will never return our key
+		if k == "" ||
+			len(k) > UDP_ENVELOPE_KEY_ID_MAX_LENGTH {
+			v.add("udp-keys", k, ERR_APP_UDPKEY_ID_INVALID)
+		} else if key == "" ||
+			len(key) > SECRET_MAX_LENGTH {
+			v.add("udp-keys", k, ERR_APP_UDPKEY_INVALID)
+		}
 	}
 	if self.ExecuteTimeout < 0 {
-		return ERR_APP_EXECUTETIMEOUT_INVALID
+		v.add("execute-timeout", self.ExecuteTimeout, ERR_APP_EXECUTETIMEOUT_INVALID)
+	}
+	if self.CheckEvery < 0 {
+		v.add("check-every", self.CheckEvery, ERR_APP_CHECKEVERY_INVALID)
+	}
+	if self.PingTimeout < 0 {
+		v.add("ping-timeout", self.PingTimeout, ERR_APP_PINGTIMEOUT_INVALID)
+	}
+	if self.CrashTail < 0 ||
+		self.CrashTail > APP_CRASH_TAIL_MAX {
+		v.add("crash-tail", self.CrashTail, ERR_APP_CRASHTAIL_INVALID)
+	}
+	if self.EnvFile != "" &&
+		self.env_file == nil {
+		v.add("env-file", self.EnvFile, ERR_ENV_FILE_UNLOADED)
+	}
+	if self.Extends != "" &&
+		!self.extended {
+		v.add("extends", self.Extends, ERR_EXTENDS_UNRESOLVED)
 	}
-	return nil
+	return v.errors
 }
@@ -0,0 +1,270 @@
+package patrol
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	CHECK_LEVEL_ERROR   = "error"
+	CHECK_LEVEL_WARNING = "warning"
+	// CHECK_SCRIPT_MAX_LENGTH is how many bytes of a script we will read while looking for a fork
+	CHECK_SCRIPT_MAX_LENGTH = 65536
+)
+
+// these arguments are commonly used to ask a process to daemonize
+var check_fork_args = []string{
+	"-d",
+	"-daemon",
+	"--daemon",
+	"--daemonize",
+	"--fork",
+	"--background",
+}
+
+// CheckResult is a single problem found by Config.Check()
+type CheckResult struct {
+	// Path is the JSON path of our problem, ie: `apps.testapp.pid-path`
+	Path string `json:"path,omitempty"`
+	// Level is either CHECK_LEVEL_ERROR or CHECK_LEVEL_WARNING
+	Level   string `json:"level,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+func (self *CheckResult) IsError() bool {
+	return self.Level == CHECK_LEVEL_ERROR
+}
+func (self *CheckResult) String() string {
+	if self.Path == "" {
+		return fmt.Sprintf("%s: %s", self.Level, self.Message)
+	}
+	return fmt.Sprintf("%s: %s: %s", self.Level, self.Path, self.Message)
+}
+
+type config_check struct {
+	results []*CheckResult
+}
+
+func (self *config_check) error(
+	path string,
+	format string,
+	a ...interface{},
+) {
+	self.results = append(self.results, &CheckResult{
+		Path:    path,
+		Level:   CHECK_LEVEL_ERROR,
+		Message: fmt.Sprintf(format, a...),
+	})
+}
+func (self *config_check) warning(
+	path string,
+	format string,
+	a ...interface{},
+) {
+	self.results = append(self.results, &CheckResult{
+		Path:    path,
+		Level:   CHECK_LEVEL_WARNING,
+		Message: fmt.Sprintf(format, a...),
+	})
+}
+
+// Check will report every problem with our config and our environment, unlike Validate() which stops at our first error
+// Binaries, Working Directories and TLS files must exist, and our listen addresses must parse
+// Risky setups, such as APP_KEEPALIVE_PID_PATROL Apps that are likely to fork, are reported as warnings
+// Our config is not modified
+func (self *Config) Check() []*CheckResult {
+	c := &config_check{}
+	if self == nil {
+		c.error("", "%s", ERR_CONFIG_NIL)
+		return c.results
+	}
+	// every path and group with a validation error
+	// we won't check our filesystem or listeners if their config is invalid
+	invalid := make(map[string]bool)
+	for _, e := range self.ValidateAll() {
+		c.error(e.Path(), "%s", e.Rule)
+		invalid[e.Path()] = true
+		invalid[e.Group] = true
+	}
+	for _, id := range sortedKeys(self.Apps) {
+		path := "apps." + id
+		if invalid[path] ||
+			invalid[path+".working-directory"] ||
+			invalid[path+".binary"] {
+			continue
+		}
+		// dereference, this will also expand our working directory
+		c.checkApp(path, self.Apps[id].Clone())
+	}
+	for i, l := range self.ListenHTTP {
+		c.checkAddress(fmt.Sprintf("listen-http[%d]", i), l)
+	}
+	for i, l := range self.ListenUDP {
+		c.checkAddress(fmt.Sprintf("listen-udp[%d]", i), l)
+	}
+	if self.HTTP.IsValid() &&
+		!invalid[VALIDATION_GROUP_HTTP] {
+		c.checkHTTP(self.HTTP, len(self.Tokens) > 0)
+	}
+	if self.UDP.IsValid() &&
+		!invalid[VALIDATION_GROUP_UDP] &&
+		!IsListenUnix(self.UDP.Listen) &&
+		self.UDP.Listen != "" {
+		c.checkAddress("udp.listen", self.UDP.Listen)
+	}
+	return c.results
+}
+func (self *config_check) checkApp(
+	path string,
+	app *ConfigApp,
+) {
+	if app.PingTimeout > 0 &&
+		app.KeepAlive != APP_KEEPALIVE_HTTP &&
+		app.KeepAlive != APP_KEEPALIVE_UDP {
+		self.warning(path+".ping-timeout", "ping-timeout is ignored, our App is not pinged with keepalive \"%s\"", app.KeepAlive)
+	}
+	if app.CrashTail > 0 &&
+		app.KeepAlive != APP_KEEPALIVE_PID_PATROL {
+		self.warning(path+".crash-tail", "our App's output is piped through Patrol, if our App outlives Patrol it will receive SIGPIPE once it writes to Stdout or Stderr")
+	}
+	if fi, err := os.Stat(app.WorkingDirectory); err != nil {
+		self.error(path+".working-directory", "%s", err)
+		// our binary can't exist
+		return
+	} else if !fi.IsDir() {
+		self.error(path+".working-directory", "\"%s\" is not a directory", app.WorkingDirectory)
+		return
+	}
+	binary := filepath.Clean(app.WorkingDirectory + "/" + app.Binary)
+	fi, err := os.Stat(binary)
+	if err != nil {
+		self.error(path+".binary", "%s", err)
+		return
+	}
+	if fi.IsDir() {
+		self.error(path+".binary", "\"%s\" is a directory", binary)
+		return
+	}
+	if fi.Mode()&0111 == 0 {
+		self.error(path+".binary", "\"%s\" is not executable", binary)
+		return
+	}
+	if app.KeepAlive == APP_KEEPALIVE_PID_PATROL {
+		if reason := checkFork(binary, app.Args); reason != "" {
+			self.warning(path+".keepalive", "PID_PATROL Apps must not fork, %s, use PID_APP if our App forks", reason)
+		}
+	}
+}
+
+// checkFork will return why our App is likely to fork, otherwise an empty string
+// this is only a guess, we check our Args and the contents of shell scripts
+func checkFork(
+	binary string,
+	args []string,
+) string {
+	for _, arg := range args {
+		for _, a := range check_fork_args {
+			if arg == a {
+				return fmt.Sprintf("argument \"%s\" is commonly used to daemonize", arg)
+			}
+		}
+	}
+	f, err := os.Open(binary)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(io.LimitReader(f, CHECK_SCRIPT_MAX_LENGTH))
+	for line := 0; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if line == 0 &&
+			!strings.HasPrefix(text, "#!") {
+			// we're only going to read scripts
+			return ""
+		}
+		if strings.HasPrefix(text, "#") {
+			continue
+		}
+		if strings.HasSuffix(text, "&") &&
+			!strings.HasSuffix(text, "&&") {
+			return fmt.Sprintf("script runs a background command on line %d", line+1)
+		}
+		for _, command := range []string{"nohup", "setsid", "daemon", "start-stop-daemon"} {
+			if text == command ||
+				strings.HasPrefix(text, command+" ") ||
+				strings.Contains(text, " "+command+" ") {
+				return fmt.Sprintf("script calls \"%s\" on line %d", command, line+1)
+			}
+		}
+	}
+	return ""
+}
+
+func (self *config_check) checkAddress(
+	path string,
+	address string,
+) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		self.error(path, "%s", err)
+		return
+	}
+	if p, err := strconv.ParseUint(port, 10, 16); err != nil ||
+		p == 0 {
+		self.error(path, "port \"%s\" was invalid", port)
+		return
+	}
+	if host != "" &&
+		net.ParseIP(host) == nil {
+		// a hostname is allowed, but it has to resolve when we listen
+		if _, err := net.LookupHost(host); err != nil {
+			self.error(path, "%s", err)
+		}
+	}
+}
+func (self *config_check) checkHTTP(
+	config *ConfigHTTP,
+	tokens bool,
+) {
+	for _, f := range []struct {
+		field string
+		path  string
+	}{
+		{"tls-cert", config.TLSCert},
+		{"tls-key", config.TLSKey},
+		{"tls-client-ca", config.TLSClientCA},
+	} {
+		if f.path == "" {
+			continue
+		}
+		if _, err := os.Stat(f.path); err != nil {
+			self.error("http."+f.field, "%s", err)
+		}
+	}
+	if config.Listen == "" ||
+		IsListenUnix(config.Listen) {
+		return
+	}
+	self.checkAddress("http.listen", config.Listen)
+	if config.IsTLS() {
+		return
+	}
+	host, _, err := net.SplitHostPort(config.Listen)
+	if err != nil {
+		return
+	}
+	if ip := net.ParseIP(host); ip == nil ||
+		!ip.IsLoopback() {
+		if tokens {
+			self.warning("http.listen", "HTTP is not loopback and TLS is not configured, our Tokens and Secrets are sent in clear text")
+		} else {
+			self.warning("http.listen", "HTTP is not loopback and TLS is not configured, our Secrets are sent in clear text")
+		}
+	}
+}
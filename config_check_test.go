@@ -0,0 +1,121 @@
+package patrol
+
+import (
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sabey.co/unittest"
+	"testing"
+)
+
+func TestConfigCheck(t *testing.T) {
+	log.Println("TestConfigCheck")
+
+	dir, err := ioutil.TempDir("", "patrol-check")
+	unittest.IsNil(t, err)
+	defer os.RemoveAll(dir)
+	unittest.IsNil(t, ioutil.WriteFile(filepath.Join(dir, "app"), []byte("#!/bin/sh\nexec sleep 100\n"), 0755))
+	unittest.IsNil(t, ioutil.WriteFile(filepath.Join(dir, "forks"), []byte("#!/bin/sh\n# sleep 100 &\nnohup sleep 100\n"), 0755))
+	unittest.IsNil(t, ioutil.WriteFile(filepath.Join(dir, "data"), []byte("data"), 0644))
+
+	unittest.Equals(t, (*Config)(nil).Check(), []*CheckResult{
+		&CheckResult{Level: CHECK_LEVEL_ERROR, Message: ERR_CONFIG_NIL.Error()},
+	})
+
+	app := func(binary string) *ConfigApp {
+		return &ConfigApp{
+			KeepAlive:        APP_KEEPALIVE_PID_PATROL,
+			Name:             binary,
+			Binary:           binary,
+			WorkingDirectory: dir,
+			LogDirectory:     "logs",
+			PIDPath:          "app.pid",
+		}
+	}
+	config := &Config{
+		Apps: map[string]*ConfigApp{
+			"app": app("app"),
+		},
+		Services: map[string]*ConfigService{
+			"ssh": &ConfigService{
+				Management: SERVICE_MANAGEMENT_SERVICE,
+				Name:       "SSH",
+				Service:    "ssh",
+			},
+		},
+		ListenHTTP: []string{"127.0.0.1:8421"},
+	}
+	unittest.Equals(t, len(config.Check()), 0)
+
+	// every problem is reported
+	config.Apps["no-pid"] = app("app")
+	config.Apps["no-pid"].PIDPath = ""
+	config.Apps["no-pid"].Binary = "missing"
+	config.Apps["missing"] = app("missing")
+	config.Apps["data"] = app("data")
+	config.Apps["forks"] = app("forks")
+	config.Apps["daemon"] = app("app")
+	config.Apps["daemon"].Args = []string{"--daemon"}
+	config.Apps["app"].PingTimeout = 10
+	config.Apps["tail"] = app("app")
+	config.Apps["tail"].KeepAlive = APP_KEEPALIVE_PID_APP
+	config.Apps["tail"].CrashTail = 10
+	config.Apps["nowd"] = app("app")
+	config.Apps["nowd"].WorkingDirectory = filepath.Join(dir, "missing")
+	config.Services["ssh"].Name = ""
+	config.ListenHTTP = []string{"127.0.0.1:http", "127.0.0.1"}
+	config.ListenUnix = []string{"unix:relative"}
+	config.HTTP = &ConfigHTTP{
+		Listen:  "0.0.0.0:8421",
+		TLSCert: filepath.Join(dir, "cert.pem"),
+	}
+	config.Tokens = []*ConfigToken{
+		nil,
+	}
+
+	paths := make(map[string]string)
+	for _, r := range config.Check() {
+		paths[r.Path] = r.Level
+	}
+	unittest.Equals(t, paths, map[string]string{
+		"apps.app.ping-timeout":       CHECK_LEVEL_WARNING,
+		"apps.tail.crash-tail":        CHECK_LEVEL_WARNING,
+		"apps.daemon.keepalive":       CHECK_LEVEL_WARNING,
+		"apps.data.binary":            CHECK_LEVEL_ERROR,
+		"apps.forks.keepalive":        CHECK_LEVEL_WARNING,
+		"apps.missing.binary":         CHECK_LEVEL_ERROR,
+		"apps.no-pid.pid-path":        CHECK_LEVEL_ERROR,
+		"apps.no-pid.binary":          CHECK_LEVEL_ERROR,
+		"apps.nowd.working-directory": CHECK_LEVEL_ERROR,
+		"services.ssh.name":           CHECK_LEVEL_ERROR,
+		"listen-http[0]":              CHECK_LEVEL_ERROR,
+		"listen-http[1]":              CHECK_LEVEL_ERROR,
+		"listen-unix[0]":              CHECK_LEVEL_ERROR,
+		"http.tls-cert":               CHECK_LEVEL_ERROR,
+		"tokens[0]":                   CHECK_LEVEL_ERROR,
+	})
+
+	// our config was not modified
+	unittest.Equals(t, config.Apps["no-pid"].PIDPath, "")
+
+	// clear text
+	config = &Config{
+		Apps: map[string]*ConfigApp{
+			"app": app("app"),
+		},
+		HTTP: &ConfigHTTP{
+			Listen: "0.0.0.0:8421",
+		},
+	}
+	results := config.Check()
+	unittest.Equals(t, len(results), 1)
+	unittest.Equals(t, results[0].Path, "http.listen")
+	unittest.Equals(t, results[0].IsError(), false)
+
+	// our fork heuristics
+	forks := filepath.Join(dir, "forks")
+	unittest.Equals(t, checkFork(forks, nil), "script calls \"nohup\" on line 3")
+	unittest.Equals(t, checkFork(filepath.Join(dir, "app"), nil), "")
+	unittest.Equals(t, checkFork(filepath.Join(dir, "app"), []string{"-d"}), "argument \"-d\" is commonly used to daemonize")
+}
@@ -0,0 +1,382 @@
+package patrol
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+var (
+	ERR_CONFIG_VARIABLE_UNSET   = fmt.Errorf("Config Variable was not set")
+	ERR_CONFIG_VARIABLE_INVALID = fmt.Errorf("Config Variable was invalid")
+	ERR_SECRET_FILE_EMPTY       = fmt.Errorf("Secret File was empty")
+	ERR_SECRET_FILE_CONFLICT    = fmt.Errorf("Secret and Secret File were both set")
+	ERR_SECRET_FILE_UNLOADED    = fmt.Errorf("Secret File was not loaded, use LoadConfig()")
+	ERR_ENV_FILE_INVALID        = fmt.Errorf("Env File was invalid")
+	ERR_ENV_FILE_UNLOADED       = fmt.Errorf("Env File was not loaded, use LoadConfig()")
+)
+
+// these keys are never interpolated in place
+// secrets are resolved into our unexported fields so that they're never echoed back by GetConfig() or our API
+// keyvalue and x are our data and not our config
+var interpolate_skip = map[string]bool{
+	"secret":   true,
+	"udp-keys": true,
+	"keyvalue": true,
+	"x":        true,
+}
+
+// ConfigValueError is returned by LoadConfig when a value can't be interpolated or a file can't be read
+type ConfigValueError struct {
+	// Path is the JSON path of our value, ie: `apps.testapp.env[0]`
+	Path string
+	// Value is our variable name or file path, secrets are never included
+	Value string
+	Err   error
+}
+
+func (self *ConfigValueError) Error() string {
+	return fmt.Sprintf("%s: %s: \"%s\"", self.Path, self.Err, self.Value)
+}
+func (self *ConfigValueError) Unwrap() error {
+	return self.Err
+}
+
+// interpolate will expand every `${VAR}` and `${VAR:-default}` within s
+// `${VAR:-default}` will use our default if VAR is unset or empty
+// `$${` is an escaped `${`
+func interpolate(
+	s string,
+) (
+	string,
+	error,
+) {
+	if !strings.Contains(s, "${") {
+		return s, nil
+	}
+	b := &strings.Builder{}
+	for {
+		i := strings.Index(s, "${")
+		if i < 0 {
+			b.WriteString(s)
+			return b.String(), nil
+		}
+		if i > 0 && s[i-1] == '$' {
+			// escaped
+			b.WriteString(s[:i-1])
+			b.WriteString("${")
+			s = s[i+2:]
+			continue
+		}
+		b.WriteString(s[:i])
+		s = s[i+2:]
+		j := strings.Index(s, "}")
+		if j < 0 {
+			return "", &ConfigValueError{
+				Value: s,
+				Err:   ERR_CONFIG_VARIABLE_INVALID,
+			}
+		}
+		name := s[:j]
+		s = s[j+1:]
+		def := ""
+		has_def := false
+		if k := strings.Index(name, ":-"); k > -1 {
+			def = name[k+2:]
+			name = name[:k]
+			has_def = true
+		}
+		if !isVariableName(name) {
+			return "", &ConfigValueError{
+				Value: name,
+				Err:   ERR_CONFIG_VARIABLE_INVALID,
+			}
+		}
+		value, ok := os.LookupEnv(name)
+		if has_def && value == "" {
+			value = def
+		} else if !ok {
+			return "", &ConfigValueError{
+				Value: name,
+				Err:   ERR_CONFIG_VARIABLE_UNSET,
+			}
+		}
+		b.WriteString(value)
+	}
+}
+
+// isVariableName will return true if name is a valid environment variable name: ( 0-9 A-Z a-z _ )
+// names may not start with a number
+func isVariableName(
+	name string,
+) bool {
+	if name == "" {
+		return false
+	}
+	for i, c := range name {
+		if c == '_' ||
+			(c >= 'A' && c <= 'Z') ||
+			(c >= 'a' && c <= 'z') ||
+			(i > 0 && c >= '0' && c <= '9') {
+			continue
+		}
+		return false
+	}
+	return true
+}
+
+// interpolateConfig will interpolate every string value of our JSON config in place
+// our secrets are skipped, see resolveConfig()
+func interpolateConfig(
+	body []byte,
+) (
+	[]byte,
+	error,
+) {
+	if !bytes.Contains(body, []byte("${")) {
+		// nothing to interpolate, our body is returned as is
+		return body, nil
+	}
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	// our numbers must not be converted to float64
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+	value, err := interpolateValue("", value)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(value)
+}
+func interpolateValue(
+	path string,
+	value interface{},
+) (
+	interface{},
+	error,
+) {
+	switch v := value.(type) {
+	case string:
+		s, err := interpolate(v)
+		if err != nil {
+			err.(*ConfigValueError).Path = path
+			return nil, err
+		}
+		return s, nil
+	case map[string]interface{}:
+		for k, e := range v {
+			if interpolate_skip[k] {
+				continue
+			}
+			p := k
+			if path != "" {
+				p = path + "." + k
+			}
+			e, err := interpolateValue(p, e)
+			if err != nil {
+				return nil, err
+			}
+			v[k] = e
+		}
+	case []interface{}:
+		for i, e := range v {
+			e, err := interpolateValue(fmt.Sprintf("%s[%d]", path, i), e)
+			if err != nil {
+				return nil, err
+			}
+			v[i] = e
+		}
+	}
+	return value, nil
+}
+
+// resolveConfig will resolve the secrets and env files of our Apps, Services and Webhooks
+// relative files are relative to dir, the directory of the config file that defined them
+// our templates have already been merged by extendConfig(), they're only marked as extended here
+// secrets are stored unexported, our exported Secret and UDPKeys remain as they were written
+func resolveConfig(
+	config *Config,
+	dir string,
+) error {
+	for id, app := range config.Apps {
+		if !app.IsValid() {
+			// Validate() will report this
+			continue
+		}
+		app.extended = app.Extends != ""
+		path := "apps." + id
+		secret, err := resolveSecret(path, app.Secret, app.SecretFile, dir)
+		if err != nil {
+			return err
+		}
+		app.secret = secret
+		for k, key := range app.UDPKeys {
+			if !strings.Contains(key, "${") {
+				continue
+			}
+			key, err := interpolate(key)
+			if err != nil {
+				err.(*ConfigValueError).Path = path + ".udp-keys." + k
+				return err
+			}
+			if app.udp_keys == nil {
+				app.udp_keys = make(map[string]string)
+				for k, v := range app.UDPKeys {
+					app.udp_keys[k] = v
+				}
+			}
+			app.udp_keys[k] = key
+		}
+		if app.EnvFile != "" {
+			env, line, err := readEnvFile(resolvePath(dir, app.EnvFile))
+			if err != nil {
+				value := app.EnvFile
+				if line > 0 {
+					// our line number is included with our file
+					value = fmt.Sprintf("%s:%d", app.EnvFile, line)
+				}
+				return &ConfigValueError{
+					Path:  path + ".env-file",
+					Value: value,
+					Err:   err,
+				}
+			}
+			app.env_file = env
+		}
+	}
+	for id, service := range config.Services {
+		if !service.IsValid() {
+			continue
+		}
+		service.extended = service.Extends != ""
+		secret, err := resolveSecret("services."+id, service.Secret, service.SecretFile, dir)
+		if err != nil {
+			return err
+		}
+		service.secret = secret
+	}
+	for i, webhook := range config.Webhooks {
+		if !webhook.IsValid() {
+			continue
+		}
+		secret, err := resolveSecret(fmt.Sprintf("webhooks[%d]", i), webhook.Secret, webhook.SecretFile, dir)
+		if err != nil {
+			return err
+		}
+		webhook.secret = secret
+	}
+	return nil
+}
+
+// resolveSecret will return nil if our secret was not interpolated or read from a file
+func resolveSecret(
+	path string,
+	secret string,
+	secret_file string,
+	dir string,
+) (
+	*string,
+	error,
+) {
+	if secret_file != "" {
+		if secret != "" {
+			// Validate() will report ERR_SECRET_FILE_CONFLICT
+			return nil, nil
+		}
+		body, err := ioutil.ReadFile(resolvePath(dir, secret_file))
+		if err != nil {
+			return nil, &ConfigValueError{
+				Path:  path + ".secret-file",
+				Value: secret_file,
+				Err:   err,
+			}
+		}
+		// a trailing newline is never part of our secret
+		secret = strings.TrimRight(string(body), "\r\n")
+		if secret == "" {
+			return nil, &ConfigValueError{
+				Path:  path + ".secret-file",
+				Value: secret_file,
+				Err:   ERR_SECRET_FILE_EMPTY,
+			}
+		}
+		return &secret, nil
+	}
+	if !strings.Contains(secret, "${") {
+		return nil, nil
+	}
+	secret, err := interpolate(secret)
+	if err != nil {
+		err.(*ConfigValueError).Path = path + ".secret"
+		return nil, err
+	}
+	return &secret, nil
+}
+func resolvePath(
+	dir string,
+	path string,
+) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(dir, path)
+}
+
+// readEnvFile will read a dotenv file as a list of `KEY=value`
+//
+// Blank lines and lines starting with `#` are ignored, and `export ` prefixes are removed
+// Double quoted values may contain the escapes `\n`, `\"` and `\\`, single quoted values are literal
+// Unquoted values are trimmed and may end with a ` #` comment
+// If a line is invalid our line number is returned with ERR_ENV_FILE_INVALID
+func readEnvFile(
+	path string,
+) (
+	[]string,
+	int,
+	error,
+) {
+	body, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	env := []string{}
+	for i, line := range strings.Split(string(body), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" ||
+			strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+		j := strings.Index(line, "=")
+		if j < 0 {
+			return nil, i + 1, ERR_ENV_FILE_INVALID
+		}
+		key := strings.TrimSpace(line[:j])
+		if !isVariableName(key) {
+			return nil, i + 1, ERR_ENV_FILE_INVALID
+		}
+		value := strings.TrimSpace(line[j+1:])
+		if len(value) > 1 &&
+			value[0] == '"' &&
+			value[len(value)-1] == '"' {
+			if value, err = strconv.Unquote(value); err != nil {
+				return nil, i + 1, ERR_ENV_FILE_INVALID
+			}
+		} else if len(value) > 1 &&
+			value[0] == '\'' &&
+			value[len(value)-1] == '\'' {
+			value = value[1 : len(value)-1]
+		} else if k := strings.Index(value, " #"); k > -1 {
+			value = strings.TrimSpace(value[:k])
+		}
+		env = append(env, key+"="+value)
+	}
+	return env, 0, nil
+}
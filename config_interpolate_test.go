@@ -0,0 +1,248 @@
+package patrol
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sabey.co/unittest"
+	"strings"
+	"testing"
+)
+
+func TestInterpolate(t *testing.T) {
+	log.Println("TestInterpolate")
+
+	os.Setenv("PATROL_TEST_VAR", "value")
+	os.Setenv("PATROL_TEST_EMPTY", "")
+	os.Unsetenv("PATROL_TEST_UNSET")
+	defer os.Unsetenv("PATROL_TEST_VAR")
+	defer os.Unsetenv("PATROL_TEST_EMPTY")
+
+	for s, expected := range map[string]string{
+		"":                   "",
+		"plain $ text":       "plain $ text",
+		"${PATROL_TEST_VAR}": "value",
+		"a-${PATROL_TEST_VAR}-${PATROL_TEST_VAR}": "a-value-value",
+		"${PATROL_TEST_EMPTY}":                    "",
+		"${PATROL_TEST_EMPTY:-default}":           "default",
+		"${PATROL_TEST_UNSET:-default}":           "default",
+		"${PATROL_TEST_UNSET:-}":                  "",
+		"${PATROL_TEST_VAR:-default}":             "value",
+		"$${PATROL_TEST_VAR}":                     "${PATROL_TEST_VAR}",
+		"$$${PATROL_TEST_VAR}":                    "$${PATROL_TEST_VAR}",
+	} {
+		v, err := interpolate(s)
+		unittest.IsNil(t, err)
+		unittest.Equals(t, v, expected)
+	}
+	_, err := interpolate("${PATROL_TEST_UNSET}")
+	unittest.Equals(t, err, &ConfigValueError{Value: "PATROL_TEST_UNSET", Err: ERR_CONFIG_VARIABLE_UNSET})
+	_, err = interpolate("${PATROL_TEST_VAR")
+	unittest.Equals(t, err.(*ConfigValueError).Err, ERR_CONFIG_VARIABLE_INVALID)
+	_, err = interpolate("${1VAR}")
+	unittest.Equals(t, err, &ConfigValueError{Value: "1VAR", Err: ERR_CONFIG_VARIABLE_INVALID})
+	_, err = interpolate("${}")
+	unittest.Equals(t, err, &ConfigValueError{Value: "", Err: ERR_CONFIG_VARIABLE_INVALID})
+}
+
+func TestReadEnvFile(t *testing.T) {
+	log.Println("TestReadEnvFile")
+
+	dir, err := ioutil.TempDir("", "patrol-env")
+	unittest.IsNil(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, ".env")
+
+	unittest.IsNil(t, ioutil.WriteFile(path, []byte(`
+# comment
+A=1
+export B = two words # comment
+C="quoted # not a comment\nnewline"
+D='single $quoted'
+E=
+F=a=b
+`), 0600))
+	env, line, err := readEnvFile(path)
+	unittest.IsNil(t, err)
+	unittest.Equals(t, line, 0)
+	unittest.Equals(t, env, []string{
+		"A=1",
+		"B=two words",
+		"C=quoted # not a comment\nnewline",
+		"D=single $quoted",
+		"E=",
+		"F=a=b",
+	})
+
+	unittest.IsNil(t, ioutil.WriteFile(path, []byte("A=1\n\nnot a variable\n"), 0600))
+	_, line, err = readEnvFile(path)
+	unittest.Equals(t, err, ERR_ENV_FILE_INVALID)
+	unittest.Equals(t, line, 3)
+	unittest.IsNil(t, ioutil.WriteFile(path, []byte("1A=1\n"), 0600))
+	_, line, err = readEnvFile(path)
+	unittest.Equals(t, err, ERR_ENV_FILE_INVALID)
+	unittest.Equals(t, line, 1)
+	_, _, err = readEnvFile(filepath.Join(dir, "missing"))
+	unittest.Equals(t, os.IsNotExist(err), true)
+}
+
+func TestLoadConfigInterpolate(t *testing.T) {
+	log.Println("TestLoadConfigInterpolate")
+
+	dir, err := ioutil.TempDir("", "patrol-interpolate")
+	unittest.IsNil(t, err)
+	defer os.RemoveAll(dir)
+	write := func(name string, body string) string {
+		path := filepath.Join(dir, name)
+		unittest.IsNil(t, os.MkdirAll(filepath.Dir(path), 0755))
+		unittest.IsNil(t, ioutil.WriteFile(path, []byte(body), 0600))
+		return path
+	}
+	os.Setenv("PATROL_TEST_DIR", "/testapp")
+	os.Setenv("PATROL_TEST_SECRET", "variable-secret")
+	defer os.Unsetenv("PATROL_TEST_DIR")
+	defer os.Unsetenv("PATROL_TEST_SECRET")
+
+	write("secrets/app", "file-secret\n")
+	write("secrets/empty", "\n")
+	write("app.env", "DB_PASSWORD=hunter2\nSHARED=env-file\n")
+	path := write("config.json", `{
+	"apps": {
+		"app": {
+			"keepalive": 1,
+			"name": "${PATROL_TEST_NAME:-App}",
+			"binary": "testapp",
+			"working-directory": "${PATROL_TEST_DIR}",
+			"log-directory": "logs",
+			"pid-path": "app.pid",
+			"secret-file": "secrets/app",
+			"args": ["-dir", "${PATROL_TEST_DIR}/data", "$${LITERAL}"],
+			"env": ["SHARED=env"],
+			"env-file": "app.env",
+			"keyvalue": {"k": "${PATROL_TEST_DIR}"}
+		},
+		"udp": {
+			"keepalive": 4,
+			"name": "UDP",
+			"binary": "testapp",
+			"working-directory": "/testapp",
+			"log-directory": "logs",
+			"secret": "${PATROL_TEST_SECRET}",
+			"udp-keys": {"key-1": "${PATROL_TEST_SECRET}", "key-2": "literal"}
+		}
+	},
+	"services": {
+		"ssh": {"management": 1, "name": "SSH", "service": "ssh", "secret": "${PATROL_TEST_SECRET:-unused}"}
+	},
+	"listen-udp": ["127.0.0.1:1248"],
+	"webhooks": [
+		{"url": "http://127.0.0.1/", "events": ["app-closed"], "secret-file": "secrets/${PATROL_TEST_FILE:-app}"}
+	]
+}`)
+	config, err := LoadConfig(path)
+	unittest.IsNil(t, err)
+	app := config.Apps["app"]
+	unittest.Equals(t, app.Name, "App")
+	unittest.Equals(t, app.WorkingDirectory, "/testapp")
+	unittest.Equals(t, app.Args, []string{"-dir", "/testapp/data", "${LITERAL}"})
+	// our data is never interpolated
+	unittest.Equals(t, app.KeyValue["k"], "${PATROL_TEST_DIR}")
+	// our secrets are resolved but our exported fields remain as they were written
+	unittest.Equals(t, app.Secret, "")
+	unittest.Equals(t, app.getSecret(), "file-secret")
+	unittest.Equals(t, app.Env, []string{"SHARED=env"})
+	unittest.Equals(t, app.env_file, []string{"DB_PASSWORD=hunter2", "SHARED=env-file"})
+	udp := config.Apps["udp"]
+	unittest.Equals(t, udp.Secret, "${PATROL_TEST_SECRET}")
+	unittest.Equals(t, udp.getSecret(), "variable-secret")
+	unittest.Equals(t, udp.UDPKeys, map[string]string{"key-1": "${PATROL_TEST_SECRET}", "key-2": "literal"})
+	unittest.Equals(t, udp.getUDPKeys(), map[string]string{"key-1": "variable-secret", "key-2": "literal"})
+	unittest.Equals(t, config.Services["ssh"].getSecret(), "variable-secret")
+	unittest.Equals(t, config.Webhooks[0].getSecret(), "file-secret")
+
+	// our resolved secrets are never echoed back
+	patrol, err := CreatePatrol(config)
+	unittest.IsNil(t, err)
+	unittest.Equals(t, patrol.GetApp("app").IsAuthorized("file-secret", nil), true)
+	unittest.Equals(t, patrol.GetApp("app").IsAuthorized("", nil), false)
+	unittest.Equals(t, patrol.GetApp("udp").IsAuthorized("variable-secret", nil), true)
+	unittest.Equals(t, patrol.GetApp("udp").IsAuthorized("${PATROL_TEST_SECRET}", nil), false)
+	unittest.Equals(t, patrol.GetService("ssh").IsAuthorized("variable-secret", nil), true)
+	unittest.Equals(t, patrol.GetApp("app").GetConfig().getSecret(), "file-secret")
+	bs, err := json.Marshal(patrol.GetConfig())
+	unittest.IsNil(t, err)
+	unittest.Equals(t, strings.Contains(string(bs), "file-secret"), false)
+	unittest.Equals(t, strings.Contains(string(bs), "variable-secret"), false)
+	unittest.Equals(t, strings.Contains(string(bs), "hunter2"), false)
+	unittest.Equals(t, patrol.GetApp("app").Snapshot().Secret, true)
+
+	// our secret files and env files are read again when we reload, a file that fails to read modifies nothing
+	config.Reload = func() (*Config, error) {
+		return LoadConfig(path)
+	}
+	patrol, err = CreatePatrol(config)
+	unittest.IsNil(t, err)
+	write("secrets/app", "reloaded-secret\n")
+	write("app.env", "DB_PASSWORD=hunter3\n")
+	unittest.IsNil(t, patrol.Reload())
+	unittest.Equals(t, patrol.GetApp("app").IsAuthorized("file-secret", nil), false)
+	unittest.Equals(t, patrol.GetApp("app").IsAuthorized("reloaded-secret", nil), true)
+	unittest.Equals(t, patrol.GetApp("app").getEnvFile(), []string{"DB_PASSWORD=hunter3"})
+	unittest.Equals(t, patrol.GetConfig().Webhooks[0].getSecret(), "reloaded-secret")
+	write("app.env", "DB_PASSWORD\n")
+	unittest.Equals(t, patrol.Reload(), &ConfigValueError{Path: "apps.app.env-file", Value: "app.env:1", Err: ERR_ENV_FILE_INVALID})
+	unittest.Equals(t, patrol.GetApp("app").getEnvFile(), []string{"DB_PASSWORD=hunter3"})
+	write("secrets/app", "file-secret\n")
+
+	// every error has our JSON path
+	_, err = LoadConfig(write("unset.json", `{"apps": {"app": {"args": ["${PATROL_TEST_UNSET}"]}}}`))
+	unittest.Equals(t, err, &ConfigValueError{Path: "apps.app.args[0]", Value: "PATROL_TEST_UNSET", Err: ERR_CONFIG_VARIABLE_UNSET})
+	_, err = LoadConfig(write("unset.json", `{"apps": {"app": {"secret": "${PATROL_TEST_UNSET}"}}}`))
+	unittest.Equals(t, err, &ConfigValueError{Path: "apps.app.secret", Value: "PATROL_TEST_UNSET", Err: ERR_CONFIG_VARIABLE_UNSET})
+	_, err = LoadConfig(write("unset.json", `{"apps": {"app": {"udp-keys": {"k": "${PATROL_TEST_UNSET}"}}}}`))
+	unittest.Equals(t, err, &ConfigValueError{Path: "apps.app.udp-keys.k", Value: "PATROL_TEST_UNSET", Err: ERR_CONFIG_VARIABLE_UNSET})
+	_, err = LoadConfig(write("empty.json", `{"services": {"ssh": {"secret-file": "secrets/empty"}}}`))
+	unittest.Equals(t, err, &ConfigValueError{Path: "services.ssh.secret-file", Value: "secrets/empty", Err: ERR_SECRET_FILE_EMPTY})
+	_, err = LoadConfig(write("missing.json", `{"webhooks": [{"secret-file": "secrets/missing"}]}`))
+	unittest.Equals(t, os.IsNotExist(err.(*ConfigValueError).Err), true)
+	unittest.Equals(t, err.(*ConfigValueError).Path, "webhooks[0].secret-file")
+	write("bad.env", "A=1\nB\n")
+	_, err = LoadConfig(write("env.json", `{"apps": {"app": {"env-file": "bad.env"}}}`))
+	unittest.Equals(t, err, &ConfigValueError{Path: "apps.app.env-file", Value: "bad.env:2", Err: ERR_ENV_FILE_INVALID})
+	// includes are relative to their own file
+	write("conf.d/app.yaml", "apps:\n  included:\n    secret-file: ../secrets/app\n    name: ${PATROL_TEST_UNSET}\n")
+	_, err = LoadConfig(write("include.json", `{"include": ["conf.d/*"]}`))
+	unittest.Equals(t, err, &ConfigFileError{
+		Path: filepath.Join(dir, "conf.d", "app.yaml"),
+		Err:  &ConfigValueError{Path: "apps.included.name", Value: "PATROL_TEST_UNSET", Err: ERR_CONFIG_VARIABLE_UNSET},
+	})
+	write("conf.d/app.yaml", "apps:\n  included:\n    secret-file: ../secrets/app\n")
+	config, err = LoadConfig(filepath.Join(dir, "include.json"))
+	unittest.IsNil(t, err)
+	unittest.Equals(t, config.Apps["included"].getSecret(), "file-secret")
+
+	// our secret and env files must be loaded by LoadConfig
+	app = &ConfigApp{
+		KeepAlive:        APP_KEEPALIVE_PID_APP,
+		Name:             "App",
+		Binary:           "testapp",
+		WorkingDirectory: "/testapp",
+		LogDirectory:     "logs",
+		PIDPath:          "app.pid",
+		SecretFile:       "secret",
+		EnvFile:          "app.env",
+	}
+	unittest.Equals(t, app.Validate(), ERR_SECRET_FILE_UNLOADED)
+	unittest.Equals(t, len(app.ValidateAll()), 2)
+	unittest.Equals(t, app.ValidateAll()[1].Rule, ERR_ENV_FILE_UNLOADED)
+	app.Secret = "secret"
+	unittest.Equals(t, app.Validate(), ERR_SECRET_FILE_CONFLICT)
+	webhook := &ConfigWebhook{
+		URL:        "http://127.0.0.1/",
+		Events:     []string{WEBHOOK_EVENT_APP_CLOSED},
+		SecretFile: "secret",
+	}
+	unittest.Equals(t, webhook.Clone().Validate(), ERR_SECRET_FILE_UNLOADED)
+}
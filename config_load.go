@@ -0,0 +1,441 @@
+package patrol
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	CONFIG_FORMAT_JSON = "json"
+	CONFIG_FORMAT_YAML = "yaml"
+	CONFIG_FORMAT_TOML = "toml"
+)
+
+var (
+	ERR_CONFIG_INCLUDE_FIELD  = fmt.Errorf("Included Config may only contain Apps and Services")
+	ERR_CONFIG_INCLUDE_NESTED = fmt.Errorf("Included Config may not Include other Configs")
+	ERR_CONFIG_INCLUDE_GLOB   = fmt.Errorf("Config Include was an invalid glob")
+	ERR_CONFIG_DIR_INVALID    = fmt.Errorf("Config Directory was not a directory")
+)
+
+// these are the only keys an included config may contain
+var config_include_keys = map[string]bool{
+	"apps":     true,
+	"services": true,
+}
+
+// ConfigFormat will return the format of our config file from its extension
+// `.yaml` and `.yml` are YAML, `.toml` is TOML and everything else is JSON
+func ConfigFormat(
+	path string,
+) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return CONFIG_FORMAT_YAML
+	case ".toml":
+		return CONFIG_FORMAT_TOML
+	}
+	return CONFIG_FORMAT_JSON
+}
+
+// LoadConfig will load our config file as JSON, YAML or TOML
+// YAML and TOML are converted to JSON before they're decoded, our JSON keys are used for every format
+//
+// Every string value may contain `${VAR}` or `${VAR:-default}`, which is interpolated from our environment
+// Our secret files and env files are read every time LoadConfig is called, Patrol.Reload() will call LoadConfig to read them again
+//
+// Every file matched by our `include` globs is merged into our config, followed by every config file within dirs
+// Included files may only contain `apps` and `services`, we recommend one App or Service per file, ie: `conf.d/webapp.yaml`
+// An App or Service ID that is defined by more than one file will return DuplicateIDErrors
+//
+// We will NOT validate our config here!!!
+// Clone() and Validate() are still called by CreatePatrol()
+func LoadConfig(
+	path string,
+	dirs ...string,
+) (
+	*Config,
+	error,
+) {
+	config, err := decodeConfigFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if config == nil {
+		// decoded config was nil
+		// while this would rarely occur in practice, it is technically possible for config to be nil after decode/unmarshal
+		// a json file with the value of "null" would cause this to occur
+		// the only time this really plays out in reality is if someone were to POST null to a JSON API
+		// this something that is sometimes overlooked
+		return nil, ERR_CONFIG_NIL
+	}
+	// our includes are relative to our config file
+	files := []string{}
+	for _, include := range config.Include {
+		if !filepath.IsAbs(include) {
+			include = filepath.Join(filepath.Dir(path), include)
+		}
+		matches, err := filepath.Glob(include)
+		if err != nil {
+			return nil, &ConfigFileError{
+				Path: include,
+				Err:  ERR_CONFIG_INCLUDE_GLOB,
+			}
+		}
+		files = append(files, matches...)
+	}
+	for _, dir := range dirs {
+		if dir == "" {
+			continue
+		}
+		matches, err := configDirFiles(dir)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, matches...)
+	}
+	if err := mergeConfigFiles(config, path, files); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// configDirFiles will return every JSON, YAML and TOML file within dir, sorted by name
+func configDirFiles(
+	dir string,
+) (
+	[]string,
+	error,
+) {
+	if fi, err := os.Stat(dir); err != nil {
+		return nil, err
+	} else if !fi.IsDir() {
+		return nil, &ConfigFileError{
+			Path: dir,
+			Err:  ERR_CONFIG_DIR_INVALID,
+		}
+	}
+	files := []string{}
+	for _, ext := range []string{"*.json", "*.yaml", "*.yml", "*.toml"} {
+		// our pattern is static, the only possible error is ErrBadPattern
+		matches, _ := filepath.Glob(filepath.Join(dir, ext))
+		files = append(files, matches...)
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// mergeConfigFiles will merge the Apps and Services of every file into config
+// every ID is tracked by the file that defined it so that we're able to report duplicates across files
+// duplicate IDs within a single file are left for Validate() to report
+func mergeConfigFiles(
+	config *Config,
+	path string,
+	files []string,
+) error {
+	app_files := make(map[string]string)
+	service_files := make(map[string]string)
+	for id := range config.Apps {
+		app_files[strings.ToLower(id)] = path
+	}
+	for id := range config.Services {
+		service_files[strings.ToLower(id)] = path
+	}
+	duplicates := &duplicateIDs{}
+	for _, file := range files {
+		include, err := decodeConfigInclude(file, config.Templates)
+		if err != nil {
+			return err
+		}
+		if include == nil {
+			// an empty include is allowed
+			continue
+		}
+		for _, id := range sortedKeys(include.Apps) {
+			if f, ok := app_files[strings.ToLower(id)]; ok && f != file {
+				duplicates.add(VALIDATION_GROUP_APP, id, f, file)
+				continue
+			}
+			app_files[strings.ToLower(id)] = file
+			if config.Apps == nil {
+				config.Apps = make(map[string]*ConfigApp)
+			}
+			config.Apps[id] = include.Apps[id]
+		}
+		for _, id := range sortedKeys(include.Services) {
+			if f, ok := service_files[strings.ToLower(id)]; ok && f != file {
+				duplicates.add(VALIDATION_GROUP_SERVICE, id, f, file)
+				continue
+			}
+			service_files[strings.ToLower(id)] = file
+			if config.Services == nil {
+				config.Services = make(map[string]*ConfigService)
+			}
+			config.Services[id] = include.Services[id]
+		}
+	}
+	if len(duplicates.errors) > 0 {
+		return duplicates.errors
+	}
+	return nil
+}
+
+// decodeConfigInclude will decode an included config file
+// we're only going to allow Apps and Services to be included, everything else belongs in our config file
+// our Apps and Services may extend the templates of our config file
+func decodeConfigInclude(
+	path string,
+	templates map[string]json.RawMessage,
+) (
+	*Config,
+	error,
+) {
+	body, err := readConfigFile(path)
+	if err != nil {
+		return nil, &ConfigFileError{
+			Path: path,
+			Err:  err,
+		}
+	}
+	keys := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(body, &keys); err != nil {
+		return nil, &ConfigFileError{
+			Path: path,
+			Err:  err,
+		}
+	}
+	for k := range keys {
+		if k == "include" {
+			return nil, &ConfigFileError{
+				Path: path,
+				Err:  ERR_CONFIG_INCLUDE_NESTED,
+			}
+		}
+		if !config_include_keys[k] {
+			return nil, &ConfigFileError{
+				Path: path,
+				Err:  ERR_CONFIG_INCLUDE_FIELD,
+			}
+		}
+	}
+	if body, err = interpolateConfig(body); err != nil {
+		return nil, &ConfigFileError{
+			Path: path,
+			Err:  err,
+		}
+	}
+	if body, err = extendConfig(body, templates); err != nil {
+		return nil, &ConfigFileError{
+			Path: path,
+			Err:  err,
+		}
+	}
+	var config *Config
+	if err := json.Unmarshal(body, &config); err != nil {
+		return nil, &ConfigFileError{
+			Path: path,
+			Err:  err,
+		}
+	}
+	if config != nil {
+		if err := resolveConfig(config, filepath.Dir(path)); err != nil {
+			return nil, &ConfigFileError{
+				Path: path,
+				Err:  err,
+			}
+		}
+	}
+	return config, nil
+}
+
+// decodeConfigFile will decode our config file
+// our values are interpolated, our templates are merged and our secrets are resolved, see resolveConfig()
+// our config will be nil if our file was `null`
+func decodeConfigFile(
+	path string,
+) (
+	*Config,
+	error,
+) {
+	body, err := readConfigFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if body, err = interpolateConfig(body); err != nil {
+		return nil, err
+	}
+	var config *Config
+	if err := json.Unmarshal(body, &config); err != nil {
+		// couldn't decode file as json
+		return nil, err
+	}
+	if config != nil {
+		// our templates are defined by our config, so we're going to decode our config again once they're merged
+		extended, err := extendConfig(body, config.Templates)
+		if err != nil {
+			return nil, err
+		}
+		if !bytes.Equal(body, extended) {
+			config = nil
+			if err := json.Unmarshal(extended, &config); err != nil {
+				return nil, err
+			}
+		}
+		if err := resolveConfig(config, filepath.Dir(path)); err != nil {
+			return nil, err
+		}
+	}
+	return config, nil
+}
+
+// readConfigFile will read our config file and convert YAML or TOML to JSON
+func readConfigFile(
+	path string,
+) (
+	[]byte,
+	error,
+) {
+	body, err := ioutil.ReadFile(path)
+	if err != nil {
+		// couldn't open file
+		return nil, err
+	}
+	var value interface{}
+	switch ConfigFormat(path) {
+	case CONFIG_FORMAT_YAML:
+		if err := yaml.Unmarshal(body, &value); err != nil {
+			return nil, err
+		}
+	case CONFIG_FORMAT_TOML:
+		m := make(map[string]interface{})
+		if _, err := toml.Decode(string(body), &m); err != nil {
+			return nil, err
+		}
+		value = m
+	default:
+		return body, nil
+	}
+	return json.Marshal(jsonValue(value))
+}
+
+// jsonValue will convert our decoded YAML to values that are able to be marshalled as JSON
+// YAML mappings may have non string keys, ie: an App ID of `123`
+func jsonValue(
+	value interface{},
+) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for k, e := range v {
+			v[k] = jsonValue(e)
+		}
+		return v
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			m[fmt.Sprint(k)] = jsonValue(e)
+		}
+		return m
+	case []interface{}:
+		for i, e := range v {
+			v[i] = jsonValue(e)
+		}
+		return v
+	}
+	return value
+}
+
+// ConfigFileError is returned by LoadConfig when an included config file fails to load
+type ConfigFileError struct {
+	Path string
+	Err  error
+}
+
+func (self *ConfigFileError) Error() string {
+	return fmt.Sprintf("%s: %s", self.Path, self.Err)
+}
+func (self *ConfigFileError) Unwrap() error {
+	return self.Err
+}
+
+// DuplicateIDError describes an App or Service ID that was defined by more than one config file
+// IDs are compared case insensitively, the same as Validate()
+type DuplicateIDError struct {
+	// Group is either VALIDATION_GROUP_APP or VALIDATION_GROUP_SERVICE
+	Group string
+	ID    string
+	// Files are every file that defined our ID, in the order they were loaded
+	Files []string
+}
+
+func (self *DuplicateIDError) Error() string {
+	group := "App"
+	if self.Group == VALIDATION_GROUP_SERVICE {
+		group = "Service"
+	}
+	return fmt.Sprintf("Duplicate %s ID \"%s\" defined in: %s", group, self.ID, strings.Join(self.Files, ", "))
+}
+
+// Unwrap will return either ERR_APP_LABEL_DUPLICATE or ERR_SERVICE_LABEL_DUPLICATE
+func (self *DuplicateIDError) Unwrap() error {
+	if self.Group == VALIDATION_GROUP_SERVICE {
+		return ERR_SERVICE_LABEL_DUPLICATE
+	}
+	return ERR_APP_LABEL_DUPLICATE
+}
+
+// DuplicateIDErrors is every duplicate ID that was found by LoadConfig
+type DuplicateIDErrors []*DuplicateIDError
+
+func (self DuplicateIDErrors) Error() string {
+	errs := make([]string, 0, len(self))
+	for _, e := range self {
+		errs = append(errs, e.Error())
+	}
+	return strings.Join(errs, "; ")
+}
+
+// Is will return true if any of our errors match our target
+func (self DuplicateIDErrors) Is(
+	target error,
+) bool {
+	for _, e := range self {
+		if e.Unwrap() == target {
+			return true
+		}
+	}
+	return false
+}
+
+type duplicateIDs struct {
+	errors DuplicateIDErrors
+}
+
+// add will record that our ID was defined by both files
+// an ID that has already been reported will have file appended
+func (self *duplicateIDs) add(
+	group string,
+	id string,
+	first string,
+	file string,
+) {
+	for _, e := range self.errors {
+		if e.Group == group &&
+			strings.ToLower(e.ID) == strings.ToLower(id) {
+			e.Files = append(e.Files, file)
+			return
+		}
+	}
+	self.errors = append(self.errors, &DuplicateIDError{
+		Group: group,
+		ID:    id,
+		Files: []string{first, file},
+	})
+}
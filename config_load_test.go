@@ -0,0 +1,224 @@
+package patrol
+
+import (
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sabey.co/unittest"
+	"testing"
+)
+
+func TestLoadConfig(t *testing.T) {
+	log.Println("TestLoadConfig")
+
+	dir, err := ioutil.TempDir("", "patrol-load")
+	unittest.IsNil(t, err)
+	defer os.RemoveAll(dir)
+	write := func(name string, body string) string {
+		path := filepath.Join(dir, name)
+		unittest.IsNil(t, os.MkdirAll(filepath.Dir(path), 0755))
+		unittest.IsNil(t, ioutil.WriteFile(path, []byte(body), 0644))
+		return path
+	}
+
+	unittest.Equals(t, ConfigFormat("config.json"), CONFIG_FORMAT_JSON)
+	unittest.Equals(t, ConfigFormat("config.YAML"), CONFIG_FORMAT_YAML)
+	unittest.Equals(t, ConfigFormat("config.yml"), CONFIG_FORMAT_YAML)
+	unittest.Equals(t, ConfigFormat("config.toml"), CONFIG_FORMAT_TOML)
+	unittest.Equals(t, ConfigFormat("config"), CONFIG_FORMAT_JSON)
+
+	// null
+	config, err := LoadConfig(write("null.json", "null"))
+	unittest.IsNil(t, config)
+	unittest.Equals(t, err, ERR_CONFIG_NIL)
+	config, err = LoadConfig(write("null.yaml", ""))
+	unittest.IsNil(t, config)
+	unittest.Equals(t, err, ERR_CONFIG_NIL)
+
+	// every format is decoded with our json keys
+	expected := &Config{
+		Apps: map[string]*ConfigApp{
+			"app": &ConfigApp{
+				KeepAlive:        APP_KEEPALIVE_PID_PATROL,
+				Name:             "App",
+				Binary:           "app",
+				WorkingDirectory: "/tmp",
+				LogDirectory:     "logs",
+				PIDPath:          "app.pid",
+				Args:             []string{"-a", "1"},
+			},
+			"123": &ConfigApp{
+				KeepAlive:        APP_KEEPALIVE_PID_APP,
+				Name:             "Numeric",
+				Binary:           "numeric",
+				WorkingDirectory: "/tmp",
+				LogDirectory:     "logs",
+				PIDPath:          "numeric.pid",
+			},
+		},
+		TickEvery:  5,
+		ListenHTTP: []string{"127.0.0.1:8421"},
+	}
+	config, err = LoadConfig(write("config.json", `{
+	"apps": {
+		"app": {"keepalive": 1, "name": "App", "binary": "app", "working-directory": "/tmp", "log-directory": "logs", "pid-path": "app.pid", "args": ["-a", "1"]},
+		"123": {"keepalive": 2, "name": "Numeric", "binary": "numeric", "working-directory": "/tmp", "log-directory": "logs", "pid-path": "numeric.pid"}
+	},
+	"tick-every": 5,
+	"listen-http": ["127.0.0.1:8421"]
+}`))
+	unittest.IsNil(t, err)
+	unittest.Equals(t, config, expected)
+	config, err = LoadConfig(write("config.yaml", `
+apps:
+  app:
+    keepalive: 1
+    name: App
+    binary: app
+    working-directory: /tmp
+    log-directory: logs
+    pid-path: app.pid
+    args: ["-a", "1"]
+  123:
+    keepalive: 2
+    name: Numeric
+    binary: numeric
+    working-directory: /tmp
+    log-directory: logs
+    pid-path: numeric.pid
+tick-every: 5
+listen-http:
+  - 127.0.0.1:8421
+`))
+	unittest.IsNil(t, err)
+	unittest.Equals(t, config, expected)
+	config, err = LoadConfig(write("config.toml", `
+tick-every = 5
+listen-http = ["127.0.0.1:8421"]
+
+[apps.app]
+keepalive = 1
+name = "App"
+binary = "app"
+working-directory = "/tmp"
+log-directory = "logs"
+pid-path = "app.pid"
+args = ["-a", "1"]
+
+[apps.123]
+keepalive = 2
+name = "Numeric"
+binary = "numeric"
+working-directory = "/tmp"
+log-directory = "logs"
+pid-path = "numeric.pid"
+`))
+	unittest.IsNil(t, err)
+	unittest.Equals(t, config, expected)
+	// our loaded config still goes through Validate()
+	unittest.IsNil(t, config.Clone().Validate())
+
+	// invalid files
+	_, err = LoadConfig(write("invalid.yaml", "apps: ["))
+	unittest.NotNil(t, err)
+	_, err = LoadConfig(write("invalid.toml", "apps = "))
+	unittest.NotNil(t, err)
+	_, err = LoadConfig(filepath.Join(dir, "missing.json"))
+	unittest.Equals(t, os.IsNotExist(err), true)
+
+	// includes are relative to our config file
+	write("conf.d/web.yaml", `
+apps:
+  web:
+    keepalive: 1
+    name: Web
+    binary: web
+    working-directory: /tmp
+    log-directory: logs
+    pid-path: web.pid
+`)
+	write("conf.d/ssh.toml", `
+[services.ssh]
+management = 1
+name = "SSH"
+service = "ssh"
+`)
+	write("conf.d/empty.yaml", "")
+	write("conf.d/README", "not a config")
+	config, err = LoadConfig(write("include.json", `{
+	"include": ["conf.d/*.yaml", "conf.d/*.toml"],
+	"apps": {
+		"app": {"keepalive": 1, "name": "App", "binary": "app", "working-directory": "/tmp", "log-directory": "logs", "pid-path": "app.pid"}
+	}
+}`))
+	unittest.IsNil(t, err)
+	unittest.Equals(t, config.Include, []string{"conf.d/*.yaml", "conf.d/*.toml"})
+	unittest.Equals(t, len(config.Apps), 2)
+	unittest.Equals(t, config.Apps["web"].Name, "Web")
+	unittest.Equals(t, config.Services["ssh"].Service, "ssh")
+	unittest.Equals(t, config.Clone().Include, config.Include)
+	unittest.IsNil(t, config.Clone().Validate())
+
+	// our config directory ignores files that aren't json, yaml or toml
+	config, err = LoadConfig(write("dir.json", `{"apps": {}}`), filepath.Join(dir, "conf.d"))
+	unittest.IsNil(t, err)
+	unittest.Equals(t, len(config.Apps), 1)
+	unittest.Equals(t, len(config.Services), 1)
+	_, err = LoadConfig(filepath.Join(dir, "dir.json"), filepath.Join(dir, "conf.d", "web.yaml"))
+	unittest.Equals(t, err, &ConfigFileError{
+		Path: filepath.Join(dir, "conf.d", "web.yaml"),
+		Err:  ERR_CONFIG_DIR_INVALID,
+	})
+
+	// included configs may only contain apps and services
+	_, err = LoadConfig(write("field.json", `{"include": ["conf.d/README"]}`))
+	unittest.NotNil(t, err)
+	unittest.Equals(t, err.(*ConfigFileError).Path, filepath.Join(dir, "conf.d", "README"))
+	write("field/http.yaml", "listen-http: [\"127.0.0.1:8421\"]\n")
+	_, err = LoadConfig(write("field.json", `{"include": ["field/*"]}`))
+	unittest.Equals(t, err, &ConfigFileError{
+		Path: filepath.Join(dir, "field", "http.yaml"),
+		Err:  ERR_CONFIG_INCLUDE_FIELD,
+	})
+	write("nested/nested.json", `{"include": ["*.json"]}`)
+	_, err = LoadConfig(write("nested.json", `{"include": ["nested/*"]}`))
+	unittest.Equals(t, err, &ConfigFileError{
+		Path: filepath.Join(dir, "nested", "nested.json"),
+		Err:  ERR_CONFIG_INCLUDE_NESTED,
+	})
+	_, err = LoadConfig(write("glob.json", `{"include": ["["]}`))
+	unittest.Equals(t, err, &ConfigFileError{
+		Path: filepath.Join(dir, "["),
+		Err:  ERR_CONFIG_INCLUDE_GLOB,
+	})
+
+	// duplicate IDs are reported with every file that defined them
+	write("dup/a.json", `{"apps": {"web": {"name": "a"}, "other": {"name": "other"}}, "services": {"SSH": {"name": "a"}}}`)
+	write("dup/b.yaml", "apps:\n  WEB:\n    name: b\n")
+	path := write("dup.json", `{"include": ["dup/*", "conf.d/*.yaml", "conf.d/*.toml"], "apps": {"Web": {"name": "config"}}}`)
+	_, err = LoadConfig(path)
+	unittest.Equals(t, err, DuplicateIDErrors{
+		&DuplicateIDError{
+			Group: VALIDATION_GROUP_APP,
+			ID:    "web",
+			Files: []string{
+				path,
+				filepath.Join(dir, "dup", "a.json"),
+				filepath.Join(dir, "dup", "b.yaml"),
+				filepath.Join(dir, "conf.d", "web.yaml"),
+			},
+		},
+		&DuplicateIDError{
+			Group: VALIDATION_GROUP_SERVICE,
+			ID:    "ssh",
+			Files: []string{
+				filepath.Join(dir, "dup", "a.json"),
+				filepath.Join(dir, "conf.d", "ssh.toml"),
+			},
+		},
+	})
+	unittest.Equals(t, err.(DuplicateIDErrors).Is(ERR_APP_LABEL_DUPLICATE), true)
+	unittest.Equals(t, err.(DuplicateIDErrors).Is(ERR_SERVICE_LABEL_DUPLICATE), true)
+	unittest.Equals(t, err.(DuplicateIDErrors)[1].Error(), "Duplicate Service ID \"ssh\" defined in: "+filepath.Join(dir, "dup", "a.json")+", "+filepath.Join(dir, "conf.d", "ssh.toml"))
+}
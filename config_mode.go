@@ -0,0 +1,131 @@
+package patrol
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+)
+
+var (
+	ERR_KEEPALIVE_NAME_INVALID  = fmt.Errorf("KeepAlive was not a valid name or number")
+	ERR_MANAGEMENT_NAME_INVALID = fmt.Errorf("Management was not a valid name or number")
+)
+
+// our symbolic names of our KeepAlive and Management methods
+var (
+	keepalive_names = map[KeepAlive]string{
+		APP_KEEPALIVE_PID_PATROL: "pid-patrol",
+		APP_KEEPALIVE_PID_APP:    "pid-app",
+		APP_KEEPALIVE_HTTP:       "http",
+		APP_KEEPALIVE_UDP:        "udp",
+	}
+	management_names = map[Management]string{
+		SERVICE_MANAGEMENT_SERVICE: "service",
+		SERVICE_MANAGEMENT_INITD:   "initd",
+	}
+)
+
+// KeepAlive is our App KeepAlive Method, see APP_KEEPALIVE_PID_PATROL
+// KeepAlive is marshalled as its name, ie: `"pid-patrol"`, and may be unmarshalled from either its name or its number
+type KeepAlive int
+
+// String will return our name, an unknown KeepAlive is returned as its number
+func (self KeepAlive) String() string {
+	if name, ok := keepalive_names[self]; ok {
+		return name
+	}
+	return strconv.Itoa(int(self))
+}
+func (self KeepAlive) MarshalJSON() ([]byte, error) {
+	if name, ok := keepalive_names[self]; ok {
+		return json.Marshal(name)
+	}
+	// an unknown KeepAlive is marshalled as its number so that Validate() may still report it
+	return json.Marshal(int(self))
+}
+func (self *KeepAlive) UnmarshalJSON(
+	data []byte,
+) error {
+	if bytes.Equal(data, []byte("null")) {
+		return nil
+	}
+	i, err := unmarshalMode(data, func(name string) (int, bool) {
+		for k, v := range keepalive_names {
+			if v == name {
+				return int(k), true
+			}
+		}
+		return 0, false
+	})
+	if err != nil {
+		return ERR_KEEPALIVE_NAME_INVALID
+	}
+	*self = KeepAlive(i)
+	return nil
+}
+
+// Management is our Service Management Method, see SERVICE_MANAGEMENT_SERVICE
+// Management is marshalled as its name, ie: `"initd"`, and may be unmarshalled from either its name or its number
+type Management int
+
+// String will return our name, an unknown Management is returned as its number
+func (self Management) String() string {
+	if name, ok := management_names[self]; ok {
+		return name
+	}
+	return strconv.Itoa(int(self))
+}
+func (self Management) MarshalJSON() ([]byte, error) {
+	if name, ok := management_names[self]; ok {
+		return json.Marshal(name)
+	}
+	return json.Marshal(int(self))
+}
+func (self *Management) UnmarshalJSON(
+	data []byte,
+) error {
+	if bytes.Equal(data, []byte("null")) {
+		return nil
+	}
+	i, err := unmarshalMode(data, func(name string) (int, bool) {
+		for k, v := range management_names {
+			if v == name {
+				return int(k), true
+			}
+		}
+		return 0, false
+	})
+	if err != nil {
+		return ERR_MANAGEMENT_NAME_INVALID
+	}
+	*self = Management(i)
+	return nil
+}
+
+// unmarshalMode will unmarshal either a number or a name
+// a string containing a number is also accepted, this allows our numbers to be interpolated, ie: `"${KEEPALIVE:-1}"`
+func unmarshalMode(
+	data []byte,
+	lookup func(name string) (int, bool),
+) (
+	int,
+	error,
+) {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		var i int
+		if err := json.Unmarshal(data, &i); err != nil {
+			return 0, err
+		}
+		return i, nil
+	}
+	if i, ok := lookup(s); ok {
+		return i, nil
+	}
+	i, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, err
+	}
+	return i, nil
+}
@@ -0,0 +1,63 @@
+package patrol
+
+import (
+	"encoding/json"
+	"log"
+	"sabey.co/unittest"
+	"testing"
+)
+
+func TestKeepAliveJSON(t *testing.T) {
+	log.Println("TestKeepAliveJSON")
+
+	for body, keepalive := range map[string]KeepAlive{
+		`1`:            APP_KEEPALIVE_PID_PATROL,
+		`"pid-patrol"`: APP_KEEPALIVE_PID_PATROL,
+		`"pid-app"`:    APP_KEEPALIVE_PID_APP,
+		`"http"`:       APP_KEEPALIVE_HTTP,
+		`4`:            APP_KEEPALIVE_UDP,
+		`"udp"`:        APP_KEEPALIVE_UDP,
+		// interpolated numbers are strings
+		`"2"`: APP_KEEPALIVE_PID_APP,
+		// unknown numbers are reported by Validate()
+		`9`: 9,
+	} {
+		var k KeepAlive
+		unittest.IsNil(t, json.Unmarshal([]byte(body), &k))
+		unittest.Equals(t, k, keepalive)
+	}
+	var k KeepAlive
+	unittest.Equals(t, json.Unmarshal([]byte(`"tcp"`), &k), ERR_KEEPALIVE_NAME_INVALID)
+	unittest.Equals(t, json.Unmarshal([]byte(`true`), &k), ERR_KEEPALIVE_NAME_INVALID)
+	// null is ignored
+	k = APP_KEEPALIVE_HTTP
+	unittest.IsNil(t, json.Unmarshal([]byte(`null`), &k))
+	unittest.Equals(t, k, KeepAlive(APP_KEEPALIVE_HTTP))
+
+	bs, err := json.Marshal(KeepAlive(APP_KEEPALIVE_PID_APP))
+	unittest.IsNil(t, err)
+	unittest.Equals(t, string(bs), `"pid-app"`)
+	bs, err = json.Marshal(KeepAlive(9))
+	unittest.IsNil(t, err)
+	unittest.Equals(t, string(bs), `9`)
+	unittest.Equals(t, KeepAlive(APP_KEEPALIVE_UDP).String(), "udp")
+	unittest.Equals(t, KeepAlive(9).String(), "9")
+}
+
+func TestManagementJSON(t *testing.T) {
+	log.Println("TestManagementJSON")
+
+	service := &ConfigService{}
+	unittest.IsNil(t, json.Unmarshal([]byte(`{"management-start": "service", "management-status": 2, "management-stop": "initd", "management-restart": "1"}`), service))
+	unittest.Equals(t, service.GetManagementStart(), Management(SERVICE_MANAGEMENT_SERVICE))
+	unittest.Equals(t, service.GetManagementStatus(), Management(SERVICE_MANAGEMENT_INITD))
+	unittest.Equals(t, service.GetManagementStop(), Management(SERVICE_MANAGEMENT_INITD))
+	unittest.Equals(t, service.GetManagementRestart(), Management(SERVICE_MANAGEMENT_SERVICE))
+	unittest.Equals(t, json.Unmarshal([]byte(`{"management": "systemd"}`), service), ERR_MANAGEMENT_NAME_INVALID)
+
+	bs, err := json.Marshal(&ConfigService{
+		Management: SERVICE_MANAGEMENT_INITD,
+	})
+	unittest.IsNil(t, err)
+	unittest.Equals(t, string(bs), `{"management":"initd"}`)
+}
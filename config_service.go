@@ -17,13 +17,19 @@ var (
 	ERR_SERVICE_MANAGEMENT_RESTART_INVALID = fmt.Errorf("Service Management Restart was invalid, please select a method!")
 	ERR_SERVICE_INVALID_EXITCODE           = fmt.Errorf("Service contained an Invalid Exit Code")
 	ERR_SERVICE_DUPLICATE_EXITCODE         = fmt.Errorf("Service contained a Duplicate Exit Code")
+	ERR_SERVICE_CHECKEVERY_INVALID         = fmt.Errorf("Service Check Every < 0")
 )
 
 type ConfigService struct {
+	// Extends is the name of a template in Config.Templates that our Service will inherit from, see ConfigApp.Extends
+	Extends        string   `json:"extends,omitempty"`
+	ExtendsReplace []string `json:"extends-replace,omitempty"`
 	// Management Method
 	//
-	// SERVICE_MANAGEMENT_SERVICE = 1
-	// SERVICE_MANAGEMENT_INITD = 2
+	// SERVICE_MANAGEMENT_SERVICE = 1 = "service"
+	// SERVICE_MANAGEMENT_INITD = 2 = "initd"
+	//
+	// Management may be either our number or our name, it is always marshalled as our name
 	//
 	// SERVICE_MANAGEMENT_SERVICE: Patrol will use the command `service *`
 	// SERVICE_MANAGEMENT_INITD: Patrol will use the command `/etc/init.d/*`
@@ -31,17 +37,21 @@ type ConfigService struct {
 	// If Management is set it will ignore all of the Management Start/Status/Stop/Restart values
 	// If Management is 0, Start/Status/Stop/Restart must each be individually set!
 	// If for whatever reason is necessary, we could choose to user `service` for `status` and `/etc/init.d/` for start or stop!
-	Management        int `json:"management,omitempty"`
-	ManagementStart   int `json:"management-start,omitempty"`
-	ManagementStatus  int `json:"management-status,omitempty"`
-	ManagementStop    int `json:"management-stop,omitempty"`
-	ManagementRestart int `json:"management-restart,omitempty"`
+	Management        Management `json:"management,omitempty"`
+	ManagementStart   Management `json:"management-start,omitempty"`
+	ManagementStatus  Management `json:"management-status,omitempty"`
+	ManagementStop    Management `json:"management-stop,omitempty"`
+	ManagementRestart Management `json:"management-restart,omitempty"`
 	// Optionally we may override our service parameters.
 	// For example, instead of `restart` we may choose to use `force-reload`
 	ManagementStartParameter   string `json:"management-start-parameter,omitempty"`
 	ManagementStatusParameter  string `json:"management-status-parameter,omitempty"`
 	ManagementStopParameter    string `json:"management-stop-parameter,omitempty"`
 	ManagementRestartParameter string `json:"management-restart-parameter,omitempty"`
+	// CheckEvery is an optional integer value in seconds of how often we will check the state of our Service
+	// Every check will execute our Management Status command, ie: `service ssh status`
+	// A Value of 0 will use Config.TickEvery, our value is limited to TICKEVERY_MIN and TICKEVERY_MAX
+	CheckEvery int `json:"check-every,omitempty"`
 	// Name is used as our Display Name in our HTTP GUI.
 	// Name can contain any characters but must be less than 255 bytes in length.
 	Name string `json:"name,omitempty"`
@@ -58,6 +68,9 @@ type ConfigService struct {
 	// The only way to enable an Service once Patrol is started is to use the API or restart Patrol
 	// If we are Disabled and we discover an Service that is running, we will signal it to stop.
 	Disabled bool `json:"disabled,omitempty"`
+	// If StopOnShutdown is true our Service will be stopped once our Apps have stopped when Patrol.Shutdown() is called.
+	// Our Services are managed by our system, by default our Services are left running when Patrol stops.
+	StopOnShutdown bool `json:"stop-on-shutdown,omitempty"`
 	// KeyValue - prexisting values to populate objects with on init
 	KeyValue map[string]interface{} `json:"keyvalue,omitempty"`
 	// KeyValueClear if true will cause our Service KeyValue to be cleared once a new instance of our Service is started.
@@ -65,20 +78,32 @@ type ConfigService struct {
 	// If Secret is set, we will require a secret to be passed when pinging and modifying the state of our Service from our HTTP and UDP API.
 	// We are not going to throttle comparing our secret. Choose a secret with enough bits of uniqueness and don't make your Patrol instance public!
 	// If you are worried about your secret being public, use TLS and HTTP, DO NOT USE UDP!!!
+	// Secret may be interpolated from our environment the same as ConfigApp.Secret
 	Secret string `json:"secret,omitempty"`
+	// SecretFile is a path to a file containing our Secret, see ConfigApp.SecretFile
+	SecretFile string `json:"secret-file,omitempty"`
+	// ClientIdentities are the Common Names and Subject Alternative Names of client certificates we will accept in place of our Secret.
+	// Client certificates are only verified if ConfigHTTP.TLSClientCA is set, our UDP API will never present an identity.
+	// If ClientIdentityRequired is true, we will require both an identity AND our Secret.
+	ClientIdentities       []string `json:"client-identities,omitempty"`
+	ClientIdentityRequired bool     `json:"client-identity-required,omitempty"`
 	// Triggers are only available when you extend Patrol as a library
 	// These values will NOT be able to be set from `config.json` - They must be set manually
 	//
-	// TriggerStart is called from tick in runServices() before we attempt to execute an Service.
+	// TriggerOptions are how each of our Triggers are called, our keys are our Trigger names such as TRIGGER_CLOSED
+	// Triggers without options are called inline and waited on, every Trigger is recovered if it panics
+	// TriggerOptions are only available when you extend Patrol as a library, see Service.GetTriggerErrors()
+	TriggerOptions map[string]*TriggerOptions `json:"-"`
+	// TriggerStart is called from tick in runService() before we attempt to execute an Service.
 	TriggerStart func(
 		service *Service,
 	) `json:"-"`
-	// TriggerStarted is called from tick in runServices() and isServiceRunning()
+	// TriggerStarted is called from tick in runService() and isServiceRunning()
 	// This is called after we either execute a new Service or we discover a newly running Service.
 	TriggerStarted func(
 		service *Service,
 	) `json:"-"`
-	// TriggerStartFailed is called from tick in runServices() when we fail to execute a new Service.
+	// TriggerStartFailed is called from tick in runService() when we fail to execute a new Service.
 	TriggerStartFailed func(
 		service *Service,
 	) `json:"-"`
@@ -103,6 +128,9 @@ type ConfigService struct {
 	) `json:"-"`
 	// Extra Unstructured Data
 	X json.RawMessage `json:"x,omitempty"`
+	// this is resolved by LoadConfig(), see resolveConfig()
+	secret   *string
+	extended bool
 }
 
 func (self *ConfigService) IsValid() bool {
@@ -116,6 +144,8 @@ func (self *ConfigService) Clone() *ConfigService {
 		return nil
 	}
 	config := &ConfigService{
+		Extends:                    self.Extends,
+		ExtendsReplace:             make([]string, 0, len(self.ExtendsReplace)),
 		Management:                 self.Management,
 		ManagementStart:            self.ManagementStart,
 		ManagementStatus:           self.ManagementStatus,
@@ -125,6 +155,7 @@ func (self *ConfigService) Clone() *ConfigService {
 		ManagementStatusParameter:  self.ManagementStatusParameter,
 		ManagementStopParameter:    self.ManagementStopParameter,
 		ManagementRestartParameter: self.ManagementRestartParameter,
+		CheckEvery:                 self.CheckEvery,
 		Name:                   self.Name,
 		Service:                self.Service,
 		IgnoreExitCodesStart:   make([]uint8, 0, len(self.IgnoreExitCodesStart)),
@@ -132,9 +163,14 @@ func (self *ConfigService) Clone() *ConfigService {
 		IgnoreExitCodesStop:    make([]uint8, 0, len(self.IgnoreExitCodesStop)),
 		IgnoreExitCodesRestart: make([]uint8, 0, len(self.IgnoreExitCodesRestart)),
 		Disabled:               self.Disabled,
+		StopOnShutdown:         self.StopOnShutdown,
 		KeyValue:               make(map[string]interface{}),
 		KeyValueClear:          self.KeyValueClear,
 		Secret:                 self.Secret,
+		SecretFile:             self.SecretFile,
+		ClientIdentities:       make([]string, 0, len(self.ClientIdentities)),
+		ClientIdentityRequired: self.ClientIdentityRequired,
+		TriggerOptions:         cloneTriggerOptions(self.TriggerOptions),
 		TriggerStart:           self.TriggerStart,
 		TriggerStarted:         self.TriggerStarted,
 		TriggerStartFailed:     self.TriggerStartFailed,
@@ -143,10 +179,18 @@ func (self *ConfigService) Clone() *ConfigService {
 		TriggerClosed:          self.TriggerClosed,
 		TriggerShutdown:        self.TriggerShutdown,
 		X:                      dereference(self.X),
+		secret:                 self.secret,
+		extended:               self.extended,
+	}
+	for _, k := range self.ExtendsReplace {
+		config.ExtendsReplace = append(config.ExtendsReplace, k)
 	}
 	for k, v := range self.KeyValue {
 		config.KeyValue[k] = v
 	}
+	for _, i := range self.ClientIdentities {
+		config.ClientIdentities = append(config.ClientIdentities, i)
+	}
 	for _, i := range self.IgnoreExitCodesStart {
 		config.IgnoreExitCodesStart = append(config.IgnoreExitCodesStart, i)
 	}
@@ -161,7 +205,25 @@ func (self *ConfigService) Clone() *ConfigService {
 	}
 	return config
 }
+
+// getSecret will return our resolved Secret if it was interpolated or read from our SecretFile
+func (self *ConfigService) getSecret() string {
+	if self.secret != nil {
+		return *self.secret
+	}
+	return self.Secret
+}
+
+// Validate will return the sentinel error of our first invalid field
 func (self *ConfigService) Validate() error {
+	return self.ValidateAll().first()
+}
+
+// ValidateAll will return every invalid field, our ID is set by Config.ValidateAll()
+func (self *ConfigService) ValidateAll() ValidationErrors {
+	v := &validation{
+		group: VALIDATION_GROUP_SERVICE,
+	}
 	if self.Management == 0 &&
 		(self.ManagementStart > 0 ||
 			self.ManagementStatus > 0 ||
@@ -171,126 +233,111 @@ func (self *ConfigService) Validate() error {
 		if self.ManagementStart < SERVICE_MANAGEMENT_SERVICE ||
 			self.ManagementStart > SERVICE_MANAGEMENT_INITD {
 			// unknown management value
-			return ERR_SERVICE_MANAGEMENT_START_INVALID
+			v.add("management-start", self.ManagementStart, ERR_SERVICE_MANAGEMENT_START_INVALID)
 		}
 		// status
 		if self.ManagementStatus < SERVICE_MANAGEMENT_SERVICE ||
 			self.ManagementStatus > SERVICE_MANAGEMENT_INITD {
 			// unknown management value
-			return ERR_SERVICE_MANAGEMENT_STATUS_INVALID
+			v.add("management-status", self.ManagementStatus, ERR_SERVICE_MANAGEMENT_STATUS_INVALID)
 		}
 		// stop
 		if self.ManagementStop < SERVICE_MANAGEMENT_SERVICE ||
 			self.ManagementStop > SERVICE_MANAGEMENT_INITD {
 			// unknown management value
-			return ERR_SERVICE_MANAGEMENT_STOP_INVALID
+			v.add("management-stop", self.ManagementStop, ERR_SERVICE_MANAGEMENT_STOP_INVALID)
 		}
 		// restart
 		if self.ManagementRestart < SERVICE_MANAGEMENT_SERVICE ||
 			self.ManagementRestart > SERVICE_MANAGEMENT_INITD {
 			// unknown management value
-			return ERR_SERVICE_MANAGEMENT_RESTART_INVALID
+			v.add("management-restart", self.ManagementRestart, ERR_SERVICE_MANAGEMENT_RESTART_INVALID)
 		}
 	} else {
 		// use master value
 		if self.Management < SERVICE_MANAGEMENT_SERVICE ||
 			self.Management > SERVICE_MANAGEMENT_INITD {
 			// unknown management value
-			return ERR_SERVICE_MANAGEMENT_INVALID
+			v.add("management", self.Management, ERR_SERVICE_MANAGEMENT_INVALID)
 		}
 	}
 	if self.Service == "" {
-		return ERR_SERVICE_EMPTY
-	}
-	if len(self.Service) > SERVICE_MAXLENGTH {
-		return ERR_SERVICE_MAXLENGTH
+		v.add("service", self.Service, ERR_SERVICE_EMPTY)
+	} else if len(self.Service) > SERVICE_MAXLENGTH {
+		v.add("service", self.Service, ERR_SERVICE_MAXLENGTH)
 	}
 	if self.Name == "" {
-		return ERR_SERVICE_NAME_EMPTY
+		v.add("name", self.Name, ERR_SERVICE_NAME_EMPTY)
+	} else if len(self.Name) > SERVICE_NAME_MAXLENGTH {
+		v.add("name", self.Name, ERR_SERVICE_NAME_MAXLENGTH)
 	}
-	if len(self.Name) > SERVICE_NAME_MAXLENGTH {
-		return ERR_SERVICE_NAME_MAXLENGTH
+	if self.CheckEvery < 0 {
+		v.add("check-every", self.CheckEvery, ERR_SERVICE_CHECKEVERY_INVALID)
 	}
-	if len(self.Secret) > SECRET_MAX_LENGTH {
-		return ERR_SECRET_TOOLONG
+	if len(self.getSecret()) > SECRET_MAX_LENGTH {
+		// we will never return our secret
+		v.add("secret", nil, ERR_SECRET_TOOLONG)
 	}
-	// start
-	exists := make(map[uint8]struct{})
-	for _, ec := range self.IgnoreExitCodesStart {
-		if ec == 0 {
-			// can't ignore 0
-			return ERR_SERVICE_INVALID_EXITCODE
+	if self.SecretFile != "" {
+		if self.Secret != "" {
+			v.add("secret-file", self.SecretFile, ERR_SECRET_FILE_CONFLICT)
+		} else if self.secret == nil {
+			v.add("secret-file", self.SecretFile, ERR_SECRET_FILE_UNLOADED)
 		}
-		if _, ok := exists[ec]; ok {
-			// exit code already exists
-			return ERR_SERVICE_DUPLICATE_EXITCODE
-		}
-		// does not exist
-		exists[ec] = struct{}{}
 	}
-	// status
-	exists = make(map[uint8]struct{})
-	for _, ec := range self.IgnoreExitCodesStatus {
-		if ec == 0 {
-			// can't ignore 0
-			return ERR_SERVICE_INVALID_EXITCODE
-		}
-		if _, ok := exists[ec]; ok {
-			// exit code already exists
-			return ERR_SERVICE_DUPLICATE_EXITCODE
-		}
-		// does not exist
-		exists[ec] = struct{}{}
+	if err := validateClientIdentities(self.ClientIdentities, self.ClientIdentityRequired); err != nil {
+		v.add("client-identities", self.ClientIdentities, err)
 	}
-	// stop
-	exists = make(map[uint8]struct{})
-	for _, ec := range self.IgnoreExitCodesStop {
-		if ec == 0 {
-			// can't ignore 0
-			return ERR_SERVICE_INVALID_EXITCODE
-		}
-		if _, ok := exists[ec]; ok {
-			// exit code already exists
-			return ERR_SERVICE_DUPLICATE_EXITCODE
-		}
-		// does not exist
-		exists[ec] = struct{}{}
+	validateExitCodes(v, "ignore-exit-codes-start", self.IgnoreExitCodesStart)
+	validateExitCodes(v, "ignore-exit-codes-status", self.IgnoreExitCodesStatus)
+	validateExitCodes(v, "ignore-exit-codes-stop", self.IgnoreExitCodesStop)
+	validateExitCodes(v, "ignore-exit-codes-restart", self.IgnoreExitCodesRestart)
+	if self.Extends != "" &&
+		!self.extended {
+		v.add("extends", self.Extends, ERR_EXTENDS_UNRESOLVED)
 	}
-	// restart
-	exists = make(map[uint8]struct{})
-	for _, ec := range self.IgnoreExitCodesRestart {
+	return v.errors
+}
+func validateExitCodes(
+	v *validation,
+	field string,
+	exit_codes []uint8,
+) {
+	exists := make(map[uint8]struct{})
+	for _, ec := range exit_codes {
 		if ec == 0 {
 			// can't ignore 0
-			return ERR_SERVICE_INVALID_EXITCODE
+			v.add(field, ec, ERR_SERVICE_INVALID_EXITCODE)
+			return
 		}
 		if _, ok := exists[ec]; ok {
 			// exit code already exists
-			return ERR_SERVICE_DUPLICATE_EXITCODE
+			v.add(field, ec, ERR_SERVICE_DUPLICATE_EXITCODE)
+			return
 		}
 		// does not exist
 		exists[ec] = struct{}{}
 	}
-	return nil
 }
-func (self *ConfigService) GetManagementStart() int {
+func (self *ConfigService) GetManagementStart() Management {
 	if self.Management > 0 {
 		return self.Management
 	}
 	return self.ManagementStart
 }
-func (self *ConfigService) GetManagementStatus() int {
+func (self *ConfigService) GetManagementStatus() Management {
 	if self.Management > 0 {
 		return self.Management
 	}
 	return self.ManagementStatus
 }
-func (self *ConfigService) GetManagementStop() int {
+func (self *ConfigService) GetManagementStop() Management {
 	if self.Management > 0 {
 		return self.Management
 	}
 	return self.ManagementStop
 }
-func (self *ConfigService) GetManagementRestart() int {
+func (self *ConfigService) GetManagementRestart() Management {
 	if self.Management > 0 {
 		return self.Management
 	}
@@ -0,0 +1,193 @@
+package patrol
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+var (
+	ERR_TEMPLATE_NOT_FOUND = fmt.Errorf("Template was not found")
+	ERR_TEMPLATE_CYCLE     = fmt.Errorf("Template extends itself")
+	ERR_TEMPLATE_INVALID   = fmt.Errorf("Template was not an object")
+	ERR_EXTENDS_UNRESOLVED = fmt.Errorf("Extends was not resolved, use LoadConfig()")
+)
+
+// these keys are never inherited from a template
+var template_skip = map[string]bool{
+	"extends":         true,
+	"extends-replace": true,
+}
+
+// extendConfig will deep merge our templates into every App and Service of our JSON config that extends them
+//
+// Our App or Service always wins: objects are merged recursively and any other value replaces our template's value
+// Lists are appended to our template's list, unless their key is listed in `extends-replace`
+// Templates may extend other templates
+func extendConfig(
+	body []byte,
+	templates map[string]json.RawMessage,
+) (
+	[]byte,
+	error,
+) {
+	if !bytes.Contains(body, []byte(`"extends"`)) {
+		// nothing extends a template, our body is returned as is
+		return body, nil
+	}
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	// our numbers must not be converted to float64
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+	config, ok := value.(map[string]interface{})
+	if !ok {
+		return body, nil
+	}
+	for _, group := range []string{"apps", "services"} {
+		objects, ok := config[group].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		for id, o := range objects {
+			object, ok := o.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			name, ok := object["extends"].(string)
+			if !ok ||
+				name == "" {
+				continue
+			}
+			template, err := resolveTemplate(templates, name, group+"."+id+".extends", nil)
+			if err != nil {
+				return nil, err
+			}
+			objects[id] = mergeTemplate(template, object)
+		}
+	}
+	return json.Marshal(config)
+}
+
+// resolveTemplate will return our template merged with every template it extends
+// path is the JSON path of our `extends`, seen is every template we've already extended
+func resolveTemplate(
+	templates map[string]json.RawMessage,
+	name string,
+	path string,
+	seen map[string]bool,
+) (
+	map[string]interface{},
+	error,
+) {
+	if seen[name] {
+		return nil, &ConfigValueError{
+			Path:  path,
+			Value: name,
+			Err:   ERR_TEMPLATE_CYCLE,
+		}
+	}
+	raw, ok := templates[name]
+	if !ok {
+		return nil, &ConfigValueError{
+			Path:  path,
+			Value: name,
+			Err:   ERR_TEMPLATE_NOT_FOUND,
+		}
+	}
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, &ConfigValueError{
+			Path:  "templates." + name,
+			Value: name,
+			Err:   err,
+		}
+	}
+	template, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, &ConfigValueError{
+			Path:  "templates." + name,
+			Value: name,
+			Err:   ERR_TEMPLATE_INVALID,
+		}
+	}
+	parent, ok := template["extends"].(string)
+	if !ok ||
+		parent == "" {
+		return template, nil
+	}
+	s := map[string]bool{
+		name: true,
+	}
+	for k := range seen {
+		s[k] = true
+	}
+	base, err := resolveTemplate(templates, parent, "templates."+name+".extends", s)
+	if err != nil {
+		return nil, err
+	}
+	return mergeTemplate(base, template), nil
+}
+
+// mergeTemplate will merge over into our template
+// the keys listed by over's `extends-replace` will replace our template's lists instead of being appended
+func mergeTemplate(
+	template map[string]interface{},
+	over map[string]interface{},
+) map[string]interface{} {
+	replace := make(map[string]bool)
+	if keys, ok := over["extends-replace"].([]interface{}); ok {
+		for _, k := range keys {
+			if k, ok := k.(string); ok {
+				replace[k] = true
+			}
+		}
+	}
+	merged := make(map[string]interface{})
+	for k, v := range template {
+		if !template_skip[k] {
+			merged[k] = v
+		}
+	}
+	for k, v := range over {
+		if replace[k] {
+			merged[k] = v
+			continue
+		}
+		merged[k] = mergeValue(merged[k], v)
+	}
+	return merged
+}
+func mergeValue(
+	template interface{},
+	over interface{},
+) interface{} {
+	switch o := over.(type) {
+	case map[string]interface{}:
+		t, ok := template.(map[string]interface{})
+		if !ok {
+			return over
+		}
+		merged := make(map[string]interface{})
+		for k, v := range t {
+			merged[k] = v
+		}
+		for k, v := range o {
+			merged[k] = mergeValue(merged[k], v)
+		}
+		return merged
+	case []interface{}:
+		t, ok := template.([]interface{})
+		if !ok {
+			return over
+		}
+		merged := make([]interface{}, 0, len(t)+len(o))
+		merged = append(merged, t...)
+		return append(merged, o...)
+	}
+	return over
+}
@@ -0,0 +1,162 @@
+package patrol
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sabey.co/unittest"
+	"testing"
+)
+
+func TestMergeTemplate(t *testing.T) {
+	log.Println("TestMergeTemplate")
+
+	template := map[string]interface{}{
+		"extends":         "parent",
+		"extends-replace": []interface{}{"env"},
+		"keepalive":       json.Number("1"),
+		"std-merge":       true,
+		"args":            []interface{}{"-a"},
+		"env":             []interface{}{"A=1"},
+		"keyvalue": map[string]interface{}{
+			"a": json.Number("1"),
+			"b": map[string]interface{}{"c": json.Number("2")},
+		},
+	}
+	merged := mergeTemplate(template, map[string]interface{}{
+		"extends":         "template",
+		"extends-replace": []interface{}{"args"},
+		"std-merge":       false,
+		"args":            []interface{}{"-b"},
+		"env":             []interface{}{"B=2"},
+		"keyvalue": map[string]interface{}{
+			"b": map[string]interface{}{"d": json.Number("3")},
+		},
+	})
+	unittest.Equals(t, merged, map[string]interface{}{
+		"extends":         "template",
+		"extends-replace": []interface{}{"args"},
+		"keepalive":       json.Number("1"),
+		// our explicit false wins
+		"std-merge": false,
+		// replaced
+		"args": []interface{}{"-b"},
+		// appended, our template's extends-replace is never inherited
+		"env": []interface{}{"A=1", "B=2"},
+		"keyvalue": map[string]interface{}{
+			"a": json.Number("1"),
+			"b": map[string]interface{}{"c": json.Number("2"), "d": json.Number("3")},
+		},
+	})
+	// our template was not modified
+	unittest.Equals(t, template["args"], []interface{}{"-a"})
+	unittest.Equals(t, len(template["keyvalue"].(map[string]interface{})["b"].(map[string]interface{})), 1)
+}
+
+func TestLoadConfigTemplates(t *testing.T) {
+	log.Println("TestLoadConfigTemplates")
+
+	dir, err := ioutil.TempDir("", "patrol-templates")
+	unittest.IsNil(t, err)
+	defer os.RemoveAll(dir)
+	write := func(name string, body string) string {
+		path := filepath.Join(dir, name)
+		unittest.IsNil(t, os.MkdirAll(filepath.Dir(path), 0755))
+		unittest.IsNil(t, ioutil.WriteFile(path, []byte(body), 0644))
+		return path
+	}
+	write("secret", "template-secret\n")
+
+	path := write("config.yaml", `
+include:
+  - conf.d/*.yaml
+templates:
+  base:
+    keepalive: 2
+    working-directory: /testapp
+    log-directory: logs
+    pid-path: app.pid
+    execute-timeout: 30
+    std-merge: true
+    env: ["A=1"]
+    args: ["-base"]
+  secret:
+    extends: base
+    secret-file: secret
+    env: ["B=2"]
+  service:
+    management: 1
+    ignore-exit-codes-start: [127]
+apps:
+  app:
+    extends: secret
+    name: App
+    binary: testapp
+    std-merge: false
+    env: ["C=3"]
+  replaced:
+    extends: base
+    extends-replace: [args, env]
+    name: Replaced
+    binary: testapp
+    args: ["-own"]
+    env: []
+services:
+  ssh:
+    extends: service
+    name: SSH
+    service: ssh
+    ignore-exit-codes-start: [1]
+`)
+	write("conf.d/included.yaml", `
+apps:
+  included:
+    extends: base
+    name: Included
+    binary: testapp
+`)
+	config, err := LoadConfig(path)
+	unittest.IsNil(t, err)
+	app := config.Apps["app"]
+	unittest.Equals(t, app.Extends, "secret")
+	unittest.Equals(t, app.KeepAlive, KeepAlive(APP_KEEPALIVE_PID_APP))
+	unittest.Equals(t, app.WorkingDirectory, "/testapp")
+	unittest.Equals(t, app.ExecuteTimeout, 30)
+	unittest.Equals(t, app.StdMerge, false)
+	unittest.Equals(t, app.Env, []string{"A=1", "B=2", "C=3"})
+	unittest.Equals(t, app.Args, []string{"-base"})
+	unittest.Equals(t, app.getSecret(), "template-secret")
+	replaced := config.Apps["replaced"]
+	unittest.Equals(t, replaced.StdMerge, true)
+	unittest.Equals(t, replaced.Args, []string{"-own"})
+	unittest.Equals(t, len(replaced.Env), 0)
+	unittest.Equals(t, config.Apps["included"].PIDPath, "app.pid")
+	unittest.Equals(t, config.Services["ssh"].Management, Management(SERVICE_MANAGEMENT_SERVICE))
+	unittest.Equals(t, config.Services["ssh"].IgnoreExitCodesStart, []uint8{127, 1})
+	unittest.Equals(t, len(config.Clone().Templates), 3)
+	unittest.IsNil(t, config.Clone().Validate())
+
+	// templates must exist and may not extend themselves
+	_, err = LoadConfig(write("missing.json", `{"apps": {"app": {"extends": "missing"}}}`))
+	unittest.Equals(t, err, &ConfigValueError{Path: "apps.app.extends", Value: "missing", Err: ERR_TEMPLATE_NOT_FOUND})
+	_, err = LoadConfig(write("cycle.json", `{"templates": {"a": {"extends": "b"}, "b": {"extends": "a"}}, "services": {"ssh": {"extends": "a"}}}`))
+	unittest.Equals(t, err, &ConfigValueError{Path: "templates.b.extends", Value: "a", Err: ERR_TEMPLATE_CYCLE})
+	_, err = LoadConfig(write("invalid.json", `{"templates": {"a": []}, "apps": {"app": {"extends": "a"}}}`))
+	unittest.Equals(t, err, &ConfigValueError{Path: "templates.a", Value: "a", Err: ERR_TEMPLATE_INVALID})
+	write("conf.d/included.yaml", "apps:\n  included:\n    extends: missing\n")
+	_, err = LoadConfig(path)
+	unittest.Equals(t, err, &ConfigFileError{
+		Path: filepath.Join(dir, "conf.d", "included.yaml"),
+		Err:  &ConfigValueError{Path: "apps.included.extends", Value: "missing", Err: ERR_TEMPLATE_NOT_FOUND},
+	})
+
+	// our templates must be merged by LoadConfig
+	app = app.Clone()
+	app.extended = false
+	unittest.Equals(t, app.Validate(), ERR_EXTENDS_UNRESOLVED)
+	service := config.Services["ssh"].Clone()
+	service.extended = false
+	unittest.Equals(t, service.Validate(), ERR_EXTENDS_UNRESOLVED)
+}
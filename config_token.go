@@ -0,0 +1,195 @@
+package patrol
+
+import (
+	"encoding/json"
+	"fmt"
+	"golang.org/x/crypto/bcrypt"
+	"path"
+	"strings"
+)
+
+const (
+	TOKEN_SCOPE_READ           = `read`
+	TOKEN_SCOPE_PING           = `ping`
+	TOKEN_SCOPE_TOGGLE         = `toggle`
+	TOKEN_SCOPE_KEYVALUE_WRITE = `keyvalue-write`
+	TOKEN_SCOPE_ADMIN          = `admin`
+)
+
+var (
+	ERR_TOKEN_NIL             = fmt.Errorf("Token was nil")
+	ERR_TOKEN_HASH_INVALID    = fmt.Errorf("Token Hash was invalid, we require a bcrypt hash")
+	ERR_TOKEN_SCOPES_EMPTY    = fmt.Errorf("Token Scopes were empty")
+	ERR_TOKEN_SCOPE_INVALID   = fmt.Errorf("Token contained an Invalid Scope")
+	ERR_TOKEN_SCOPE_DUPLICATE = fmt.Errorf("Token contained a Duplicate Scope")
+	ERR_TOKEN_IDS_EMPTY       = fmt.Errorf("Token Apps and Services were empty")
+	ERR_TOKEN_GLOB_INVALID    = fmt.Errorf("Token contained an Invalid App or Service Glob")
+	ERR_TOKEN_REQUIRED_EMPTY  = fmt.Errorf("Tokens Required but Tokens were empty")
+	ERR_TOKEN_ID_INVALID      = fmt.Errorf("Token ID may only contain letters, numbers, `-` and `_`")
+	ERR_TOKEN_ID_DUPLICATE    = fmt.Errorf("Token ID was a Duplicate")
+)
+
+type ConfigToken struct {
+	// Name is only used to identify our Token, it is never used to authorize a request.
+	Name string `json:"name,omitempty"`
+	// ID is OPTIONAL but recommended, if our ID is set our Token is presented as `ID.TOKEN` and our Hash is the hash of `ID.TOKEN`
+	// bcrypt is slow, a Token with an ID is only ever compared to our Hash, a Token without an ID is compared to every Token without an ID
+	ID string `json:"id,omitempty"`
+	// Hash is the bcrypt hash of our Token, we never store our Token in plain text.
+	// ie: `htpasswd -bnBC 10 "" TOKEN | tr -d ':\n'`
+	Hash string `json:"hash,omitempty"`
+	// Scopes is the list of actions our Token is authorized to perform.
+	//
+	// TOKEN_SCOPE_READ = "read"
+	// TOKEN_SCOPE_PING = "ping"
+	// TOKEN_SCOPE_TOGGLE = "toggle"
+	// TOKEN_SCOPE_KEYVALUE_WRITE = "keyvalue-write"
+	// TOKEN_SCOPE_ADMIN = "admin"
+	//
+	// TOKEN_SCOPE_READ: Read the state of an App or Service and read the logs of an App
+	// TOKEN_SCOPE_PING: Ping an App and update its PID
+	// TOKEN_SCOPE_TOGGLE: Toggle the state of an App or Service
+	// TOKEN_SCOPE_KEYVALUE_WRITE: Modify the KeyValue of an App or Service
+	// TOKEN_SCOPE_ADMIN: All of the above
+	Scopes []string `json:"scopes,omitempty"`
+	// Apps/Services are the App and Service IDs our Token is authorized for.
+	// IDs are globs, ie: "web-*" - "*" will match every ID.
+	// If only one is set, our Token is NOT authorized for the other group.
+	Apps     []string `json:"apps,omitempty"`
+	Services []string `json:"services,omitempty"`
+	// Extra Unstructured Data
+	X json.RawMessage `json:"x,omitempty"`
+}
+
+func (self *ConfigToken) IsValid() bool {
+	if self == nil {
+		return false
+	}
+	return true
+}
+func (self *ConfigToken) Clone() *ConfigToken {
+	if self == nil {
+		return nil
+	}
+	config := &ConfigToken{
+		Name:     self.Name,
+		ID:       self.ID,
+		Hash:     self.Hash,
+		Scopes:   make([]string, 0, len(self.Scopes)),
+		Apps:     make([]string, 0, len(self.Apps)),
+		Services: make([]string, 0, len(self.Services)),
+		X:        dereference(self.X),
+	}
+	for _, s := range self.Scopes {
+		config.Scopes = append(config.Scopes, s)
+	}
+	for _, a := range self.Apps {
+		config.Apps = append(config.Apps, a)
+	}
+	for _, s := range self.Services {
+		config.Services = append(config.Services, s)
+	}
+	return config
+}
+func (self *ConfigToken) Validate() error {
+	for _, c := range self.ID {
+		if !(c >= 'a' && c <= 'z') &&
+			!(c >= 'A' && c <= 'Z') &&
+			!(c >= '0' && c <= '9') &&
+			c != '-' &&
+			c != '_' {
+			return ERR_TOKEN_ID_INVALID
+		}
+	}
+	if _, err := bcrypt.Cost([]byte(self.Hash)); err != nil {
+		return ERR_TOKEN_HASH_INVALID
+	}
+	if len(self.Scopes) == 0 {
+		return ERR_TOKEN_SCOPES_EMPTY
+	}
+	exists := make(map[string]struct{})
+	for _, s := range self.Scopes {
+		if !IsTokenScope(s) {
+			return ERR_TOKEN_SCOPE_INVALID
+		}
+		if _, ok := exists[s]; ok {
+			// scope already exists
+			return ERR_TOKEN_SCOPE_DUPLICATE
+		}
+		// does not exist
+		exists[s] = struct{}{}
+	}
+	if len(self.Apps) == 0 &&
+		len(self.Services) == 0 {
+		return ERR_TOKEN_IDS_EMPTY
+	}
+	// our IDs are lowercased by Config.Validate(), we have to do the same here
+	for i, glob := range self.Apps {
+		if _, err := path.Match(glob, ""); err != nil ||
+			glob == "" {
+			return ERR_TOKEN_GLOB_INVALID
+		}
+		self.Apps[i] = strings.ToLower(glob)
+	}
+	for i, glob := range self.Services {
+		if _, err := path.Match(glob, ""); err != nil ||
+			glob == "" {
+			return ERR_TOKEN_GLOB_INVALID
+		}
+		self.Services[i] = strings.ToLower(glob)
+	}
+	return nil
+}
+
+// HasScope will return true if our Token has our scope or is an admin
+func (self *ConfigToken) HasScope(
+	scope string,
+) bool {
+	for _, s := range self.Scopes {
+		if s == scope ||
+			s == TOKEN_SCOPE_ADMIN {
+			return true
+		}
+	}
+	return false
+}
+func (self *ConfigToken) IsID(
+	group string,
+	id string,
+) bool {
+	globs := self.Apps
+	if group == "service" {
+		globs = self.Services
+	}
+	for _, glob := range globs {
+		if ok, _ := path.Match(glob, id); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// isToken will return true if our Token may be compared to our Hash
+// a Token prefixed with our ID is only compared to our Token, a Token without a known ID is only compared to Tokens without an ID
+func (self *ConfigToken) isToken(
+	token string,
+	ids map[string]bool,
+) bool {
+	if self.ID != "" {
+		return strings.HasPrefix(token, self.ID+".")
+	}
+	if i := strings.Index(token, "."); i > 0 &&
+		ids[token[:i]] {
+		return false
+	}
+	return true
+}
+func IsTokenScope(
+	scope string,
+) bool {
+	return scope == TOKEN_SCOPE_READ ||
+		scope == TOKEN_SCOPE_PING ||
+		scope == TOKEN_SCOPE_TOGGLE ||
+		scope == TOKEN_SCOPE_KEYVALUE_WRITE ||
+		scope == TOKEN_SCOPE_ADMIN
+}
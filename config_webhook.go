@@ -0,0 +1,253 @@
+package patrol
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+const (
+	WEBHOOK_RETRIES_MAX     = 10
+	WEBHOOK_BACKOFF_DEFAULT = 1
+	WEBHOOK_BACKOFF_MAX     = 300
+	WEBHOOK_TIMEOUT_DEFAULT = 10
+	WEBHOOK_TIMEOUT_MAX     = 120
+)
+
+const (
+	WEBHOOK_EVENT_APP_STARTED          = `app-started`
+	WEBHOOK_EVENT_APP_START_FAILED     = `app-start-failed`
+	WEBHOOK_EVENT_APP_CLOSED           = `app-closed`
+	WEBHOOK_EVENT_SERVICE_STARTED      = `service-started`
+	WEBHOOK_EVENT_SERVICE_START_FAILED = `service-start-failed`
+	WEBHOOK_EVENT_SERVICE_CLOSED       = `service-closed`
+)
+
+var (
+	ERR_WEBHOOK_NIL                = fmt.Errorf("Webhook was nil")
+	ERR_WEBHOOK_URL_EMPTY          = fmt.Errorf("Webhook URL was empty")
+	ERR_WEBHOOK_URL_INVALID        = fmt.Errorf("Webhook URL was invalid, we require an absolute http or https URL")
+	ERR_WEBHOOK_EVENTS_EMPTY       = fmt.Errorf("Webhook Events were empty")
+	ERR_WEBHOOK_EVENT_INVALID      = fmt.Errorf("Webhook contained an Invalid Event")
+	ERR_WEBHOOK_EVENT_DUPLICATE    = fmt.Errorf("Webhook contained a Duplicate Event")
+	ERR_WEBHOOK_APP_INVALID        = fmt.Errorf("Webhook contained an Invalid App ID")
+	ERR_WEBHOOK_SERVICE_INVALID    = fmt.Errorf("Webhook contained an Invalid Service ID")
+	ERR_WEBHOOK_RETRIES_INVALID    = fmt.Errorf("Webhook Retries was < 0 or > %d", WEBHOOK_RETRIES_MAX)
+	ERR_WEBHOOK_BACKOFF_INVALID    = fmt.Errorf("Webhook Backoff was < 0 or > %d", WEBHOOK_BACKOFF_MAX)
+	ERR_WEBHOOK_TIMEOUT_INVALID    = fmt.Errorf("Webhook Timeout was < 0 or > %d", WEBHOOK_TIMEOUT_MAX)
+	ERR_WEBHOOK_DEADLETTER_UNCLEAN = fmt.Errorf("Webhook Dead Letter path was unclean")
+)
+
+type ConfigWebhook struct {
+	// URL is the absolute http or https URL we will POST our JSON body to.
+	URL string `json:"url,omitempty"`
+	// Events is the list of events that will be sent to this Webhook.
+	//
+	// WEBHOOK_EVENT_APP_STARTED = "app-started"
+	// WEBHOOK_EVENT_APP_START_FAILED = "app-start-failed"
+	// WEBHOOK_EVENT_APP_CLOSED = "app-closed"
+	// WEBHOOK_EVENT_SERVICE_STARTED = "service-started"
+	// WEBHOOK_EVENT_SERVICE_START_FAILED = "service-start-failed"
+	// WEBHOOK_EVENT_SERVICE_CLOSED = "service-closed"
+	Events []string `json:"events,omitempty"`
+	// Apps/Services optionally filter which App and Service IDs will be sent.
+	// If both are empty, every App and Service will be sent.
+	// If only one is set, the other group will NOT be sent.
+	Apps     []string `json:"apps,omitempty"`
+	Services []string `json:"services,omitempty"`
+	// If UnexpectedOnly is true, closed events will only be sent if we did not expect our App or Service to close.
+	// An expected close is one caused by being Disabled, Restarted, consuming RunOnce, or Patrol shutting down.
+	UnexpectedOnly bool `json:"unexpected-only,omitempty"`
+	// If Secret is set, we will sign our JSON body with HMAC-SHA256.
+	// The hex encoded signature is sent in the header `X-Patrol-Signature` as: `sha256=<signature>`
+	// Secret may be interpolated from our environment the same as ConfigApp.Secret
+	Secret string `json:"secret,omitempty"`
+	// SecretFile is a path to a file containing our Secret, see ConfigApp.SecretFile
+	SecretFile string `json:"secret-file,omitempty"`
+	// Retries is the amount of additional attempts we will make if our POST fails.
+	// A POST fails if we can't connect or if we do not receive a 2xx status code.
+	Retries int `json:"retries,omitempty"`
+	// Backoff is an integer value in seconds of how long we will wait before our first retry.
+	// Each additional retry will double this value, up to WEBHOOK_BACKOFF_MAX seconds.
+	// Value of 0 Defaults to 1 second
+	Backoff int `json:"backoff,omitempty"`
+	// Timeout is an integer value in seconds of how long we will wait for each POST.
+	// Value of 0 Defaults to 10 seconds
+	Timeout int `json:"timeout,omitempty"`
+	// DeadLetter is an optional path to a file that we will append to once we've exhausted our retries.
+	// Each line is a JSON object containing our URL, our last error, and our JSON body.
+	DeadLetter string `json:"dead-letter,omitempty"`
+	// Extra Unstructured Data
+	X json.RawMessage `json:"x,omitempty"`
+	// this is resolved by LoadConfig(), see resolveConfig()
+	secret *string
+}
+
+func (self *ConfigWebhook) IsValid() bool {
+	if self == nil {
+		return false
+	}
+	return true
+}
+func (self *ConfigWebhook) Clone() *ConfigWebhook {
+	if self == nil {
+		return nil
+	}
+	config := &ConfigWebhook{
+		URL:            self.URL,
+		Events:         make([]string, 0, len(self.Events)),
+		Apps:           make([]string, 0, len(self.Apps)),
+		Services:       make([]string, 0, len(self.Services)),
+		UnexpectedOnly: self.UnexpectedOnly,
+		Secret:         self.Secret,
+		SecretFile:     self.SecretFile,
+		Retries:        self.Retries,
+		Backoff:        self.Backoff,
+		Timeout:        self.Timeout,
+		DeadLetter:     self.DeadLetter,
+		X:              dereference(self.X),
+		secret:         self.secret,
+	}
+	for _, e := range self.Events {
+		config.Events = append(config.Events, e)
+	}
+	for _, a := range self.Apps {
+		config.Apps = append(config.Apps, a)
+	}
+	for _, s := range self.Services {
+		config.Services = append(config.Services, s)
+	}
+	return config
+}
+
+// getSecret will return our resolved Secret if it was interpolated or read from our SecretFile
+func (self *ConfigWebhook) getSecret() string {
+	if self.secret != nil {
+		return *self.secret
+	}
+	return self.Secret
+}
+func (self *ConfigWebhook) Validate() error {
+	if self.URL == "" {
+		return ERR_WEBHOOK_URL_EMPTY
+	}
+	u, err := url.Parse(self.URL)
+	if err != nil ||
+		!u.IsAbs() ||
+		(u.Scheme != "http" && u.Scheme != "https") ||
+		u.Host == "" {
+		return ERR_WEBHOOK_URL_INVALID
+	}
+	if len(self.Events) == 0 {
+		return ERR_WEBHOOK_EVENTS_EMPTY
+	}
+	exists := make(map[string]struct{})
+	for _, e := range self.Events {
+		if !IsWebhookEvent(e) {
+			return ERR_WEBHOOK_EVENT_INVALID
+		}
+		if _, ok := exists[e]; ok {
+			// event already exists
+			return ERR_WEBHOOK_EVENT_DUPLICATE
+		}
+		// does not exist
+		exists[e] = struct{}{}
+	}
+	// our IDs are lowercased by Config.Validate(), we have to do the same here
+	for i, id := range self.Apps {
+		if !IsAppServiceID(id) {
+			return ERR_WEBHOOK_APP_INVALID
+		}
+		self.Apps[i] = strings.ToLower(id)
+	}
+	for i, id := range self.Services {
+		if !IsAppServiceID(id) {
+			return ERR_WEBHOOK_SERVICE_INVALID
+		}
+		self.Services[i] = strings.ToLower(id)
+	}
+	if len(self.getSecret()) > SECRET_MAX_LENGTH {
+		return ERR_SECRET_TOOLONG
+	}
+	if self.SecretFile != "" {
+		if self.Secret != "" {
+			return ERR_SECRET_FILE_CONFLICT
+		} else if self.secret == nil {
+			return ERR_SECRET_FILE_UNLOADED
+		}
+	}
+	if self.Retries < 0 ||
+		self.Retries > WEBHOOK_RETRIES_MAX {
+		return ERR_WEBHOOK_RETRIES_INVALID
+	}
+	if self.Backoff < 0 ||
+		self.Backoff > WEBHOOK_BACKOFF_MAX {
+		return ERR_WEBHOOK_BACKOFF_INVALID
+	}
+	if self.Timeout < 0 ||
+		self.Timeout > WEBHOOK_TIMEOUT_MAX {
+		return ERR_WEBHOOK_TIMEOUT_INVALID
+	}
+	if self.DeadLetter != "" &&
+		!IsPathClean(self.DeadLetter) {
+		return ERR_WEBHOOK_DEADLETTER_UNCLEAN
+	}
+	return nil
+}
+func (self *ConfigWebhook) GetBackoff() int {
+	if self.Backoff == 0 {
+		return WEBHOOK_BACKOFF_DEFAULT
+	}
+	return self.Backoff
+}
+func (self *ConfigWebhook) GetTimeout() int {
+	if self.Timeout == 0 {
+		return WEBHOOK_TIMEOUT_DEFAULT
+	}
+	return self.Timeout
+}
+func (self *ConfigWebhook) IsEvent(
+	event string,
+) bool {
+	for _, e := range self.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+func (self *ConfigWebhook) IsID(
+	group string,
+	id string,
+) bool {
+	if len(self.Apps) == 0 &&
+		len(self.Services) == 0 {
+		// no filters
+		return true
+	}
+	ids := self.Apps
+	if group == "service" {
+		ids = self.Services
+	}
+	for _, i := range ids {
+		if i == id {
+			return true
+		}
+	}
+	return false
+}
+func IsWebhookEvent(
+	event string,
+) bool {
+	switch event {
+	case WEBHOOK_EVENT_APP_STARTED,
+		WEBHOOK_EVENT_APP_START_FAILED,
+		WEBHOOK_EVENT_APP_CLOSED,
+		WEBHOOK_EVENT_SERVICE_STARTED,
+		WEBHOOK_EVENT_SERVICE_START_FAILED,
+		WEBHOOK_EVENT_SERVICE_CLOSED:
+		return true
+	}
+	return false
+}
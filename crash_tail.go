@@ -0,0 +1,201 @@
+package patrol
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// APP_CRASH_TAIL_MAX is the maximum number of lines we will keep of our Stdout and our Stderr
+	APP_CRASH_TAIL_MAX = 1000
+	// APP_CRASH_TAIL_LINE_MAX is the maximum length of a line in bytes, longer lines are truncated
+	APP_CRASH_TAIL_LINE_MAX = 4096
+	// APP_CRASH_TAIL_WAIT is how long we will wait for our pipe to be drained once our App has exited
+	// our pipe is never drained if a child of our App is still holding it open
+	APP_CRASH_TAIL_WAIT = time.Second
+)
+
+// crashTail is a ring of the last lines written to our Stdout or our Stderr
+type crashTail struct {
+	mu    sync.Mutex
+	lines []string
+	// next is the index of our oldest line once our ring is full
+	next int
+	full bool
+	// partial is our current line that has not yet been terminated by a newline
+	partial []byte
+	// truncated is true if our current line is longer than APP_CRASH_TAIL_LINE_MAX
+	truncated bool
+	// done is closed once our pipe has been drained
+	done chan struct{}
+}
+
+func newCrashTail(
+	lines int,
+) *crashTail {
+	return &crashTail{
+		lines: make([]string, 0, lines),
+		done:  make(chan struct{}),
+	}
+}
+
+// Write will never return an error, our App must never be blocked by our tail
+func (self *crashTail) Write(
+	p []byte,
+) (int, error) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	b := p
+	for len(b) > 0 {
+		i := bytes.IndexByte(b, '\n')
+		line := b
+		if i >= 0 {
+			line = b[:i]
+		}
+		if !self.truncated {
+			if n := APP_CRASH_TAIL_LINE_MAX - len(self.partial); len(line) > n {
+				line = line[:n]
+				self.truncated = true
+			}
+			self.partial = append(self.partial, line...)
+		}
+		if i < 0 {
+			break
+		}
+		self.push(strings.TrimSuffix(string(self.partial), "\r"))
+		self.partial = self.partial[:0]
+		self.truncated = false
+		b = b[i+1:]
+	}
+	return len(p), nil
+}
+func (self *crashTail) push(
+	line string,
+) {
+	if !self.full {
+		self.lines = append(self.lines, line)
+		self.full = len(self.lines) == cap(self.lines)
+		return
+	}
+	self.lines[self.next] = line
+	self.next = (self.next + 1) % len(self.lines)
+}
+
+// Lines will return our lines in the order they were written, our current unterminated line is included
+func (self *crashTail) Lines() []string {
+	if self == nil {
+		return nil
+	}
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	lines := make([]string, 0, len(self.lines)+1)
+	lines = append(lines, self.lines[self.next:]...)
+	lines = append(lines, self.lines[:self.next]...)
+	if len(self.partial) > 0 {
+		lines = append(lines, string(self.partial))
+		if len(lines) > cap(self.lines) {
+			// our unterminated line replaces our oldest line
+			lines = lines[1:]
+		}
+	}
+	if len(lines) == 0 {
+		return nil
+	}
+	return lines
+}
+
+// wait will wait until our deadline for our pipe to be drained, so that our last lines are never missed
+func (self *crashTail) wait(
+	deadline time.Time,
+) {
+	if self == nil {
+		return
+	}
+	t := time.NewTimer(time.Until(deadline))
+	defer t.Stop()
+	select {
+	case <-self.done:
+	case <-t.C:
+	}
+}
+
+// copy will copy our pipe to our log and our tail until every writer of our pipe has closed
+// our log is closed once we're done if we own it
+func (self *crashTail) copy(
+	r *os.File,
+	w io.Writer,
+	own bool,
+) {
+	defer close(self.done)
+	defer r.Close()
+	if c, ok := w.(io.Closer); ok && own {
+		defer c.Close()
+	}
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			// a failure to write our log must never stop us from reading our pipe
+			// if we stopped reading our App would block once our pipe is full
+			w.Write(buf[:n])
+			self.Write(buf[:n])
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// tailSTD will replace our Stdout and Stderr with pipes that we own, our output is still written to our logs
+// our App is given our write ends directly, so that our App is never waited on by cmd.Wait() for our pipes to close
+// our write ends must be closed once our App has been started
+func (self *App) tailSTD(
+	cmd *exec.Cmd,
+	std_merge bool,
+) (
+	stdout *crashTail,
+	stderr *crashTail,
+	files []*os.File,
+	err error,
+) {
+	pipe := func(w io.Writer, own bool) (*crashTail, error) {
+		if w == nil {
+			w = io.Discard
+		}
+		r, pw, err := os.Pipe()
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, pw)
+		tail := newCrashTail(self.config.CrashTail)
+		go tail.copy(r, w, own)
+		return tail, nil
+	}
+	merged := std_merge && cmd.Stdout == cmd.Stderr
+	if stdout, err = pipe(cmd.Stdout, self.config.Stdout == nil); err != nil {
+		return nil, nil, files, err
+	}
+	cmd.Stdout = files[0]
+	if merged {
+		// our merged output is our Stdout tail
+		cmd.Stderr = files[0]
+		return stdout, nil, files, nil
+	}
+	if stderr, err = pipe(cmd.Stderr, self.config.Stderr == nil); err != nil {
+		return nil, nil, files, err
+	}
+	cmd.Stderr = files[1]
+	return stdout, stderr, files, nil
+}
+func closeFiles(
+	files []*os.File,
+) {
+	for _, f := range files {
+		f.Close()
+	}
+}
@@ -0,0 +1,121 @@
+package patrol
+
+import (
+	"bytes"
+	"log"
+	"sabey.co/patrol/cas"
+	"sabey.co/unittest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCrashTail(t *testing.T) {
+	log.Println("TestCrashTail")
+
+	tail := newCrashTail(3)
+	unittest.Equals(t, len(tail.Lines()), 0)
+
+	// our lines may be split across writes
+	n, err := tail.Write([]byte("a\nb"))
+	unittest.IsNil(t, err)
+	unittest.Equals(t, n, 3)
+	unittest.Equals(t, tail.Lines(), []string{"a", "b"})
+	tail.Write([]byte("c\r\nd\n"))
+	unittest.Equals(t, tail.Lines(), []string{"a", "bc", "d"})
+
+	// our oldest lines are replaced
+	tail.Write([]byte("e\nf\ng\n"))
+	unittest.Equals(t, tail.Lines(), []string{"e", "f", "g"})
+	// our unterminated line replaces our oldest line
+	tail.Write([]byte("h"))
+	unittest.Equals(t, tail.Lines(), []string{"f", "g", "h"})
+	tail.Write([]byte("\n\n"))
+	unittest.Equals(t, tail.Lines(), []string{"g", "h", ""})
+
+	// our long lines are truncated
+	tail = newCrashTail(2)
+	tail.Write([]byte(strings.Repeat("x", APP_CRASH_TAIL_LINE_MAX-1)))
+	tail.Write([]byte("yz\nshort\n"))
+	lines := tail.Lines()
+	unittest.Equals(t, len(lines), 2)
+	unittest.Equals(t, len(lines[0]), APP_CRASH_TAIL_LINE_MAX)
+	unittest.Equals(t, strings.HasSuffix(lines[0], "xy"), true)
+	unittest.Equals(t, lines[1], "short")
+
+	// nil
+	var empty *crashTail
+	unittest.Equals(t, len(empty.Lines()), 0)
+	empty.wait(time.Now())
+}
+func TestAppCrashTail(t *testing.T) {
+	log.Println("TestAppCrashTail")
+
+	create := func(script string) (*App, *bytes.Buffer) {
+		stdout := &bytes.Buffer{}
+		return &App{
+			id: "crashtail",
+			patrol: &Patrol{
+				config: &Config{
+					History: 5,
+				},
+			},
+			config: &ConfigApp{
+				Name:             "crashtail",
+				KeepAlive:        APP_KEEPALIVE_PID_PATROL,
+				WorkingDirectory: "/bin",
+				Binary:           "sh",
+				Args:             []string{"-c", script},
+				Stdout:           stdout,
+				// our Stderr is never written to our logs
+				Stderr:    &bytes.Buffer{},
+				CrashTail: 3,
+			},
+			o: cas.CreateApp(false),
+		}, stdout
+	}
+	closed := func(app *App) *History {
+		for i := 0; i < 50; i++ {
+			<-time.After(time.Millisecond * 100)
+			app.o.RLock()
+			if len(app.history) > 0 {
+				h := app.history[0]
+				app.o.RUnlock()
+				return h
+			}
+			app.o.RUnlock()
+		}
+		t.Fatal("App was never closed")
+		return nil
+	}
+
+	// unexpected
+	app, stdout := create(`for i in 1 2 3 4 5; do echo "out $i"; done; printf "err a\nerr b" >&2; exit 3`)
+	app.o.Lock()
+	unittest.IsNil(t, app.startApp())
+	app.o.Unlock()
+	h := closed(app)
+	unittest.Equals(t, h.IsUnexpected(), true)
+	unittest.Equals(t, h.ExitCode, 3)
+	unittest.Equals(t, h.StdoutTail, []string{"out 3", "out 4", "out 5"})
+	unittest.Equals(t, h.StderrTail, []string{"err a", "err b"})
+	// our log is still written
+	unittest.Equals(t, stdout.String(), "out 1\nout 2\nout 3\nout 4\nout 5\n")
+	// our tail is never reused
+	app.o.RLock()
+	unittest.Equals(t, app.stdout_tail == nil, true)
+	unittest.Equals(t, app.stderr_tail == nil, true)
+	app.o.RUnlock()
+
+	// expected
+	app, _ = create(`sleep 0.5; echo "out"; echo "err" >&2; exit 1`)
+	app.o.Lock()
+	unittest.IsNil(t, app.startApp())
+	app.patrol.shutdown = true
+	app.o.Unlock()
+	h = closed(app)
+	unittest.Equals(t, h.IsUnexpected(), false)
+	unittest.Equals(t, h.ExitCode, 1)
+	unittest.Equals(t, len(h.StdoutTail), 0)
+	unittest.Equals(t, len(h.StderrTail), 0)
+}
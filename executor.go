@@ -0,0 +1,162 @@
+package patrol
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+var (
+	ERR_EXECUTOR_NOT_STARTED = fmt.Errorf("Executor command was not started")
+)
+
+// Executor starts, waits on and signals our Apps, and runs our Service management commands
+// Our commands are built by Patrol, an Executor is only responsible for running them
+// SystemExecutor is our default, see patroltest.Executor for an in-memory Executor for testing
+type Executor interface {
+	// Start will start our command and return its PID, Start must not wait for our command to exit
+	// our command's Stdout, Stderr and ExtraFiles may be closed by Patrol once Start returns
+	Start(
+		cmd *exec.Cmd,
+	) (
+		uint32,
+		error,
+	)
+	// Wait will wait for our started command to exit
+	// an ExitStatus is returned regardless of our exit code, an error is only returned if we failed to wait
+	Wait(
+		cmd *exec.Cmd,
+	) (
+		*ExitStatus,
+		error,
+	)
+	// Signal will send our signal to our PID, our PID may not have been started by our Executor
+	Signal(
+		pid uint32,
+		sig syscall.Signal,
+	) error
+	// Status will return nil if our PID is running, this is our `kill -0 PID`
+	Status(
+		pid uint32,
+	) error
+}
+
+// ExecutorWatcher is an optional interface of our Executor, if it's implemented our App's check is woken as soon as our PID exits
+// exited must never be called once unwatch has been called
+type ExecutorWatcher interface {
+	Watch(
+		pid uint32,
+		exited func(),
+	) (
+		unwatch func(),
+	)
+}
+
+// ExitStatus is how our command exited
+type ExitStatus struct {
+	WaitStatus syscall.WaitStatus
+	// Rusage is our resource usage, this may be nil
+	Rusage *syscall.Rusage
+}
+
+// ExitError is returned by Patrol.runCommand() if our command did not exit with 0, the same as exec.ExitError
+type ExitError struct {
+	*ExitStatus
+}
+
+func (self *ExitError) Error() string {
+	if self.WaitStatus.Signaled() {
+		return "signal: " + signalName(self.WaitStatus.Signal())
+	}
+	return fmt.Sprintf("exit status %d", self.WaitStatus.ExitStatus())
+}
+
+// SystemExecutor executes our commands as processes of our operating system
+type SystemExecutor struct{}
+
+func (self SystemExecutor) Start(
+	cmd *exec.Cmd,
+) (
+	uint32,
+	error,
+) {
+	if err := cmd.Start(); err != nil {
+		return 0, err
+	}
+	return uint32(cmd.Process.Pid), nil
+}
+func (self SystemExecutor) Wait(
+	cmd *exec.Cmd,
+) (
+	*ExitStatus,
+	error,
+) {
+	if cmd.Process == nil {
+		return nil, ERR_EXECUTOR_NOT_STARTED
+	}
+	// our error is ignored if we have a ProcessState, our exit status is included even if copying our stdout or stderr failed
+	err := cmd.Wait()
+	if cmd.ProcessState == nil {
+		return nil, err
+	}
+	status, _ := cmd.ProcessState.Sys().(syscall.WaitStatus)
+	rusage, _ := cmd.ProcessState.SysUsage().(*syscall.Rusage)
+	return &ExitStatus{
+		WaitStatus: status,
+		Rusage:     rusage,
+	}, nil
+}
+func (self SystemExecutor) Signal(
+	pid uint32,
+	sig syscall.Signal,
+) error {
+	process, err := os.FindProcess(int(pid))
+	if err != nil {
+		return err
+	}
+	return process.Signal(sig)
+}
+func (self SystemExecutor) Status(
+	pid uint32,
+) error {
+	return self.Signal(pid, syscall.Signal(0))
+}
+
+// Watch will watch our PID with pidfd_open, or by polling our PID if pidfd_open is not supported
+func (self SystemExecutor) Watch(
+	pid uint32,
+	exited func(),
+) func() {
+	return watchPID(pid, exited).Close
+}
+
+// executor will return our Config.Executor, SystemExecutor is our default
+func (self *Patrol) executor() Executor {
+	if self.config.Executor != nil {
+		return self.config.Executor
+	}
+	return SystemExecutor{}
+}
+
+// runCommand will start our command and wait for it to exit
+// if we don't exit with 0 an *ExitError is returned, the same as cmd.Run()
+func (self *Patrol) runCommand(
+	cmd *exec.Cmd,
+) error {
+	e := self.executor()
+	if _, err := e.Start(cmd); err != nil {
+		return err
+	}
+	status, err := e.Wait(cmd)
+	if err != nil {
+		return err
+	}
+	if !status.WaitStatus.Exited() ||
+		status.WaitStatus.ExitStatus() != 0 {
+		return &ExitError{
+			ExitStatus: status,
+		}
+	}
+	return nil
+}
@@ -64,3 +64,13 @@ func dereference(
 	copy(safe, data)
 	return safe
 }
+func dereferenceStrings(
+	data []string,
+) []string {
+	if data == nil {
+		return nil
+	}
+	safe := make([]string, len(data))
+	copy(safe, data)
+	return safe
+}
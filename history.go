@@ -1,16 +1,75 @@
 package patrol
 
+import (
+	"fmt"
+	"syscall"
+	"time"
+)
+
+// signal_names are our Linux signal names, Signal.String() is a description and not a name
+var signal_names = map[syscall.Signal]string{
+	syscall.SIGHUP:    "SIGHUP",
+	syscall.SIGINT:    "SIGINT",
+	syscall.SIGQUIT:   "SIGQUIT",
+	syscall.SIGILL:    "SIGILL",
+	syscall.SIGTRAP:   "SIGTRAP",
+	syscall.SIGABRT:   "SIGABRT",
+	syscall.SIGBUS:    "SIGBUS",
+	syscall.SIGFPE:    "SIGFPE",
+	syscall.SIGKILL:   "SIGKILL",
+	syscall.SIGUSR1:   "SIGUSR1",
+	syscall.SIGSEGV:   "SIGSEGV",
+	syscall.SIGUSR2:   "SIGUSR2",
+	syscall.SIGPIPE:   "SIGPIPE",
+	syscall.SIGALRM:   "SIGALRM",
+	syscall.SIGTERM:   "SIGTERM",
+	syscall.SIGSTKFLT: "SIGSTKFLT",
+	syscall.SIGCHLD:   "SIGCHLD",
+	syscall.SIGCONT:   "SIGCONT",
+	syscall.SIGSTOP:   "SIGSTOP",
+	syscall.SIGTSTP:   "SIGTSTP",
+	syscall.SIGTTIN:   "SIGTTIN",
+	syscall.SIGTTOU:   "SIGTTOU",
+	syscall.SIGURG:    "SIGURG",
+	syscall.SIGXCPU:   "SIGXCPU",
+	syscall.SIGXFSZ:   "SIGXFSZ",
+	syscall.SIGVTALRM: "SIGVTALRM",
+	syscall.SIGPROF:   "SIGPROF",
+	syscall.SIGWINCH:  "SIGWINCH",
+	syscall.SIGIO:     "SIGIO",
+	syscall.SIGPWR:    "SIGPWR",
+	syscall.SIGSYS:    "SIGSYS",
+}
+
 type History struct {
-	InstanceID string                 `json:"instance-id,omitempty"`
-	PID        uint32                 `json:"pid,omitempty"`
-	Started    *Timestamp             `json:"started,omitempty"`
-	LastSeen   *Timestamp             `json:"lastseen,omitempty"`
-	Stopped    *Timestamp             `json:"stopped,omitempty"`
-	Disabled   bool                   `json:"disabled,omitempty"`
-	Restart    bool                   `json:"restart,omitempty"`
-	RunOnce    bool                   `json:"run-once,omitempty"`
-	Shutdown   bool                   `json:"shutdown,omitempty"`
-	ExitCode   uint8                  `json:"exit-code,omitempty"`
+	InstanceID string     `json:"instance-id,omitempty"`
+	PID        uint32     `json:"pid,omitempty"`
+	Started    *Timestamp `json:"started,omitempty"`
+	LastSeen   *Timestamp `json:"lastseen,omitempty"`
+	Stopped    *Timestamp `json:"stopped,omitempty"`
+	Disabled   bool       `json:"disabled,omitempty"`
+	Restart    bool       `json:"restart,omitempty"`
+	RunOnce    bool       `json:"run-once,omitempty"`
+	Shutdown   bool       `json:"shutdown,omitempty"`
+	// ExitCode is only set if our process exited, a process that was terminated by a signal has no exit code
+	// exit code is only garaunteed to exist for APP_KEEPALIVE_PID_PATROL, as is everything below
+	ExitCode uint8 `json:"exit-code,omitempty"`
+	// Signal is the name of the signal that terminated our process, ie: "SIGKILL"
+	Signal       string `json:"signal,omitempty"`
+	SignalNumber int    `json:"signal-number,omitempty"`
+	// CoreDump is true if our process dumped core when it was terminated
+	CoreDump bool `json:"core-dump,omitempty"`
+	// WaitStatus is our raw wait(2) status
+	WaitStatus uint32 `json:"wait-status,omitempty"`
+	// MaxRSS is the maximum resident set size of our process in kilobytes
+	MaxRSS int64 `json:"max-rss,omitempty"`
+	// UserTime and SystemTime are the CPU time used by our process in seconds
+	UserTime   float64 `json:"user-time,omitempty"`
+	SystemTime float64 `json:"system-time,omitempty"`
+	// StdoutTail and StderrTail are the last lines written by our App, see ConfigApp.CrashTail
+	// our tails are only kept if our exit was unexpected, if our App's output was merged our tail is StdoutTail
+	StdoutTail []string               `json:"stdout-tail,omitempty"`
+	StderrTail []string               `json:"stderr-tail,omitempty"`
 	KeyValue   map[string]interface{} `json:"keyvalue,omitempty"`
 }
 
@@ -25,17 +84,26 @@ func (self *History) clone() *History {
 		return nil
 	}
 	h := &History{
-		InstanceID: self.InstanceID,
-		PID:        self.PID,
-		Started:    self.Started,
-		LastSeen:   self.LastSeen,
-		Stopped:    self.Stopped,
-		Disabled:   self.Disabled,
-		Restart:    self.Restart,
-		RunOnce:    self.RunOnce,
-		Shutdown:   self.Shutdown,
-		ExitCode:   self.ExitCode,
-		KeyValue:   make(map[string]interface{}),
+		InstanceID:   self.InstanceID,
+		PID:          self.PID,
+		Started:      self.Started,
+		LastSeen:     self.LastSeen,
+		Stopped:      self.Stopped,
+		Disabled:     self.Disabled,
+		Restart:      self.Restart,
+		RunOnce:      self.RunOnce,
+		Shutdown:     self.Shutdown,
+		ExitCode:     self.ExitCode,
+		Signal:       self.Signal,
+		SignalNumber: self.SignalNumber,
+		CoreDump:     self.CoreDump,
+		WaitStatus:   self.WaitStatus,
+		MaxRSS:       self.MaxRSS,
+		UserTime:     self.UserTime,
+		SystemTime:   self.SystemTime,
+		StdoutTail:   dereferenceStrings(self.StdoutTail),
+		StderrTail:   dereferenceStrings(self.StderrTail),
+		KeyValue:     make(map[string]interface{}),
 	}
 	// dereference
 	for k, v := range self.KeyValue {
@@ -43,3 +111,65 @@ func (self *History) clone() *History {
 	}
 	return h
 }
+func (self *History) IsUnexpected() bool {
+	// we expected to close if we were disabled, restarting, consumed run once, or patrol is shutting down
+	// anything else is an unexpected exit
+	return !self.Disabled &&
+		!self.Restart &&
+		!self.RunOnce &&
+		!self.Shutdown
+}
+
+// Exit will return our exit code, or our signal if our process was terminated by a signal, ie: "SIGSEGV (core dumped)"
+func (self *History) Exit() string {
+	if self.Signal == "" {
+		return fmt.Sprintf("%d", self.ExitCode)
+	}
+	if self.CoreDump {
+		return self.Signal + " (core dumped)"
+	}
+	return self.Signal
+}
+
+// setExitStatus will copy our exit status and resource usage from our process once it has been waited on
+func (self *History) setExitStatus(
+	status *ExitStatus,
+) {
+	if status == nil {
+		// our process was never waited on
+		return
+	}
+	self.setWaitStatus(status.WaitStatus, status.Rusage)
+}
+func (self *History) setWaitStatus(
+	status syscall.WaitStatus,
+	rusage *syscall.Rusage,
+) {
+	self.WaitStatus = uint32(status)
+	if status.Exited() {
+		self.ExitCode = uint8(status.ExitStatus())
+	} else if status.Signaled() {
+		// ExitStatus() is -1, previously this would have become an exit code of 255
+		self.Signal = signalName(status.Signal())
+		self.SignalNumber = int(status.Signal())
+		self.CoreDump = status.CoreDump()
+	}
+	if rusage != nil {
+		// Maxrss is in kilobytes on Linux
+		self.MaxRSS = rusage.Maxrss
+		self.UserTime = time.Duration(rusage.Utime.Nano()).Seconds()
+		self.SystemTime = time.Duration(rusage.Stime.Nano()).Seconds()
+	}
+}
+func signalName(
+	sig syscall.Signal,
+) string {
+	if name, ok := signal_names[sig]; ok {
+		return name
+	}
+	if sig >= 34 && sig <= 64 {
+		// our real-time signals
+		return fmt.Sprintf("SIGRTMIN+%d", sig-34)
+	}
+	return fmt.Sprintf("SIG%d", int(sig))
+}
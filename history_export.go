@@ -0,0 +1,252 @@
+package patrol
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	HISTORY_EXPORT_CSV   = "csv"
+	HISTORY_EXPORT_JSONL = "jsonl"
+	// HISTORY_EXPORT_KEYVALUE_PREFIX is prefixed to each of our flattened KeyValue CSV columns, ie: `keyvalue.config.port`
+	HISTORY_EXPORT_KEYVALUE_PREFIX = "keyvalue."
+)
+
+var (
+	ERR_HISTORY_EXPORT_FORMAT_INVALID = fmt.Errorf("History Export Format must be `csv` or `jsonl`")
+)
+
+// HISTORY_EXPORT_COLUMNS are our CSV columns, in order
+// our flattened KeyValue columns follow our columns, sorted by key
+var HISTORY_EXPORT_COLUMNS = []string{
+	"group",
+	"id",
+	"instance-id",
+	"pid",
+	"started",
+	"lastseen",
+	"stopped",
+	"unexpected",
+	"disabled",
+	"restart",
+	"run-once",
+	"shutdown",
+	"exit-code",
+	"signal",
+	"signal-number",
+	"core-dump",
+	"wait-status",
+	"max-rss",
+	"user-time",
+	"system-time",
+	"stdout-tail",
+	"stderr-tail",
+}
+
+// history_export_timestamps are the names of timestamp layouts we will accept instead of a Go layout
+var history_export_timestamps = map[string]string{
+	"rfc3339":     time.RFC3339,
+	"rfc3339nano": time.RFC3339Nano,
+	"rfc1123":     time.RFC1123,
+	"rfc1123z":    time.RFC1123Z,
+	"rfc822":      time.RFC822,
+	"rfc822z":     time.RFC822Z,
+	"rfc850":      time.RFC850,
+	"ansic":       time.ANSIC,
+	"unixdate":    time.UnixDate,
+	"rubydate":    time.RubyDate,
+}
+
+// ExportHistory will write every History entry that matches our request, oldest first
+// our format is either HISTORY_EXPORT_CSV or HISTORY_EXPORT_JSONL, our Limit and Cursor are ignored
+// our timestamp is a Go layout or a name such as `rfc3339`, if our timestamp is empty our Config.Timestamp is used
+// our request is validated before anything is written, our query errors are returned as a single error
+func (self *Patrol) ExportHistory(
+	w io.Writer,
+	request *API_HistoryRequest,
+	format string,
+	timestamp string,
+) error {
+	if format != HISTORY_EXPORT_CSV &&
+		format != HISTORY_EXPORT_JSONL {
+		return ERR_HISTORY_EXPORT_FORMAT_INVALID
+	}
+	if !request.IsValid() {
+		return errors.New("Request NIL")
+	}
+	history, _, errs := self.queryHistory(request)
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, ", "))
+	}
+	return self.exportHistory(w, history, format, timestamp)
+}
+
+// exportHistory will write our queried History, our History must be newest first and our format must be valid
+func (self *Patrol) exportHistory(
+	w io.Writer,
+	history []*API_HistoryEntry,
+	format string,
+	timestamp string,
+) error {
+	if timestamp == "" {
+		timestamp = self.config.Timestamp
+	} else if layout, ok := history_export_timestamps[strings.ToLower(timestamp)]; ok {
+		timestamp = layout
+	}
+	// our query is newest first, we export in the order our History happened
+	for i, j := 0, len(history)-1; i < j; i, j = i+1, j-1 {
+		history[i], history[j] = history[j], history[i]
+	}
+	if format == HISTORY_EXPORT_JSONL {
+		return exportHistoryJSONL(w, history, timestamp)
+	}
+	return exportHistoryCSV(w, history, timestamp)
+}
+func exportHistoryJSONL(
+	w io.Writer,
+	history []*API_HistoryEntry,
+	timestamp string,
+) error {
+	e := json.NewEncoder(w)
+	for _, entry := range history {
+		// our History is a copy, but our Timestamps are shared
+		h := entry.History.clone()
+		h.Started = exportTimestamp(h.Started, timestamp)
+		h.LastSeen = exportTimestamp(h.LastSeen, timestamp)
+		h.Stopped = exportTimestamp(h.Stopped, timestamp)
+		if err := e.Encode(&API_HistoryEntry{
+			Group:   entry.Group,
+			ID:      entry.ID,
+			History: h,
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+func exportHistoryCSV(
+	w io.Writer,
+	history []*API_HistoryEntry,
+	timestamp string,
+) error {
+	// our KeyValue columns are every key of every row
+	rows := make([]map[string]string, 0, len(history))
+	keys := make(map[string]bool)
+	for _, entry := range history {
+		kv := make(map[string]string)
+		flattenKeyValue(HISTORY_EXPORT_KEYVALUE_PREFIX, entry.History.KeyValue, kv)
+		for k := range kv {
+			keys[k] = true
+		}
+		rows = append(rows, kv)
+	}
+	kv_columns := make([]string, 0, len(keys))
+	for k := range keys {
+		kv_columns = append(kv_columns, k)
+	}
+	sort.Strings(kv_columns)
+	c := csv.NewWriter(w)
+	if err := c.Write(append(append([]string{}, HISTORY_EXPORT_COLUMNS...), kv_columns...)); err != nil {
+		return err
+	}
+	for i, entry := range history {
+		h := entry.History
+		record := []string{
+			entry.Group,
+			entry.ID,
+			h.InstanceID,
+			strconv.FormatUint(uint64(h.PID), 10),
+			exportTime(h.Started, timestamp),
+			exportTime(h.LastSeen, timestamp),
+			exportTime(h.Stopped, timestamp),
+			strconv.FormatBool(h.IsUnexpected()),
+			strconv.FormatBool(h.Disabled),
+			strconv.FormatBool(h.Restart),
+			strconv.FormatBool(h.RunOnce),
+			strconv.FormatBool(h.Shutdown),
+			strconv.FormatUint(uint64(h.ExitCode), 10),
+			h.Signal,
+			strconv.Itoa(h.SignalNumber),
+			strconv.FormatBool(h.CoreDump),
+			strconv.FormatUint(uint64(h.WaitStatus), 10),
+			strconv.FormatInt(h.MaxRSS, 10),
+			strconv.FormatFloat(h.UserTime, 'f', -1, 64),
+			strconv.FormatFloat(h.SystemTime, 'f', -1, 64),
+			strings.Join(h.StdoutTail, "\n"),
+			strings.Join(h.StderrTail, "\n"),
+		}
+		for _, k := range kv_columns {
+			record = append(record, rows[i][k])
+		}
+		if err := c.Write(record); err != nil {
+			return err
+		}
+	}
+	c.Flush()
+	return c.Error()
+}
+
+// flattenKeyValue will flatten our nested objects with dotted keys, ie: `{"a":{"b":1}}` is `a.b`
+// strings are written as is, every other value is written as JSON
+// a key that already contains a dot may collide with a nested object, ie: `{"a.b":1,"a":{"b":2}}`
+// our keys are flattened in sorted order and our first value is kept, our collision is logged
+func flattenKeyValue(
+	prefix string,
+	kv map[string]interface{},
+	flat map[string]string,
+) {
+	keys := make([]string, 0, len(kv))
+	for k := range kv {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		key := prefix + k
+		if nested, ok := kv[k].(map[string]interface{}); ok {
+			flattenKeyValue(key+".", nested, flat)
+			continue
+		}
+		if _, ok := flat[key]; ok {
+			log.Printf("./patrol.flattenKeyValue(): Key: \"%s\" collides with another key and was not exported\n", key)
+			continue
+		}
+		switch value := kv[k].(type) {
+		case string:
+			flat[key] = value
+		case nil:
+			flat[key] = ""
+		default:
+			bs, _ := json.Marshal(value)
+			flat[key] = string(bs)
+		}
+	}
+}
+func exportTimestamp(
+	t *Timestamp,
+	timestamp string,
+) *Timestamp {
+	if t == nil {
+		return nil
+	}
+	return &Timestamp{
+		Time:            t.Time,
+		TimestampFormat: timestamp,
+	}
+}
+func exportTime(
+	t *Timestamp,
+	timestamp string,
+) string {
+	if t == nil {
+		return ""
+	}
+	return exportTimestamp(t, timestamp).String()
+}
@@ -0,0 +1,234 @@
+package patrol
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"log"
+	"net/http/httptest"
+	"sabey.co/unittest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExportHistory(t *testing.T) {
+	log.Println("TestExportHistory")
+
+	p, err := CreatePatrol(&Config{
+		Apps: map[string]*ConfigApp{
+			"web": &ConfigApp{
+				KeepAlive:        APP_KEEPALIVE_PID_APP,
+				Name:             "Web",
+				Binary:           "web",
+				WorkingDirectory: "/web",
+				LogDirectory:     "logs",
+				PIDPath:          "web.pid",
+			},
+		},
+		Services: map[string]*ConfigService{
+			"ssh": &ConfigService{
+				Management: SERVICE_MANAGEMENT_SERVICE,
+				Name:       "SSH",
+				Service:    "ssh",
+			},
+		},
+		Timestamp: time.RFC1123Z,
+	})
+	unittest.IsNil(t, err)
+
+	started := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	p.apps["web"].history = []*History{
+		&History{
+			InstanceID: "web-1",
+			PID:        100,
+			Started: &Timestamp{
+				Time:            started,
+				TimestampFormat: time.RFC1123Z,
+			},
+			Stopped: &Timestamp{
+				Time:            started.Add(time.Hour),
+				TimestampFormat: time.RFC1123Z,
+			},
+			Signal:       "SIGSEGV",
+			SignalNumber: 11,
+			CoreDump:     true,
+			UserTime:     1.5,
+			StderrTail:   []string{"panic: a", "goroutine 1"},
+			KeyValue: map[string]interface{}{
+				"version": "1.0",
+				"config": map[string]interface{}{
+					"port":  8080.0,
+					"hosts": []interface{}{"a", "b"},
+				},
+			},
+		},
+		&History{
+			InstanceID: "web-2",
+			PID:        101,
+			Started: &Timestamp{
+				Time:            started.Add(time.Hour * 2),
+				TimestampFormat: time.RFC1123Z,
+			},
+			Stopped: &Timestamp{
+				Time:            started.Add(time.Hour * 3),
+				TimestampFormat: time.RFC1123Z,
+			},
+			Restart:  true,
+			KeyValue: map[string]interface{}{},
+		},
+	}
+	p.services["ssh"].history = []*History{
+		&History{
+			InstanceID: "ssh-1",
+			Stopped: &Timestamp{
+				Time:            started.Add(time.Minute * 90),
+				TimestampFormat: time.RFC1123Z,
+			},
+			ExitCode: 1,
+			KeyValue: map[string]interface{}{
+				"enabled": true,
+			},
+		},
+	}
+
+	// csv
+	b := &bytes.Buffer{}
+	unittest.IsNil(t, p.ExportHistory(b, &API_HistoryRequest{}, HISTORY_EXPORT_CSV, ""))
+	records, err := csv.NewReader(b).ReadAll()
+	unittest.IsNil(t, err)
+	unittest.Equals(t, len(records), 4)
+	columns := append(append([]string{}, HISTORY_EXPORT_COLUMNS...), "keyvalue.config.hosts", "keyvalue.config.port", "keyvalue.enabled", "keyvalue.version")
+	unittest.Equals(t, records[0], columns)
+	row := func(record []string) map[string]string {
+		r := make(map[string]string)
+		for i, c := range columns {
+			r[c] = record[i]
+		}
+		return r
+	}
+	// oldest first
+	web1 := row(records[1])
+	unittest.Equals(t, web1["group"], "app")
+	unittest.Equals(t, web1["id"], "web")
+	unittest.Equals(t, web1["instance-id"], "web-1")
+	unittest.Equals(t, web1["pid"], "100")
+	// our Config.Timestamp is used by default
+	unittest.Equals(t, web1["started"], started.Format(time.RFC1123Z))
+	unittest.Equals(t, web1["lastseen"], "")
+	unittest.Equals(t, web1["unexpected"], "true")
+	unittest.Equals(t, web1["signal"], "SIGSEGV")
+	unittest.Equals(t, web1["signal-number"], "11")
+	unittest.Equals(t, web1["core-dump"], "true")
+	unittest.Equals(t, web1["user-time"], "1.5")
+	unittest.Equals(t, web1["stderr-tail"], "panic: a\ngoroutine 1")
+	unittest.Equals(t, web1["keyvalue.version"], "1.0")
+	unittest.Equals(t, web1["keyvalue.config.port"], "8080")
+	unittest.Equals(t, web1["keyvalue.config.hosts"], `["a","b"]`)
+	unittest.Equals(t, web1["keyvalue.enabled"], "")
+	ssh1 := row(records[2])
+	unittest.Equals(t, ssh1["group"], "service")
+	unittest.Equals(t, ssh1["exit-code"], "1")
+	unittest.Equals(t, ssh1["started"], "")
+	unittest.Equals(t, ssh1["keyvalue.enabled"], "true")
+	web2 := row(records[3])
+	unittest.Equals(t, web2["instance-id"], "web-2")
+	unittest.Equals(t, web2["unexpected"], "false")
+	unittest.Equals(t, web2["restart"], "true")
+
+	// our requested timestamp and our filters
+	b.Reset()
+	unittest.IsNil(t, p.ExportHistory(b, &API_HistoryRequest{
+		Group: "app",
+		ID:    "web",
+	}, HISTORY_EXPORT_CSV, "RFC3339"))
+	records, err = csv.NewReader(b).ReadAll()
+	unittest.IsNil(t, err)
+	unittest.Equals(t, len(records), 3)
+	// our KeyValue columns are only the keys we've exported
+	unittest.Equals(t, len(records[0]), len(HISTORY_EXPORT_COLUMNS)+3)
+	unittest.Equals(t, records[1][4], "2020-01-01T00:00:00Z")
+	b.Reset()
+	unittest.IsNil(t, p.ExportHistory(b, &API_HistoryRequest{
+		Group: "app",
+		ID:    "web",
+	}, HISTORY_EXPORT_CSV, "2006-01-02"))
+	records, err = csv.NewReader(b).ReadAll()
+	unittest.IsNil(t, err)
+	unittest.Equals(t, records[1][4], "2020-01-01")
+
+	// jsonl
+	b.Reset()
+	unittest.IsNil(t, p.ExportHistory(b, &API_HistoryRequest{
+		Unexpected: true,
+	}, HISTORY_EXPORT_JSONL, "rfc3339"))
+	lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+	unittest.Equals(t, len(lines), 2)
+	entry := &API_HistoryEntry{}
+	unittest.IsNil(t, json.Unmarshal([]byte(lines[0]), entry))
+	unittest.Equals(t, entry.Group, "app")
+	unittest.Equals(t, entry.ID, "web")
+	unittest.Equals(t, entry.History.InstanceID, "web-1")
+	unittest.Equals(t, entry.History.KeyValue["config"].(map[string]interface{})["port"], 8080.0)
+	unittest.Equals(t, strings.Contains(lines[0], `"started":"2020-01-01T00:00:00Z"`), true)
+	unittest.IsNil(t, json.Unmarshal([]byte(lines[1]), entry))
+	unittest.Equals(t, entry.History.InstanceID, "ssh-1")
+	// our History was never modified
+	unittest.Equals(t, p.apps["web"].history[0].Started.TimestampFormat, time.RFC1123Z)
+
+	// errors
+	unittest.Equals(t, p.ExportHistory(b, &API_HistoryRequest{}, "xml", ""), ERR_HISTORY_EXPORT_FORMAT_INVALID)
+	unittest.Equals(t, p.ExportHistory(b, &API_HistoryRequest{Group: "app", ID: "unknown"}, HISTORY_EXPORT_CSV, "").Error(), "Unknown App")
+	unittest.Equals(t, p.ExportHistory(b, nil, HISTORY_EXPORT_CSV, "").Error(), "Request NIL")
+
+	// http
+	r := httptest.NewRequest("GET", "/api/history/export?group=service&format=jsonl", nil)
+	w := httptest.NewRecorder()
+	p.ServeHTTPAPIHistoryExport(w, r)
+	unittest.Equals(t, w.Code, 200)
+	unittest.Equals(t, w.Header().Get("Content-Type"), "application/x-ndjson; charset=utf-8")
+	unittest.Equals(t, w.Header().Get("Content-Disposition"), `attachment; filename="history.jsonl"`)
+	unittest.Equals(t, strings.Count(w.Body.String(), "\n"), 1)
+	r = httptest.NewRequest("GET", "/api/history/export?unexpected&timestamp=2006", nil)
+	w = httptest.NewRecorder()
+	p.ServeHTTPAPIHistoryExport(w, r)
+	unittest.Equals(t, w.Code, 200)
+	unittest.Equals(t, w.Header().Get("Content-Type"), "text/csv; charset=utf-8")
+	records, err = csv.NewReader(w.Body).ReadAll()
+	unittest.IsNil(t, err)
+	unittest.Equals(t, len(records), 3)
+	unittest.Equals(t, records[1][4], "2020")
+	// errors are never written into our export
+	r = httptest.NewRequest("GET", "/api/history/export?format=xml", nil)
+	w = httptest.NewRecorder()
+	p.ServeHTTPAPIHistoryExport(w, r)
+	unittest.Equals(t, w.Code, 400)
+	response := &API_HistoryResponse{}
+	unittest.IsNil(t, json.Unmarshal(w.Body.Bytes(), response))
+	unittest.Equals(t, response.Errors, []string{"Invalid Format"})
+	r = httptest.NewRequest("GET", "/api/history/export?group=app&id=unknown", nil)
+	w = httptest.NewRecorder()
+	p.ServeHTTPAPIHistoryExport(w, r)
+	unittest.Equals(t, w.Code, 400)
+	unittest.IsNil(t, json.Unmarshal(w.Body.Bytes(), response))
+	unittest.Equals(t, response.Errors, []string{"Unknown App"})
+}
+func TestFlattenKeyValue(t *testing.T) {
+	log.Println("TestFlattenKeyValue")
+
+	flat := make(map[string]string)
+	flattenKeyValue(HISTORY_EXPORT_KEYVALUE_PREFIX, map[string]interface{}{
+		"a.b": "literal",
+		"a": map[string]interface{}{
+			"b": "nested",
+			"c": 1,
+		},
+		"a.d": true,
+	}, flat)
+	// our keys are flattened in sorted order, our first value is kept
+	unittest.Equals(t, flat, map[string]string{
+		"keyvalue.a.b": "nested",
+		"keyvalue.a.c": "1",
+		"keyvalue.a.d": "true",
+	})
+}
@@ -0,0 +1,98 @@
+package patrol
+
+import (
+	"log"
+	"os/exec"
+	"sabey.co/unittest"
+	"syscall"
+	"testing"
+)
+
+func TestHistoryProcessState(t *testing.T) {
+	log.Println("TestHistoryProcessState")
+
+	wait := func(script string) *History {
+		cmd := exec.Command("/bin/sh", "-c", script)
+		_, err := SystemExecutor{}.Start(cmd)
+		unittest.IsNil(t, err)
+		status, err := SystemExecutor{}.Wait(cmd)
+		unittest.IsNil(t, err)
+		h := &History{}
+		h.setExitStatus(status)
+		return h
+	}
+
+	// exited
+	h := wait("exit 0")
+	unittest.Equals(t, h.ExitCode, 0)
+	unittest.Equals(t, h.Signal, "")
+	unittest.Equals(t, h.WaitStatus, 0)
+	unittest.Equals(t, h.Exit(), "0")
+	unittest.Equals(t, h.MaxRSS > 0, true)
+
+	h = wait("exit 255")
+	unittest.Equals(t, h.ExitCode, 255)
+	unittest.Equals(t, h.Signal, "")
+	unittest.Equals(t, h.SignalNumber, 0)
+	unittest.Equals(t, h.WaitStatus, 255<<8)
+	unittest.Equals(t, h.Exit(), "255")
+
+	// signalled, this is NOT an exit code of 255
+	h = wait("kill -KILL $$")
+	unittest.Equals(t, h.ExitCode, 0)
+	unittest.Equals(t, h.Signal, "SIGKILL")
+	unittest.Equals(t, h.SignalNumber, 9)
+	unittest.Equals(t, h.CoreDump, false)
+	unittest.Equals(t, h.WaitStatus, 9)
+	unittest.Equals(t, h.Exit(), "SIGKILL")
+
+	h = wait("kill -TERM $$")
+	unittest.Equals(t, h.Signal, "SIGTERM")
+	unittest.Equals(t, h.SignalNumber, 15)
+
+	// our core dump is set by our kernel, we can't rely on `ulimit -c`
+	h = &History{}
+	h.setWaitStatus(syscall.WaitStatus(0x80|11), nil)
+	unittest.Equals(t, h.ExitCode, 0)
+	unittest.Equals(t, h.Signal, "SIGSEGV")
+	unittest.Equals(t, h.SignalNumber, 11)
+	unittest.Equals(t, h.CoreDump, true)
+	unittest.Equals(t, h.WaitStatus, 0x80|11)
+	unittest.Equals(t, h.MaxRSS, 0)
+	unittest.Equals(t, h.Exit(), "SIGSEGV (core dumped)")
+
+	// our resource usage
+	h = &History{}
+	h.setWaitStatus(syscall.WaitStatus(0), &syscall.Rusage{
+		Utime:  syscall.Timeval{Sec: 1, Usec: 500000},
+		Stime:  syscall.Timeval{Sec: 0, Usec: 250000},
+		Maxrss: 1024,
+	})
+	unittest.Equals(t, h.UserTime, 1.5)
+	unittest.Equals(t, h.SystemTime, 0.25)
+	unittest.Equals(t, h.MaxRSS, 1024)
+
+	// our clone
+	h.Signal = "SIGKILL"
+	h.SignalNumber = 9
+	h.CoreDump = true
+	h.WaitStatus = 9
+	h.KeyValue = map[string]interface{}{
+		"k": "v",
+	}
+	clone := h.clone()
+	unittest.Equals(t, clone, h)
+	// our KeyValue is copied
+	clone.KeyValue["k"] = "modified"
+	unittest.Equals(t, h.KeyValue["k"], "v")
+
+	// never waited on
+	h = &History{}
+	h.setExitStatus(nil)
+	unittest.Equals(t, h, &History{})
+
+	unittest.Equals(t, signalName(syscall.SIGUSR1), "SIGUSR1")
+	unittest.Equals(t, signalName(syscall.Signal(34)), "SIGRTMIN+0")
+	unittest.Equals(t, signalName(syscall.Signal(40)), "SIGRTMIN+6")
+	unittest.Equals(t, signalName(syscall.Signal(99)), "SIG99")
+}
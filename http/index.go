@@ -54,10 +54,8 @@ func Index(
 				if post.Toggle > 0 {
 					if post.Group == "app" {
 						if app := p.GetApp(post.ID); app.IsValid() {
-							c := app.GetConfig()
-							// validate secret
-							if c.Secret == "" ||
-								c.Secret == post.Secret {
+							// validate token, secret and client identity
+							if p.IsHTTPAuthorized(r, "app", post.ID, post.Secret, patrol.TOKEN_SCOPE_TOGGLE) {
 								// toggle
 								app.Toggle(post.Toggle)
 								// success!
@@ -65,17 +63,15 @@ func Index(
 								w.WriteHeader(302)
 								return
 							} else {
-								post.Error = "Secret Invalid"
+								post.Error = "Unauthorized"
 							}
 						} else {
 							post.Error = "Unknown App"
 						}
 					} else if post.Group == "service" {
 						if service := p.GetService(post.ID); service.IsValid() {
-							c := service.GetConfig()
-							// validate secret
-							if c.Secret == "" ||
-								c.Secret == post.Secret {
+							// validate token, secret and client identity
+							if p.IsHTTPAuthorized(r, "service", post.ID, post.Secret, patrol.TOKEN_SCOPE_TOGGLE) {
 								// toggle
 								service.Toggle(post.Toggle)
 								// success!
@@ -83,7 +79,7 @@ func Index(
 								w.WriteHeader(302)
 								return
 							} else {
-								post.Error = "Secret Invalid"
+								post.Error = "Unauthorized"
 							}
 						} else {
 							post.Error = "Unknown Service"
@@ -98,6 +94,13 @@ func Index(
 				post.Error = "Bad POST"
 			}
 		}
+		// if our Token is presented or required, we only show the Apps and Services our Token may read
+		status := p.GetTokenStatus(patrol.RequestToken(r))
+		if status == nil {
+			w.WriteHeader(401)
+			fmt.Fprintln(w, "Unauthorized")
+			return
+		}
 		// we do NOT care about the overhead of parsing our template on each request
 		// we might change this later, but if we do not have a lot of traffic there's no reason to
 		t, err := template.ParseGlob("tmpl/*.tmpl")
@@ -121,7 +124,7 @@ func Index(
 		}
 		data := &Data{
 			Patrol:     p,
-			Status:     p.GetStatus(),
+			Status:     status,
 			StatusPost: post,
 			Now:        time.Now(),
 		}
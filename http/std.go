@@ -44,14 +44,11 @@ func std(
 		return
 	}
 	secret := q.Get("secret")
-	// get config
-	c := app.GetConfig()
-	// validate secret
-	if c.Secret != "" &&
-		c.Secret != secret {
+	// validate token, secret and client identity
+	if !p.IsHTTPAuthorized(r, "app", id, secret, patrol.TOKEN_SCOPE_READ) {
 		w.Header().Set("Content-Type", "text/html; charset=utf-8")
 		w.WriteHeader(405)
-		fmt.Fprintln(w, "Secret Invalid")
+		fmt.Fprintln(w, "Unauthorized")
 		return
 	}
 	var last uint64 = 0
@@ -0,0 +1,319 @@
+package patrol
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+const (
+	LISTEN_UNIX_PREFIX     = `unix:`
+	LISTEN_UNIXGRAM_PREFIX = `unixgram:`
+)
+
+var (
+	ERR_LISTEN_UNIX_INVALID  = fmt.Errorf("Unix Listener was invalid, we require an absolute clean path prefixed with either `unix:` or `unixgram:`")
+	ERR_SOCKET_MODE_INVALID  = fmt.Errorf("Socket Mode was invalid, we require an octal string such as \"0660\"")
+	ERR_SOCKET_OWNER_INVALID = fmt.Errorf("Socket Owner was not found")
+	ERR_SOCKET_GROUP_INVALID = fmt.Errorf("Socket Group was not found")
+	ERR_PEER_UNAUTHORIZED    = fmt.Errorf("Peer Credentials were not authorized")
+)
+
+type peer_credentials_key struct{}
+
+// ParseListen will return the network and address of a listener
+//
+// `unix:/run/patrol.sock` will return: `unix`, `/run/patrol.sock`
+// `unixgram:/run/patrol.sock` will return: `unixgram`, `/run/patrol.sock`
+// Any other value will return our default network and the unmodified address
+func ParseListen(
+	listen string,
+	network string,
+) (
+	string,
+	string,
+) {
+	if strings.HasPrefix(listen, LISTEN_UNIX_PREFIX) {
+		return "unix", listen[len(LISTEN_UNIX_PREFIX):]
+	}
+	if strings.HasPrefix(listen, LISTEN_UNIXGRAM_PREFIX) {
+		return "unixgram", listen[len(LISTEN_UNIXGRAM_PREFIX):]
+	}
+	return network, listen
+}
+func IsListenUnix(
+	listen string,
+) bool {
+	return strings.HasPrefix(listen, LISTEN_UNIX_PREFIX) ||
+		strings.HasPrefix(listen, LISTEN_UNIXGRAM_PREFIX)
+}
+func isListenUnixValid(
+	listen string,
+) bool {
+	if !IsListenUnix(listen) {
+		return false
+	}
+	_, path := ParseListen(listen, "")
+	if path == "" ||
+		path[0] != '/' ||
+		!IsPathClean(path) {
+		return false
+	}
+	return true
+}
+func isListenUnixNetwork(
+	listen string,
+	network string,
+) bool {
+	n, _ := ParseListen(listen, "")
+	return n == network
+}
+func parseSocketMode(
+	mode string,
+) (
+	os.FileMode,
+	error,
+) {
+	m, err := strconv.ParseUint(mode, 8, 32)
+	if err != nil ||
+		m > 0777 {
+		return 0, ERR_SOCKET_MODE_INVALID
+	}
+	return os.FileMode(m), nil
+}
+
+// ListenHTTP will create a listener from ConfigHTTP
+// If our listener is prefixed with `unix:` we will create a unix domain socket and set our socket mode and owner
+// If PeerUIDs or PeerGIDs are set, our unix listener will close any connection that isn't authorized
+// If TLSCert and TLSKey are set, our listener will serve TLS
+func ListenHTTP(
+	config *ConfigHTTP,
+) (
+	net.Listener,
+	error,
+) {
+	l, err := listenHTTP(config)
+	if err != nil {
+		return nil, err
+	}
+	if !config.IsTLS() {
+		return l, nil
+	}
+	c, err := TLSConfig(config)
+	if err != nil {
+		l.Close()
+		return nil, err
+	}
+	return tls.NewListener(l, c), nil
+}
+func listenHTTP(
+	config *ConfigHTTP,
+) (
+	net.Listener,
+	error,
+) {
+	network, address := ParseListen(config.Listen, "tcp")
+	if network != "unix" {
+		return net.Listen(network, address)
+	}
+	// remove a stale socket
+	// if this isn't a socket we're not going to remove it and our listener will fail
+	if fi, err := os.Lstat(address); err == nil &&
+		fi.Mode()&os.ModeSocket != 0 {
+		os.Remove(address)
+	}
+	l, err := net.Listen(network, address)
+	if err != nil {
+		return nil, err
+	}
+	if err := setupSocket(address, config.SocketMode, config.SocketOwner, config.SocketGroup); err != nil {
+		l.Close()
+		return nil, err
+	}
+	return &peer_listener{
+		UnixListener: l.(*net.UnixListener),
+		uids:         config.PeerUIDs,
+		gids:         config.PeerGIDs,
+	}, nil
+}
+
+// ListenUDP will create a packet listener from ConfigUDP
+// If our listener is prefixed with `unixgram:` we will create a unix datagram socket and set our socket mode and owner
+func ListenUDP(
+	config *ConfigUDP,
+) (
+	net.PacketConn,
+	error,
+) {
+	network, address := ParseListen(config.Listen, "udp")
+	if network != "unixgram" {
+		return net.ListenPacket(network, address)
+	}
+	// remove a stale socket
+	if fi, err := os.Lstat(address); err == nil &&
+		fi.Mode()&os.ModeSocket != 0 {
+		os.Remove(address)
+	}
+	conn, err := net.ListenPacket(network, address)
+	if err != nil {
+		return nil, err
+	}
+	if err := setupSocket(address, config.SocketMode, config.SocketOwner, config.SocketGroup); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+func setupSocket(
+	path string,
+	mode string,
+	owner string,
+	group string,
+) error {
+	if mode != "" {
+		m, err := parseSocketMode(mode)
+		if err != nil {
+			return err
+		}
+		if err := os.Chmod(path, m); err != nil {
+			return err
+		}
+	}
+	if owner == "" &&
+		group == "" {
+		return nil
+	}
+	// -1 will leave our uid or gid unchanged
+	uid, gid := -1, -1
+	if owner != "" {
+		u, err := user.Lookup(owner)
+		if err != nil {
+			u, err = user.LookupId(owner)
+		}
+		if err != nil {
+			return ERR_SOCKET_OWNER_INVALID
+		}
+		uid, _ = strconv.Atoi(u.Uid)
+	}
+	if group != "" {
+		g, err := user.LookupGroup(group)
+		if err != nil {
+			g, err = user.LookupGroupId(group)
+		}
+		if err != nil {
+			return ERR_SOCKET_GROUP_INVALID
+		}
+		gid, _ = strconv.Atoi(g.Gid)
+	}
+	return os.Chown(path, uid, gid)
+}
+
+// peer_listener will verify the SO_PEERCRED of every accepted connection
+type peer_listener struct {
+	*net.UnixListener
+	uids []uint32
+	gids []uint32
+}
+
+func (self *peer_listener) Accept() (
+	net.Conn,
+	error,
+) {
+	for {
+		conn, err := self.UnixListener.AcceptUnix()
+		if err != nil {
+			return nil, err
+		}
+		if len(self.uids) == 0 &&
+			len(self.gids) == 0 {
+			// no authorization
+			return conn, nil
+		}
+		cred, err := getPeerCredentials(conn)
+		if err == nil &&
+			isPeerAuthorized(cred, self.uids, self.gids) {
+			return conn, nil
+		}
+		// we're not going to return an error here, http.Serve would stop serving!
+		if err == nil {
+			err = ERR_PEER_UNAUTHORIZED
+		}
+		log.Printf("./patrol.peer_listener.Accept(): closing connection: \"%s\"\n", err)
+		conn.Close()
+	}
+}
+func getPeerCredentials(
+	conn *net.UnixConn,
+) (
+	*syscall.Ucred,
+	error,
+) {
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return nil, err
+	}
+	var cred *syscall.Ucred
+	var cred_err error
+	err = raw.Control(func(fd uintptr) {
+		cred, cred_err = syscall.GetsockoptUcred(int(fd), syscall.SOL_SOCKET, syscall.SO_PEERCRED)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if cred_err != nil {
+		return nil, cred_err
+	}
+	return cred, nil
+}
+func isPeerAuthorized(
+	cred *syscall.Ucred,
+	uids []uint32,
+	gids []uint32,
+) bool {
+	for _, uid := range uids {
+		if cred.Uid == uid {
+			return true
+		}
+	}
+	for _, gid := range gids {
+		if cred.Gid == gid {
+			return true
+		}
+	}
+	return false
+}
+
+// ConnContext should be used as our http.Server.ConnContext
+// This will allow our handlers to read PeerCredentials() when we're served from a unix domain socket
+func ConnContext(
+	ctx context.Context,
+	conn net.Conn,
+) context.Context {
+	if c, ok := conn.(*tls.Conn); ok {
+		// our peer credentials belong to our underlying connection
+		conn = c.NetConn()
+	}
+	if c, ok := conn.(*net.UnixConn); ok {
+		if cred, err := getPeerCredentials(c); err == nil {
+			return context.WithValue(ctx, peer_credentials_key{}, cred)
+		}
+	}
+	return ctx
+}
+
+// PeerCredentials will return the credentials of the process that connected to our unix domain socket
+// If our request was not served from a unix domain socket, or ConnContext was not used, nil will be returned
+func PeerCredentials(
+	r *http.Request,
+) *syscall.Ucred {
+	cred, _ := r.Context().Value(peer_credentials_key{}).(*syscall.Ucred)
+	return cred
+}
@@ -0,0 +1,240 @@
+package patrol
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"sabey.co/unittest"
+	"testing"
+	"time"
+)
+
+func TestListenParse(t *testing.T) {
+	log.Println("TestListenParse")
+
+	network, address := ParseListen("127.0.0.1:8421", "tcp")
+	unittest.Equals(t, network, "tcp")
+	unittest.Equals(t, address, "127.0.0.1:8421")
+
+	network, address = ParseListen("unix:/run/patrol.sock", "tcp")
+	unittest.Equals(t, network, "unix")
+	unittest.Equals(t, address, "/run/patrol.sock")
+
+	network, address = ParseListen("unixgram:/run/patrol.sock", "udp")
+	unittest.Equals(t, network, "unixgram")
+	unittest.Equals(t, address, "/run/patrol.sock")
+
+	unittest.Equals(t, IsListenUnix("127.0.0.1:8421"), false)
+	unittest.Equals(t, IsListenUnix("unix:/run/patrol.sock"), true)
+	unittest.Equals(t, IsListenUnix("unixgram:/run/patrol.sock"), true)
+
+	unittest.Equals(t, isListenUnixValid("unix:"), false)
+	unittest.Equals(t, isListenUnixValid("unix:patrol.sock"), false)
+	unittest.Equals(t, isListenUnixValid("unix:/run/../patrol.sock"), false)
+	unittest.Equals(t, isListenUnixValid("unix:/run/patrol.sock"), true)
+
+	// http
+	config := &ConfigHTTP{
+		Listen: "unixgram:/run/patrol.sock",
+	}
+	unittest.Equals(t, config.Validate(), ERR_LISTEN_UNIX_INVALID)
+	config.Listen = "unix:/run/patrol.sock"
+	unittest.IsNil(t, config.Validate())
+	config.SocketMode = "999"
+	unittest.Equals(t, config.Validate(), ERR_SOCKET_MODE_INVALID)
+	config.SocketMode = "1777"
+	unittest.Equals(t, config.Validate(), ERR_SOCKET_MODE_INVALID)
+	config.SocketMode = "0660"
+	unittest.IsNil(t, config.Validate())
+
+	// udp
+	config_udp := &ConfigUDP{
+		Listen: "unix:/run/patrol.sock",
+	}
+	unittest.Equals(t, config_udp.Validate(), ERR_LISTEN_UNIX_INVALID)
+	config_udp.Listen = "unixgram:/run/patrol.sock"
+	unittest.IsNil(t, config_udp.Validate())
+
+	// listen unix
+	c := &Config{
+		Apps: map[string]*ConfigApp{
+			"http": &ConfigApp{
+				KeepAlive:        APP_KEEPALIVE_HTTP,
+				Name:             "http",
+				Binary:           "testapp",
+				WorkingDirectory: "/testapp",
+				LogDirectory:     "logs",
+			},
+		},
+	}
+	unittest.Equals(t, c.Validate(), ERR_LISTEN_HTTP_EMPTY)
+	c.ListenUnix = []string{"unixgram:/run/patrol.sock"}
+	unittest.Equals(t, c.Validate(), ERR_LISTEN_HTTP_EMPTY)
+	c.ListenUnix = []string{"tcp:/run/patrol.sock"}
+	unittest.Equals(t, c.Validate(), ERR_LISTEN_UNIX_INVALID)
+	c.ListenUnix = []string{"unix:/run/patrol.sock"}
+	unittest.IsNil(t, c.Validate())
+	c.HTTP = config
+	c.HTTP.SocketMode = "abc"
+	unittest.Equals(t, c.Validate(), ERR_SOCKET_MODE_INVALID)
+}
+func TestListenUnix(t *testing.T) {
+	log.Println("TestListenUnix")
+
+	dir, err := ioutil.TempDir("", "patrol-listen")
+	unittest.IsNil(t, err)
+	defer os.RemoveAll(dir)
+
+	config := &Config{
+		Apps: map[string]*ConfigApp{
+			"http": &ConfigApp{
+				KeepAlive:        APP_KEEPALIVE_HTTP,
+				Name:             "http",
+				Binary:           "testapp",
+				WorkingDirectory: "/testapp",
+				LogDirectory:     "logs",
+			},
+			"udp": &ConfigApp{
+				KeepAlive:        APP_KEEPALIVE_UDP,
+				Name:             "udp",
+				Binary:           "testapp",
+				WorkingDirectory: "/testapp",
+				LogDirectory:     "logs",
+			},
+		},
+		ListenUnix: []string{
+			fmt.Sprintf("unix:%s/http.sock", dir),
+			fmt.Sprintf("unixgram:%s/udp.sock", dir),
+		},
+		HTTP: &ConfigHTTP{
+			Listen:     fmt.Sprintf("unix:%s/http.sock", dir),
+			SocketMode: "0600",
+			PeerUIDs:   []uint32{uint32(os.Getuid())},
+		},
+		UDP: &ConfigUDP{
+			Listen:     fmt.Sprintf("unixgram:%s/udp.sock", dir),
+			SocketMode: "0620",
+		},
+	}
+	patrol, err := CreatePatrol(config)
+	unittest.IsNil(t, err)
+
+	// http
+	l, err := ListenHTTP(patrol.GetConfig().HTTP)
+	unittest.IsNil(t, err)
+	defer l.Close()
+	fi, err := os.Stat(dir + "/http.sock")
+	unittest.IsNil(t, err)
+	unittest.Equals(t, fi.Mode()&os.ModeSocket != 0, true)
+	unittest.Equals(t, fi.Mode().Perm(), os.FileMode(0600))
+
+	uid := make(chan uint32, 1)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/", func(w http.ResponseWriter, r *http.Request) {
+		if cred := PeerCredentials(r); cred != nil {
+			uid <- cred.Uid
+		}
+		patrol.ServeHTTPAPI(w, r)
+	})
+	server := &http.Server{
+		Handler:     mux,
+		ConnContext: ConnContext,
+	}
+	go server.Serve(l)
+	defer server.Close()
+
+	client := &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return net.Dial("unix", dir+"/http.sock")
+			},
+		},
+	}
+	bs, _ := json.Marshal(&API_Request{
+		ID:    "http",
+		Group: "app",
+		Ping:  true,
+		PID:   1234,
+	})
+	resp, err := client.Post("http://unix/api/", "application/json", bytes.NewReader(bs))
+	unittest.IsNil(t, err)
+	resp.Body.Close()
+	unittest.Equals(t, resp.StatusCode, 200)
+	unittest.Equals(t, <-uid, uint32(os.Getuid()))
+	unittest.Equals(t, patrol.GetApp("http").GetPID(), uint32(1234))
+	unittest.Equals(t, patrol.GetApp("http").IsRunning(), true)
+
+	// udp
+	conn, err := ListenUDP(patrol.GetConfig().UDP)
+	unittest.IsNil(t, err)
+	defer conn.Close()
+	fi, err = os.Stat(dir + "/udp.sock")
+	unittest.IsNil(t, err)
+	unittest.Equals(t, fi.Mode().Perm(), os.FileMode(0620))
+
+	// our client must bind to receive a response
+	client_addr := &net.UnixAddr{Name: dir + "/client.sock", Net: "unixgram"}
+	client_conn, err := net.ListenUnixgram("unixgram", client_addr)
+	unittest.IsNil(t, err)
+	defer client_conn.Close()
+	bs, _ = json.Marshal(&API_Request{
+		ID:    "udp",
+		Group: "app",
+		Ping:  true,
+		PID:   4321,
+	})
+	_, err = client_conn.WriteToUnix(bs, &net.UnixAddr{Name: dir + "/udp.sock", Net: "unixgram"})
+	unittest.IsNil(t, err)
+	unittest.IsNil(t, patrol.HandleUDPConnection(conn))
+	client_conn.SetReadDeadline(time.Now().Add(time.Second * 5))
+	body := make([]byte, 2048)
+	n, err := client_conn.Read(body)
+	unittest.IsNil(t, err)
+	response := patrol.NewAPIResponse()
+	unittest.IsNil(t, json.Unmarshal(body[:n], response))
+	unittest.Equals(t, response.ID, "udp")
+	unittest.Equals(t, patrol.GetApp("udp").GetPID(), uint32(4321))
+
+	// an unbound client can still ping, we just won't respond
+	unbound, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: dir + "/udp.sock", Net: "unixgram"})
+	unittest.IsNil(t, err)
+	defer unbound.Close()
+	_, err = unbound.Write(bs)
+	unittest.IsNil(t, err)
+	unittest.IsNil(t, patrol.HandleUDPConnection(conn))
+}
+func TestListenUnixPeerUnauthorized(t *testing.T) {
+	log.Println("TestListenUnixPeerUnauthorized")
+
+	dir, err := ioutil.TempDir("", "patrol-listen")
+	unittest.IsNil(t, err)
+	defer os.RemoveAll(dir)
+
+	l, err := ListenHTTP(&ConfigHTTP{
+		Listen: fmt.Sprintf("unix:%s/http.sock", dir),
+		// nobody
+		PeerUIDs: []uint32{uint32(os.Getuid()) + 1},
+	})
+	unittest.IsNil(t, err)
+	defer l.Close()
+	go http.Serve(l, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(200)
+	}))
+
+	client := &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return net.Dial("unix", dir+"/http.sock")
+			},
+		},
+	}
+	// our connection will be closed
+	_, err = client.Get("http://unix/")
+	unittest.NotNil(t, err)
+}
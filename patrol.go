@@ -1,6 +1,7 @@
 package patrol
 
 import (
+	"crypto/sha256"
 	"log"
 	"os"
 	"sabey.co/patrol/cas"
@@ -41,18 +42,22 @@ func CreatePatrol(
 		config:      config,
 		apps:        make(map[string]*App),
 		services:    make(map[string]*Service),
+		// our extra slot is for Patrol.stop()
+		wake_c:        make(chan *App, len(config.Apps)+1),
+		shutdown_c:    make(chan struct{}),
+		shutdown_done: make(chan struct{}),
+		webhooks_done: make(chan struct{}),
 	}
+	// our trigger errors are recorded by our Clock
+	p.triggers.now = p.now
 	// we're going to check if we're unittesting
 	// this isn't the ideal way to do this, but it will work
 	if os.Getenv(PATROL_ENV_UNITTEST_KEY) == PATROL_ENV_UNITTEST_VALUE {
 		log.Println("./patrol.CreatePatrol(): We are running in unittesting mode!")
 		// unittesting!!!
+		// we will not signal our Apps on stop or on our death
+		// our TickEvery and PingTimeout are no longer overridden, our unittests should use a faster Clock instead
 		p.config.unittesting = true
-		// we're going to override tickevery so we don't have to wait ages for unittests
-		p.config.TickEvery = 2
-		// we won't start HTTP/UDP apps until PingTimeout * 2 on boot
-		// we're going to override that it's at least something low
-		p.config.PingTimeout = 3
 	}
 	// add apps
 	for id, app := range config.Apps {
@@ -61,6 +66,9 @@ func CreatePatrol(
 			patrol: p,
 			config: app,
 			o:      cas.CreateApp(app.Disabled),
+			triggers: triggers{
+				now: p.now,
+			},
 		}
 		// add preexisting keyvalues
 		p.apps[id].ReplaceKeyValue(app.KeyValue)
@@ -72,6 +80,9 @@ func CreatePatrol(
 			patrol: p,
 			config: service,
 			o:      cas.CreateService(service.Disabled),
+			triggers: triggers{
+				now: p.now,
+			},
 		}
 		// add preexisting keyvalues
 		p.services[id].ReplaceKeyValue(service.KeyValue)
@@ -81,7 +92,18 @@ func CreatePatrol(
 		// we do NOT need to use a goroutine
 		// we'll use this as additional validation
 		// if this returns an error we WONT return a patrol object
-		if err := config.TriggerStart(p); err != nil {
+		// TriggerStart is always called inline, our TriggerOptions are ignored
+		// if our trigger panics our recovered panic is returned as a TriggerError
+		var err error
+		if panicked := p.triggers.run("Patrol", &triggerCall{
+			name: TRIGGER_START,
+			f: func() {
+				err = config.TriggerStart(p)
+			},
+		}); panicked != nil {
+			return nil, panicked
+		}
+		if err != nil {
 			// failed to trigger start
 			return nil, err
 		}
@@ -98,10 +120,41 @@ type Patrol struct {
 	services    map[string]*Service
 	// unsafe
 	shutdown bool
+	// shutdown_c is closed once Shutdown() is called, see Patrol.Run()
+	shutdown_c chan struct{}
+	// shutdown_done is closed once our first Shutdown() has finished and our report is ready
+	shutdown_done   chan struct{}
+	shutdown_report *ShutdownReport
+	shutdown_err    error
 	// ticker
 	ticker_running time.Time
 	ticker_stop    bool
-	mu             sync.RWMutex
+	// ticker_done is closed once our tick has stopped
+	ticker_done chan struct{}
+	mu          sync.RWMutex
+	// wake_c will check an App as soon as possible instead of waiting for its next check, see Patrol.wake()
+	wake_c chan *App
+	// webhooks
+	webhooks_wg sync.WaitGroup
+	webhooks_mu sync.Mutex
+	// webhooks_done is closed once Shutdown() has stopped waiting for our webhooks, our remaining retries are abandoned
+	webhooks_done chan struct{}
+	// tokens
+	// verified tokens are cached by their sha256 so that we only compare our bcrypt hash once
+	// invalid tokens are cached until we've cached TOKEN_INVALID_CACHE_MAX, see Patrol.verifyToken()
+	tokens         map[[sha256.Size]byte]*ConfigToken
+	tokens_invalid map[[sha256.Size]byte]struct{}
+	tokens_mu      sync.Mutex
+	// reload
+	// reload_mu guards our Tokens and our resolved secrets and env files, see Patrol.Reload()
+	// reload_mu may be read locked while our App or Service is locked, nothing else is ever locked while we hold reload_mu except tokens_mu
+	reload_mu sync.RWMutex
+	// udp envelopes
+	// nonces are mapped to the unix timestamp they expire at
+	udp_nonces    map[string]int64
+	udp_nonces_mu sync.Mutex
+	// triggers calls our triggers, see Config.TriggerOptions
+	triggers triggers
 }
 
 func (self *Patrol) IsValid() bool {
@@ -124,6 +177,8 @@ func (self *Patrol) GetStarted() time.Time {
 	return self.ticker_running
 }
 func (self *Patrol) GetConfig() *Config {
+	self.reload_mu.RLock()
+	defer self.reload_mu.RUnlock()
 	return self.config.Clone()
 }
 func (self *Patrol) GetApps() map[string]*App {
@@ -152,17 +207,6 @@ func (self *Patrol) GetService(
 ) *Service {
 	return self.services[key]
 }
-func (self *Patrol) Shutdown() {
-	self.mu.Lock()
-	defer self.mu.Unlock()
-	if !self.shutdown && self.config.TriggerShutdown != nil {
-		// never shutdown
-		// use goroutine to avoid deadlock
-		go self.config.TriggerShutdown(self)
-	}
-	self.shutdown = true
-	self.stop()
-}
 func (self *Patrol) IsShutdown() bool {
 	self.mu.RLock()
 	defer self.mu.RUnlock()
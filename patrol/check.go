@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sabey.co/patrol"
+	"strings"
+)
+
+const (
+	CHECK_EXIT_OK     = 0
+	CHECK_EXIT_ERRORS = 1
+)
+
+const (
+	// CHECK_REDACTED replaces our secrets when we print our effective config
+	CHECK_REDACTED = "REDACTED"
+)
+
+// checkConfig will print every problem with our config and return our exit code
+// warnings are printed but they will not cause a failure
+func checkConfig(
+	path string,
+) int {
+	config, err := patrol.LoadConfig(path, *config_dir)
+	if err != nil {
+		fmt.Printf("%s: %s\n", patrol.CHECK_LEVEL_ERROR, err)
+		return CHECK_EXIT_ERRORS
+	}
+	// we're going to check the same config we would run with
+	fixConfig(config)
+	if *check_app != "" ||
+		*check_service != "" {
+		if !printEffective(config) {
+			return CHECK_EXIT_ERRORS
+		}
+	}
+	results := config.Check()
+	errors := 0
+	warnings := 0
+	for _, r := range results {
+		fmt.Println(r)
+		if r.IsError() {
+			errors++
+		} else {
+			warnings++
+		}
+	}
+	fmt.Printf("%s: %d errors, %d warnings\n", path, errors, warnings)
+	if errors > 0 {
+		return CHECK_EXIT_ERRORS
+	}
+	return CHECK_EXIT_OK
+}
+
+// printEffective will print the effective config of our App or Service as JSON
+// our templates have been merged and our values interpolated
+// our `secret`, our `udp-keys` and the values of our `env` are redacted, our keys are still printed
+// our `secret-file` and `env-file` are never read into our config, only their paths are printed
+// our `args` are printed as they were interpolated, never interpolate a secret into our args
+func printEffective(
+	config *patrol.Config,
+) bool {
+	var effective interface{}
+	if *check_app != "" {
+		for id, app := range config.Apps {
+			// our IDs are case insensitive, the same as Validate()
+			if strings.EqualFold(id, *check_app) {
+				// Clone() will expand our working directory
+				effective = redactApp(app.Clone())
+			}
+		}
+		if effective == nil {
+			fmt.Printf("%s: App \"%s\" was not found\n", patrol.CHECK_LEVEL_ERROR, *check_app)
+			return false
+		}
+	} else {
+		for id, service := range config.Services {
+			if strings.EqualFold(id, *check_service) {
+				effective = redactService(service.Clone())
+			}
+		}
+		if effective == nil {
+			fmt.Printf("%s: Service \"%s\" was not found\n", patrol.CHECK_LEVEL_ERROR, *check_service)
+			return false
+		}
+	}
+	bs, err := json.MarshalIndent(effective, "", "  ")
+	if err != nil {
+		fmt.Printf("%s: %s\n", patrol.CHECK_LEVEL_ERROR, err)
+		return false
+	}
+	fmt.Println(string(bs))
+	return true
+}
+
+// redactApp will redact the secrets of our cloned App
+func redactApp(
+	app *patrol.ConfigApp,
+) *patrol.ConfigApp {
+	if app.Secret != "" {
+		app.Secret = CHECK_REDACTED
+	}
+	for k := range app.UDPKeys {
+		app.UDPKeys[k] = CHECK_REDACTED
+	}
+	for i, e := range app.Env {
+		// our key is kept so that our env may still be checked
+		if j := strings.Index(e, "="); j > -1 {
+			app.Env[i] = e[:j+1] + CHECK_REDACTED
+		}
+	}
+	return app
+}
+
+// redactService will redact the secret of our cloned Service
+func redactService(
+	service *patrol.ConfigService,
+) *patrol.ConfigService {
+	if service.Secret != "" {
+		service.Secret = CHECK_REDACTED
+	}
+	return service
+}
@@ -3,7 +3,6 @@ package main
 import (
 	"fmt"
 	"log"
-	"net"
 	"net/http"
 	"sabey.co/patrol"
 	patrol_http "sabey.co/patrol/http"
@@ -14,9 +13,9 @@ func httpListen() string {
 }
 func HTTP() {
 	defer log.Println("./patrol.HTTP(): Stopped!!!")
-	listen := p.GetConfig().HTTP.Listen
-	log.Printf("./patrol.HTTP(): Listen: \"%s\"\n", listen)
-	l, err := net.Listen("tcp", listen)
+	config := p.GetConfig().HTTP
+	log.Printf("./patrol.HTTP(): Listen: \"%s\"\n", config.Listen)
+	l, err := patrol.ListenHTTP(config)
 	if err != nil {
 		log.Printf("./patrol.HTTP(): Failed to Listen: \"%s\"\n", err)
 		return
@@ -25,12 +24,22 @@ func HTTP() {
 	mux := http.NewServeMux()
 	mux.HandleFunc("/status/", p.ServeHTTPStatus)
 	mux.HandleFunc("/api/", p.ServeHTTPAPI)
+	mux.HandleFunc("/api/history", p.ServeHTTPAPIHistory)
+	mux.HandleFunc("/api/history/", p.ServeHTTPAPIHistory)
+	mux.HandleFunc("/api/history/export", p.ServeHTTPAPIHistoryExport)
+	mux.HandleFunc("/api/reload", p.ServeHTTPAPIReload)
+	mux.HandleFunc("/schema/", p.ServeHTTPSchema)
 	mux.HandleFunc("/stdout/", stdout)
 	mux.HandleFunc("/stderr/", stderr)
 	mux.HandleFunc("/logs/", logs)
 	mux.HandleFunc("/", index)
 	go func() {
-		if err := http.Serve(l, mux); err != nil {
+		server := &http.Server{
+			Handler: mux,
+			// this will allow our handlers to read our peer credentials from unix domain sockets
+			ConnContext: patrol.ConnContext,
+		}
+		if err := server.Serve(l); err != nil {
 			log.Printf("./patrol.HTTP(): Serve Error: \"%s\"\n", err)
 		}
 		// call shutdown
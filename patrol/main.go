@@ -1,18 +1,25 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"log"
 	"os"
 	"os/signal"
 	"sabey.co/patrol"
+	"sort"
 	"sync"
 	"syscall"
 	"time"
 )
 
 var (
-	config_path = flag.String("config", "config.json", "path to patrol config file")
+	config_path   = flag.String("config", "config.json", "path to patrol config file, json, yaml or toml")
+	config_dir    = flag.String("config-dir", "", "path to a directory of config files to merge into our apps and services, ie: conf.d")
+	check         = flag.Bool("check", false, "check our config file for problems and exit, exit code 1 if errors were found")
+	check_app     = flag.String("app", "", "with -check, print the effective config of our App once our templates are merged")
+	check_service = flag.String("service", "", "with -check, print the effective config of our Service once our templates are merged")
+	schema        = flag.Bool("schema", false, "print our JSON Schema of our config and API and exit")
 )
 var (
 	p           *patrol.Patrol
@@ -31,19 +38,13 @@ func shutdown() {
 	close(shutdown_c)
 }
 
-func main() {
-	start := time.Now()
-	log.SetFlags(log.Ldate | log.Ltime | log.Lmicroseconds | log.Llongfile)
-	if !flag.Parsed() {
-		flag.Parse()
-	}
-	config, err := patrol.LoadConfig(*config_path)
-	if err != nil {
-		log.Printf("./patrol/patrol.main(): failed to Load Patrol Config: %s\n", err)
-		os.Exit(254)
-		return
-	}
+// fixConfig will set our default listeners
+func fixConfig(
+	config *patrol.Config,
+) {
 	// fix listeners
+	// we will only advertise our unix listeners if none were configured
+	listen_unix := len(config.ListenUnix) == 0
 	// http
 	if config.HTTP == nil {
 		config.HTTP = &patrol.ConfigHTTP{
@@ -53,7 +54,12 @@ func main() {
 	if config.HTTP.Listen == "" {
 		config.HTTP.Listen = httpListen()
 	}
-	if len(config.ListenHTTP) == 0 {
+	if patrol.IsListenUnix(config.HTTP.Listen) {
+		// unix domain sockets are advertised to our Apps with PATROL_UNIX
+		if listen_unix {
+			config.ListenUnix = append(config.ListenUnix, config.HTTP.Listen)
+		}
+	} else if len(config.ListenHTTP) == 0 {
 		config.ListenHTTP = []string{config.HTTP.Listen}
 	}
 	// udp
@@ -65,11 +71,59 @@ func main() {
 	if config.UDP.Listen == "" {
 		config.UDP.Listen = udpListen()
 	}
-	if len(config.ListenUDP) == 0 {
+	if patrol.IsListenUnix(config.UDP.Listen) {
+		// unix datagram sockets are advertised to our Apps with PATROL_UNIX
+		if listen_unix {
+			config.ListenUnix = append(config.ListenUnix, config.UDP.Listen)
+		}
+	} else if len(config.ListenUDP) == 0 {
 		config.ListenUDP = []string{config.UDP.Listen}
 	}
+}
+
+// loadConfig will load our config file and config directory and set our defaults
+// this is called once on start and again by Patrol.Reload()
+func loadConfig() (
+	*patrol.Config,
+	error,
+) {
+	config, err := patrol.LoadConfig(*config_path, *config_dir)
+	if err != nil {
+		return nil, err
+	}
+	fixConfig(config)
 	// modify timestamp
 	config.Timestamp = time.RFC1123Z
+	// we will reload our config on SIGUSR1 or `POST /api/reload`
+	config.Reload = loadConfig
+	return config, nil
+}
+
+func main() {
+	start := time.Now()
+	log.SetFlags(log.Ldate | log.Ltime | log.Lmicroseconds | log.Llongfile)
+	if !flag.Parsed() {
+		flag.Parse()
+	}
+	if *schema {
+		os.Stdout.Write(patrol.MarshalSchema())
+		return
+	}
+	if *check {
+		// our config may be passed as an argument: `patrol -check config.json`
+		path := *config_path
+		if flag.NArg() > 0 {
+			path = flag.Arg(0)
+		}
+		os.Exit(checkConfig(path))
+		return
+	}
+	config, err := loadConfig()
+	if err != nil {
+		log.Printf("./patrol/patrol.main(): failed to Load Patrol Config: %s\n", err)
+		os.Exit(254)
+		return
+	}
 	p, err = patrol.CreatePatrol(config)
 	if err != nil {
 		log.Printf("./patrol/patrol.main(): failed to Create Patrol: %s\n", err)
@@ -77,8 +131,13 @@ func main() {
 		return
 	}
 	// start patrol
+	// Run will Shutdown once our context is cancelled, waiting up to our shutdown-timeout for our Apps to exit
 	log.Println("./patrol/patrol.main(): Starting Patrol")
-	p.Start()
+	ctx, cancel := context.WithCancel(context.Background())
+	run_err := make(chan error, 1)
+	go func() {
+		run_err <- p.Run(ctx)
+	}()
 	go HTTP()
 	go UDP()
 	// create an unbuffered channel to listen for signals
@@ -158,8 +217,11 @@ func main() {
 				done = true
 				break
 			case syscall.SIGUSR1:
-				// unreserved signal - handle however we want
-				log.Println("./patrol/patrol.main(): SIGUSR1 - Ignored")
+				// unreserved signal - we will reload our config
+				log.Println("./patrol/patrol.main(): SIGUSR1 - Reload")
+				if err := p.Reload(); err != nil {
+					log.Printf("./patrol/patrol.main(): failed to Reload Patrol Config: %s\n", err)
+				}
 			case syscall.SIGUSR2:
 				// unreserved signal - handle however we want
 				log.Println("./patrol/patrol.main(): SIGUSR2 - Ignored")
@@ -178,20 +240,35 @@ func main() {
 		}
 	}
 	log.Println("./patrol/patrol.main(): Stopping Patrol")
-	p.Shutdown()
-	// wait for patrol to stop
-	log.Println("./patrol/patrol.main(): Waiting for Patrol to stop!")
-	for {
-		// we're going to add a saftey measure incase we fail to stop
-		go func() {
-			<-time.After(time.Minute * 3)
-			log.Fatalln("./patrol/patrol.main(): Failed to Stop Patrol, Dying!")
-		}()
-		if !p.IsRunning() {
-			// we're done!
-			break
-		}
+	cancel()
+	// wait for our Apps to exit
+	log.Println("./patrol/patrol.main(): Waiting for our Apps to exit!")
+	if err := <-run_err; err != nil {
+		log.Printf("./patrol/patrol.main(): %s\n", err)
 	}
+	logShutdownReport(p.GetShutdownReport())
 	log.Printf("./patrol/patrol.main(): Patrol ran for: %s\n", time.Now().Sub(start))
 	log.Println("good bye!")
 }
+
+// logShutdownReport will log how each of our Apps and Services stopped
+func logShutdownReport(
+	report *patrol.ShutdownReport,
+) {
+	if report == nil {
+		return
+	}
+	logResults := func(group string, results map[string]*patrol.ShutdownResult) {
+		ids := make([]string, 0, len(results))
+		for id := range results {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+		for _, id := range ids {
+			r := results[id]
+			log.Printf("./patrol/patrol.main(): %s ID: %s %s - PID: %d Signals: %v Duration: %.3fs\n", group, id, r.State, r.PID, r.Signals, r.Duration)
+		}
+	}
+	logResults("App", report.Apps)
+	logResults("Service", report.Services)
+}
@@ -3,7 +3,6 @@ package main
 import (
 	"fmt"
 	"log"
-	"net"
 	"sabey.co/patrol"
 )
 
@@ -12,9 +11,9 @@ func udpListen() string {
 }
 func UDP() {
 	defer log.Println("./patrol.UDP(): Stopped!!!")
-	listen := p.GetConfig().UDP.Listen
-	log.Printf("./patrol.UDP(): Listen: \"%s\"\n", listen)
-	conn, err := net.ListenPacket("udp", listen)
+	config := p.GetConfig().UDP
+	log.Printf("./patrol.UDP(): Listen: \"%s\"\n", config.Listen)
+	conn, err := patrol.ListenUDP(config)
 	if err != nil {
 		log.Printf("./patrol.UDP(): Failed to Listen: \"%s\"\n", err)
 		return
@@ -41,6 +41,15 @@ func (self *Patrol) api(
 			},
 		}
 	}
+	for _, op := range request.KeyValueOps {
+		if !op.IsValid() {
+			return &API_Response{
+				Errors: []string{
+					"Invalid KeyValue Op",
+				},
+			}
+		}
+	}
 	request.ID = strings.ToLower(request.ID)
 	request.Group = strings.ToLower(request.Group)
 	if request.Group == "app" ||
@@ -54,8 +63,20 @@ func (self *Patrol) api(
 				},
 			}
 		}
+		// validate token
+		// secrets and client identities are ignored once a token is presented
+		token := request.Token != "" || self.config.TokenRequired
+		if token &&
+			!self.IsTokenAuthorized(request.Token, "app", request.ID, apiScopes(request)...) {
+			return &API_Response{
+				Errors: []string{
+					"Token Unauthorized",
+				},
+			}
+		}
+		authorized := token || request.signed || a.IsAuthorized(request.Secret, request.identities)
 		// empty secret?
-		if a.config.Secret != "" && request.Secret == "" {
+		if !authorized && request.Secret == "" {
 			// regular request
 			a.o.Lock()
 			// NO MODIFICATIONS!!!
@@ -66,8 +87,7 @@ func (self *Patrol) api(
 			return response
 		}
 		// validate secret
-		if a.config.Secret != "" &&
-			a.config.Secret != request.Secret {
+		if !authorized {
 			return &API_Response{
 				Errors: []string{
 					"Secret Invalid",
@@ -125,6 +145,10 @@ func (self *Patrol) api(
 		response := a.apiResponse(endpoint)
 		// handle request
 		response.CASInvalid = !a.apiRequest(request)
+		if !response.CASInvalid &&
+			len(request.KeyValueOps) > 0 {
+			response.KeyValueOps = self.apiKeyValueOps(a.o, request.KeyValueOps)
+		}
 		a.o.Unlock()
 		return response
 	} else if request.Group == "service" ||
@@ -138,8 +162,20 @@ func (self *Patrol) api(
 				},
 			}
 		}
+		// validate token
+		// secrets and client identities are ignored once a token is presented
+		token := request.Token != "" || self.config.TokenRequired
+		if token &&
+			!self.IsTokenAuthorized(request.Token, "service", request.ID, apiScopes(request)...) {
+			return &API_Response{
+				Errors: []string{
+					"Token Unauthorized",
+				},
+			}
+		}
+		authorized := token || s.IsAuthorized(request.Secret, request.identities)
 		// empty secret?
-		if s.config.Secret != "" && request.Secret == "" {
+		if !authorized && request.Secret == "" {
 			// regular request
 			s.o.Lock()
 			// NO MODIFICATIONS!!!
@@ -150,8 +186,7 @@ func (self *Patrol) api(
 			return response
 		}
 		// validate secret
-		if s.config.Secret != "" &&
-			s.config.Secret != request.Secret {
+		if !authorized {
 			return &API_Response{
 				Errors: []string{
 					"Secret Invalid",
@@ -164,6 +199,10 @@ func (self *Patrol) api(
 		response := s.apiResponse(endpoint)
 		// handle request
 		response.CASInvalid = !s.apiRequest(request)
+		if !response.CASInvalid &&
+			len(request.KeyValueOps) > 0 {
+			response.KeyValueOps = self.apiKeyValueOps(s.o, request.KeyValueOps)
+		}
 		s.o.Unlock()
 		return response
 	}
@@ -0,0 +1,372 @@
+package patrol
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"sort"
+	"strings"
+	"time"
+)
+
+// historyCursor is the last entry of our previous page
+// our cursor is a position in our order and not an offset, new History will never shift our next page
+type historyCursor struct {
+	Stopped    int64  `json:"s"`
+	Group      string `json:"g"`
+	ID         string `json:"i"`
+	InstanceID string `json:"n"`
+}
+
+func (self *historyCursor) encode() string {
+	bs, _ := json.Marshal(self)
+	return base64.RawURLEncoding.EncodeToString(bs)
+}
+func decodeHistoryCursor(
+	cursor string,
+) (
+	*historyCursor,
+	bool,
+) {
+	bs, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, false
+	}
+	c := &historyCursor{}
+	if err := json.Unmarshal(bs, c); err != nil {
+		return nil, false
+	}
+	return c, true
+}
+
+// historySource is an App or Service that our request is authorized to read
+type historySource struct {
+	group   string
+	id      string
+	name    string
+	history []*History
+}
+
+// APIHistory will query the History of our Apps and Services
+// our History is returned newest first, our order is Stopped, then Group, ID and InstanceID
+func (self *Patrol) APIHistory(
+	request *API_HistoryRequest,
+) *API_HistoryResponse {
+	if !request.IsValid() {
+		return &API_HistoryResponse{
+			Errors: []string{
+				"Request NIL",
+			},
+		}
+	}
+	var cursor *historyCursor
+	if request.Cursor != "" {
+		var ok bool
+		if cursor, ok = decodeHistoryCursor(request.Cursor); !ok {
+			return &API_HistoryResponse{
+				Errors: []string{
+					"Invalid Cursor",
+				},
+			}
+		}
+	}
+	history, stats, errors := self.queryHistory(request)
+	if len(errors) > 0 {
+		return &API_HistoryResponse{
+			Errors: errors,
+		}
+	}
+	response := &API_HistoryResponse{
+		History: history,
+		Stats:   stats,
+	}
+	if cursor != nil {
+		// our page starts after our cursor
+		i := sort.Search(len(response.History), func(i int) bool {
+			return cursor.before(historyCursorOf(response.History[i]))
+		})
+		response.History = response.History[i:]
+	}
+	limit := request.Limit
+	if limit <= 0 {
+		limit = API_HISTORY_LIMIT_DEFAULT
+	} else if limit > API_HISTORY_LIMIT_MAX {
+		limit = API_HISTORY_LIMIT_MAX
+	}
+	if len(response.History) > limit {
+		response.History = response.History[:limit]
+		response.Cursor = historyCursorOf(response.History[limit-1]).encode()
+	}
+	return response
+}
+
+// queryHistory will return every History entry that matches our request newest first, and our stats
+// our Limit and Cursor are ignored
+func (self *Patrol) queryHistory(
+	request *API_HistoryRequest,
+) (
+	[]*API_HistoryEntry,
+	[]*API_HistoryStats,
+	[]string,
+) {
+	request.ID = strings.ToLower(request.ID)
+	request.Group = strings.ToLower(request.Group)
+	if request.Group == "apps" {
+		request.Group = "app"
+	} else if request.Group == "services" {
+		request.Group = "service"
+	}
+	if request.Group != "" &&
+		request.Group != "app" &&
+		request.Group != "service" {
+		return nil, nil, []string{"Unknown Group"}
+	}
+	if request.ID != "" &&
+		request.Group == "" {
+		return nil, nil, []string{"Group Required"}
+	}
+	sources, errors := self.historySources(request)
+	if len(errors) > 0 {
+		return nil, nil, errors
+	}
+	history := []*API_HistoryEntry{}
+	stats := make([]*API_HistoryStats, 0, len(sources))
+	for _, source := range sources {
+		matched := []*History{}
+		for _, h := range source.history {
+			if request.isMatch(h) {
+				history = append(history, &API_HistoryEntry{
+					Group:   source.group,
+					ID:      source.id,
+					History: h,
+				})
+				matched = append(matched, h)
+			}
+		}
+		s := historyStats(matched)
+		s.Group = source.group
+		s.ID = source.id
+		s.Name = source.name
+		stats = append(stats, s)
+	}
+	sort.Slice(history, func(i, j int) bool {
+		return historyCursorOf(history[i]).before(historyCursorOf(history[j]))
+	})
+	return history, stats, nil
+}
+
+// historySources will return the Apps and Services our request is authorized to read, ordered by Group and ID
+// our History is readable without a Secret, the same as our /api/ endpoint, unless a Token is presented or required
+func (self *Patrol) historySources(
+	request *API_HistoryRequest,
+) (
+	[]*historySource,
+	[]string,
+) {
+	token := request.Token != "" || self.config.TokenRequired
+	sources := []*historySource{}
+	// authorized will return false if our Token is not authorized for our App or Service
+	// a single App or Service is an error instead, so that our request isn't silently empty
+	authorized := func(group string, id string) bool {
+		if token &&
+			!self.IsTokenAuthorized(request.Token, group, id, TOKEN_SCOPE_READ) {
+			return false
+		}
+		return true
+	}
+	if request.Group == "" ||
+		request.Group == "app" {
+		for id, a := range self.apps {
+			if request.ID != "" &&
+				request.ID != id {
+				continue
+			}
+			if !authorized("app", id) {
+				if request.ID != "" {
+					return nil, []string{"Token Unauthorized"}
+				}
+				continue
+			}
+			if !token &&
+				request.ID != "" &&
+				request.Secret != "" &&
+				!a.IsAuthorized(request.Secret, request.identities) {
+				return nil, []string{"Secret Invalid"}
+			}
+			sources = append(sources, &historySource{
+				group:   "app",
+				id:      id,
+				name:    a.config.Name,
+				history: a.GetHistory(),
+			})
+		}
+		if request.ID != "" &&
+			len(sources) == 0 {
+			return nil, []string{"Unknown App"}
+		}
+	}
+	if request.Group == "" ||
+		request.Group == "service" {
+		for id, s := range self.services {
+			if request.ID != "" &&
+				request.ID != id {
+				continue
+			}
+			if !authorized("service", id) {
+				if request.ID != "" {
+					return nil, []string{"Token Unauthorized"}
+				}
+				continue
+			}
+			if !token &&
+				request.ID != "" &&
+				request.Secret != "" &&
+				!s.IsAuthorized(request.Secret, request.identities) {
+				return nil, []string{"Secret Invalid"}
+			}
+			sources = append(sources, &historySource{
+				group:   "service",
+				id:      id,
+				name:    s.config.Name,
+				history: s.GetHistory(),
+			})
+		}
+		if request.ID != "" &&
+			len(sources) == 0 {
+			return nil, []string{"Unknown Service"}
+		}
+	}
+	sort.Slice(sources, func(i, j int) bool {
+		if sources[i].group != sources[j].group {
+			return sources[i].group < sources[j].group
+		}
+		return sources[i].id < sources[j].id
+	})
+	return sources, nil
+}
+
+// isMatch will return true if our History matches every filter of our request
+func (self *API_HistoryRequest) isMatch(
+	h *History,
+) bool {
+	if self.Since != nil ||
+		self.Until != nil {
+		if h.Stopped == nil {
+			return false
+		}
+		if self.Since != nil &&
+			h.Stopped.Time.Before(self.Since.Time) {
+			return false
+		}
+		if self.Until != nil &&
+			!h.Stopped.Time.Before(self.Until.Time) {
+			return false
+		}
+	}
+	if len(self.ExitCodes) > 0 {
+		if h.Signal != "" {
+			return false
+		}
+		found := false
+		for _, code := range self.ExitCodes {
+			if h.ExitCode == code {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if self.Unexpected &&
+		!h.IsUnexpected() {
+		return false
+	}
+	return true
+}
+func historyCursorOf(
+	entry *API_HistoryEntry,
+) *historyCursor {
+	c := &historyCursor{
+		Group:      entry.Group,
+		ID:         entry.ID,
+		InstanceID: entry.History.InstanceID,
+	}
+	if entry.History.Stopped != nil {
+		c.Stopped = entry.History.Stopped.Time.UnixNano()
+	}
+	return c
+}
+
+// before will return true if our cursor is ordered before another, our newest History is first
+func (self *historyCursor) before(
+	other *historyCursor,
+) bool {
+	if self.Stopped != other.Stopped {
+		return self.Stopped > other.Stopped
+	}
+	if self.Group != other.Group {
+		return self.Group < other.Group
+	}
+	if self.ID != other.ID {
+		return self.ID < other.ID
+	}
+	return self.InstanceID < other.InstanceID
+}
+
+// historyStats will compute the stats of our History, our History is ordered oldest first
+func historyStats(
+	history []*History,
+) *API_HistoryStats {
+	stats := &API_HistoryStats{
+		Count: len(history),
+	}
+	uptimes := []float64{}
+	for _, h := range history {
+		if h.IsUnexpected() {
+			stats.Failures++
+			if stats.LastFailure == nil ||
+				isHistoryAfter(h, stats.LastFailure) {
+				stats.LastFailure = h
+			}
+		}
+		if h.IsUnexpected() ||
+			h.Restart {
+			stats.Restarts++
+		}
+		if h.Started != nil &&
+			h.Stopped != nil {
+			uptime := h.Stopped.Time.Sub(h.Started.Time)
+			if uptime < 0 {
+				uptime = 0
+			}
+			uptimes = append(uptimes, uptime.Seconds())
+			stats.UptimeTotal += uptime.Seconds()
+		}
+	}
+	if len(uptimes) > 0 {
+		stats.UptimeMean = stats.UptimeTotal / float64(len(uptimes))
+		sort.Float64s(uptimes)
+		if l := len(uptimes); l%2 == 1 {
+			stats.UptimeMedian = uptimes[l/2]
+		} else {
+			stats.UptimeMedian = (uptimes[l/2-1] + uptimes[l/2]) / 2
+		}
+	}
+	if stats.Failures > 0 {
+		stats.MTBF = stats.UptimeTotal / float64(stats.Failures)
+	}
+	return stats
+}
+func isHistoryAfter(
+	h *History,
+	other *History,
+) bool {
+	var a, b time.Time
+	if h.Stopped != nil {
+		a = h.Stopped.Time
+	}
+	if other.Stopped != nil {
+		b = other.Stopped.Time
+	}
+	return !a.Before(b)
+}
@@ -0,0 +1,231 @@
+package patrol
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http/httptest"
+	"sabey.co/unittest"
+	"testing"
+	"time"
+)
+
+func TestAPIHistory(t *testing.T) {
+	log.Println("TestAPIHistory")
+
+	config := &Config{
+		Apps: map[string]*ConfigApp{
+			"web": &ConfigApp{
+				KeepAlive:        APP_KEEPALIVE_PID_APP,
+				Name:             "Web",
+				Binary:           "web",
+				WorkingDirectory: "/web",
+				LogDirectory:     "logs",
+				PIDPath:          "web.pid",
+				Secret:           "secret",
+			},
+			"db": &ConfigApp{
+				KeepAlive:        APP_KEEPALIVE_PID_APP,
+				Name:             "DB",
+				Binary:           "db",
+				WorkingDirectory: "/db",
+				LogDirectory:     "logs",
+				PIDPath:          "db.pid",
+			},
+		},
+		Services: map[string]*ConfigService{
+			"ssh": &ConfigService{
+				Management: SERVICE_MANAGEMENT_SERVICE,
+				Name:       "SSH",
+				Service:    "ssh",
+			},
+		},
+		Tokens: []*ConfigToken{
+			&ConfigToken{
+				Name:   "web",
+				Hash:   testTokenHash(t, "web"),
+				Scopes: []string{TOKEN_SCOPE_READ},
+				Apps:   []string{"web"},
+			},
+		},
+	}
+	p, err := CreatePatrol(config)
+	unittest.IsNil(t, err)
+
+	now := time.Date(2020, 1, 8, 0, 0, 0, 0, time.UTC)
+	history := func(instance string, started time.Duration, uptime time.Duration, h *History) *History {
+		h.InstanceID = instance
+		h.Started = &Timestamp{
+			Time: now.Add(-started),
+		}
+		h.Stopped = &Timestamp{
+			Time: now.Add(-started + uptime),
+		}
+		return h
+	}
+	// web has failed twice this week, and was restarted once
+	p.apps["web"].history = []*History{
+		history("web-1", time.Hour*24*10, time.Hour*24, &History{ExitCode: 1}),
+		history("web-2", time.Hour*24*6, time.Hour*10, &History{ExitCode: 2}),
+		history("web-3", time.Hour*24*5, time.Hour*20, &History{Restart: true}),
+		history("web-4", time.Hour*24*4, time.Hour*30, &History{Signal: "SIGSEGV", SignalNumber: 11}),
+	}
+	p.apps["db"].history = []*History{
+		history("db-1", time.Hour*24*3, time.Hour, &History{Disabled: true}),
+	}
+	p.services["ssh"].history = []*History{
+		history("ssh-1", time.Hour*24*2, time.Hour, &History{ExitCode: 1}),
+	}
+	ids := func(response *API_HistoryResponse) []string {
+		unittest.Equals(t, len(response.Errors), 0)
+		ids := []string{}
+		for _, e := range response.History {
+			ids = append(ids, e.History.InstanceID)
+		}
+		return ids
+	}
+
+	// every App and Service, newest first
+	response := p.APIHistory(&API_HistoryRequest{})
+	unittest.Equals(t, ids(response), []string{"ssh-1", "web-4", "db-1", "web-3", "web-2", "web-1"})
+	unittest.Equals(t, response.Cursor, "")
+	unittest.Equals(t, len(response.Stats), 3)
+	unittest.Equals(t, response.Stats[0].ID, "db")
+	unittest.Equals(t, response.Stats[1].ID, "web")
+	unittest.Equals(t, response.Stats[2].Group, "service")
+	unittest.Equals(t, response.History[0].Group, "service")
+	unittest.Equals(t, response.History[0].ID, "ssh")
+
+	// this week
+	response = p.APIHistory(&API_HistoryRequest{
+		Group: "apps",
+		ID:    "WEB",
+		Since: &Timestamp{
+			Time: now.Add(-time.Hour * 24 * 7),
+		},
+	})
+	unittest.Equals(t, ids(response), []string{"web-4", "web-3", "web-2"})
+	unittest.Equals(t, len(response.Stats), 1)
+	stats := response.Stats[0]
+	unittest.Equals(t, stats.Name, "Web")
+	unittest.Equals(t, stats.Count, 3)
+	unittest.Equals(t, stats.Failures, 2)
+	unittest.Equals(t, stats.Restarts, 3)
+	unittest.Equals(t, stats.UptimeTotal, (time.Hour * 60).Seconds())
+	unittest.Equals(t, stats.UptimeMean, (time.Hour * 20).Seconds())
+	unittest.Equals(t, stats.UptimeMedian, (time.Hour * 20).Seconds())
+	unittest.Equals(t, stats.MTBF, (time.Hour * 30).Seconds())
+	unittest.Equals(t, stats.LastFailure.InstanceID, "web-4")
+
+	// until is exclusive
+	response = p.APIHistory(&API_HistoryRequest{
+		Group: "app",
+		ID:    "web",
+		Until: p.apps["web"].history[2].Stopped,
+	})
+	unittest.Equals(t, ids(response), []string{"web-2", "web-1"})
+	unittest.Equals(t, response.Stats[0].UptimeMedian, (time.Hour * 17).Seconds())
+
+	// exit codes never match a signal
+	response = p.APIHistory(&API_HistoryRequest{
+		ExitCodes: []uint8{0, 2},
+	})
+	unittest.Equals(t, ids(response), []string{"db-1", "web-3", "web-2"})
+
+	// unexpected
+	response = p.APIHistory(&API_HistoryRequest{
+		Group:      "app",
+		Unexpected: true,
+	})
+	unittest.Equals(t, ids(response), []string{"web-4", "web-2", "web-1"})
+	unittest.Equals(t, response.Stats[0].Count, 0)
+	unittest.Equals(t, response.Stats[0].MTBF, float64(0))
+	unittest.Equals(t, response.Stats[0].LastFailure == nil, true)
+
+	// pages
+	seen := []string{}
+	request := &API_HistoryRequest{
+		Limit: 4,
+	}
+	response = p.APIHistory(request)
+	seen = append(seen, ids(response)...)
+	unittest.Equals(t, len(seen), 4)
+	unittest.Equals(t, response.Cursor != "", true)
+	// new History never shifts our next page
+	p.apps["db"].history = append(p.apps["db"].history, history("db-2", time.Hour, time.Minute, &History{}))
+	request.Cursor = response.Cursor
+	response = p.APIHistory(request)
+	seen = append(seen, ids(response)...)
+	unittest.Equals(t, response.Cursor, "")
+	unittest.Equals(t, seen, []string{"ssh-1", "web-4", "db-1", "web-3", "web-2", "web-1"})
+	// our stats are never paged
+	unittest.Equals(t, response.Stats[0].Count, 2)
+
+	// errors
+	unittest.Equals(t, p.APIHistory(nil).Errors, []string{"Request NIL"})
+	unittest.Equals(t, p.APIHistory(&API_HistoryRequest{Group: "unknown"}).Errors, []string{"Unknown Group"})
+	unittest.Equals(t, p.APIHistory(&API_HistoryRequest{ID: "web"}).Errors, []string{"Group Required"})
+	unittest.Equals(t, p.APIHistory(&API_HistoryRequest{Group: "app", ID: "unknown"}).Errors, []string{"Unknown App"})
+	unittest.Equals(t, p.APIHistory(&API_HistoryRequest{Group: "service", ID: "unknown"}).Errors, []string{"Unknown Service"})
+	unittest.Equals(t, p.APIHistory(&API_HistoryRequest{Cursor: "!"}).Errors, []string{"Invalid Cursor"})
+	unittest.Equals(t, p.APIHistory(&API_HistoryRequest{Group: "app", ID: "web", Secret: "wrong"}).Errors, []string{"Secret Invalid"})
+	unittest.Equals(t, len(p.APIHistory(&API_HistoryRequest{Group: "app", ID: "web", Secret: "secret"}).Errors), 0)
+
+	// our token only reads web
+	response = p.APIHistory(&API_HistoryRequest{
+		Token: "web",
+	})
+	unittest.Equals(t, ids(response), []string{"web-4", "web-3", "web-2", "web-1"})
+	unittest.Equals(t, len(response.Stats), 1)
+	unittest.Equals(t, p.APIHistory(&API_HistoryRequest{Group: "app", ID: "db", Token: "web"}).Errors, []string{"Token Unauthorized"})
+	unittest.Equals(t, p.APIHistory(&API_HistoryRequest{Group: "app", ID: "web", Token: "unknown"}).Errors, []string{"Token Unauthorized"})
+
+	// http
+	serve := func(method string, target string, body []byte) (int, *API_HistoryResponse) {
+		r := httptest.NewRequest(method, target, bytes.NewReader(body))
+		w := httptest.NewRecorder()
+		p.ServeHTTPAPIHistory(w, r)
+		response := &API_HistoryResponse{}
+		unittest.IsNil(t, json.Unmarshal(w.Body.Bytes(), response))
+		return w.Code, response
+	}
+	code, response := serve("GET", fmt.Sprintf("/api/history?group=app&id=web&since=%d&exit-code=1,2&exit-code=0", now.Add(-time.Hour*24*7).Unix()), nil)
+	unittest.Equals(t, code, 200)
+	unittest.Equals(t, ids(response), []string{"web-3", "web-2"})
+	unittest.Equals(t, response.History[0].History.Started.Time.Equal(now.Add(-time.Hour*24*5)), true)
+	code, response = serve("GET", "/api/history?unexpected&limit=1&until="+now.Add(-time.Hour*24*5).Format(time.RFC3339), nil)
+	unittest.Equals(t, code, 200)
+	unittest.Equals(t, ids(response), []string{"web-2"})
+	unittest.Equals(t, response.Cursor != "", true)
+	code, response = serve("GET", "/api/history?unexpected&limit=1&until="+now.Add(-time.Hour*24*5).Format(time.RFC3339)+"&cursor="+response.Cursor, nil)
+	unittest.Equals(t, ids(response), []string{"web-1"})
+	// our token may be sent as a header
+	r := httptest.NewRequest("GET", "/api/history", nil)
+	r.Header.Set("Authorization", "Bearer web")
+	w := httptest.NewRecorder()
+	p.ServeHTTPAPIHistory(w, r)
+	response = &API_HistoryResponse{}
+	unittest.IsNil(t, json.Unmarshal(w.Body.Bytes(), response))
+	unittest.Equals(t, len(response.Stats), 1)
+	// post
+	body, _ := json.Marshal(&API_HistoryRequest{
+		Group:      "service",
+		Unexpected: true,
+	})
+	code, response = serve("POST", "/api/history", body)
+	unittest.Equals(t, code, 200)
+	unittest.Equals(t, ids(response), []string{"ssh-1"})
+	// errors
+	code, response = serve("GET", "/api/history?since=yesterday", nil)
+	unittest.Equals(t, code, 400)
+	unittest.Equals(t, response.Errors, []string{"Invalid Since"})
+	code, response = serve("GET", "/api/history?exit-code=256", nil)
+	unittest.Equals(t, code, 400)
+	unittest.Equals(t, response.Errors, []string{"Invalid Exit Code"})
+	code, response = serve("POST", "/api/history", []byte("{"))
+	unittest.Equals(t, code, 400)
+	unittest.Equals(t, response.Errors, []string{"Invalid Request"})
+	code, response = serve("DELETE", "/api/history", nil)
+	unittest.Equals(t, code, 405)
+}
@@ -0,0 +1,243 @@
+package patrol
+
+import (
+	"encoding/json"
+	"log"
+	"sabey.co/unittest"
+	"testing"
+	"time"
+)
+
+// keyValueClock is our SystemClock stopped at now
+type keyValueClock struct {
+	SystemClock
+	now time.Time
+}
+
+func (self *keyValueClock) Now() time.Time {
+	return self.now
+}
+
+func TestAPIKeyValueOps(t *testing.T) {
+	log.Println("TestAPIKeyValueOps")
+
+	clock := &keyValueClock{
+		now: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+	}
+	p, err := CreatePatrol(&Config{
+		Apps: map[string]*ConfigApp{
+			"web": &ConfigApp{
+				KeepAlive:        APP_KEEPALIVE_PID_APP,
+				Name:             "Web",
+				Binary:           "web",
+				WorkingDirectory: "/web",
+				LogDirectory:     "logs",
+				PIDPath:          "web.pid",
+				// we never want to start our App
+				Disabled: true,
+				KeyValue: map[string]interface{}{
+					"a": "a",
+				},
+			},
+		},
+		Clock: clock,
+	})
+	unittest.IsNil(t, err)
+
+	response := p.API(&API_Request{
+		Group: "app",
+		ID:    "web",
+	})
+	unittest.Equals(t, len(response.Errors), 0)
+	version := response.KeyValueVersions["a"]
+	unittest.Equals(t, version > 0, true)
+	unittest.IsNil(t, response.KeyValueExpires)
+	unittest.IsNil(t, response.KeyValueOps)
+
+	// our operations are applied in order, a failed operation never stops our remaining operations
+	response = p.API(&API_Request{
+		Group: "app",
+		ID:    "web",
+		KeyValueOps: []*API_KeyValueOp{
+			&API_KeyValueOp{Op: API_KEYVALUE_OP_INCREMENT, Key: "counter", Delta: 2},
+			&API_KeyValueOp{Op: API_KEYVALUE_OP_INCREMENT, Key: "counter", Delta: 1, TTL: 60},
+			&API_KeyValueOp{Op: API_KEYVALUE_OP_COMPARE_AND_SET, Key: "a", Value: "b", Version: version + 100},
+			&API_KeyValueOp{Op: API_KEYVALUE_OP_COMPARE_AND_SET, Key: "a", Value: "b", Version: version},
+			&API_KeyValueOp{Op: API_KEYVALUE_OP_APPEND, Key: "list", Value: "a"},
+			&API_KeyValueOp{Op: API_KEYVALUE_OP_APPEND, Key: "list", Value: []interface{}{"b", "c"}},
+			&API_KeyValueOp{Op: API_KEYVALUE_OP_APPEND, Key: "counter", Value: "a"},
+			&API_KeyValueOp{Op: API_KEYVALUE_OP_SET, Key: "session", Value: "x", TTL: 10},
+			&API_KeyValueOp{Op: API_KEYVALUE_OP_DELETE, Key: "unknown"},
+		},
+	})
+	unittest.Equals(t, len(response.Errors), 0)
+	unittest.Equals(t, response.CASInvalid, false)
+	// our KeyValue is our previous snapshot, our results are not
+	unittest.Equals(t, response.KeyValue, map[string]interface{}{"a": "a"})
+	results := response.KeyValueOps
+	unittest.Equals(t, len(results), 9)
+	unittest.Equals(t, results[0].Value, float64(2))
+	unittest.IsNil(t, results[0].Expires)
+	unittest.Equals(t, results[1].Value, float64(3))
+	unittest.Equals(t, results[1].Expires.Time, clock.now.Add(time.Minute))
+	unittest.Equals(t, results[2].Error, "Key Version Invalid")
+	unittest.Equals(t, results[2].Version, uint64(0))
+	unittest.Equals(t, results[3].Error, "")
+	unittest.Equals(t, results[3].Value, "b")
+	unittest.Equals(t, results[3].Version > version, true)
+	unittest.Equals(t, results[4].Value, []interface{}{"a"})
+	unittest.Equals(t, results[5].Value, []interface{}{"a", "b", "c"})
+	unittest.Equals(t, results[6].Error, "Key Not List")
+	unittest.Equals(t, results[7].Expires.Time, clock.now.Add(time.Second*10))
+	unittest.Equals(t, results[8].Error, "Unknown Key")
+
+	response = p.API(&API_Request{
+		Group: "app",
+		ID:    "web",
+	})
+	unittest.Equals(t, response.KeyValue, map[string]interface{}{
+		"a":       "b",
+		"counter": float64(3),
+		"list":    []interface{}{"a", "b", "c"},
+		"session": "x",
+	})
+	unittest.Equals(t, response.KeyValueVersions["a"], results[3].Version)
+	unittest.Equals(t, len(response.KeyValueExpires), 2)
+	unittest.Equals(t, response.KeyValueExpires["session"].Time, clock.now.Add(time.Second*10))
+	// a stale version of another key never prevents our operation
+	response = p.API(&API_Request{
+		Group: "app",
+		ID:    "web",
+		KeyValueOps: []*API_KeyValueOp{
+			&API_KeyValueOp{Op: API_KEYVALUE_OP_COMPARE_AND_SET, Key: "list", Value: []interface{}{}, Version: response.KeyValueVersions["list"]},
+		},
+	})
+	unittest.Equals(t, response.KeyValueOps[0].Error, "")
+
+	// our expired keys are never returned, even before our next check
+	clock.now = clock.now.Add(time.Second * 10)
+	response = p.API(&API_Request{
+		Group: "app",
+		ID:    "web",
+	})
+	_, ok := response.KeyValue["session"]
+	unittest.Equals(t, ok, false)
+	_, ok = response.KeyValueVersions["session"]
+	unittest.Equals(t, ok, false)
+	unittest.Equals(t, len(response.KeyValueExpires), 1)
+	_, ok = p.GetStatus().Apps["web"].KeyValue["session"]
+	unittest.Equals(t, ok, false)
+	_, ok = p.apps["web"].Snapshot().KeyValue["session"]
+	unittest.Equals(t, ok, false)
+	_, ok = p.apps["web"].GetKeyValue()["session"]
+	unittest.Equals(t, ok, false)
+
+	// our expired keys are deleted on our next check
+	p.runApp(p.apps["web"])
+	response = p.API(&API_Request{
+		Group: "app",
+		ID:    "web",
+	})
+	_, ok = response.KeyValue["session"]
+	unittest.Equals(t, ok, false)
+	_, ok = response.KeyValueVersions["session"]
+	unittest.Equals(t, ok, false)
+	unittest.Equals(t, len(response.KeyValueExpires), 1)
+	clock.now = clock.now.Add(time.Minute)
+	p.runApp(p.apps["web"])
+	response = p.API(&API_Request{
+		Group: "app",
+		ID:    "web",
+	})
+	unittest.Equals(t, response.KeyValue, map[string]interface{}{
+		"a":    "b",
+		"list": []interface{}{},
+	})
+	unittest.IsNil(t, response.KeyValueExpires)
+
+	// our operations never act on an expired key
+	p.API(&API_Request{
+		Group: "app",
+		ID:    "web",
+		KeyValueOps: []*API_KeyValueOp{
+			&API_KeyValueOp{Op: API_KEYVALUE_OP_SET, Key: "session", Value: "y", TTL: 10},
+			&API_KeyValueOp{Op: API_KEYVALUE_OP_INCREMENT, Key: "counter", Delta: 1, TTL: 10},
+		},
+	})
+	clock.now = clock.now.Add(time.Second * 10)
+	response = p.API(&API_Request{
+		Group: "app",
+		ID:    "web",
+		KeyValueOps: []*API_KeyValueOp{
+			&API_KeyValueOp{Op: API_KEYVALUE_OP_INCREMENT, Key: "counter", Delta: 1},
+		},
+	})
+	unittest.Equals(t, response.KeyValueOps[0].Value, float64(1))
+	unittest.IsNil(t, response.KeyValueOps[0].Expires)
+	// our History never snapshots an expired key
+	app := p.apps["web"]
+	app.o.Lock()
+	app.o.SetKey("session", "z", clock.now.Add(time.Second))
+	app.o.SetStarted(clock.now)
+	clock.now = clock.now.Add(time.Second)
+	app.close()
+	app.o.Unlock()
+	history := app.GetHistory()
+	_, ok = history[len(history)-1].KeyValue["session"]
+	unittest.Equals(t, ok, false)
+	unittest.Equals(t, history[len(history)-1].KeyValue["counter"], float64(1))
+	response = p.API(&API_Request{
+		Group: "app",
+		ID:    "web",
+		KeyValueOps: []*API_KeyValueOp{
+			&API_KeyValueOp{Op: API_KEYVALUE_OP_DELETE, Key: "counter"},
+		},
+	})
+	unittest.Equals(t, response.KeyValueOps[0].Error, "")
+
+	// our operations are still guarded by our CAS if it's set
+	response = p.API(&API_Request{
+		Group: "app",
+		ID:    "web",
+		CAS:   response.CAS + 100,
+		KeyValueOps: []*API_KeyValueOp{
+			&API_KeyValueOp{Op: API_KEYVALUE_OP_DELETE, Key: "a"},
+		},
+	})
+	unittest.Equals(t, response.CASInvalid, true)
+	unittest.IsNil(t, response.KeyValueOps)
+
+	// invalid operations are rejected before anything is modified
+	for _, op := range []*API_KeyValueOp{
+		nil,
+		&API_KeyValueOp{Op: API_KEYVALUE_OP_SET},
+		&API_KeyValueOp{Op: "multiply", Key: "a"},
+		&API_KeyValueOp{Op: API_KEYVALUE_OP_SET, Key: "a", TTL: -1},
+	} {
+		response = p.API(&API_Request{
+			Group: "app",
+			ID:    "web",
+			KeyValueOps: []*API_KeyValueOp{
+				&API_KeyValueOp{Op: API_KEYVALUE_OP_DELETE, Key: "a"},
+				op,
+			},
+		})
+		unittest.Equals(t, response.Errors, []string{"Invalid KeyValue Op"})
+	}
+	unittest.Equals(t, p.apps["web"].GetKeyValue()["a"], "b")
+
+	// our results unmarshal
+	bs, err := json.Marshal(p.API(&API_Request{
+		Group: "app",
+		ID:    "web",
+		KeyValueOps: []*API_KeyValueOp{
+			&API_KeyValueOp{Op: API_KEYVALUE_OP_INCREMENT, Key: "counter", Delta: 1, TTL: 5},
+		},
+	}))
+	unittest.IsNil(t, err)
+	response = &API_Response{}
+	unittest.IsNil(t, json.Unmarshal(bs, response))
+	unittest.Equals(t, response.KeyValueOps[0].Value, float64(1))
+	unittest.Equals(t, response.KeyValueOps[0].Expires.Time.Equal(clock.now.Add(time.Second*5)), true)
+	unittest.Equals(t, len(response.KeyValueVersions), 2)
+}
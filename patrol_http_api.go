@@ -40,6 +40,7 @@ func (self *Patrol) ServeHTTPAPI(
 		}
 		request.History = len(q["history"]) > 0
 		request.Secret = q.Get("secret")
+		request.Token = q.Get("token")
 		if cas, _ := strconv.ParseUint(q.Get("cas"), 10, 64); cas > 0 {
 			request.CAS = cas
 		}
@@ -80,6 +81,11 @@ func (self *Patrol) ServeHTTPAPI(
 			return
 		}
 	}
+	request.identities = ClientIdentities(r)
+	if request.Token == "" {
+		// our token may be sent as an Authorization header
+		request.Token = RequestToken(r)
+	}
 	response := self.api(api_endpoint_http, request)
 	if len(response.Errors) > 0 {
 		w.WriteHeader(400)
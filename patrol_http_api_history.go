@@ -0,0 +1,187 @@
+package patrol
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ServeHTTPAPIHistory will query our History, see API_HistoryRequest
+// our GET query string supports: `group, id, since, until, exit-code, unexpected, limit, cursor, secret, token`
+// `since` and `until` are either unix seconds or a timestamp, `exit-code` may be repeated or comma separated
+func (self *Patrol) ServeHTTPAPIHistory(
+	w http.ResponseWriter,
+	r *http.Request,
+) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	write := func(status int, response *API_HistoryResponse) {
+		w.WriteHeader(status)
+		bs, _ := json.MarshalIndent(response, "", "\t")
+		w.Write(bs)
+		w.Write([]byte("\n"))
+	}
+	request, status, err := self.httpHistoryRequest(r)
+	if err != "" {
+		write(status, &API_HistoryResponse{
+			Errors: []string{
+				err,
+			},
+		})
+		return
+	}
+	response := self.APIHistory(request)
+	if len(response.Errors) > 0 {
+		write(400, response)
+	} else {
+		write(200, response)
+	}
+}
+
+// ServeHTTPAPIHistoryExport will export our History as CSV or JSON Lines, see Patrol.ExportHistory()
+// our query string supports our ServeHTTPAPIHistory values, `format` is `csv` or `jsonl`, `timestamp` is a Go layout or a name such as `rfc3339`
+// every matching entry is exported, our limit and cursor are ignored
+func (self *Patrol) ServeHTTPAPIHistoryExport(
+	w http.ResponseWriter,
+	r *http.Request,
+) {
+	write := func(status int, err string) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.WriteHeader(status)
+		bs, _ := json.MarshalIndent(&API_HistoryResponse{
+			Errors: []string{
+				err,
+			},
+		}, "", "\t")
+		w.Write(bs)
+		w.Write([]byte("\n"))
+	}
+	request, status, err := self.httpHistoryRequest(r)
+	if err != "" {
+		write(status, err)
+		return
+	}
+	format := strings.ToLower(r.URL.Query().Get("format"))
+	if format == "" {
+		format = HISTORY_EXPORT_CSV
+	}
+	if format != HISTORY_EXPORT_CSV &&
+		format != HISTORY_EXPORT_JSONL {
+		write(400, "Invalid Format")
+		return
+	}
+	// our query is validated before we write, so that our errors are never written into our export
+	history, _, errs := self.queryHistory(request)
+	if len(errs) > 0 {
+		write(400, strings.Join(errs, ", "))
+		return
+	}
+	if format == HISTORY_EXPORT_CSV {
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	} else {
+		w.Header().Set("Content-Type", "application/x-ndjson; charset=utf-8")
+	}
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"history.%s\"", format))
+	w.WriteHeader(200)
+	if err := self.exportHistory(w, history, format, r.URL.Query().Get("timestamp")); err != nil {
+		log.Printf("./patrol.ServeHTTPAPIHistoryExport(): Failed to Export: \"%s\"\n", err)
+	}
+}
+
+// httpHistoryRequest will read our API_HistoryRequest from our GET query string or our POST body
+// if our request is invalid our status code and error are returned
+func (self *Patrol) httpHistoryRequest(
+	r *http.Request,
+) (
+	*API_HistoryRequest,
+	int,
+	string,
+) {
+	if r.Method != "POST" &&
+		r.Method != "GET" {
+		// unknown method
+		return nil, 405, "Invalid Method"
+	}
+	request := &API_HistoryRequest{}
+	if r.Method == "GET" {
+		q := r.URL.Query()
+		request.Group = q.Get("group")
+		request.ID = q.Get("id")
+		var ok bool
+		if request.Since, ok = self.parseHistoryTime(q.Get("since")); !ok {
+			return nil, 400, "Invalid Since"
+		}
+		if request.Until, ok = self.parseHistoryTime(q.Get("until")); !ok {
+			return nil, 400, "Invalid Until"
+		}
+		for _, v := range q["exit-code"] {
+			for _, code := range strings.Split(v, ",") {
+				c, err := strconv.ParseUint(strings.TrimSpace(code), 10, 8)
+				if err != nil {
+					return nil, 400, "Invalid Exit Code"
+				}
+				request.ExitCodes = append(request.ExitCodes, uint8(c))
+			}
+		}
+		request.Unexpected = len(q["unexpected"]) > 0
+		if limit, _ := strconv.ParseInt(q.Get("limit"), 10, 64); limit > 0 {
+			request.Limit = int(limit)
+		}
+		request.Cursor = q.Get("cursor")
+		request.Secret = q.Get("secret")
+		request.Token = q.Get("token")
+	} else {
+		// POST
+		body, err := ioutil.ReadAll(r.Body)
+		defer r.Body.Close()
+		if err != nil {
+			return nil, 400, "Invalid Body"
+		}
+		if err := json.Unmarshal(body, request); err != nil {
+			return nil, 400, "Invalid Request"
+		}
+	}
+	request.identities = ClientIdentities(r)
+	if request.Token == "" {
+		// our token may be sent as an Authorization header
+		request.Token = RequestToken(r)
+	}
+	return request, 0, ""
+}
+
+// parseHistoryTime will parse unix seconds, our Config.Timestamp, or any of our known timestamp formats
+// an empty value is nil and valid
+func (self *Patrol) parseHistoryTime(
+	value string,
+) (
+	*Timestamp,
+	bool,
+) {
+	if value == "" {
+		return nil, true
+	}
+	if unix, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return &Timestamp{
+			Time:            time.Unix(unix, 0),
+			TimestampFormat: self.config.Timestamp,
+		}, true
+	}
+	if self.config.Timestamp != "" {
+		if t, err := time.Parse(self.config.Timestamp, value); err == nil {
+			return &Timestamp{
+				Time:            t,
+				TimestampFormat: self.config.Timestamp,
+			}, true
+		}
+	}
+	t := &Timestamp{}
+	if err := t.UnmarshalJSON([]byte(value)); err != nil {
+		return nil, false
+	}
+	t.TimestampFormat = self.config.Timestamp
+	return t, true
+}
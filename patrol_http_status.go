@@ -10,7 +10,20 @@ func (self *Patrol) ServeHTTPStatus(
 	r *http.Request,
 ) {
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
-	bs, _ := json.MarshalIndent(self.GetStatus(), "", "\t")
+	// if our Token is presented or required, we only return the Apps and Services our Token may read
+	status := self.GetTokenStatus(RequestToken(r))
+	if status == nil {
+		bs, _ := json.MarshalIndent(&API_Response{
+			Errors: []string{
+				"Token Unauthorized",
+			},
+		}, "", "\t")
+		w.WriteHeader(401)
+		w.Write(bs)
+		w.Write([]byte("\n"))
+		return
+	}
+	bs, _ := json.MarshalIndent(status, "", "\t")
 	w.WriteHeader(200)
 	w.Write(bs)
 	w.Write([]byte("\n"))
@@ -0,0 +1,155 @@
+package patrol
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+)
+
+var (
+	ERR_RELOAD_UNSUPPORTED      = fmt.Errorf("Config Reload was nil, our Config can not be reloaded")
+	ERR_RELOAD_RESTART_REQUIRED = fmt.Errorf("Config was modified, only our Tokens, secret files, env files and interpolated secrets can be reloaded, restart Patrol to apply changes")
+)
+
+// Reload will load our config again with Config.Reload and apply what can be reloaded
+//
+// Our Tokens are replaced and our token caches are cleared
+// Our secret files, env files and interpolated `secret` and `udp-keys` values are resolved again for our Apps, Services and Webhooks
+// An env file is only used the next time our App is started, a running App is never restarted
+//
+// Every other value of our config must be unchanged, otherwise ERR_RELOAD_RESTART_REQUIRED is returned and nothing is modified
+// If our config fails to load or validate, our error is returned and nothing is modified
+func (self *Patrol) Reload() error {
+	if self.config.Reload == nil {
+		return ERR_RELOAD_UNSUPPORTED
+	}
+	config, err := self.config.Reload()
+	if err != nil {
+		return err
+	}
+	// deference
+	config = config.Clone()
+	if !config.IsValid() {
+		return ERR_CONFIG_NIL
+	}
+	if err := config.Validate(); err != nil {
+		return err
+	}
+	self.reload_mu.Lock()
+	defer self.reload_mu.Unlock()
+	if !bytes.Equal(reloadable(self.config), reloadable(config)) {
+		return ERR_RELOAD_RESTART_REQUIRED
+	}
+	for id, app := range self.config.Apps {
+		a := config.Apps[id]
+		app.secret = a.secret
+		app.udp_keys = a.udp_keys
+		app.env_file = a.env_file
+	}
+	for id, service := range self.config.Services {
+		service.secret = config.Services[id].secret
+	}
+	for i, webhook := range self.config.Webhooks {
+		webhook.secret = config.Webhooks[i].secret
+	}
+	self.config.Tokens = config.Tokens
+	// a removed or modified Token must never be authorized by our cache
+	self.tokens_mu.Lock()
+	self.tokens = nil
+	self.tokens_invalid = nil
+	self.tokens_mu.Unlock()
+	log.Println("./patrol.Reload(): Reloaded our Config")
+	return nil
+}
+
+// reloadable will marshal our config without the values that Patrol.Reload() may modify
+// our resolved secrets and env files are unexported, so they're never marshaled
+func reloadable(
+	config *Config,
+) []byte {
+	config = config.Clone()
+	config.Tokens = nil
+	bs, _ := json.Marshal(config)
+	return bs
+}
+
+// getTokens will return our Tokens, our Tokens are replaced by Patrol.Reload()
+func (self *Patrol) getTokens() []*ConfigToken {
+	self.reload_mu.RLock()
+	defer self.reload_mu.RUnlock()
+	return self.config.Tokens
+}
+
+// ServeHTTPAPIReload will call Patrol.Reload(), our request must be a POST
+// If our request presents a Token, or Tokens are required, our Token must have the `admin` scope for every App and Service
+func (self *Patrol) ServeHTTPAPIReload(
+	w http.ResponseWriter,
+	r *http.Request,
+) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	write := func(status int, response *API_Response) {
+		w.WriteHeader(status)
+		bs, _ := json.MarshalIndent(response, "", "\t")
+		w.Write(bs)
+		w.Write([]byte("\n"))
+	}
+	if r.Method != "POST" {
+		write(405, &API_Response{
+			Errors: []string{
+				"Invalid Method",
+			},
+		})
+		return
+	}
+	if !self.isReloadAuthorized(RequestToken(r)) {
+		write(401, &API_Response{
+			Errors: []string{
+				"Token Unauthorized",
+			},
+		})
+		return
+	}
+	if err := self.Reload(); err != nil {
+		log.Printf("./patrol.ServeHTTPAPIReload(): Failed to Reload: \"%s\"\n", err)
+		status := 400
+		if err == ERR_RELOAD_UNSUPPORTED {
+			status = 501
+		} else if err == ERR_RELOAD_RESTART_REQUIRED {
+			status = 409
+		}
+		write(status, &API_Response{
+			Errors: []string{
+				err.Error(),
+			},
+		})
+		return
+	}
+	write(200, &API_Response{})
+}
+
+// isReloadAuthorized will return true if our Token may reload our config
+// Without a Token, a reload is only authorized if Tokens are not required, a reload only ever reads our config from our disk
+func (self *Patrol) isReloadAuthorized(
+	token string,
+) bool {
+	if token == "" &&
+		!self.config.TokenRequired {
+		return true
+	}
+	if self.verifyToken(token) == nil {
+		return false
+	}
+	for id := range self.apps {
+		if !self.IsTokenAuthorized(token, "app", id, TOKEN_SCOPE_ADMIN) {
+			return false
+		}
+	}
+	for id := range self.services {
+		if !self.IsTokenAuthorized(token, "service", id, TOKEN_SCOPE_ADMIN) {
+			return false
+		}
+	}
+	return true
+}
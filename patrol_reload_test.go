@@ -0,0 +1,149 @@
+package patrol
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sabey.co/unittest"
+	"strings"
+	"testing"
+)
+
+func TestPatrolReload(t *testing.T) {
+	log.Println("TestPatrolReload")
+
+	dir, err := ioutil.TempDir("", "patrol-reload")
+	unittest.IsNil(t, err)
+	defer os.RemoveAll(dir)
+	write := func(name string, body string) string {
+		path := filepath.Join(dir, name)
+		unittest.IsNil(t, ioutil.WriteFile(path, []byte(body), 0600))
+		return path
+	}
+	os.Setenv("PATROL_TEST_RELOAD_KEY", "key-a")
+	defer os.Unsetenv("PATROL_TEST_RELOAD_KEY")
+	config := func(name string, hash string) string {
+		return `{
+	"apps": {
+		"app": {
+			"keepalive": 1,
+			"name": "` + name + `",
+			"binary": "testapp",
+			"working-directory": "/testapp",
+			"log-directory": "logs",
+			"pid-path": "app.pid",
+			"secret-file": "app.secret",
+			"env-file": "app.env",
+			"udp-keys": {"key-1": "${PATROL_TEST_RELOAD_KEY}"}
+		}
+	},
+	"services": {
+		"ssh": {"management": 1, "name": "SSH", "service": "ssh", "secret-file": "ssh.secret"}
+	},
+	"webhooks": [
+		{"url": "http://127.0.0.1/", "events": ["app-closed"], "secret-file": "webhook.secret"}
+	],
+	"tokens": [
+		{"hash": "` + hash + `", "scopes": ["admin"], "apps": ["*"], "services": ["*"]}
+	]
+}`
+	}
+	write("app.secret", "app-a\n")
+	write("ssh.secret", "ssh-a\n")
+	write("webhook.secret", "webhook-a\n")
+	write("app.env", "A=a\n")
+	path := write("config.json", config("App", testTokenHash(t, "token-a")))
+	load := func() (*Config, error) {
+		return LoadConfig(path)
+	}
+
+	c, err := load()
+	unittest.IsNil(t, err)
+	// our config may not be reloaded without a loader
+	p, err := CreatePatrol(c)
+	unittest.IsNil(t, err)
+	unittest.Equals(t, p.Reload(), ERR_RELOAD_UNSUPPORTED)
+
+	c.Reload = load
+	p, err = CreatePatrol(c)
+	unittest.IsNil(t, err)
+	app := p.GetApp("app")
+	ssh := p.GetService("ssh")
+	unittest.Equals(t, app.IsAuthorized("app-a", nil), true)
+	unittest.Equals(t, p.IsTokenAuthorized("token-a", "app", "app", TOKEN_SCOPE_ADMIN), true)
+	// our cached token must not survive our reload
+	unittest.Equals(t, p.IsTokenAuthorized("token-b", "app", "app", TOKEN_SCOPE_ADMIN), false)
+
+	// an unmodified config reloads
+	unittest.IsNil(t, p.Reload())
+
+	// our secrets, env file, udp keys and tokens are reloaded
+	write("app.secret", "app-b\n")
+	write("ssh.secret", "ssh-b\n")
+	write("webhook.secret", "webhook-b\n")
+	write("app.env", "A=b\n")
+	os.Setenv("PATROL_TEST_RELOAD_KEY", "key-b")
+	write("config.json", config("App", testTokenHash(t, "token-b")))
+	unittest.IsNil(t, p.Reload())
+	unittest.Equals(t, app.IsAuthorized("app-a", nil), false)
+	unittest.Equals(t, app.IsAuthorized("app-b", nil), true)
+	unittest.Equals(t, ssh.IsAuthorized("ssh-b", nil), true)
+	unittest.Equals(t, app.getEnvFile(), []string{"A=b"})
+	unittest.Equals(t, app.getUDPKeys(), map[string]string{"key-1": "key-b"})
+	unittest.Equals(t, p.config.Webhooks[0].getSecret(), "webhook-b")
+	unittest.Equals(t, p.IsTokenAuthorized("token-a", "app", "app", TOKEN_SCOPE_ADMIN), false)
+	unittest.Equals(t, p.IsTokenAuthorized("token-b", "app", "app", TOKEN_SCOPE_ADMIN), true)
+	// our exported config is unchanged
+	unittest.Equals(t, p.GetConfig().Apps["app"].SecretFile, "app.secret")
+
+	// any other change requires a restart, nothing is modified
+	write("app.secret", "app-c\n")
+	write("config.json", config("Renamed", testTokenHash(t, "token-c")))
+	unittest.Equals(t, p.Reload(), ERR_RELOAD_RESTART_REQUIRED)
+	unittest.Equals(t, app.IsAuthorized("app-b", nil), true)
+	unittest.Equals(t, p.IsTokenAuthorized("token-b", "app", "app", TOKEN_SCOPE_ADMIN), true)
+	// a config that fails to load modifies nothing
+	write("config.json", config("App", testTokenHash(t, "token-c")))
+	unittest.IsNil(t, os.Remove(filepath.Join(dir, "app.secret")))
+	unittest.NotNil(t, p.Reload())
+	unittest.Equals(t, app.IsAuthorized("app-b", nil), true)
+
+	// http
+	write("app.secret", "app-c\n")
+	reload := func(method string, token string) (int, *API_Response) {
+		r := httptest.NewRequest(method, "/api/reload", nil)
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		p.ServeHTTPAPIReload(w, r)
+		response := &API_Response{}
+		unittest.IsNil(t, json.Unmarshal(w.Body.Bytes(), response))
+		return w.Code, response
+	}
+	code, response := reload("GET", "")
+	unittest.Equals(t, code, 405)
+	unittest.Equals(t, response.Errors, []string{"Invalid Method"})
+	code, response = reload("POST", "token-a")
+	unittest.Equals(t, code, 401)
+	unittest.Equals(t, response.Errors, []string{"Token Unauthorized"})
+	code, response = reload("POST", "token-b")
+	unittest.Equals(t, code, 200)
+	unittest.Equals(t, len(response.Errors), 0)
+	unittest.Equals(t, app.IsAuthorized("app-c", nil), true)
+	unittest.Equals(t, p.IsTokenAuthorized("token-c", "app", "app", TOKEN_SCOPE_ADMIN), true)
+	write("config.json", config("Renamed", testTokenHash(t, "token-c")))
+	code, response = reload("POST", "token-c")
+	unittest.Equals(t, code, 409)
+	unittest.Equals(t, strings.Contains(response.Errors[0], "restart Patrol"), true)
+
+	// a token must have our admin scope for every App and Service
+	write("config.json", strings.Replace(config("App", testTokenHash(t, "token-c")), `"services": ["*"]`, `"services": ["other"]`, 1))
+	code, _ = reload("POST", "token-c")
+	unittest.Equals(t, code, 200)
+	code, _ = reload("POST", "token-c")
+	unittest.Equals(t, code, 401)
+}
@@ -0,0 +1,166 @@
+package patrol
+
+import (
+	"container/heap"
+	"sync"
+	"time"
+)
+
+const (
+	// SCHEDULE_WAKE_MIN is the minimum time between the start of an App's last check and a check woken by its PID exiting
+	SCHEDULE_WAKE_MIN = time.Second
+)
+
+// schedule is a single App or Service within our scheduler
+type schedule struct {
+	// next is when we will check our App or Service next
+	next time.Time
+	// checked is when our last check started
+	checked time.Time
+	app     *App
+	service *Service
+	// index is our index within our heap, -1 while we're being checked
+	index int
+	// woken is true if we were woken while we were being checked
+	woken bool
+}
+
+func (self *schedule) every() time.Duration {
+	if self.app != nil {
+		return self.app.checkEvery()
+	}
+	return self.service.checkEvery()
+}
+
+// scheduler is a min heap of our Apps and Services ordered by their next check
+// an App or Service is removed from our heap while it is being checked, so that it's never checked twice at once
+type scheduler []*schedule
+
+func (self scheduler) Len() int {
+	return len(self)
+}
+func (self scheduler) Less(
+	i, j int,
+) bool {
+	return self[i].next.Before(self[j].next)
+}
+func (self scheduler) Swap(
+	i, j int,
+) {
+	self[i], self[j] = self[j], self[i]
+	self[i].index = i
+	self[j].index = j
+}
+func (self *scheduler) Push(
+	x interface{},
+) {
+	s := x.(*schedule)
+	s.index = len(*self)
+	*self = append(*self, s)
+}
+func (self *scheduler) Pop() interface{} {
+	old := *self
+	n := len(old)
+	s := old[n-1]
+	old[n-1] = nil
+	s.index = -1
+	*self = old[:n-1]
+	return s
+}
+
+// schedule will check every App and Service whose next check is due
+// every check runs in its own goroutine and is returned to done once it's finished, so that a slow `service x status` never delays our other Apps and Services
+// our next check is relative to when our check finished, the same as our global tick
+func (self *Patrol) schedule(
+	s *scheduler,
+	now time.Time,
+	done chan<- *schedule,
+	wg *sync.WaitGroup,
+) {
+	for s.Len() > 0 &&
+		!(*s)[0].next.After(now) {
+		e := heap.Pop(s).(*schedule)
+		e.checked = now
+		wg.Add(1)
+		go func(e *schedule) {
+			defer wg.Done()
+			if e.app != nil {
+				self.runApp(e.app)
+			} else {
+				self.runService(e.service)
+			}
+			e.next = self.now().Add(e.every())
+			done <- e
+		}(e)
+	}
+}
+
+// wakeSchedule will move our next check to now, an App is never woken more than once every SCHEDULE_WAKE_MIN
+// this prevents an App that is crashing on start from being restarted in a busy loop
+func wakeSchedule(
+	s *scheduler,
+	e *schedule,
+	now time.Time,
+) {
+	if e.index < 0 {
+		// we're being checked, we will be woken once our check is finished
+		e.woken = true
+		return
+	}
+	next := e.checked.Add(SCHEDULE_WAKE_MIN)
+	if next.Before(now) {
+		next = now
+	}
+	if next.Before(e.next) {
+		e.next = next
+		heap.Fix(s, e.index)
+	}
+}
+
+// wake will check our App as soon as possible instead of waiting for its next check
+// if we can't wake our App right now, our App will still be checked on schedule
+func (self *Patrol) wake(
+	app *App,
+) {
+	select {
+	case self.wake_c <- app:
+	default:
+	}
+}
+
+// checkEvery will return how often we check our App, Config.TickEvery is our default
+func (self *App) checkEvery() time.Duration {
+	return checkEvery(self.config.CheckEvery, self.patrol.config.TickEvery)
+}
+
+// checkEvery will return how often we check our Service, Config.TickEvery is our default
+func (self *Service) checkEvery() time.Duration {
+	return checkEvery(self.config.CheckEvery, self.patrol.config.TickEvery)
+}
+func checkEvery(
+	every int,
+	tick_every int,
+) time.Duration {
+	if every == 0 {
+		// our global tick has already been limited by Config.Validate()
+		return time.Second * time.Duration(tick_every)
+	} else if every < TICKEVERY_MIN {
+		every = TICKEVERY_MIN
+	} else if every > TICKEVERY_MAX {
+		every = TICKEVERY_MAX
+	}
+	return time.Second * time.Duration(every)
+}
+
+// pingTimeout will return how long we will wait for our App to Ping, Config.PingTimeout is our default
+func (self *App) pingTimeout() time.Duration {
+	timeout := self.config.PingTimeout
+	if timeout == 0 {
+		return time.Second * time.Duration(self.patrol.config.PingTimeout)
+	} else if timeout < APP_PING_TIMEOUT_MIN {
+		timeout = APP_PING_TIMEOUT_MIN
+	} else if timeout > APP_PING_TIMEOUT_MAX {
+		timeout = APP_PING_TIMEOUT_MAX
+	}
+	return time.Second * time.Duration(timeout)
+}
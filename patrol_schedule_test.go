@@ -0,0 +1,103 @@
+package patrol
+
+import (
+	"container/heap"
+	"log"
+	"sabey.co/unittest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCheckEvery(t *testing.T) {
+	log.Println("TestCheckEvery")
+
+	unittest.Equals(t, checkEvery(0, 15), 15*time.Second)
+	unittest.Equals(t, checkEvery(1, 15), TICKEVERY_MIN*time.Second)
+	unittest.Equals(t, checkEvery(30, 15), 30*time.Second)
+	unittest.Equals(t, checkEvery(1000, 15), TICKEVERY_MAX*time.Second)
+
+	p := &Patrol{
+		config: &Config{
+			PingTimeout: 30,
+		},
+	}
+	app := &App{
+		patrol: p,
+		config: &ConfigApp{},
+	}
+	unittest.Equals(t, app.pingTimeout(), 30*time.Second)
+	app.config.PingTimeout = 1
+	unittest.Equals(t, app.pingTimeout(), APP_PING_TIMEOUT_MIN*time.Second)
+	app.config.PingTimeout = 10
+	unittest.Equals(t, app.pingTimeout(), 10*time.Second)
+
+	// our scheduler is ordered by our next check
+	now := time.Now()
+	s := &scheduler{}
+	heap.Push(s, &schedule{next: now.Add(time.Second * 3)})
+	heap.Push(s, &schedule{next: now.Add(time.Second)})
+	heap.Push(s, &schedule{next: now.Add(time.Second * 2)})
+	unittest.Equals(t, heap.Pop(s).(*schedule).next, now.Add(time.Second))
+	unittest.Equals(t, heap.Pop(s).(*schedule).next, now.Add(time.Second*2))
+	unittest.Equals(t, heap.Pop(s).(*schedule).next, now.Add(time.Second*3))
+}
+
+func TestSchedule(t *testing.T) {
+	log.Println("TestSchedule")
+
+	var mu sync.Mutex
+	checks := make(map[string]int)
+	ticks := 0
+	disabled := func(app *App) {
+		mu.Lock()
+		checks[app.GetID()]++
+		mu.Unlock()
+	}
+	// our disabled Apps are never executed, our TriggerDisabled is called every time they're checked
+	config := &Config{
+		Apps: map[string]*ConfigApp{
+			"fast": &ConfigApp{
+				KeepAlive:        APP_KEEPALIVE_PID_PATROL,
+				Name:             "fast",
+				Binary:           "testapp",
+				WorkingDirectory: "/testapp",
+				LogDirectory:     "logs",
+				PIDPath:          "testapp.pid",
+				Disabled:         true,
+				TriggerDisabled:  disabled,
+			},
+			"slow": &ConfigApp{
+				KeepAlive:        APP_KEEPALIVE_PID_PATROL,
+				Name:             "slow",
+				Binary:           "testapp",
+				WorkingDirectory: "/testapp",
+				LogDirectory:     "logs",
+				PIDPath:          "testapp.pid",
+				Disabled:         true,
+				CheckEvery:       TICKEVERY_MIN,
+				TriggerDisabled:  disabled,
+			},
+		},
+		TriggerTick: func(p *Patrol) {
+			mu.Lock()
+			ticks++
+			mu.Unlock()
+		},
+	}
+	p, err := CreatePatrol(config)
+	unittest.IsNil(t, err)
+	// our global tick is our default
+	p.config.TickEvery = 1
+	unittest.IsNil(t, p.Start())
+	<-time.After(time.Millisecond * 5500)
+	unittest.IsNil(t, p.Stop())
+
+	mu.Lock()
+	defer mu.Unlock()
+	// fast: 0s 1s 2s 3s 4s 5s
+	unittest.Equals(t, checks["fast"] >= 5, true)
+	// slow: 0s 5s
+	unittest.Equals(t, checks["slow"], 2)
+	unittest.Equals(t, ticks >= 5, true)
+}
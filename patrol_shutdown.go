@@ -0,0 +1,453 @@
+package patrol
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	SHUTDOWN_TIMEOUT_MIN     = 1
+	SHUTDOWN_TIMEOUT_DEFAULT = 30
+	SHUTDOWN_TIMEOUT_MAX     = 600
+	// SHUTDOWN_POLL_EVERY is how often we check if our Apps have exited while we're shutting down
+	SHUTDOWN_POLL_EVERY = time.Millisecond * 50
+	// SHUTDOWN_KILL_WAIT is how long we will wait for our App to exit once we've sent SIGKILL
+	// our context is already done by then, so we will never wait any longer than this
+	SHUTDOWN_KILL_WAIT = time.Second
+	// SHUTDOWN_STOP_WAIT is how long we will wait for a Service to stop if our context was done before our Apps had exited
+	SHUTDOWN_STOP_WAIT = time.Second * 5
+	// SHUTDOWN_WEBHOOK_WAIT is how long we will wait for our webhooks to be sent if our context was done before our Apps and Services had stopped
+	SHUTDOWN_WEBHOOK_WAIT = time.Second * 5
+)
+
+const (
+	// SHUTDOWN_STATE_NOT_RUNNING is an App or Service that wasn't running when we shutdown
+	SHUTDOWN_STATE_NOT_RUNNING = "not-running"
+	// SHUTDOWN_STATE_STOPPED is an App that exited once it was signalled with SIGUSR1, or a Service that was stopped
+	SHUTDOWN_STATE_STOPPED = "stopped"
+	// SHUTDOWN_STATE_TERMINATED is an App that exited once it was signalled with SIGTERM
+	SHUTDOWN_STATE_TERMINATED = "terminated"
+	// SHUTDOWN_STATE_KILLED is an App that exited once it was signalled with SIGKILL
+	SHUTDOWN_STATE_KILLED = "killed"
+	// SHUTDOWN_STATE_LEFT_RUNNING is an App that never exited, an App without a PID, or a Service without StopOnShutdown
+	// Services are managed by our system and are only stopped by Patrol if ConfigService.StopOnShutdown is true
+	SHUTDOWN_STATE_LEFT_RUNNING = "left-running"
+	// SHUTDOWN_STATE_STOP_FAILED is a Service with StopOnShutdown that failed to stop before our context was done
+	SHUTDOWN_STATE_STOP_FAILED = "stop-failed"
+)
+
+// ShutdownReport is how each of our Apps and Services stopped once Patrol.Shutdown() was called
+type ShutdownReport struct {
+	Apps     map[string]*ShutdownResult `json:"apps,omitempty"`
+	Services map[string]*ShutdownResult `json:"services,omitempty"`
+	// Duration is how long our Shutdown took in seconds
+	Duration float64 `json:"duration"`
+}
+
+// ShutdownResult is how a single App or Service stopped
+type ShutdownResult struct {
+	State string `json:"state"`
+	PID   uint32 `json:"pid,omitempty"`
+	// Signals are the signals sent to our App in the order they were sent
+	Signals []string `json:"signals,omitempty"`
+	// Duration is how long our App took to exit, or how long our Service took to stop, in seconds
+	Duration float64 `json:"duration,omitempty"`
+	// Error is why our Service failed to stop
+	Error string `json:"error,omitempty"`
+}
+
+// IsClean will return true if our App exited without being killed, or if it wasn't running
+func (self *ShutdownResult) IsClean() bool {
+	return self.State == SHUTDOWN_STATE_NOT_RUNNING ||
+		self.State == SHUTDOWN_STATE_STOPPED ||
+		self.State == SHUTDOWN_STATE_TERMINATED
+}
+
+// IsClean will return true if every App exited without being killed and none of our Services failed to stop
+// a Service that was left running is clean, we were never asked to stop it
+func (self *ShutdownReport) IsClean() bool {
+	for _, r := range self.Apps {
+		if !r.IsClean() {
+			return false
+		}
+	}
+	for _, r := range self.Services {
+		if r.State == SHUTDOWN_STATE_STOP_FAILED {
+			return false
+		}
+	}
+	return true
+}
+
+// ShutdownError is returned by Patrol.Shutdown() if any of our Apps were killed or left running, or any of our Services failed to stop
+type ShutdownError struct {
+	Report *ShutdownReport
+}
+
+func (self *ShutdownError) Error() string {
+	apps := []string{}
+	for id, r := range self.Report.Apps {
+		if !r.IsClean() {
+			apps = append(apps, fmt.Sprintf("%s (%s)", id, r.State))
+		}
+	}
+	sort.Strings(apps)
+	services := []string{}
+	for id, r := range self.Report.Services {
+		if r.State == SHUTDOWN_STATE_STOP_FAILED {
+			services = append(services, fmt.Sprintf("%s (%s)", id, r.State))
+		}
+	}
+	sort.Strings(services)
+	if len(services) == 0 {
+		return fmt.Sprintf("Patrol failed to stop Apps cleanly: %s", strings.Join(apps, ", "))
+	}
+	if len(apps) == 0 {
+		return fmt.Sprintf("Patrol failed to stop Services: %s", strings.Join(services, ", "))
+	}
+	return fmt.Sprintf("Patrol failed to stop Apps cleanly: %s, and failed to stop Services: %s", strings.Join(apps, ", "), strings.Join(services, ", "))
+}
+
+// Run will start Patrol and block until our context is done or Patrol.Shutdown() is called
+// once we're done we will Shutdown, waiting up to Config.ShutdownTimeout for our Apps to exit
+func (self *Patrol) Run(
+	ctx context.Context,
+) error {
+	if err := self.Start(); err != nil {
+		return err
+	}
+	select {
+	case <-ctx.Done():
+	case <-self.shutdown_c:
+	}
+	// our context is already done, our shutdown needs its own deadline
+	shutdown_ctx, cancel := context.WithTimeout(context.Background(), self.shutdownTimeout())
+	defer cancel()
+	return self.Shutdown(shutdown_ctx)
+}
+
+// Shutdown will stop Patrol and wait for our Apps to exit
+// our Apps are signalled with SIGUSR1, SIGTERM once half of our context's deadline has passed, and SIGKILL once our context is done
+// if our context has no deadline we will wait for our Apps to exit until our context is done
+// our Apps are stopped in parallel, and then our Services with StopOnShutdown are stopped, our Apps may depend on our Services
+// our webhooks are sent as our Apps and Services close, we will wait until our context is done for our webhooks to be sent
+// a ShutdownError is returned if any of our Apps were killed or left running, or any of our Services failed to stop, see GetShutdownReport()
+func (self *Patrol) Shutdown(
+	ctx context.Context,
+) error {
+	// we need to know which of our Apps were running before our tick signals them to stop
+	running := self.runningApps()
+	self.mu.Lock()
+	first := !self.shutdown
+	if first && self.config.TriggerShutdown != nil {
+		// never shutdown
+		// use goroutine to avoid deadlock
+		go self.trigger(TRIGGER_SHUTDOWN, func() {
+			self.config.TriggerShutdown(self)
+		})
+	}
+	self.shutdown = true
+	self.stop()
+	ticker_done := self.ticker_done
+	if first {
+		close(self.shutdown_c)
+	}
+	self.mu.Unlock()
+	if !first {
+		// we're already shutting down, wait for our first Shutdown to finish
+		select {
+		case <-self.shutdown_done:
+			self.mu.RLock()
+			defer self.mu.RUnlock()
+			return self.shutdown_err
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	report := self.shutdownWait(ctx, ticker_done, running)
+	self.shutdownWebhooks(ctx)
+	var err error
+	if !report.IsClean() {
+		err = &ShutdownError{
+			Report: report,
+		}
+	}
+	self.mu.Lock()
+	self.shutdown_report = report
+	self.shutdown_err = err
+	self.mu.Unlock()
+	close(self.shutdown_done)
+	return err
+}
+
+// GetShutdownReport will return how our Apps and Services stopped, nil is returned until Shutdown() has finished
+func (self *Patrol) GetShutdownReport() *ShutdownReport {
+	self.mu.RLock()
+	defer self.mu.RUnlock()
+	return self.shutdown_report
+}
+
+// shutdownTimeout will return Config.ShutdownTimeout, our value has already been limited by Config.Validate()
+func (self *Patrol) shutdownTimeout() time.Duration {
+	return time.Second * time.Duration(self.config.ShutdownTimeout)
+}
+
+// shutdownWait will wait for our tick to stop and then for each of our Apps to exit
+// our deadlines are always our wall clock, the same as our context
+func (self *Patrol) shutdownWait(
+	ctx context.Context,
+	ticker_done <-chan struct{},
+	running map[*App]uint32,
+) *ShutdownReport {
+	started := time.Now()
+	if ticker_done != nil {
+		// our tick signals our Apps with SIGUSR1 once it has stopped
+		// if our context is done first we will still escalate to SIGKILL
+		select {
+		case <-ticker_done:
+		case <-ctx.Done():
+		}
+	}
+	report := &ShutdownReport{
+		Apps:     make(map[string]*ShutdownResult),
+		Services: make(map[string]*ShutdownResult),
+	}
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	for id, app := range self.apps {
+		wg.Add(1)
+		go func(id string, app *App) {
+			defer wg.Done()
+			pid, ok := running[app]
+			r := self.shutdownApp(ctx, app, pid, ok)
+			mu.Lock()
+			report.Apps[id] = r
+			mu.Unlock()
+		}(id, app)
+	}
+	wg.Wait()
+	// our Services are only stopped once our Apps have stopped
+	for id, service := range self.services {
+		wg.Add(1)
+		go func(id string, service *Service) {
+			defer wg.Done()
+			r := self.shutdownService(ctx, service)
+			mu.Lock()
+			report.Services[id] = r
+			mu.Unlock()
+		}(id, service)
+	}
+	wg.Wait()
+	report.Duration = time.Since(started).Seconds()
+	return report
+}
+
+// shutdownWebhooks will wait for our webhooks to be sent, including their retries, until our context is done
+// if our Apps and Services used our entire context we will still wait up to SHUTDOWN_WEBHOOK_WAIT
+func (self *Patrol) shutdownWebhooks(
+	ctx context.Context,
+) {
+	// our webhooks that are still waiting to retry will stop once we return
+	defer close(self.webhooks_done)
+	sent := make(chan struct{})
+	go func() {
+		self.webhooks_wg.Wait()
+		close(sent)
+	}()
+	done := ctx.Done()
+	var wait <-chan time.Time
+	if ctx.Err() != nil {
+		timer := time.NewTimer(SHUTDOWN_WEBHOOK_WAIT)
+		defer timer.Stop()
+		done = nil
+		wait = timer.C
+	}
+	select {
+	case <-sent:
+	case <-done:
+		log.Println("./patrol.shutdownWebhooks(): our webhooks were not sent before our context was done")
+	case <-wait:
+		log.Println("./patrol.shutdownWebhooks(): our webhooks were not sent within SHUTDOWN_WEBHOOK_WAIT")
+	}
+}
+
+// shutdownService will stop our Service if ConfigService.StopOnShutdown is true, otherwise our Service is left running
+// we will only wait until our context is done for our stop command, our stop command will still finish in the background
+// if our Apps used our entire context we will still wait up to SHUTDOWN_STOP_WAIT, the same as SHUTDOWN_KILL_WAIT for our Apps
+func (self *Patrol) shutdownService(
+	ctx context.Context,
+	service *Service,
+) *ShutdownResult {
+	started := time.Now()
+	service.o.RLock()
+	running := !service.o.GetStarted().IsZero()
+	service.o.RUnlock()
+	result := &ShutdownResult{
+		State: SHUTDOWN_STATE_NOT_RUNNING,
+	}
+	if !running {
+		return result
+	}
+	if !service.config.StopOnShutdown {
+		result.State = SHUTDOWN_STATE_LEFT_RUNNING
+		return result
+	}
+	stopped := make(chan error, 1)
+	go func() {
+		service.o.Lock()
+		defer service.o.Unlock()
+		stopped <- service.stopService()
+	}()
+	done := ctx.Done()
+	var wait <-chan time.Time
+	if ctx.Err() != nil {
+		// our Apps used our entire context
+		timer := time.NewTimer(SHUTDOWN_STOP_WAIT)
+		defer timer.Stop()
+		done = nil
+		wait = timer.C
+	}
+	select {
+	case err := <-stopped:
+		result.Duration = time.Since(started).Seconds()
+		if err != nil {
+			log.Printf("./patrol.shutdownService(): Service ID: %s failed to stop: \"%s\"\n", service.id, err)
+			result.State = SHUTDOWN_STATE_STOP_FAILED
+			result.Error = err.Error()
+		} else {
+			result.State = SHUTDOWN_STATE_STOPPED
+		}
+	case <-done:
+		log.Printf("./patrol.shutdownService(): Service ID: %s did not stop before our context was done\n", service.id)
+		result.State = SHUTDOWN_STATE_STOP_FAILED
+		result.Error = ctx.Err().Error()
+	case <-wait:
+		log.Printf("./patrol.shutdownService(): Service ID: %s did not stop within SHUTDOWN_STOP_WAIT\n", service.id)
+		result.State = SHUTDOWN_STATE_STOP_FAILED
+		result.Error = ctx.Err().Error()
+	}
+	return result
+}
+
+// shutdownApp will wait for our App to exit, escalating our signals until our context is done
+func (self *Patrol) shutdownApp(
+	ctx context.Context,
+	app *App,
+	pid uint32,
+	running bool,
+) *ShutdownResult {
+	started := time.Now()
+	app.o.Lock()
+	if !running &&
+		!app.o.GetStarted().IsZero() {
+		// our App was started by a check that was running while we started to shutdown
+		pid = app.o.GetPID()
+		running = true
+	}
+	stopped := app.isStopped(pid)
+	app.o.Unlock()
+	result := &ShutdownResult{
+		State: SHUTDOWN_STATE_NOT_RUNNING,
+		PID:   pid,
+	}
+	if !running {
+		return result
+	}
+	if pid == 0 ||
+		self.config.unittesting {
+		// we can't signal an App without a PID, and we never signal our Apps while unittesting
+		result.State = SHUTDOWN_STATE_LEFT_RUNNING
+		if stopped {
+			// our App exited on its own
+			result.State = SHUTDOWN_STATE_STOPPED
+		}
+		return result
+	}
+	// our App was signalled with SIGUSR1 once our tick stopped, see Patrol.shutdownApps()
+	result.State = SHUTDOWN_STATE_STOPPED
+	result.Signals = []string{signalName(syscall.SIGUSR1)}
+	if stopped {
+		result.Duration = time.Since(started).Seconds()
+		return result
+	}
+	signal := func(sig syscall.Signal, state string) {
+		log.Printf("./patrol.shutdownApp(): App ID: %s has not exited - Signalling %s!\n", app.id, signalName(sig))
+		self.executor().Signal(pid, sig)
+		result.State = state
+		result.Signals = append(result.Signals, signalName(sig))
+	}
+	var term <-chan time.Time
+	if deadline, ok := ctx.Deadline(); ok {
+		t := time.NewTimer(time.Until(deadline) / 2)
+		defer t.Stop()
+		term = t.C
+	}
+	done := ctx.Done()
+	var kill <-chan time.Time
+	poll := time.NewTicker(SHUTDOWN_POLL_EVERY)
+	defer poll.Stop()
+	for {
+		select {
+		case <-poll.C:
+			app.o.Lock()
+			stopped = app.isStopped(pid)
+			app.o.Unlock()
+			if stopped {
+				result.Duration = time.Since(started).Seconds()
+				return result
+			}
+		case <-term:
+			term = nil
+			signal(syscall.SIGTERM, SHUTDOWN_STATE_TERMINATED)
+		case <-done:
+			term = nil
+			done = nil
+			signal(syscall.SIGKILL, SHUTDOWN_STATE_KILLED)
+			kill = time.After(SHUTDOWN_KILL_WAIT)
+		case <-kill:
+			log.Printf("./patrol.shutdownApp(): App ID: %s has not exited - Leaving it running!\n", app.id)
+			result.State = SHUTDOWN_STATE_LEFT_RUNNING
+			return result
+		}
+	}
+}
+
+// isStopped will return true once our PID has exited, our App must be locked
+// our History is saved once we've seen our PID exit, an APP_KEEPALIVE_PID_PATROL App saves its History once cmd.Wait() returns
+func (self *App) isStopped(
+	pid uint32,
+) bool {
+	if self.o.GetStarted().IsZero() ||
+		self.o.GetPID() != pid {
+		return true
+	}
+	if self.config.KeepAlive == APP_KEEPALIVE_PID_PATROL ||
+		pid == 0 {
+		return false
+	}
+	if self.exited == pid ||
+		self.patrol.executor().Status(pid) != nil {
+		self.close()
+		return true
+	}
+	return false
+}
+
+// runningApps will return the PID of each of our running Apps, our PID may be 0 if our App has not pinged us with its PID
+func (self *Patrol) runningApps() map[*App]uint32 {
+	running := make(map[*App]uint32)
+	for _, app := range self.apps {
+		app.o.RLock()
+		if !app.o.GetStarted().IsZero() {
+			running[app] = app.o.GetPID()
+		}
+		app.o.RUnlock()
+	}
+	return running
+}
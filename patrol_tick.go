@@ -1,6 +1,7 @@
 package patrol
 
 import (
+	"container/heap"
 	"fmt"
 	"log"
 	"sync"
@@ -24,7 +25,16 @@ func (self *Patrol) Start() error {
 		// ticker running
 		return ERR_PATROL_ALREADYRUNNING
 	}
-	go self.tick()
+	if self.ticker_done != nil {
+		select {
+		case <-self.ticker_done:
+		default:
+			// our tick is still starting or stopping
+			return ERR_PATROL_ALREADYRUNNING
+		}
+	}
+	self.ticker_done = make(chan struct{})
+	go self.tick(self.ticker_done)
 	return nil
 }
 func (self *Patrol) Stop() error {
@@ -38,9 +48,15 @@ func (self *Patrol) stop() error {
 		return ERR_PATROL_NOTRUNNING
 	}
 	self.ticker_stop = true
+	// wake our tick so that we stop right away instead of on our next check
+	// our Clock may never fire again if it's only advanced manually
+	self.wake(nil)
 	return nil
 }
-func (self *Patrol) tick() {
+func (self *Patrol) tick(
+	ticker_done chan<- struct{},
+) {
+	defer close(ticker_done)
 	log.Println("./patrol.tick(): starting")
 	self.mu.Lock()
 	if !self.ticker_running.IsZero() {
@@ -58,12 +74,14 @@ func (self *Patrol) tick() {
 		self.mu.Unlock()
 		return
 	}
-	self.ticker_running = time.Now()
+	self.ticker_running = self.now()
 	self.mu.Unlock()
 	// signal that we've started
 	if self.config.TriggerStarted != nil {
 		// since we're not in a lock we're going to wait for this function
-		self.config.TriggerStarted(self)
+		self.trigger(TRIGGER_STARTED, func() {
+			self.config.TriggerStarted(self)
+		})
 	}
 	log.Println("./patrol.tick(): started")
 	defer func() {
@@ -72,7 +90,9 @@ func (self *Patrol) tick() {
 		// we should signal our trigger before we signal all of our apps
 		if self.config.TriggerStopped != nil {
 			// since we're not in a lock we're going to wait for this function
-			self.config.TriggerStopped(self)
+			self.trigger(TRIGGER_STOPPED, func() {
+				self.config.TriggerStopped(self)
+			})
 		}
 		// we need to signal to all of our apps/services that we're shutting down!
 		self.shutdownApps()
@@ -84,11 +104,42 @@ func (self *Patrol) tick() {
 		self.mu.Unlock()
 		log.Println("./patrol.tick(): stopped")
 	}()
+	// every App and Service is checked on its own schedule, see ConfigApp.CheckEvery
+	// our global tick remains our default and still calls TriggerTick every TickEvery
+	s := &scheduler{}
+	clock := self.clock()
+	now := clock.Now()
+	// our Apps may be woken by their PID exiting
+	apps := make(map[*App]*schedule)
+	for _, app := range self.apps {
+		apps[app] = &schedule{
+			next: now,
+			app:  app,
+		}
+		heap.Push(s, apps[app])
+	}
+	for _, service := range self.services {
+		heap.Push(s, &schedule{
+			next:    now,
+			service: service,
+		})
+	}
+	// our Apps and Services are returned once they've been checked
+	// we will never have more checks running than we have Apps and Services, so we can never block
+	done := make(chan *schedule, s.Len())
 	var wg sync.WaitGroup
+	next_tick := now
 	for {
-		// call tick
-		if self.config.TriggerTick != nil {
-			self.config.TriggerTick(self)
+		now = clock.Now()
+		if !now.Before(next_tick) {
+			// call tick
+			if self.config.TriggerTick != nil {
+				// a slow TriggerTick will delay every check, see TriggerOptions
+				self.trigger(TRIGGER_TICK, func() {
+					self.config.TriggerTick(self)
+				})
+			}
+			next_tick = clock.Now().Add(time.Second * time.Duration(self.config.TickEvery))
 		}
 		self.mu.RLock()
 		// if we're shutting down, do not close yet
@@ -96,25 +147,50 @@ func (self *Patrol) tick() {
 		shutdown := self.shutdown
 		if self.ticker_stop {
 			self.mu.RUnlock()
+			// wait for our running checks
+			wg.Wait()
 			// stopped
 			return
 		}
 		self.mu.RUnlock()
-		// tick
-		wg.Add(2)
-		go func() {
-			defer wg.Done()
-			self.runApps()
-		}()
-		go func() {
-			defer wg.Done()
-			self.runServices()
-		}()
-		wg.Wait()
 		if shutdown {
+			// wait for our running checks, then check every App and Service one last time
+			wg.Wait()
+			wg.Add(2)
+			go func() {
+				defer wg.Done()
+				self.runApps()
+			}()
+			go func() {
+				defer wg.Done()
+				self.runServices()
+			}()
+			wg.Wait()
 			// we're done!
 			return
 		}
-		<-time.After(time.Second * time.Duration(self.config.TickEvery))
+		self.schedule(s, now, done, &wg)
+		// wait for either our next check, our next tick, a check to finish, or an App to be woken
+		wait := next_tick
+		if s.Len() > 0 &&
+			(*s)[0].next.Before(wait) {
+			wait = (*s)[0].next
+		}
+		timer := clock.NewTimer(wait.Sub(clock.Now()))
+		select {
+		case e := <-done:
+			timer.Stop()
+			heap.Push(s, e)
+			if e.woken {
+				e.woken = false
+				wakeSchedule(s, e, clock.Now())
+			}
+		case app := <-self.wake_c:
+			timer.Stop()
+			if e, ok := apps[app]; ok {
+				wakeSchedule(s, e, clock.Now())
+			}
+		case <-timer.C():
+		}
 	}
 }
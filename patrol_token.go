@@ -0,0 +1,172 @@
+package patrol
+
+import (
+	"crypto/sha256"
+	"golang.org/x/crypto/bcrypt"
+	"net/http"
+	"strings"
+)
+
+const (
+	// TOKEN_INVALID_CACHE_MAX is how many invalid tokens we will cache before our invalid cache is cleared
+	TOKEN_INVALID_CACHE_MAX = 1024
+)
+
+// RequestToken will return the Token of our HTTP request
+// Our Token is read from our `Authorization: Bearer TOKEN` header, otherwise our `token` query or form value
+func RequestToken(
+	r *http.Request,
+) string {
+	if a := r.Header.Get("Authorization"); strings.HasPrefix(a, "Bearer ") {
+		return strings.TrimSpace(a[len("Bearer "):])
+	}
+	return r.FormValue("token")
+}
+
+// IsTokenRequired will return true if every request must present an authorized Token
+func (self *Patrol) IsTokenRequired() bool {
+	return self.config.TokenRequired
+}
+
+// IsTokenAuthorized will return true if our Token exists, is authorized for our App or Service ID, and has every scope
+func (self *Patrol) IsTokenAuthorized(
+	token string,
+	group string,
+	id string,
+	scopes ...string,
+) bool {
+	t := self.verifyToken(token)
+	if t == nil {
+		return false
+	}
+	if !t.IsID(group, strings.ToLower(id)) {
+		return false
+	}
+	for _, scope := range scopes {
+		if !t.HasScope(scope) {
+			return false
+		}
+	}
+	return true
+}
+
+// isTokenAccepted will return true if our App or Service ID may be authorized by any of our Tokens
+func (self *Patrol) isTokenAccepted(
+	group string,
+	id string,
+) bool {
+	for _, t := range self.getTokens() {
+		if t.IsID(group, id) {
+			return true
+		}
+	}
+	return false
+}
+
+// verifyToken will return our Token if it matches our Hash
+// bcrypt is slow, so we never compare our hashes while locked, a cached Token must never wait on an unknown Token
+// our valid tokens are cached, our invalid tokens are cached until TOKEN_INVALID_CACHE_MAX, then our invalid cache is cleared
+// we hold reload_mu so that Patrol.Reload() can never clear our caches while we're comparing a Token it has removed
+func (self *Patrol) verifyToken(
+	token string,
+) *ConfigToken {
+	self.reload_mu.RLock()
+	defer self.reload_mu.RUnlock()
+	if token == "" ||
+		len(self.config.Tokens) == 0 {
+		return nil
+	}
+	key := sha256.Sum256([]byte(token))
+	self.tokens_mu.Lock()
+	if t, ok := self.tokens[key]; ok {
+		self.tokens_mu.Unlock()
+		return t
+	}
+	if _, ok := self.tokens_invalid[key]; ok {
+		self.tokens_mu.Unlock()
+		return nil
+	}
+	self.tokens_mu.Unlock()
+	ids := make(map[string]bool)
+	for _, t := range self.config.Tokens {
+		if t.ID != "" {
+			ids[t.ID] = true
+		}
+	}
+	var found *ConfigToken
+	for _, t := range self.config.Tokens {
+		if t.isToken(token, ids) &&
+			bcrypt.CompareHashAndPassword([]byte(t.Hash), []byte(token)) == nil {
+			found = t
+			break
+		}
+	}
+	self.tokens_mu.Lock()
+	defer self.tokens_mu.Unlock()
+	if found != nil {
+		if self.tokens == nil {
+			self.tokens = make(map[[sha256.Size]byte]*ConfigToken)
+		}
+		self.tokens[key] = found
+		return found
+	}
+	if self.tokens_invalid == nil ||
+		len(self.tokens_invalid) >= TOKEN_INVALID_CACHE_MAX {
+		// our cache is bounded, we would rather compare our hashes again than grow forever
+		self.tokens_invalid = make(map[[sha256.Size]byte]struct{})
+	}
+	self.tokens_invalid[key] = struct{}{}
+	return nil
+}
+
+// apiScopes will return the scopes required by our request
+// a request that doesn't modify anything only requires TOKEN_SCOPE_READ
+func apiScopes(
+	request *API_Request,
+) []string {
+	scopes := []string{}
+	if request.Ping ||
+		request.PID > 0 {
+		scopes = append(scopes, TOKEN_SCOPE_PING)
+	}
+	if request.Toggle > 0 {
+		scopes = append(scopes, TOKEN_SCOPE_TOGGLE)
+	}
+	if request.KeyValue != nil ||
+		request.KeyValueReplace ||
+		len(request.KeyValueOps) > 0 {
+		scopes = append(scopes, TOKEN_SCOPE_KEYVALUE_WRITE)
+	}
+	if request.History ||
+		len(scopes) == 0 {
+		scopes = append(scopes, TOKEN_SCOPE_READ)
+	}
+	return scopes
+}
+
+// IsHTTPAuthorized will authorize an HTTP request for our App or Service
+// If our request presents a Token, or Tokens are required, our Token must be authorized for every scope
+// Otherwise we will compare our Secret and the identities of a verified client certificate
+func (self *Patrol) IsHTTPAuthorized(
+	r *http.Request,
+	group string,
+	id string,
+	secret string,
+	scopes ...string,
+) bool {
+	if token := RequestToken(r); token != "" ||
+		self.config.TokenRequired {
+		return self.IsTokenAuthorized(token, group, id, scopes...)
+	}
+	id = strings.ToLower(id)
+	if group == "app" {
+		if a, ok := self.apps[id]; ok {
+			return a.IsAuthorized(secret, ClientIdentities(r))
+		}
+	} else if group == "service" {
+		if s, ok := self.services[id]; ok {
+			return s.IsAuthorized(secret, ClientIdentities(r))
+		}
+	}
+	return false
+}
@@ -0,0 +1,334 @@
+package patrol
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"golang.org/x/crypto/bcrypt"
+	"log"
+	"net/http/httptest"
+	"sabey.co/unittest"
+	"testing"
+)
+
+func testTokenHash(
+	t *testing.T,
+	token string,
+) string {
+	hash, err := bcrypt.GenerateFromPassword([]byte(token), bcrypt.MinCost)
+	unittest.IsNil(t, err)
+	return string(hash)
+}
+func TestConfigToken(t *testing.T) {
+	log.Println("TestConfigToken")
+
+	token := &ConfigToken{}
+	unittest.Equals(t, token.Validate(), ERR_TOKEN_HASH_INVALID)
+
+	token.Hash = "plaintext"
+	unittest.Equals(t, token.Validate(), ERR_TOKEN_HASH_INVALID)
+
+	token.Hash = testTokenHash(t, "token")
+	unittest.Equals(t, token.Validate(), ERR_TOKEN_SCOPES_EMPTY)
+
+	token.Scopes = []string{"write"}
+	unittest.Equals(t, token.Validate(), ERR_TOKEN_SCOPE_INVALID)
+
+	token.Scopes = []string{TOKEN_SCOPE_READ, TOKEN_SCOPE_READ}
+	unittest.Equals(t, token.Validate(), ERR_TOKEN_SCOPE_DUPLICATE)
+
+	token.Scopes = []string{TOKEN_SCOPE_READ, TOKEN_SCOPE_PING}
+	unittest.Equals(t, token.Validate(), ERR_TOKEN_IDS_EMPTY)
+
+	token.Apps = []string{"web-["}
+	unittest.Equals(t, token.Validate(), ERR_TOKEN_GLOB_INVALID)
+
+	token.Apps = []string{"Web-*"}
+	token.ID = "web.1"
+	unittest.Equals(t, token.Validate(), ERR_TOKEN_ID_INVALID)
+	token.ID = ""
+	unittest.IsNil(t, token.Validate())
+	// globs are lowercased
+	unittest.Equals(t, token.Apps, []string{"web-*"})
+	unittest.Equals(t, token.IsID("app", "web-1"), true)
+	unittest.Equals(t, token.IsID("app", "db-1"), false)
+	// we only authorized apps, so services are not authorized
+	unittest.Equals(t, token.IsID("service", "web-1"), false)
+
+	// scopes
+	unittest.Equals(t, token.HasScope(TOKEN_SCOPE_READ), true)
+	unittest.Equals(t, token.HasScope(TOKEN_SCOPE_TOGGLE), false)
+	token.Scopes = []string{TOKEN_SCOPE_ADMIN}
+	unittest.Equals(t, token.HasScope(TOKEN_SCOPE_TOGGLE), true)
+	unittest.Equals(t, token.HasScope(TOKEN_SCOPE_KEYVALUE_WRITE), true)
+
+	// clone
+	clone := token.Clone()
+	unittest.Equals(t, clone.Hash, token.Hash)
+	unittest.Equals(t, clone.Scopes, token.Scopes)
+	unittest.Equals(t, clone.Apps, token.Apps)
+	// dereference
+	clone.Apps[0] = "*"
+	unittest.Equals(t, token.Apps[0], "web-*")
+
+	// config
+	config := &Config{
+		Services: map[string]*ConfigService{
+			"ssh": &ConfigService{
+				Management: SERVICE_MANAGEMENT_SERVICE,
+				Name:       "SSH",
+				Service:    "ssh",
+			},
+		},
+		TokenRequired: true,
+	}
+	unittest.Equals(t, config.Validate(), ERR_TOKEN_REQUIRED_EMPTY)
+	config.Tokens = []*ConfigToken{
+		nil,
+	}
+	unittest.Equals(t, config.Validate(), ERR_TOKEN_NIL)
+	config.Tokens[0] = &ConfigToken{}
+	unittest.Equals(t, config.Validate(), ERR_TOKEN_HASH_INVALID)
+	config.Tokens[0] = token
+	unittest.IsNil(t, config.Validate())
+	// our IDs are unique
+	config.Tokens = []*ConfigToken{token.Clone(), token.Clone()}
+	config.Tokens[0].ID = "web"
+	config.Tokens[1].ID = "web"
+	unittest.Equals(t, config.Validate(), ERR_TOKEN_ID_DUPLICATE)
+	unittest.Equals(t, config.ValidateAll()[0].Rule, ERR_TOKEN_ID_DUPLICATE)
+	unittest.Equals(t, config.ValidateAll()[0].Field, "id")
+	config.Tokens[1].ID = ""
+	unittest.IsNil(t, config.Validate())
+	// a token with a known ID is only compared to that token
+	ids := map[string]bool{"web": true}
+	unittest.Equals(t, config.Tokens[0].isToken("web.secret", ids), true)
+	unittest.Equals(t, config.Tokens[0].isToken("db.secret", ids), false)
+	unittest.Equals(t, config.Tokens[1].isToken("web.secret", ids), false)
+	unittest.Equals(t, config.Tokens[1].isToken("db.secret", ids), true)
+	config.Tokens = []*ConfigToken{token}
+	unittest.Equals(t, len(config.Clone().Tokens), 1)
+	unittest.Equals(t, config.Clone().Tokens[0].Hash, token.Hash)
+	unittest.Equals(t, config.Clone().TokenRequired, true)
+}
+func TestPatrolToken(t *testing.T) {
+	log.Println("TestPatrolToken")
+
+	config := &Config{
+		Apps: map[string]*ConfigApp{
+			"http": &ConfigApp{
+				KeepAlive:        APP_KEEPALIVE_HTTP,
+				Name:             "http",
+				Binary:           "testapp",
+				WorkingDirectory: "/testapp",
+				LogDirectory:     "logs",
+				Secret:           "secret",
+			},
+		},
+		Services: map[string]*ConfigService{
+			"ssh": &ConfigService{
+				Management: SERVICE_MANAGEMENT_SERVICE,
+				Name:       "SSH",
+				Service:    "ssh",
+			},
+		},
+		ListenHTTP: []string{"127.0.0.1:8421"},
+		Tokens: []*ConfigToken{
+			&ConfigToken{
+				Name:   "readonly",
+				Hash:   testTokenHash(t, "read"),
+				Scopes: []string{TOKEN_SCOPE_READ},
+				Apps:   []string{"*"},
+			},
+			&ConfigToken{
+				Name:   "pinger",
+				Hash:   testTokenHash(t, "ping"),
+				Scopes: []string{TOKEN_SCOPE_PING},
+				Apps:   []string{"http"},
+			},
+			&ConfigToken{
+				Name:   "deploy",
+				ID:     "deploy",
+				Hash:   testTokenHash(t, "deploy.secret"),
+				Scopes: []string{TOKEN_SCOPE_READ},
+				Apps:   []string{"http"},
+			},
+			&ConfigToken{
+				Name:     "operator",
+				Hash:     testTokenHash(t, "operator"),
+				Scopes:   []string{TOKEN_SCOPE_READ, TOKEN_SCOPE_TOGGLE, TOKEN_SCOPE_KEYVALUE_WRITE},
+				Apps:     []string{"*"},
+				Services: []string{"*"},
+			},
+		},
+	}
+	patrol, err := CreatePatrol(config)
+	unittest.IsNil(t, err)
+
+	// scopes
+	unittest.Equals(t, apiScopes(&API_Request{}), []string{TOKEN_SCOPE_READ})
+	unittest.Equals(t, apiScopes(&API_Request{Ping: true, History: true}), []string{TOKEN_SCOPE_PING, TOKEN_SCOPE_READ})
+	unittest.Equals(t, apiScopes(&API_Request{Toggle: API_TOGGLE_STATE_DISABLE, KeyValueReplace: true}), []string{TOKEN_SCOPE_TOGGLE, TOKEN_SCOPE_KEYVALUE_WRITE})
+
+	// unknown token
+	unittest.Equals(t, patrol.IsTokenAuthorized("unknown", "app", "http", TOKEN_SCOPE_READ), false)
+	unittest.Equals(t, patrol.IsTokenAuthorized("", "app", "http"), false)
+	// our token is cached once verified
+	unittest.Equals(t, patrol.IsTokenAuthorized("read", "app", "HTTP", TOKEN_SCOPE_READ), true)
+	unittest.Equals(t, len(patrol.tokens), 1)
+	unittest.Equals(t, patrol.IsTokenAuthorized("read", "app", "http", TOKEN_SCOPE_READ), true)
+	unittest.Equals(t, len(patrol.tokens), 1)
+	unittest.Equals(t, patrol.IsTokenAuthorized("read", "service", "ssh", TOKEN_SCOPE_READ), false)
+	// our invalid tokens are cached
+	unittest.Equals(t, len(patrol.tokens_invalid), 1)
+	unittest.Equals(t, patrol.IsTokenAuthorized("unknown", "app", "http", TOKEN_SCOPE_READ), false)
+	unittest.Equals(t, len(patrol.tokens_invalid), 1)
+	// our invalid cache is bounded
+	for i := len(patrol.tokens_invalid); i < TOKEN_INVALID_CACHE_MAX; i++ {
+		patrol.tokens_invalid[sha256.Sum256([]byte(fmt.Sprintf("junk-%d", i)))] = struct{}{}
+	}
+	unittest.Equals(t, patrol.IsTokenAuthorized("junk", "app", "http", TOKEN_SCOPE_READ), false)
+	unittest.Equals(t, len(patrol.tokens_invalid), 1)
+	// a token with an ID
+	unittest.Equals(t, patrol.IsTokenAuthorized("deploy.secret", "app", "http", TOKEN_SCOPE_READ), true)
+	unittest.Equals(t, patrol.IsTokenAuthorized("deploy.unknown", "app", "http", TOKEN_SCOPE_READ), false)
+	unittest.Equals(t, len(patrol.tokens), 2)
+
+	// read only
+	response := patrol.API(&API_Request{
+		ID:    "http",
+		Group: "app",
+		Token: "read",
+	})
+	unittest.Equals(t, len(response.Errors), 0)
+	unittest.Equals(t, response.CASInvalid, false)
+	unittest.Equals(t, response.Token, true)
+	response = patrol.API(&API_Request{
+		ID:     "http",
+		Group:  "app",
+		Token:  "read",
+		Toggle: API_TOGGLE_STATE_DISABLE,
+	})
+	unittest.Equals(t, response.Errors, []string{"Token Unauthorized"})
+	unittest.Equals(t, patrol.GetApp("http").IsDisabled(), false)
+
+	// ping only
+	response = patrol.API(&API_Request{
+		ID:    "http",
+		Group: "app",
+		Token: "ping",
+		Ping:  true,
+		PID:   1234,
+	})
+	unittest.Equals(t, len(response.Errors), 0)
+	unittest.Equals(t, patrol.GetApp("http").GetPID(), uint32(1234))
+	response = patrol.API(&API_Request{
+		ID:    "http",
+		Group: "app",
+		Token: "ping",
+		KeyValue: map[string]interface{}{
+			"a": "b",
+		},
+	})
+	unittest.Equals(t, response.Errors, []string{"Token Unauthorized"})
+
+	// a token overrides our secret
+	response = patrol.API(&API_Request{
+		ID:     "http",
+		Group:  "app",
+		Token:  "unknown",
+		Secret: "secret",
+	})
+	unittest.Equals(t, response.Errors, []string{"Token Unauthorized"})
+
+	// operator
+	response = patrol.API(&API_Request{
+		ID:     "ssh",
+		Group:  "service",
+		Token:  "operator",
+		Toggle: API_TOGGLE_STATE_DISABLE,
+		KeyValue: map[string]interface{}{
+			"a": "b",
+		},
+	})
+	unittest.Equals(t, len(response.Errors), 0)
+	unittest.Equals(t, response.CASInvalid, false)
+	unittest.Equals(t, patrol.GetService("ssh").IsDisabled(), true)
+	unittest.Equals(t, len(patrol.GetService("ssh").GetKeyValue()), 1)
+
+	// tokens are optional, so our secret is still accepted
+	response = patrol.API(&API_Request{
+		ID:     "http",
+		Group:  "app",
+		Secret: "secret",
+		Toggle: API_TOGGLE_STATE_DISABLE,
+	})
+	unittest.Equals(t, len(response.Errors), 0)
+	unittest.Equals(t, patrol.GetApp("http").IsDisabled(), true)
+
+	// http
+	r := httptest.NewRequest("GET", "/logs/?group=app&id=http", nil)
+	unittest.Equals(t, patrol.IsHTTPAuthorized(r, "app", "http", "", TOKEN_SCOPE_READ), false)
+	unittest.Equals(t, patrol.IsHTTPAuthorized(r, "app", "http", "secret", TOKEN_SCOPE_READ), true)
+	r.Header.Set("Authorization", "Bearer read")
+	unittest.Equals(t, RequestToken(r), "read")
+	unittest.Equals(t, patrol.IsHTTPAuthorized(r, "app", "http", "", TOKEN_SCOPE_READ), true)
+	unittest.Equals(t, patrol.IsHTTPAuthorized(r, "app", "http", "", TOKEN_SCOPE_TOGGLE), false)
+	r = httptest.NewRequest("GET", "/logs/?group=app&id=http&token=operator", nil)
+	unittest.Equals(t, RequestToken(r), "operator")
+	unittest.Equals(t, patrol.IsHTTPAuthorized(r, "app", "http", "", TOKEN_SCOPE_TOGGLE), true)
+
+	// tokens required
+	patrol.config.TokenRequired = true
+	response = patrol.API(&API_Request{
+		ID:    "http",
+		Group: "app",
+	})
+	unittest.Equals(t, response.Errors, []string{"Token Unauthorized"})
+	response = patrol.API(&API_Request{
+		ID:     "http",
+		Group:  "app",
+		Secret: "secret",
+	})
+	unittest.Equals(t, response.Errors, []string{"Token Unauthorized"})
+	r = httptest.NewRequest("GET", "/logs/?group=app&id=http", nil)
+	unittest.Equals(t, patrol.IsHTTPAuthorized(r, "app", "http", "secret", TOKEN_SCOPE_READ), false)
+
+	// status
+	status := func(token string) (int, *API_Status) {
+		r := httptest.NewRequest("GET", "/status/", nil)
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		patrol.ServeHTTPStatus(w, r)
+		status := &API_Status{}
+		unittest.IsNil(t, json.Unmarshal(w.Body.Bytes(), status))
+		return w.Code, status
+	}
+	code, _ := status("")
+	unittest.Equals(t, code, 401)
+	code, _ = status("unknown")
+	unittest.Equals(t, code, 401)
+	// our pinger may not read
+	code, s := status("ping")
+	unittest.Equals(t, code, 200)
+	unittest.Equals(t, len(s.Apps), 0)
+	unittest.Equals(t, len(s.Services), 0)
+	code, s = status("read")
+	unittest.Equals(t, code, 200)
+	unittest.Equals(t, len(s.Apps), 1)
+	unittest.Equals(t, len(s.Services), 0)
+	code, s = status("operator")
+	unittest.Equals(t, len(s.Apps), 1)
+	unittest.Equals(t, len(s.Services), 1)
+	// tokens are optional, but a presented token is still enforced
+	patrol.config.TokenRequired = false
+	code, s = status("")
+	unittest.Equals(t, code, 200)
+	unittest.Equals(t, len(s.Services), 1)
+	code, s = status("read")
+	unittest.Equals(t, len(s.Services), 0)
+	code, _ = status("unknown")
+	unittest.Equals(t, code, 401)
+}
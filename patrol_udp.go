@@ -17,20 +17,46 @@ func (self *Patrol) HandleUDPConnection(
 		return err
 	}
 	// read something
-	request := &API_Request{}
-	// unmarshal
-	if err = json.Unmarshal(body[:n], request); err != nil ||
-		!request.IsValid() {
+	// we're either going to read a signed envelope or a request
+	envelope := &API_UDPEnvelope{}
+	if err = json.Unmarshal(body[:n], envelope); err != nil {
 		// failed to unmarshal
 		// ignore error
 		return nil
 	}
+	request := &API_Request{}
+	if envelope.Signature != "" {
+		// signed envelope
+		if request, err = self.openUDPEnvelope(envelope); err != nil {
+			// failed to verify
+			// ignore error
+			return nil
+		}
+	} else {
+		// unmarshal
+		if err = json.Unmarshal(body[:n], request); err != nil ||
+			!request.IsValid() {
+			// failed to unmarshal
+			// ignore error
+			return nil
+		}
+		if self.isUDPSignatureRequired(request) {
+			// our App will only accept signed envelopes
+			return nil
+		}
+	}
 	// read response
 	response := self.api(api_endpoint_udp, request)
 	if len(response.Errors) > 0 {
 		// DO NOT RESPOND WITH ERRORS!
 		return nil
 	}
+	if a, ok := addr.(*net.UnixAddr); addr == nil ||
+		(ok && a.Name == "") {
+		// our unixgram sender never bound to a path, we have nowhere to respond to
+		// this isn't an error, we don't want our listener to stop
+		return nil
+	}
 	// marshal response
 	bs, _ := json.Marshal(response)
 	// write response
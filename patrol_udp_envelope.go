@@ -0,0 +1,186 @@
+package patrol
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// UDP_ENVELOPE_WINDOW is how many seconds our envelope timestamp may differ from our clock
+	UDP_ENVELOPE_WINDOW            = 30
+	UDP_ENVELOPE_KEY_ID_MAX_LENGTH = 64
+	UDP_ENVELOPE_NONCE_MAX_LENGTH  = 64
+	// UDP_ENVELOPE_NONCES_MAX is the maximum amount of nonces we will remember within our window
+	UDP_ENVELOPE_NONCES_MAX = 65536
+)
+
+var (
+	ERR_UDP_ENVELOPE_UNKNOWN_APP = fmt.Errorf("UDP Envelope App was unknown or does not have UDP Keys")
+	ERR_UDP_ENVELOPE_KEY_ID      = fmt.Errorf("UDP Envelope Key ID was unknown")
+	ERR_UDP_ENVELOPE_SIGNATURE   = fmt.Errorf("UDP Envelope Signature was invalid")
+	ERR_UDP_ENVELOPE_STALE       = fmt.Errorf("UDP Envelope Timestamp was outside of our window")
+	ERR_UDP_ENVELOPE_NONCE       = fmt.Errorf("UDP Envelope Nonce was empty or longer than %d bytes", UDP_ENVELOPE_NONCE_MAX_LENGTH)
+	ERR_UDP_ENVELOPE_REPLAYED    = fmt.Errorf("UDP Envelope Nonce was replayed")
+	ERR_UDP_ENVELOPE_NONCES_FULL = fmt.Errorf("UDP Envelope Nonces were full")
+)
+
+// API_UDPEnvelope is a signed wrapper around an API_Request for our UDP API
+// Our Signature is the hex encoded HMAC-SHA256 of our KeyID, Timestamp, Nonce and Body
+// See UDPEnvelopeSignature()
+type API_UDPEnvelope struct {
+	KeyID string `json:"key-id,omitempty"`
+	// Timestamp is a unix timestamp in seconds
+	Timestamp int64 `json:"timestamp,omitempty"`
+	// Nonce must never be reused within our window
+	Nonce string `json:"nonce,omitempty"`
+	// Body is our JSON encoded API_Request
+	Body      json.RawMessage `json:"body,omitempty"`
+	Signature string          `json:"signature,omitempty"`
+}
+
+// NewUDPEnvelope will marshal and sign our request with a random nonce and our current time
+func NewUDPEnvelope(
+	key_id string,
+	key string,
+	request *API_Request,
+) (
+	*API_UDPEnvelope,
+	error,
+) {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	envelope := &API_UDPEnvelope{
+		KeyID:     key_id,
+		Timestamp: time.Now().Unix(),
+		Nonce:     hex.EncodeToString(nonce),
+		Body:      body,
+	}
+	envelope.Signature = UDPEnvelopeSignature(key, envelope.KeyID, envelope.Timestamp, envelope.Nonce, envelope.Body)
+	return envelope, nil
+}
+
+// UDPEnvelopeSignature will return the hex encoded HMAC-SHA256 of our envelope
+// Each value is separated by a newline so that values can't be shifted between fields
+func UDPEnvelopeSignature(
+	key string,
+	key_id string,
+	timestamp int64,
+	nonce string,
+	body []byte,
+) string {
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write([]byte(key_id))
+	mac.Write([]byte("\n"))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("\n"))
+	mac.Write([]byte(nonce))
+	mac.Write([]byte("\n"))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// openUDPEnvelope will verify our envelope and return our signed request
+func (self *Patrol) openUDPEnvelope(
+	envelope *API_UDPEnvelope,
+) (
+	*API_Request,
+	error,
+) {
+	request := &API_Request{}
+	if err := json.Unmarshal(envelope.Body, request); err != nil {
+		return nil, err
+	}
+	group := strings.ToLower(request.Group)
+	if group != "app" &&
+		group != "apps" {
+		return nil, ERR_UDP_ENVELOPE_UNKNOWN_APP
+	}
+	id := strings.ToLower(request.ID)
+	a, ok := self.apps[id]
+	if !ok ||
+		len(a.getUDPKeys()) == 0 {
+		return nil, ERR_UDP_ENVELOPE_UNKNOWN_APP
+	}
+	key, ok := a.getUDPKeys()[envelope.KeyID]
+	if !ok {
+		return nil, ERR_UDP_ENVELOPE_KEY_ID
+	}
+	signature := UDPEnvelopeSignature(key, envelope.KeyID, envelope.Timestamp, envelope.Nonce, envelope.Body)
+	if !hmac.Equal([]byte(signature), []byte(envelope.Signature)) {
+		return nil, ERR_UDP_ENVELOPE_SIGNATURE
+	}
+	// we're only going to check our timestamp and nonce once our signature is valid
+	// otherwise anyone would be able to fill our nonces
+	now := time.Now().Unix()
+	if envelope.Timestamp < now-UDP_ENVELOPE_WINDOW ||
+		envelope.Timestamp > now+UDP_ENVELOPE_WINDOW {
+		return nil, ERR_UDP_ENVELOPE_STALE
+	}
+	if envelope.Nonce == "" ||
+		len(envelope.Nonce) > UDP_ENVELOPE_NONCE_MAX_LENGTH {
+		return nil, ERR_UDP_ENVELOPE_NONCE
+	}
+	if err := self.useUDPNonce(id+"\n"+envelope.KeyID+"\n"+envelope.Nonce, now); err != nil {
+		return nil, err
+	}
+	request.signed = true
+	return request, nil
+}
+
+// useUDPNonce will remember our nonce until it can no longer be within our window
+func (self *Patrol) useUDPNonce(
+	nonce string,
+	now int64,
+) error {
+	self.udp_nonces_mu.Lock()
+	defer self.udp_nonces_mu.Unlock()
+	if self.udp_nonces == nil {
+		self.udp_nonces = make(map[string]int64)
+	}
+	if expires, ok := self.udp_nonces[nonce]; ok &&
+		expires >= now {
+		return ERR_UDP_ENVELOPE_REPLAYED
+	}
+	if len(self.udp_nonces) >= UDP_ENVELOPE_NONCES_MAX {
+		// remove expired nonces
+		for n, expires := range self.udp_nonces {
+			if expires < now {
+				delete(self.udp_nonces, n)
+			}
+		}
+		if len(self.udp_nonces) >= UDP_ENVELOPE_NONCES_MAX {
+			// we're not going to forget a nonce that's still within our window
+			return ERR_UDP_ENVELOPE_NONCES_FULL
+		}
+	}
+	// a timestamp can be at most UDP_ENVELOPE_WINDOW seconds in the future
+	// we have to remember our nonce for our entire window in both directions
+	self.udp_nonces[nonce] = now + UDP_ENVELOPE_WINDOW*2
+	return nil
+}
+
+// isUDPSignatureRequired will return true if our request is for an App that requires signed envelopes
+func (self *Patrol) isUDPSignatureRequired(
+	request *API_Request,
+) bool {
+	group := strings.ToLower(request.Group)
+	if group != "app" &&
+		group != "apps" {
+		return false
+	}
+	a, ok := self.apps[strings.ToLower(request.ID)]
+	return ok && len(a.getUDPKeys()) > 0
+}
@@ -0,0 +1,158 @@
+package patrol
+
+import (
+	"encoding/json"
+	"log"
+	"net"
+	"sabey.co/unittest"
+	"testing"
+	"time"
+)
+
+func TestPatrolUDPEnvelope(t *testing.T) {
+	log.Println("TestPatrolUDPEnvelope")
+
+	config := &Config{
+		Apps: map[string]*ConfigApp{
+			"udp": &ConfigApp{
+				KeepAlive:        APP_KEEPALIVE_UDP,
+				Name:             "udp",
+				Binary:           "testapp",
+				WorkingDirectory: "/testapp",
+				LogDirectory:     "logs",
+				Secret:           "secret",
+				UDPKeys: map[string]string{
+					"key-1": "key",
+				},
+			},
+			"unsigned": &ConfigApp{
+				KeepAlive:        APP_KEEPALIVE_UDP,
+				Name:             "unsigned",
+				Binary:           "testapp",
+				WorkingDirectory: "/testapp",
+				LogDirectory:     "logs",
+			},
+		},
+		ListenUDP: []string{"127.0.0.1:1248"},
+	}
+	// validate keys
+	config.Apps["udp"].UDPKeys[""] = "key"
+	unittest.Equals(t, config.Validate(), ERR_APP_UDPKEY_ID_INVALID)
+	delete(config.Apps["udp"].UDPKeys, "")
+	config.Apps["udp"].UDPKeys["key-2"] = ""
+	unittest.Equals(t, config.Validate(), ERR_APP_UDPKEY_INVALID)
+	delete(config.Apps["udp"].UDPKeys, "key-2")
+
+	patrol, err := CreatePatrol(config)
+	unittest.IsNil(t, err)
+	unittest.Equals(t, patrol.GetApp("udp").GetConfig().UDPKeys, map[string]string{"key-1": "key"})
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	unittest.IsNil(t, err)
+	defer conn.Close()
+	client, err := net.Dial("udp", conn.LocalAddr().String())
+	unittest.IsNil(t, err)
+	defer client.Close()
+
+	send := func(bs []byte) *API_Response {
+		_, err := client.Write(bs)
+		unittest.IsNil(t, err)
+		unittest.IsNil(t, patrol.HandleUDPConnection(conn))
+		client.SetReadDeadline(time.Now().Add(time.Millisecond * 100))
+		body := make([]byte, 2048)
+		n, err := client.Read(body)
+		if err != nil {
+			// we did not respond
+			return nil
+		}
+		response := patrol.NewAPIResponse()
+		unittest.IsNil(t, json.Unmarshal(body[:n], response))
+		return response
+	}
+	request := &API_Request{
+		ID:    "udp",
+		Group: "app",
+		Ping:  true,
+		PID:   1234,
+	}
+
+	// unsigned requests are ignored, even with our secret
+	request.Secret = "secret"
+	bs, _ := json.Marshal(request)
+	unittest.IsNil(t, send(bs))
+	unittest.Equals(t, patrol.GetApp("udp").GetPID(), uint32(0))
+	request.Secret = ""
+
+	// apps without keys are unaffected
+	bs, _ = json.Marshal(&API_Request{
+		ID:    "unsigned",
+		Group: "app",
+		Ping:  true,
+		PID:   4321,
+	})
+	unittest.NotNil(t, send(bs))
+	unittest.Equals(t, patrol.GetApp("unsigned").GetPID(), uint32(4321))
+
+	// signed
+	envelope, err := NewUDPEnvelope("key-1", "key", request)
+	unittest.IsNil(t, err)
+	bs, _ = json.Marshal(envelope)
+	response := send(bs)
+	unittest.NotNil(t, response)
+	unittest.Equals(t, response.ID, "udp")
+	unittest.Equals(t, response.CASInvalid, false)
+	unittest.Equals(t, patrol.GetApp("udp").GetPID(), uint32(1234))
+
+	// replayed
+	unittest.IsNil(t, send(bs))
+	_, err = patrol.openUDPEnvelope(envelope)
+	unittest.Equals(t, err, ERR_UDP_ENVELOPE_REPLAYED)
+
+	// unknown key id
+	envelope, _ = NewUDPEnvelope("key-2", "key", request)
+	_, err = patrol.openUDPEnvelope(envelope)
+	unittest.Equals(t, err, ERR_UDP_ENVELOPE_KEY_ID)
+
+	// invalid signature
+	envelope, _ = NewUDPEnvelope("key-1", "other", request)
+	_, err = patrol.openUDPEnvelope(envelope)
+	unittest.Equals(t, err, ERR_UDP_ENVELOPE_SIGNATURE)
+
+	// modified body
+	envelope, _ = NewUDPEnvelope("key-1", "key", request)
+	envelope.Body, _ = json.Marshal(&API_Request{
+		ID:     "udp",
+		Group:  "app",
+		Toggle: API_TOGGLE_STATE_DISABLE,
+	})
+	_, err = patrol.openUDPEnvelope(envelope)
+	unittest.Equals(t, err, ERR_UDP_ENVELOPE_SIGNATURE)
+
+	// stale
+	envelope, _ = NewUDPEnvelope("key-1", "key", request)
+	envelope.Timestamp -= UDP_ENVELOPE_WINDOW + 1
+	envelope.Signature = UDPEnvelopeSignature("key", envelope.KeyID, envelope.Timestamp, envelope.Nonce, envelope.Body)
+	_, err = patrol.openUDPEnvelope(envelope)
+	unittest.Equals(t, err, ERR_UDP_ENVELOPE_STALE)
+
+	// empty nonce
+	envelope, _ = NewUDPEnvelope("key-1", "key", request)
+	envelope.Nonce = ""
+	envelope.Signature = UDPEnvelopeSignature("key", envelope.KeyID, envelope.Timestamp, envelope.Nonce, envelope.Body)
+	_, err = patrol.openUDPEnvelope(envelope)
+	unittest.Equals(t, err, ERR_UDP_ENVELOPE_NONCE)
+
+	// unknown app
+	envelope, _ = NewUDPEnvelope("key-1", "key", &API_Request{
+		ID:    "unsigned",
+		Group: "app",
+	})
+	_, err = patrol.openUDPEnvelope(envelope)
+	unittest.Equals(t, err, ERR_UDP_ENVELOPE_UNKNOWN_APP)
+
+	// nonces expire once they're outside of our window
+	now := time.Now().Unix()
+	unittest.IsNil(t, patrol.useUDPNonce("nonce", now))
+	unittest.Equals(t, patrol.useUDPNonce("nonce", now+UDP_ENVELOPE_WINDOW*2), ERR_UDP_ENVELOPE_REPLAYED)
+	unittest.IsNil(t, patrol.useUDPNonce("nonce", now+UDP_ENVELOPE_WINDOW*2+1))
+}
@@ -0,0 +1,221 @@
+package patrol
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+const (
+	WEBHOOK_HEADER_EVENT     = `X-Patrol-Event`
+	WEBHOOK_HEADER_SIGNATURE = `X-Patrol-Signature`
+)
+
+// API_Webhook is the JSON body we POST to our Webhooks
+type API_Webhook struct {
+	// Event: see WEBHOOK_EVENT_*
+	Event string `json:"event,omitempty"`
+	// Unique Identifier
+	ID string `json:"id,omitempty"`
+	// Group: `app` or `service`
+	Group string `json:"group,omitempty"`
+	// Display Name
+	Name string `json:"name,omitempty"`
+	// Patrol Instance ID - UUIDv4
+	PatrolInstanceID string `json:"patrol-instance-id,omitempty"`
+	// Timestamp our Event occurred at
+	Timestamp *Timestamp `json:"timestamp,omitempty"`
+	// Unexpected is only set for closed events
+	// An App or Service closed without being Disabled, Restarted, consuming RunOnce or Patrol shutting down
+	Unexpected bool `json:"unexpected,omitempty"`
+	// History is only set for closed events, this is the exact History entry that was saved on close()
+	History *History `json:"history,omitempty"`
+	// Error is only set for start failed events
+	Error string `json:"error,omitempty"`
+}
+
+// this is what we append to our dead letter log
+type webhookDeadLetter struct {
+	Timestamp *Timestamp      `json:"timestamp,omitempty"`
+	URL       string          `json:"url,omitempty"`
+	Attempts  int             `json:"attempts,omitempty"`
+	Error     string          `json:"error,omitempty"`
+	Body      json.RawMessage `json:"body,omitempty"`
+}
+
+func WebhookSignature(
+	secret string,
+	body []byte,
+) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return fmt.Sprintf("sha256=%s", hex.EncodeToString(mac.Sum(nil)))
+}
+func (self *Patrol) webhook(
+	event string,
+	group string,
+	id string,
+	name string,
+	history *History,
+	err error,
+) {
+	// we're assumed to be in a lock of our App or Service
+	// we're going to marshal our body now, our webhooks will be sent from a goroutine
+	if len(self.config.Webhooks) == 0 {
+		return
+	}
+	payload := &API_Webhook{
+		Event:            event,
+		ID:               id,
+		Group:            group,
+		Name:             name,
+		PatrolInstanceID: self.instance_id,
+		Timestamp: &Timestamp{
+			Time:            self.now(),
+			TimestampFormat: self.config.Timestamp,
+		},
+		History: history,
+	}
+	if history != nil {
+		payload.Unexpected = history.IsUnexpected()
+	}
+	if err != nil {
+		payload.Error = err.Error()
+	}
+	var body []byte
+	for _, w := range self.config.Webhooks {
+		if !w.IsEvent(event) ||
+			!w.IsID(group, id) {
+			continue
+		}
+		if history != nil &&
+			w.UnexpectedOnly &&
+			!payload.Unexpected {
+			// we expected to close
+			continue
+		}
+		if body == nil {
+			body, _ = json.Marshal(payload)
+		}
+		self.webhooks_wg.Add(1)
+		go func(w *ConfigWebhook) {
+			defer self.webhooks_wg.Done()
+			self.sendWebhook(event, w, body)
+		}(w)
+	}
+}
+func (self *Patrol) sendWebhook(
+	event string,
+	w *ConfigWebhook,
+	body []byte,
+) {
+	client := &http.Client{
+		Timeout: time.Second * time.Duration(w.GetTimeout()),
+	}
+	backoff := time.Second * time.Duration(w.GetBackoff())
+	var err error
+	attempts := 0
+	for ; attempts <= w.Retries; attempts++ {
+		if attempts > 0 {
+			// backoff before we retry
+			if !self.webhookBackoff(backoff) {
+				log.Printf("./patrol.sendWebhook(): Event: %s URL: \"%s\" Patrol has shutdown, our remaining retries were abandoned\n", event, w.URL)
+				break
+			}
+			backoff = nextWebhookBackoff(backoff)
+		}
+		// our secret may be modified by Patrol.Reload() between our attempts
+		self.reload_mu.RLock()
+		secret := w.getSecret()
+		self.reload_mu.RUnlock()
+		if err = postWebhook(client, event, w, secret, body); err == nil {
+			// sent!
+			return
+		}
+		log.Printf("./patrol.sendWebhook(): Event: %s URL: \"%s\" Attempt: %d failed: \"%s\"\n", event, w.URL, attempts+1, err)
+	}
+	// we've exhausted our retries
+	if w.DeadLetter == "" {
+		return
+	}
+	bs, _ := json.Marshal(
+		&webhookDeadLetter{
+			Timestamp: &Timestamp{
+				Time:            self.now(),
+				TimestampFormat: self.config.Timestamp,
+			},
+			URL:      w.URL,
+			Attempts: attempts,
+			Error:    err.Error(),
+			Body:     body,
+		},
+	)
+	// multiple webhooks may share the same dead letter log
+	self.webhooks_mu.Lock()
+	defer self.webhooks_mu.Unlock()
+	f, err := OpenFile(w.DeadLetter)
+	if err != nil {
+		log.Printf("./patrol.sendWebhook(): failed to OpenFile Dead Letter: \"%s\" Err: \"%s\"\n", w.DeadLetter, err)
+		return
+	}
+	defer f.Close()
+	f.Write(append(bs, '\n'))
+}
+
+// webhookBackoff will wait for our backoff, false is returned if Shutdown() stopped waiting for our webhooks before our backoff passed
+func (self *Patrol) webhookBackoff(
+	backoff time.Duration,
+) bool {
+	timer := time.NewTimer(backoff)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-self.webhooks_done:
+		return false
+	}
+}
+
+// nextWebhookBackoff will double our backoff, our backoff is never more than WEBHOOK_BACKOFF_MAX seconds
+func nextWebhookBackoff(
+	backoff time.Duration,
+) time.Duration {
+	backoff *= 2
+	if backoff > time.Second*WEBHOOK_BACKOFF_MAX {
+		return time.Second * WEBHOOK_BACKOFF_MAX
+	}
+	return backoff
+}
+func postWebhook(
+	client *http.Client,
+	event string,
+	w *ConfigWebhook,
+	secret string,
+	body []byte,
+) error {
+	req, err := http.NewRequest("POST", w.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	req.Header.Set(WEBHOOK_HEADER_EVENT, event)
+	if secret != "" {
+		req.Header.Set(WEBHOOK_HEADER_SIGNATURE, WebhookSignature(secret, body))
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 ||
+		resp.StatusCode > 299 {
+		return fmt.Errorf("Unexpected Status Code: %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,394 @@
+package patrol
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sabey.co/unittest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestConfigWebhook(t *testing.T) {
+	log.Println("TestConfigWebhook")
+
+	webhook := &ConfigWebhook{}
+	unittest.Equals(t, webhook.Validate(), ERR_WEBHOOK_URL_EMPTY)
+
+	webhook.URL = "/relative"
+	unittest.Equals(t, webhook.Validate(), ERR_WEBHOOK_URL_INVALID)
+
+	webhook.URL = "ftp://127.0.0.1/"
+	unittest.Equals(t, webhook.Validate(), ERR_WEBHOOK_URL_INVALID)
+
+	webhook.URL = "http://127.0.0.1/hook"
+	unittest.Equals(t, webhook.Validate(), ERR_WEBHOOK_EVENTS_EMPTY)
+
+	webhook.Events = []string{"unknown"}
+	unittest.Equals(t, webhook.Validate(), ERR_WEBHOOK_EVENT_INVALID)
+
+	webhook.Events = []string{WEBHOOK_EVENT_APP_CLOSED, WEBHOOK_EVENT_APP_CLOSED}
+	unittest.Equals(t, webhook.Validate(), ERR_WEBHOOK_EVENT_DUPLICATE)
+
+	webhook.Events = []string{WEBHOOK_EVENT_APP_CLOSED, WEBHOOK_EVENT_SERVICE_START_FAILED}
+	unittest.IsNil(t, webhook.Validate())
+
+	webhook.Apps = []string{"-invalid"}
+	unittest.Equals(t, webhook.Validate(), ERR_WEBHOOK_APP_INVALID)
+
+	webhook.Apps = []string{"TestApp"}
+	webhook.Services = []string{"-invalid"}
+	unittest.Equals(t, webhook.Validate(), ERR_WEBHOOK_SERVICE_INVALID)
+
+	webhook.Services = nil
+	unittest.IsNil(t, webhook.Validate())
+	// IDs are lowercased
+	unittest.Equals(t, webhook.Apps, []string{"testapp"})
+	unittest.Equals(t, webhook.IsID("app", "testapp"), true)
+	unittest.Equals(t, webhook.IsID("app", "other"), false)
+	// we only filter apps, so services are not sent
+	unittest.Equals(t, webhook.IsID("service", "testapp"), false)
+
+	webhook.Retries = -1
+	unittest.Equals(t, webhook.Validate(), ERR_WEBHOOK_RETRIES_INVALID)
+	webhook.Retries = WEBHOOK_RETRIES_MAX + 1
+	unittest.Equals(t, webhook.Validate(), ERR_WEBHOOK_RETRIES_INVALID)
+	webhook.Retries = 2
+
+	webhook.Backoff = -1
+	unittest.Equals(t, webhook.Validate(), ERR_WEBHOOK_BACKOFF_INVALID)
+	webhook.Backoff = 0
+	unittest.Equals(t, webhook.GetBackoff(), WEBHOOK_BACKOFF_DEFAULT)
+
+	webhook.Timeout = WEBHOOK_TIMEOUT_MAX + 1
+	unittest.Equals(t, webhook.Validate(), ERR_WEBHOOK_TIMEOUT_INVALID)
+	webhook.Timeout = 0
+	unittest.Equals(t, webhook.GetTimeout(), WEBHOOK_TIMEOUT_DEFAULT)
+
+	webhook.DeadLetter = "./"
+	unittest.Equals(t, webhook.Validate(), ERR_WEBHOOK_DEADLETTER_UNCLEAN)
+	webhook.DeadLetter = "/tmp/dead-letter.log"
+	unittest.IsNil(t, webhook.Validate())
+
+	// clone
+	clone := webhook.Clone()
+	unittest.Equals(t, clone.URL, webhook.URL)
+	unittest.Equals(t, clone.Events, webhook.Events)
+	unittest.Equals(t, clone.Apps, webhook.Apps)
+	unittest.Equals(t, clone.Retries, webhook.Retries)
+	unittest.Equals(t, clone.DeadLetter, webhook.DeadLetter)
+	// dereference
+	clone.Events[0] = WEBHOOK_EVENT_APP_STARTED
+	unittest.Equals(t, webhook.Events[0], WEBHOOK_EVENT_APP_CLOSED)
+
+	// config
+	config := &Config{
+		Services: map[string]*ConfigService{
+			"ssh": &ConfigService{
+				Management: SERVICE_MANAGEMENT_SERVICE,
+				Name:       "SSH",
+				Service:    "ssh",
+			},
+		},
+		Webhooks: []*ConfigWebhook{
+			nil,
+		},
+	}
+	unittest.Equals(t, config.Validate(), ERR_WEBHOOK_NIL)
+	config.Webhooks[0] = &ConfigWebhook{}
+	unittest.Equals(t, config.Validate(), ERR_WEBHOOK_URL_EMPTY)
+	config.Webhooks[0] = webhook
+	unittest.IsNil(t, config.Validate())
+	unittest.Equals(t, len(config.Clone().Webhooks), 1)
+	unittest.Equals(t, config.Clone().Webhooks[0].URL, webhook.URL)
+}
+func TestPatrolWebhook(t *testing.T) {
+	log.Println("TestPatrolWebhook")
+
+	var mu sync.Mutex
+	attempts := 0
+	received := make(chan *http.Request, 10)
+	bodies := make(chan []byte, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		attempts++
+		a := attempts
+		mu.Unlock()
+		if a == 1 {
+			// fail our first attempt so that we retry
+			w.WriteHeader(500)
+			return
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		received <- r
+		bodies <- body
+		w.WriteHeader(200)
+	}))
+	defer server.Close()
+
+	config := &Config{
+		Apps: map[string]*ConfigApp{
+			"testapp": &ConfigApp{
+				KeepAlive:        APP_KEEPALIVE_PID_PATROL,
+				Name:             "testapp",
+				Binary:           "testapp",
+				WorkingDirectory: "/testapp",
+				LogDirectory:     "logs",
+				PIDPath:          "testapp.pid",
+			},
+			"ignored": &ConfigApp{
+				KeepAlive:        APP_KEEPALIVE_PID_PATROL,
+				Name:             "ignored",
+				Binary:           "testapp",
+				WorkingDirectory: "/testapp",
+				LogDirectory:     "logs",
+				PIDPath:          "testapp.pid",
+			},
+		},
+		Webhooks: []*ConfigWebhook{
+			&ConfigWebhook{
+				URL:            server.URL,
+				Events:         []string{WEBHOOK_EVENT_APP_CLOSED},
+				Apps:           []string{"testapp"},
+				UnexpectedOnly: true,
+				Secret:         "secret",
+				Retries:        1,
+			},
+		},
+	}
+	patrol, err := CreatePatrol(config)
+	unittest.IsNil(t, err)
+
+	// close ignored app, this is filtered
+	app := patrol.GetApp("ignored")
+	app.o.Lock()
+	app.o.SetStarted(time.Now())
+	app.close()
+	app.o.Unlock()
+
+	// close disabled app, this was expected so it is filtered
+	app = patrol.GetApp("testapp")
+	app.o.Lock()
+	app.o.SetStarted(time.Now())
+	app.toggle(API_TOGGLE_STATE_DISABLE)
+	app.close()
+	app.toggle(API_TOGGLE_STATE_ENABLE)
+	app.o.Unlock()
+
+	// close unexpectedly
+	app.o.Lock()
+	app.o.SetStarted(time.Now())
+	app.o.SetExitCode(3)
+	app.close()
+	app.o.Unlock()
+
+	patrol.webhooks_wg.Wait()
+	unittest.Equals(t, len(received), 1)
+	mu.Lock()
+	unittest.Equals(t, attempts, 2)
+	mu.Unlock()
+
+	r := <-received
+	body := <-bodies
+	unittest.Equals(t, r.Method, "POST")
+	unittest.Equals(t, r.Header.Get(WEBHOOK_HEADER_EVENT), WEBHOOK_EVENT_APP_CLOSED)
+	unittest.Equals(t, r.Header.Get(WEBHOOK_HEADER_SIGNATURE), WebhookSignature("secret", body))
+
+	result := &API_Webhook{
+		Timestamp: &Timestamp{},
+		History:   patrol.NewAPIHistory(),
+	}
+	unittest.IsNil(t, json.Unmarshal(body, result))
+	unittest.Equals(t, result.Event, WEBHOOK_EVENT_APP_CLOSED)
+	unittest.Equals(t, result.ID, "testapp")
+	unittest.Equals(t, result.Group, "app")
+	unittest.Equals(t, result.PatrolInstanceID, patrol.GetInstanceID())
+	unittest.Equals(t, result.Unexpected, true)
+	unittest.Equals(t, result.History.ExitCode, uint8(3))
+	unittest.Equals(t, result.History.Disabled, false)
+}
+func TestPatrolWebhookDeadLetter(t *testing.T) {
+	log.Println("TestPatrolWebhookDeadLetter")
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(503)
+	}))
+	defer server.Close()
+
+	dead_letter := fmt.Sprintf("%s/patrol-dead-letter-%d.log", os.TempDir(), time.Now().UnixNano())
+	defer os.Remove(dead_letter)
+
+	config := &Config{
+		Services: map[string]*ConfigService{
+			"ssh": &ConfigService{
+				Management: SERVICE_MANAGEMENT_SERVICE,
+				Name:       "SSH",
+				Service:    "ssh",
+			},
+		},
+		Webhooks: []*ConfigWebhook{
+			&ConfigWebhook{
+				URL:        server.URL,
+				Events:     []string{WEBHOOK_EVENT_SERVICE_START_FAILED},
+				DeadLetter: dead_letter,
+			},
+		},
+	}
+	patrol, err := CreatePatrol(config)
+	unittest.IsNil(t, err)
+
+	patrol.webhook(WEBHOOK_EVENT_SERVICE_START_FAILED, "service", "ssh", "SSH", nil, fmt.Errorf("exit status 1"))
+	patrol.webhooks_wg.Wait()
+
+	bs, err := ioutil.ReadFile(dead_letter)
+	unittest.IsNil(t, err)
+	result := &webhookDeadLetter{
+		Timestamp: &Timestamp{},
+	}
+	unittest.IsNil(t, json.Unmarshal(bs, result))
+	unittest.Equals(t, result.URL, server.URL)
+	unittest.Equals(t, result.Attempts, 1)
+	unittest.Equals(t, result.Error, "Unexpected Status Code: 503")
+
+	payload := &API_Webhook{
+		Timestamp: &Timestamp{},
+	}
+	unittest.IsNil(t, json.Unmarshal(result.Body, payload))
+	unittest.Equals(t, payload.Event, WEBHOOK_EVENT_SERVICE_START_FAILED)
+	unittest.Equals(t, payload.ID, "ssh")
+	unittest.Equals(t, payload.Group, "service")
+	unittest.Equals(t, payload.Error, "exit status 1")
+	unittest.IsNil(t, payload.History)
+}
+func TestPatrolWebhookShutdown(t *testing.T) {
+	log.Println("TestPatrolWebhookShutdown")
+
+	var mu sync.Mutex
+	received := 0
+	block := make(chan struct{})
+	blocking := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		b := blocking
+		mu.Unlock()
+		if b {
+			<-block
+			return
+		}
+		<-time.After(time.Millisecond * 200)
+		mu.Lock()
+		received++
+		mu.Unlock()
+	}))
+	defer server.Close()
+	defer close(block)
+
+	config := func() *Config {
+		return &Config{
+			Services: map[string]*ConfigService{
+				"ssh": &ConfigService{
+					Management: SERVICE_MANAGEMENT_SERVICE,
+					Name:       "SSH",
+					Service:    "ssh",
+				},
+			},
+			Webhooks: []*ConfigWebhook{
+				&ConfigWebhook{
+					URL:    server.URL,
+					Events: []string{WEBHOOK_EVENT_SERVICE_START_FAILED},
+				},
+			},
+		}
+	}
+	// our webhook is sent before Shutdown returns
+	patrol, err := CreatePatrol(config())
+	unittest.IsNil(t, err)
+	patrol.webhook(WEBHOOK_EVENT_SERVICE_START_FAILED, "service", "ssh", "SSH", nil, fmt.Errorf("exit status 1"))
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	patrol.Shutdown(ctx)
+	mu.Lock()
+	unittest.Equals(t, received, 1)
+	mu.Unlock()
+
+	// a webhook that is never sent only delays Shutdown until our context is done
+	mu.Lock()
+	blocking = true
+	mu.Unlock()
+	patrol, err = CreatePatrol(config())
+	unittest.IsNil(t, err)
+	patrol.webhook(WEBHOOK_EVENT_SERVICE_START_FAILED, "service", "ssh", "SSH", nil, fmt.Errorf("exit status 1"))
+	ctx, cancel = context.WithTimeout(context.Background(), time.Millisecond*100)
+	defer cancel()
+	start := time.Now()
+	patrol.Shutdown(ctx)
+	unittest.Equals(t, time.Since(start) < time.Second*2, true)
+}
+func TestPatrolWebhookBackoff(t *testing.T) {
+	log.Println("TestPatrolWebhookBackoff")
+
+	// our backoff doubles, but never more than WEBHOOK_BACKOFF_MAX
+	unittest.Equals(t, nextWebhookBackoff(time.Second), time.Second*2)
+	unittest.Equals(t, nextWebhookBackoff(time.Second*200), time.Second*WEBHOOK_BACKOFF_MAX)
+	unittest.Equals(t, nextWebhookBackoff(time.Second*WEBHOOK_BACKOFF_MAX), time.Second*WEBHOOK_BACKOFF_MAX)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(503)
+	}))
+	defer server.Close()
+
+	dead_letter := fmt.Sprintf("%s/patrol-dead-letter-%d.log", os.TempDir(), time.Now().UnixNano())
+	defer os.Remove(dead_letter)
+
+	config := &Config{
+		Services: map[string]*ConfigService{
+			"ssh": &ConfigService{
+				Management: SERVICE_MANAGEMENT_SERVICE,
+				Name:       "SSH",
+				Service:    "ssh",
+			},
+		},
+		Webhooks: []*ConfigWebhook{
+			&ConfigWebhook{
+				URL:        server.URL,
+				Events:     []string{WEBHOOK_EVENT_SERVICE_START_FAILED},
+				Retries:    WEBHOOK_RETRIES_MAX,
+				Backoff:    WEBHOOK_BACKOFF_MAX,
+				DeadLetter: dead_letter,
+			},
+		},
+	}
+	patrol, err := CreatePatrol(config)
+	unittest.IsNil(t, err)
+
+	// our retries are abandoned once Shutdown stops waiting for our webhooks
+	patrol.webhook(WEBHOOK_EVENT_SERVICE_START_FAILED, "service", "ssh", "SSH", nil, fmt.Errorf("exit status 1"))
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*100)
+	defer cancel()
+	patrol.Shutdown(ctx)
+	sent := make(chan struct{})
+	go func() {
+		patrol.webhooks_wg.Wait()
+		close(sent)
+	}()
+	select {
+	case <-sent:
+	case <-time.After(time.Second * 5):
+		t.Fatal("our webhook retries were not abandoned")
+	}
+
+	bs, err := ioutil.ReadFile(dead_letter)
+	unittest.IsNil(t, err)
+	result := &webhookDeadLetter{
+		Timestamp: &Timestamp{},
+	}
+	unittest.IsNil(t, json.Unmarshal(bs, result))
+	unittest.Equals(t, result.Attempts, 1)
+	unittest.Equals(t, result.Error, "Unexpected Status Code: 503")
+}
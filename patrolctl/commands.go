@@ -0,0 +1,303 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"sabey.co/patrol"
+	"sort"
+	"time"
+)
+
+const (
+	// LOGS_FOLLOW_EVERY is how often `logs -follow` will check our log for new output
+	LOGS_FOLLOW_EVERY = time.Second
+)
+
+func (self *ctl) status(
+	args []string,
+) error {
+	status, err := self.getStatus()
+	if err != nil {
+		return err
+	}
+	if len(args) > 0 {
+		// filter our IDs
+		ids := make(map[string]bool)
+		for _, id := range args {
+			ids[id] = true
+		}
+		for id := range status.Apps {
+			if !ids[id] {
+				delete(status.Apps, id)
+			}
+		}
+		for id := range status.Services {
+			if !ids[id] {
+				delete(status.Services, id)
+			}
+		}
+	}
+	if *json_output {
+		return printJSON(status)
+	}
+	t := newTable("GROUP", "ID", "NAME", "STATE", "PID", "STARTED", "LASTSEEN")
+	for _, id := range sortedIDs(status.Apps) {
+		t.responseRow("app", id, status.Apps[id])
+	}
+	for _, id := range sortedIDs(status.Services) {
+		t.responseRow("service", id, status.Services[id])
+	}
+	return t.flush()
+}
+func (self *ctl) toggle(
+	args []string,
+	toggle uint8,
+) error {
+	if len(args) != 1 {
+		return ERR_USAGE
+	}
+	response, err := self.api(&patrol.API_Request{
+		ID:     args[0],
+		Toggle: toggle,
+	})
+	if err != nil {
+		return err
+	}
+	if response.CASInvalid {
+		// our request was not authorized to modify anything
+		return ERR_UNAUTHORIZED
+	}
+	// our response is a snapshot of our state before our toggle
+	// we will request our current state
+	if response, err = self.api(&patrol.API_Request{
+		ID: args[0],
+	}); err != nil {
+		return err
+	}
+	if *json_output {
+		return printJSON(response)
+	}
+	t := newTable("GROUP", "ID", "NAME", "STATE", "PID", "STARTED", "LASTSEEN")
+	t.responseRow(*group, args[0], response)
+	return t.flush()
+}
+func (self *ctl) history(
+	args []string,
+) error {
+	if len(args) != 1 {
+		return ERR_USAGE
+	}
+	response, err := self.api(&patrol.API_Request{
+		ID:      args[0],
+		History: true,
+	})
+	if err != nil {
+		return err
+	}
+	if *json_output {
+		return printJSON(response.History)
+	}
+	t := newTable("INSTANCE", "PID", "STARTED", "STOPPED", "EXIT", "MAXRSS", "CPU", "STATE")
+	// our newest instance is printed first
+	for i := len(response.History) - 1; i >= 0; i-- {
+		h := response.History[i]
+		t.row(
+			h.InstanceID,
+			formatPID(h.PID),
+			formatTimestamp(h.Started),
+			formatTimestamp(h.Stopped),
+			h.Exit(),
+			formatRSS(h.MaxRSS),
+			formatCPU(h.UserTime, h.SystemTime),
+			formatState(h.Disabled, h.Restart, h.RunOnce, h.Shutdown, h.InstanceID != ""),
+		)
+	}
+	return t.flush()
+}
+
+// export will print our History oldest first, our History is streamed and never formatted as a table
+// if our ID and -group are not set we will export every App and Service
+func (self *ctl) export(
+	args []string,
+) error {
+	if len(args) > 1 {
+		return ERR_USAGE
+	}
+	query := url.Values{}
+	query.Set("format", *format)
+	if *timestamp != "" {
+		query.Set("timestamp", *timestamp)
+	}
+	if *since != "" {
+		query.Set("since", *since)
+	}
+	if *until != "" {
+		query.Set("until", *until)
+	}
+	if *unexpected {
+		query.Set("unexpected", "true")
+	}
+	group_set := false
+	flags.Visit(func(f *flag.Flag) {
+		if f.Name == "group" {
+			group_set = true
+		}
+	})
+	if len(args) == 1 ||
+		group_set {
+		query.Set("group", *group)
+	}
+	if len(args) == 1 {
+		query.Set("id", args[0])
+		if self.secret != "" {
+			query.Set("secret", self.secret)
+		}
+	}
+	return self.getExport(query, os.Stdout)
+}
+func (self *ctl) keyvalue(
+	args []string,
+) error {
+	if len(args) < 2 {
+		return ERR_USAGE
+	}
+	switch args[0] {
+	case "get":
+		if len(args) > 3 {
+			return ERR_USAGE
+		}
+		response, err := self.api(&patrol.API_Request{
+			ID: args[1],
+		})
+		if err != nil {
+			return err
+		}
+		if len(args) == 3 {
+			v, ok := response.KeyValue[args[2]]
+			if !ok {
+				return fmt.Errorf("Key \"%s\" does not exist", args[2])
+			}
+			// a single value is always printed as JSON
+			return printJSON(v)
+		}
+		if *json_output {
+			return printJSON(response.KeyValue)
+		}
+		t := newTable("KEY", "VALUE")
+		keys := make([]string, 0, len(response.KeyValue))
+		for k := range response.KeyValue {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			bs, _ := json.Marshal(response.KeyValue[k])
+			t.row(k, string(bs))
+		}
+		return t.flush()
+	case "set":
+		if len(args) != 4 {
+			return ERR_USAGE
+		}
+		// our value is parsed as JSON, otherwise our value is a string
+		var value interface{}
+		if err := json.Unmarshal([]byte(args[3]), &value); err != nil {
+			value = args[3]
+		}
+		response, err := self.api(&patrol.API_Request{
+			ID: args[1],
+			KeyValue: map[string]interface{}{
+				args[2]: value,
+			},
+			CAS: *cas,
+		})
+		if err != nil {
+			return err
+		}
+		if response.CASInvalid {
+			if *cas == 0 {
+				// our request was not authorized to modify anything
+				return ERR_UNAUTHORIZED
+			}
+			return fmt.Errorf("CAS was invalid, current CAS: %d", response.CAS)
+		}
+		if *json_output {
+			return printJSON(response)
+		}
+		return nil
+	}
+	return ERR_USAGE
+}
+
+// reload will reload our Patrol config, nothing is printed unless -json is set
+func (self *ctl) reload(
+	args []string,
+) error {
+	if len(args) != 0 {
+		return ERR_USAGE
+	}
+	response, err := self.postReload()
+	if err != nil {
+		return err
+	}
+	if *json_output {
+		return printJSON(response)
+	}
+	return nil
+}
+func (self *ctl) logs(
+	args []string,
+) error {
+	if len(args) != 1 {
+		return ERR_USAGE
+	}
+	offset, err := self.getLog(args[0], 0, os.Stdout)
+	if err != nil ||
+		!*follow {
+		return err
+	}
+	for {
+		time.Sleep(LOGS_FOLLOW_EVERY)
+		if offset, err = self.getLog(args[0], offset, os.Stdout); err != nil {
+			return err
+		}
+	}
+}
+
+// validate will load and validate our config without connecting to Patrol
+// every invalid field is printed
+func validate(
+	args []string,
+) error {
+	if len(args) != 1 &&
+		len(args) != 2 {
+		return ERR_USAGE
+	}
+	// our optional config directory is merged the same as `patrol -config-dir`
+	config, err := patrol.LoadConfig(args[0], args[1:]...)
+	if err != nil {
+		return err
+	}
+	errs := config.ValidateAll()
+	if *json_output {
+		if err := printJSON(map[string]interface{}{
+			"valid":  len(errs) == 0,
+			"errors": errs,
+		}); err != nil {
+			return err
+		}
+	} else {
+		for _, e := range errs {
+			fmt.Println(e)
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("\"%s\" is invalid: %d errors", args[0], len(errs))
+	}
+	if !*json_output {
+		fmt.Printf("\"%s\" is valid\n", args[0])
+	}
+	return nil
+}
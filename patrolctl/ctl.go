@@ -0,0 +1,367 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sabey.co/patrol"
+	"sabey.co/patrol/client"
+	"strings"
+)
+
+var (
+	ERR_USAGE         = fmt.Errorf("invalid usage")
+	ERR_GROUP_INVALID = fmt.Errorf("Group must be `app` or `service`")
+	ERR_CA_INVALID    = fmt.Errorf("CA File did not contain a PEM encoded certificate")
+	ERR_UNAUTHORIZED  = fmt.Errorf("Unauthorized, set $PATROL_SECRET, $PATROL_TOKEN, -secret-file or -token-file")
+)
+
+type ctl struct {
+	// scheme is either http or https
+	scheme string
+	// host is ignored by our unix dialer
+	host   string
+	client *http.Client
+	secret string
+	token  string
+}
+
+func newCtl() (
+	*ctl,
+	error,
+) {
+	if *group != "app" &&
+		*group != "service" {
+		return nil, ERR_GROUP_INVALID
+	}
+	c := &ctl{
+		scheme: "http",
+		host:   *addr,
+		secret: os.Getenv(client.ENV_SECRET),
+		token:  os.Getenv(client.ENV_TOKEN),
+	}
+	if c.host == "" {
+		c.host = os.Getenv(ENV_ADDR)
+	}
+	if c.host == "" {
+		c.host = fmt.Sprintf("127.0.0.1:%d", patrol.LISTEN_HTTP_PORT_DEFAULT)
+	}
+	var err error
+	if *secret_file != "" {
+		if c.secret, err = readSecret(*secret_file); err != nil {
+			return nil, err
+		}
+	}
+	if *token_file != "" {
+		if c.token, err = readSecret(*token_file); err != nil {
+			return nil, err
+		}
+	}
+	transport := &http.Transport{}
+	if strings.HasPrefix(c.host, "https://") {
+		c.scheme = "https"
+		c.host = strings.TrimPrefix(c.host, "https://")
+		if transport.TLSClientConfig, err = tlsConfig(); err != nil {
+			return nil, err
+		}
+	} else {
+		c.host = strings.TrimPrefix(c.host, "http://")
+	}
+	if network, address := patrol.ParseListen(c.host, "tcp"); network == "unix" {
+		transport.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", address)
+		}
+		c.host = "unix"
+	}
+	c.client = &http.Client{
+		Transport: transport,
+	}
+	return c, nil
+}
+
+// readSecret will read our secret from a file, surrounding whitespace is removed so that a trailing newline is never sent
+func readSecret(
+	path string,
+) (
+	string,
+	error,
+) {
+	bs, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(bs)), nil
+}
+func tlsConfig() (
+	*tls.Config,
+	error,
+) {
+	config := &tls.Config{}
+	if *ca_file != "" {
+		bs, err := ioutil.ReadFile(*ca_file)
+		if err != nil {
+			return nil, err
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(bs) {
+			return nil, ERR_CA_INVALID
+		}
+	}
+	if *cert_file != "" ||
+		*key_file != "" {
+		cert, err := tls.LoadX509KeyPair(*cert_file, *key_file)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
+func (self *ctl) url(
+	path string,
+	query url.Values,
+) string {
+	u := &url.URL{
+		Scheme: self.scheme,
+		Host:   self.host,
+		Path:   path,
+	}
+	if query != nil {
+		u.RawQuery = query.Encode()
+	}
+	return u.String()
+}
+
+// do will send our request with our token and our timeout
+// our caller must close our response body and call our cancel function
+func (self *ctl) do(
+	req *http.Request,
+	with_timeout bool,
+) (
+	*http.Response,
+	context.CancelFunc,
+	error,
+) {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	if with_timeout {
+		ctx, cancel = context.WithTimeout(context.Background(), *timeout)
+	} else {
+		ctx, cancel = context.WithCancel(context.Background())
+	}
+	if self.token != "" {
+		req.Header.Set("Authorization", "Bearer "+self.token)
+	}
+	resp, err := self.client.Do(req.WithContext(ctx))
+	if err != nil {
+		cancel()
+		return nil, nil, err
+	}
+	return resp, cancel, nil
+}
+func (self *ctl) getStatus() (
+	*patrol.API_Status,
+	error,
+) {
+	req, err := http.NewRequest("GET", self.url("/status/", nil), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, cancel, err := self.do(req, true)
+	if err != nil {
+		return nil, err
+	}
+	defer cancel()
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("Patrol responded with Status Code: %d", resp.StatusCode)
+	}
+	status := &patrol.API_Status{}
+	if err := json.NewDecoder(resp.Body).Decode(status); err != nil {
+		return nil, err
+	}
+	return status, nil
+}
+
+// api will POST our request to our API, our Group, Secret and Token are set from our flags
+func (self *ctl) api(
+	request *patrol.API_Request,
+) (
+	*patrol.API_Response,
+	error,
+) {
+	request.Group = *group
+	request.Secret = self.secret
+	request.Token = self.token
+	body, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest("POST", self.url("/api/", nil), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, cancel, err := self.do(req, true)
+	if err != nil {
+		return nil, err
+	}
+	defer cancel()
+	defer resp.Body.Close()
+	response := &patrol.API_Response{}
+	if err := json.NewDecoder(resp.Body).Decode(response); err != nil {
+		return nil, fmt.Errorf("Patrol responded with Status Code: %d: %s", resp.StatusCode, err)
+	}
+	if len(response.Errors) > 0 {
+		return nil, fmt.Errorf("Patrol responded with Errors: \"%s\"", strings.Join(response.Errors, "\", \""))
+	}
+	return response, nil
+}
+
+// postReload will ask our Patrol to reload its config, see Patrol.Reload()
+func (self *ctl) postReload() (
+	*patrol.API_Response,
+	error,
+) {
+	req, err := http.NewRequest("POST", self.url("/api/reload", nil), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, cancel, err := self.do(req, true)
+	if err != nil {
+		return nil, err
+	}
+	defer cancel()
+	defer resp.Body.Close()
+	response := &patrol.API_Response{}
+	if err := json.NewDecoder(resp.Body).Decode(response); err != nil {
+		return nil, fmt.Errorf("Patrol responded with Status Code: %d: %s", resp.StatusCode, err)
+	}
+	if len(response.Errors) > 0 {
+		return nil, fmt.Errorf("Patrol responded with Errors: \"%s\"", strings.Join(response.Errors, "\", \""))
+	}
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("Patrol responded with Status Code: %d", resp.StatusCode)
+	}
+	return response, nil
+}
+
+// getExport will stream our History export to w
+// our export may take longer than our timeout
+func (self *ctl) getExport(
+	query url.Values,
+	w io.Writer,
+) error {
+	req, err := http.NewRequest("GET", self.url("/api/history/export", query), nil)
+	if err != nil {
+		return err
+	}
+	resp, cancel, err := self.do(req, false)
+	if err != nil {
+		return err
+	}
+	defer cancel()
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		response := &patrol.API_HistoryResponse{}
+		if err := json.NewDecoder(resp.Body).Decode(response); err != nil ||
+			len(response.Errors) == 0 {
+			return fmt.Errorf("Patrol responded with Status Code: %d", resp.StatusCode)
+		}
+		return fmt.Errorf("Patrol responded with Errors: \"%s\"", strings.Join(response.Errors, "\", \""))
+	}
+	_, err = io.Copy(w, resp.Body)
+	return err
+}
+
+// getLog will request our log starting at offset
+// our log is served by http.ServeFile, so we can request a byte range
+func (self *ctl) getLog(
+	id string,
+	offset int64,
+	w io.Writer,
+) (
+	int64,
+	error,
+) {
+	path := "/stdout/"
+	if *stderr {
+		path = "/stderr/"
+	}
+	query := url.Values{}
+	query.Set("group", "app")
+	query.Set("id", id)
+	if self.secret != "" {
+		query.Set("secret", self.secret)
+	}
+	req, err := http.NewRequest("GET", self.url(path, query), nil)
+	if err != nil {
+		return 0, err
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+	// a large log may take longer than our timeout
+	resp, cancel, err := self.do(req, !*follow)
+	if err != nil {
+		return 0, err
+	}
+	defer cancel()
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+		if offset > 0 &&
+			resp.ContentLength >= offset {
+			// our range was ignored, we're going to skip what we've already printed
+			if _, err := io.CopyN(ioutil.Discard, resp.Body, offset); err != nil {
+				return 0, err
+			}
+		} else {
+			// our log was truncated, we will start over
+			offset = 0
+		}
+		n, err := io.Copy(w, resp.Body)
+		return offset + n, err
+	case http.StatusPartialContent:
+		n, err := io.Copy(w, resp.Body)
+		return offset + n, err
+	case http.StatusRequestedRangeNotSatisfiable:
+		// nothing new was written
+		// if our log was truncated our offset is now beyond our log, we will start over
+		if size, ok := contentRangeSize(resp.Header.Get("Content-Range")); ok &&
+			size < offset {
+			return 0, nil
+		}
+		return offset, nil
+	}
+	bs, _ := ioutil.ReadAll(resp.Body)
+	return offset, fmt.Errorf("Patrol responded with Status Code: %d: %s", resp.StatusCode, strings.TrimSpace(string(bs)))
+}
+
+// contentRangeSize will parse our size from `bytes */SIZE`
+func contentRangeSize(
+	content_range string,
+) (
+	int64,
+	bool,
+) {
+	i := strings.LastIndex(content_range, "/")
+	if i < 0 {
+		return 0, false
+	}
+	var size int64
+	if _, err := fmt.Sscanf(content_range[i+1:], "%d", &size); err != nil {
+		return 0, false
+	}
+	return size, true
+}
@@ -0,0 +1,278 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sabey.co/patrol"
+	"sabey.co/unittest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testCtl will create our ctl for our test server
+func testCtl(
+	t *testing.T,
+	server *httptest.Server,
+) *ctl {
+	*addr = server.URL
+	defer func() {
+		*addr = ""
+	}()
+	c, err := newCtl()
+	unittest.IsNil(t, err)
+	return c
+}
+func TestContentRangeSize(t *testing.T) {
+	log.Println("TestContentRangeSize")
+
+	size, ok := contentRangeSize("bytes */1024")
+	unittest.Equals(t, ok, true)
+	unittest.Equals(t, size, int64(1024))
+	size, ok = contentRangeSize("bytes 0-9/10")
+	unittest.Equals(t, ok, true)
+	unittest.Equals(t, size, int64(10))
+	_, ok = contentRangeSize("")
+	unittest.Equals(t, ok, false)
+	_, ok = contentRangeSize("bytes 0-9")
+	unittest.Equals(t, ok, false)
+	_, ok = contentRangeSize("bytes */*")
+	unittest.Equals(t, ok, false)
+}
+func TestNewCtl(t *testing.T) {
+	log.Println("TestNewCtl")
+
+	defer func() {
+		*addr = ""
+		*group = "app"
+	}()
+	os.Setenv(ENV_ADDR, "")
+	// our default
+	c, err := newCtl()
+	unittest.IsNil(t, err)
+	unittest.Equals(t, c.scheme, "http")
+	unittest.Equals(t, c.host, fmt.Sprintf("127.0.0.1:%d", patrol.LISTEN_HTTP_PORT_DEFAULT))
+	unittest.Equals(t, c.url("/status/", nil), fmt.Sprintf("http://127.0.0.1:%d/status/", patrol.LISTEN_HTTP_PORT_DEFAULT))
+
+	// our environment is only used without -addr
+	os.Setenv(ENV_ADDR, "http://10.0.0.1:1234")
+	defer os.Unsetenv(ENV_ADDR)
+	c, err = newCtl()
+	unittest.IsNil(t, err)
+	unittest.Equals(t, c.host, "10.0.0.1:1234")
+	*addr = "127.0.0.1:4321"
+	c, err = newCtl()
+	unittest.IsNil(t, err)
+	unittest.Equals(t, c.host, "127.0.0.1:4321")
+
+	// https
+	*addr = "https://patrol.local:8421"
+	c, err = newCtl()
+	unittest.IsNil(t, err)
+	unittest.Equals(t, c.scheme, "https")
+	unittest.Equals(t, c.host, "patrol.local:8421")
+	unittest.NotNil(t, c.client.Transport.(*http.Transport).TLSClientConfig)
+
+	// unix
+	*addr = "unix:/var/run/patrol.sock"
+	c, err = newCtl()
+	unittest.IsNil(t, err)
+	unittest.Equals(t, c.scheme, "http")
+	unittest.Equals(t, c.host, "unix")
+	unittest.NotNil(t, c.client.Transport.(*http.Transport).DialContext)
+
+	// our group must be valid
+	*group = "apps"
+	_, err = newCtl()
+	unittest.Equals(t, err, ERR_GROUP_INVALID)
+}
+func TestCtlUnix(t *testing.T) {
+	log.Println("TestCtlUnix")
+
+	dir, err := ioutil.TempDir("", "patrolctl")
+	unittest.IsNil(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "patrol.sock")
+	l, err := net.Listen("unix", path)
+	unittest.IsNil(t, err)
+	server := &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			unittest.Equals(t, r.URL.Path, "/status/")
+			w.Write([]byte(`{"apps":{"testapp":{"name":"testapp"}}}`))
+		}),
+	}
+	go server.Serve(l)
+	defer server.Close()
+
+	*addr = "unix:" + path
+	defer func() {
+		*addr = ""
+	}()
+	c, err := newCtl()
+	unittest.IsNil(t, err)
+	status, err := c.getStatus()
+	unittest.IsNil(t, err)
+	unittest.Equals(t, status.Apps["testapp"].Name, "testapp")
+}
+func TestCtlAPI(t *testing.T) {
+	log.Println("TestCtlAPI")
+
+	var status int
+	var body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		unittest.Equals(t, r.Method, "POST")
+		unittest.Equals(t, r.URL.Path, "/api/")
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	}))
+	defer server.Close()
+	c := testCtl(t, server)
+
+	status = 200
+	body = `{"id":"testapp","name":"Test App","cas":2}`
+	response, err := c.api(&patrol.API_Request{
+		ID: "testapp",
+	})
+	unittest.IsNil(t, err)
+	unittest.Equals(t, response.Name, "Test App")
+	unittest.Equals(t, response.CAS, uint64(2))
+
+	// our errors are returned
+	status = 400
+	body = `{"errors":["Unknown App","Secret Invalid"]}`
+	_, err = c.api(&patrol.API_Request{
+		ID: "unknown",
+	})
+	unittest.NotNil(t, err)
+	unittest.Equals(t, err.Error(), `Patrol responded with Errors: "Unknown App", "Secret Invalid"`)
+
+	// a response that isn't JSON returns our status code
+	status = 502
+	body = "Bad Gateway"
+	_, err = c.api(&patrol.API_Request{
+		ID: "testapp",
+	})
+	unittest.NotNil(t, err)
+	unittest.Equals(t, strings.HasPrefix(err.Error(), "Patrol responded with Status Code: 502: "), true)
+}
+func TestCtlGetLog(t *testing.T) {
+	log.Println("TestCtlGetLog")
+
+	// our log is modified between our requests
+	var mu sync.Mutex
+	log_body := []byte("0123456789")
+	ignore_range := false
+	unauthorized := false
+	set := func(body string, ignore bool) {
+		mu.Lock()
+		defer mu.Unlock()
+		log_body = []byte(body)
+		ignore_range = ignore
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		unittest.Equals(t, r.URL.Path, "/stdout/")
+		unittest.Equals(t, r.URL.Query().Get("id"), "testapp")
+		if unauthorized {
+			http.Error(w, "Unauthorized", 401)
+			return
+		}
+		if ignore_range {
+			w.Header().Set("Content-Length", fmt.Sprintf("%d", len(log_body)))
+			w.Write(log_body)
+			return
+		}
+		http.ServeContent(w, r, "testapp.log", time.Time{}, bytes.NewReader(log_body))
+	}))
+	defer server.Close()
+	c := testCtl(t, server)
+
+	// 200: our whole log
+	b := &bytes.Buffer{}
+	offset, err := c.getLog("testapp", 0, b)
+	unittest.IsNil(t, err)
+	unittest.Equals(t, offset, int64(10))
+	unittest.Equals(t, b.String(), "0123456789")
+
+	// 206: only what was written since our offset
+	set("0123456789abc", false)
+	b.Reset()
+	offset, err = c.getLog("testapp", offset, b)
+	unittest.IsNil(t, err)
+	unittest.Equals(t, offset, int64(13))
+	unittest.Equals(t, b.String(), "abc")
+
+	// 416: nothing new was written
+	b.Reset()
+	offset, err = c.getLog("testapp", offset, b)
+	unittest.IsNil(t, err)
+	unittest.Equals(t, offset, int64(13))
+	unittest.Equals(t, b.Len(), 0)
+
+	// 416: our log was truncated, we will start over
+	set("new", false)
+	offset, err = c.getLog("testapp", offset, b)
+	unittest.IsNil(t, err)
+	unittest.Equals(t, offset, int64(0))
+	offset, err = c.getLog("testapp", offset, b)
+	unittest.IsNil(t, err)
+	unittest.Equals(t, offset, int64(3))
+	unittest.Equals(t, b.String(), "new")
+
+	// 200: our range was ignored, we skip what we've already printed
+	set("newer", true)
+	b.Reset()
+	offset, err = c.getLog("testapp", offset, b)
+	unittest.IsNil(t, err)
+	unittest.Equals(t, offset, int64(5))
+	unittest.Equals(t, b.String(), "er")
+
+	// 200: our range was ignored and our log was truncated, we print our whole log
+	set("abc", true)
+	b.Reset()
+	offset, err = c.getLog("testapp", offset, b)
+	unittest.IsNil(t, err)
+	unittest.Equals(t, offset, int64(3))
+	unittest.Equals(t, b.String(), "abc")
+
+	// any other status is an error, our offset is unchanged
+	mu.Lock()
+	unauthorized = true
+	mu.Unlock()
+	offset, err = c.getLog("testapp", offset, b)
+	unittest.NotNil(t, err)
+	unittest.Equals(t, err.Error(), "Patrol responded with Status Code: 401: Unauthorized")
+	unittest.Equals(t, offset, int64(3))
+}
+func TestCtlReload(t *testing.T) {
+	log.Println("TestCtlReload")
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		unittest.Equals(t, r.Method, "POST")
+		unittest.Equals(t, r.URL.Path, "/api/reload")
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(401)
+			w.Write([]byte(`{"errors":["Token Unauthorized"]}`))
+			return
+		}
+		w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+	c := testCtl(t, server)
+
+	_, err := c.postReload()
+	unittest.NotNil(t, err)
+	unittest.Equals(t, err.Error(), `Patrol responded with Errors: "Token Unauthorized"`)
+	c.token = "token"
+	_, err = c.postReload()
+	unittest.IsNil(t, err)
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sabey.co/patrol"
+	"time"
+)
+
+const (
+	// ENV_ADDR is our default address when `-addr` is not set
+	ENV_ADDR = `PATROL_ADDR`
+)
+
+const (
+	EXIT_OK      = 0
+	EXIT_FAILURE = 1
+	EXIT_USAGE   = 2
+)
+
+var (
+	flags       = flag.NewFlagSet("patrolctl", flag.ContinueOnError)
+	addr        = flags.String("addr", "", "`address` of our Patrol HTTP API: HOST:PORT, https://HOST:PORT or unix:/path/to/patrol.sock, Default: $PATROL_ADDR or 127.0.0.1:8421")
+	json_output = flags.Bool("json", false, "print JSON instead of a table")
+	group       = flags.String("group", "app", "`group` of our ID: app or service")
+	secret_file = flags.String("secret-file", "", "read our Secret from this file instead of $PATROL_SECRET")
+	token_file  = flags.String("token-file", "", "read our API Token from this file instead of $PATROL_TOKEN")
+	ca_file     = flags.String("ca-file", "", "PEM encoded CA used to verify our https Patrol")
+	cert_file   = flags.String("cert-file", "", "PEM encoded client certificate for mutual TLS")
+	key_file    = flags.String("key-file", "", "PEM encoded client key for mutual TLS")
+	timeout     = flags.Duration("timeout", time.Second*10, "timeout of each request, logs -follow and export are not affected")
+	follow      = flags.Bool("follow", false, "logs: keep printing our log as it grows")
+	stderr      = flags.Bool("stderr", false, "logs: print stderr instead of stdout")
+	cas         = flags.Uint64("cas", 0, "kv set: only modify our KeyValue if our CAS matches")
+	format      = flags.String("format", patrol.HISTORY_EXPORT_CSV, "export: `format` of our History: csv or jsonl")
+	timestamp   = flags.String("timestamp", "", "export: timestamp `layout` of our History, a Go layout or rfc3339, rfc1123 etc, Default: our Patrol's timestamp")
+	since       = flags.String("since", "", "export: only export History that stopped since this unix time or timestamp")
+	until       = flags.String("until", "", "export: only export History that stopped before this unix time or timestamp")
+	unexpected  = flags.Bool("unexpected", false, "export: only export History that closed unexpectedly")
+)
+
+func usage() {
+	fmt.Fprintf(os.Stderr, `Usage: patrolctl [flags] COMMAND [ARGS]
+
+Commands:
+  status [ID...]            list Apps and Services
+  enable ID                 enable an App or Service
+  disable ID                disable an App or Service
+  restart ID                restart an App or Service
+  runonce ID                enable an App or Service and run it once
+  history ID                list previous instances of an App or Service
+  export [ID]               print History as CSV or JSON Lines, every App and Service unless ID or -group is set
+  kv get ID [KEY]           print our KeyValue
+  kv set ID KEY VALUE       set KEY to VALUE, VALUE is parsed as JSON if possible
+  logs ID                   print the stdout or stderr log of an App
+  reload                    reload our Tokens, secret files and env files, other changes require a restart
+  validate CONFIG [DIR]     validate a Patrol config file, json, yaml or toml, DIR is merged as -config-dir
+
+Flags may appear before or after our command.
+
+Flags:
+`)
+	flags.PrintDefaults()
+}
+
+// parseArgs will parse our flags wherever they appear and return our positional arguments
+// flag.Parse() stops at our first positional argument, so `patrolctl logs testapp -follow` would otherwise ignore -follow
+func parseArgs(
+	args []string,
+) (
+	[]string,
+	error,
+) {
+	positional := []string{}
+	for {
+		if err := flags.Parse(args); err != nil {
+			return nil, err
+		}
+		args = flags.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+func main() {
+	flags.Usage = usage
+	args, err := parseArgs(os.Args[1:])
+	if err != nil {
+		if err == flag.ErrHelp {
+			os.Exit(EXIT_OK)
+		}
+		os.Exit(EXIT_USAGE)
+	}
+	if len(args) == 0 {
+		usage()
+		os.Exit(EXIT_USAGE)
+	}
+	if args[0] == "validate" {
+		// validate never connects to Patrol
+		os.Exit(run(nil, args))
+	}
+	c, err := newCtl()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "patrolctl: %s\n", err)
+		os.Exit(EXIT_FAILURE)
+	}
+	os.Exit(run(c, args))
+}
+func run(
+	c *ctl,
+	args []string,
+) int {
+	command := args[0]
+	args = args[1:]
+	var err error
+	switch command {
+	case "status":
+		err = c.status(args)
+	case "enable":
+		err = c.toggle(args, patrol.API_TOGGLE_STATE_ENABLE)
+	case "disable":
+		err = c.toggle(args, patrol.API_TOGGLE_STATE_DISABLE)
+	case "restart":
+		err = c.toggle(args, patrol.API_TOGGLE_STATE_RESTART)
+	case "runonce":
+		err = c.toggle(args, patrol.API_TOGGLE_STATE_ENABLE_RUNONCE_ENABLE)
+	case "history":
+		err = c.history(args)
+	case "export":
+		err = c.export(args)
+	case "kv":
+		err = c.keyvalue(args)
+	case "logs":
+		err = c.logs(args)
+	case "reload":
+		err = c.reload(args)
+	case "validate":
+		err = validate(args)
+	default:
+		fmt.Fprintf(os.Stderr, "patrolctl: unknown command: \"%s\"\n\n", command)
+		usage()
+		return EXIT_USAGE
+	}
+	if err == ERR_USAGE {
+		usage()
+		return EXIT_USAGE
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "patrolctl: %s\n", err)
+		return EXIT_FAILURE
+	}
+	return EXIT_OK
+}
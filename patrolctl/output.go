@@ -0,0 +1,138 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sabey.co/patrol"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+type table struct {
+	w *tabwriter.Writer
+}
+
+func newTable(
+	columns ...string,
+) *table {
+	t := &table{
+		w: tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0),
+	}
+	t.row(columns...)
+	return t
+}
+func (self *table) row(
+	columns ...string,
+) {
+	fmt.Fprintln(self.w, strings.Join(columns, "\t"))
+}
+func (self *table) responseRow(
+	group string,
+	id string,
+	response *patrol.API_Response,
+) {
+	self.row(
+		group,
+		id,
+		response.Name,
+		formatState(response.Disabled, response.Restart, response.RunOnce, response.Shutdown, response.InstanceID != ""),
+		formatPID(response.PID),
+		formatTimestamp(response.Started),
+		formatTimestamp(response.LastSeen),
+	)
+}
+func (self *table) flush() error {
+	return self.w.Flush()
+}
+func printJSON(
+	v interface{},
+) error {
+	bs, err := json.MarshalIndent(v, "", "\t")
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s\n", bs)
+	return nil
+}
+func sortedIDs(
+	responses map[string]*patrol.API_Response,
+) []string {
+	ids := make([]string, 0, len(responses))
+	for id := range responses {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+func formatState(
+	disabled bool,
+	restart bool,
+	run_once bool,
+	shutdown bool,
+	running bool,
+) string {
+	state := "stopped"
+	if running {
+		state = "running"
+	}
+	if disabled {
+		state = "disabled"
+	}
+	if restart {
+		state += ",restart"
+	}
+	if run_once {
+		state += ",run-once"
+	}
+	if shutdown {
+		state += ",shutdown"
+	}
+	return state
+}
+func formatPID(
+	pid uint32,
+) string {
+	if pid == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%d", pid)
+}
+func formatTimestamp(
+	ts *patrol.Timestamp,
+) string {
+	if ts == nil ||
+		ts.IsZero() {
+		return "-"
+	}
+	return ts.String()
+}
+
+// formatRSS will format our maximum resident set size, which is in kilobytes
+func formatRSS(
+	kb int64,
+) string {
+	if kb == 0 {
+		return "-"
+	}
+	if kb < 1024 {
+		return fmt.Sprintf("%dK", kb)
+	}
+	if kb < 1024*1024 {
+		return fmt.Sprintf("%.1fM", float64(kb)/1024)
+	}
+	return fmt.Sprintf("%.1fG", float64(kb)/(1024*1024))
+}
+
+// formatCPU will format our total user and system CPU time
+func formatCPU(
+	user float64,
+	system float64,
+) string {
+	if user == 0 &&
+		system == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.2fs", user+system)
+}
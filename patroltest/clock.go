@@ -0,0 +1,123 @@
+package patroltest
+
+import (
+	"sabey.co/patrol"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Clock is a patrol.Clock that is only advanced manually
+// Our timers fire once our Clock has been advanced past their deadline, so that our schedules and ping timeouts are tested without waiting
+type Clock struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers []*clockTimer
+	// added is closed and replaced every time a timer is created
+	added chan struct{}
+}
+
+func NewClock(
+	now time.Time,
+) *Clock {
+	return &Clock{
+		now:   now,
+		added: make(chan struct{}),
+	}
+}
+
+type clockTimer struct {
+	clock    *Clock
+	deadline time.Time
+	c        chan time.Time
+}
+
+func (self *Clock) Now() time.Time {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	return self.now
+}
+func (self *Clock) NewTimer(
+	d time.Duration,
+) patrol.Timer {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	t := &clockTimer{
+		clock:    self,
+		deadline: self.now.Add(d),
+		c:        make(chan time.Time, 1),
+	}
+	if d <= 0 {
+		// we've already expired
+		t.c <- self.now
+		return t
+	}
+	self.timers = append(self.timers, t)
+	close(self.added)
+	self.added = make(chan struct{})
+	return t
+}
+
+// Advance will move our Clock forward and fire every timer whose deadline has passed, in the order of their deadlines
+func (self *Clock) Advance(
+	d time.Duration,
+) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	self.now = self.now.Add(d)
+	sort.SliceStable(self.timers, func(i, j int) bool {
+		return self.timers[i].deadline.Before(self.timers[j].deadline)
+	})
+	i := 0
+	for ; i < len(self.timers) &&
+		!self.timers[i].deadline.After(self.now); i++ {
+		self.timers[i].c <- self.now
+	}
+	self.timers = self.timers[i:]
+}
+
+// Timers will return the number of timers that are waiting to fire
+func (self *Clock) Timers() int {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	return len(self.timers)
+}
+
+// WaitTimers will wait for at least n timers to be waiting to fire
+// Patrol creates a timer once it's waiting for its next check, so this is how we know Patrol is idle before we Advance()
+// false is returned if we timed out, our timeout is real time
+func (self *Clock) WaitTimers(
+	n int,
+	timeout time.Duration,
+) bool {
+	t := time.NewTimer(timeout)
+	defer t.Stop()
+	for {
+		self.mu.Lock()
+		if len(self.timers) >= n {
+			self.mu.Unlock()
+			return true
+		}
+		added := self.added
+		self.mu.Unlock()
+		select {
+		case <-added:
+		case <-t.C:
+			return false
+		}
+	}
+}
+func (self *clockTimer) C() <-chan time.Time {
+	return self.c
+}
+func (self *clockTimer) Stop() bool {
+	self.clock.mu.Lock()
+	defer self.clock.mu.Unlock()
+	for i, t := range self.clock.timers {
+		if t == self {
+			self.clock.timers = append(self.clock.timers[:i], self.clock.timers[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,151 @@
+package patroltest
+
+import (
+	"context"
+	"io/ioutil"
+	"log"
+	"os"
+	"sabey.co/patrol"
+	"sabey.co/unittest"
+	"testing"
+	"time"
+)
+
+func TestClock(t *testing.T) {
+	log.Println("TestClock")
+
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := NewClock(now)
+	var _ patrol.Clock = c
+	unittest.Equals(t, c.Now(), now)
+
+	t1 := c.NewTimer(time.Second * 2)
+	t2 := c.NewTimer(time.Second)
+	t3 := c.NewTimer(time.Second * 3)
+	unittest.Equals(t, c.Timers(), 3)
+	unittest.Equals(t, c.WaitTimers(3, 0), true)
+	unittest.Equals(t, c.WaitTimers(4, time.Millisecond), false)
+
+	// our timers fire once their deadline has passed
+	c.Advance(time.Millisecond * 1500)
+	unittest.Equals(t, c.Now(), now.Add(time.Millisecond*1500))
+	unittest.Equals(t, <-t2.C(), now.Add(time.Millisecond*1500))
+	unittest.Equals(t, c.Timers(), 2)
+	select {
+	case <-t1.C():
+		t.Fatal("timer fired before its deadline")
+	default:
+	}
+	unittest.Equals(t, t2.Stop(), false)
+
+	// our stopped timers never fire
+	unittest.Equals(t, t3.Stop(), true)
+	unittest.Equals(t, t3.Stop(), false)
+	c.Advance(time.Second * 5)
+	<-t1.C()
+	select {
+	case <-t3.C():
+		t.Fatal("stopped timer fired")
+	default:
+	}
+	unittest.Equals(t, c.Timers(), 0)
+
+	// our expired timers fire right away
+	<-c.NewTimer(0).C()
+	<-c.NewTimer(-time.Second).C()
+	unittest.Equals(t, c.Timers(), 0)
+}
+func TestClockApp(t *testing.T) {
+	log.Println("TestClockApp")
+
+	dir, err := ioutil.TempDir("", "patroltest")
+	unittest.IsNil(t, err)
+	defer os.RemoveAll(dir)
+
+	clock := NewClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	e := NewExecutor()
+	p, err := patrol.CreatePatrol(&patrol.Config{
+		Apps: map[string]*patrol.ConfigApp{
+			"app": &patrol.ConfigApp{
+				KeepAlive:        patrol.APP_KEEPALIVE_HTTP,
+				Name:             "app",
+				Binary:           "app",
+				WorkingDirectory: dir,
+				LogDirectory:     "logs",
+			},
+		},
+		ListenHTTP: []string{"127.0.0.1:8421"},
+		Executor:   e,
+		Clock:      clock,
+	})
+	unittest.IsNil(t, err)
+	unittest.IsNil(t, p.Start())
+	app := p.GetApp("app")
+	ping_timeout := time.Second * patrol.APP_PING_TIMEOUT_DEFAULT
+	tick_every := time.Second * patrol.TICKEVERY_DEFAULT
+
+	// step will advance our clock a second at a time until our condition is true
+	// our clock is only advanced once our tick is waiting, so every check is run on schedule
+	step := func(limit time.Duration, condition func() bool) time.Duration {
+		started := clock.Now()
+		for clock.Now().Sub(started) <= limit {
+			if condition() {
+				return clock.Now().Sub(started)
+			}
+			unittest.Equals(t, clock.WaitTimers(1, time.Second), true)
+			clock.Advance(time.Second)
+			<-time.After(time.Millisecond * 2)
+		}
+		t.Fatal("condition was never true")
+		return 0
+	}
+
+	// our pingable App is never started on boot until PingTimeout * 2
+	started := step(time.Minute*3, func() bool {
+		return len(e.Processes()) > 0
+	})
+	unittest.Equals(t, started > ping_timeout*2, true)
+	unittest.Equals(t, started <= ping_timeout*2+tick_every+time.Second, true)
+	p0 := e.WaitProcess(0, 0)
+	unittest.Equals(t, app.GetStarted(), clock.Now())
+
+	// ping
+	response := p.API(&patrol.API_Request{
+		ID:    "app",
+		Group: "app",
+		Ping:  true,
+		PID:   p0.PID,
+	})
+	unittest.Equals(t, len(response.Errors), 0)
+	pinged := clock.Now()
+	unittest.Equals(t, app.GetLastSeen(), pinged)
+
+	// our ping expires once PingTimeout has passed, we're restarted right away
+	expired := step(time.Minute*3, func() bool {
+		return len(e.Processes()) > 1
+	})
+	unittest.Equals(t, expired > ping_timeout, true)
+	unittest.Equals(t, expired <= ping_timeout+tick_every+time.Second, true)
+	history := app.GetHistory()
+	unittest.Equals(t, len(history), 1)
+	unittest.Equals(t, history[0].PID, p0.PID)
+	unittest.Equals(t, history[0].LastSeen.Time, pinged)
+	unittest.Equals(t, history[0].Stopped.Time, clock.Now())
+	unittest.Equals(t, history[0].IsUnexpected(), true)
+
+	// our restarted App has no PID until it has pinged us
+	response = p.API(&patrol.API_Request{
+		ID:    "app",
+		Group: "app",
+		Ping:  true,
+		PID:   e.WaitProcess(1, 0).PID,
+	})
+	unittest.Equals(t, len(response.Errors), 0)
+
+	// we stop right away, even though our clock is never advanced again
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	unittest.IsNil(t, p.Shutdown(ctx))
+	unittest.Equals(t, p.IsRunning(), false)
+	unittest.Equals(t, p.GetShutdownReport().Apps["app"].State, patrol.SHUTDOWN_STATE_STOPPED)
+}
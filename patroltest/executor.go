@@ -0,0 +1,284 @@
+// Package patroltest provides an in-memory patrol.Executor
+// Our App and Service lifecycles may be tested deterministically without executing real processes
+package patroltest
+
+import (
+	"fmt"
+	"os/exec"
+	"sabey.co/patrol"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	// PID_FIRST is the PID of our first process, our PIDs are never real PIDs
+	PID_FIRST = 100000
+)
+
+var (
+	ERR_PROCESS_NOT_FOUND = fmt.Errorf("Process was not started by our Executor")
+)
+
+// Executor is an in-memory patrol.Executor and patrol.ExecutorWatcher
+// Our processes never exit on their own, they exit once Exit() or Kill() is called, or once they're signalled
+type Executor struct {
+	// TriggerStart is called before we start a process
+	// If an error is returned our process will fail to start
+	TriggerStart func(
+		cmd *exec.Cmd,
+	) error
+	// TriggerStarted is called once our process is started, our process may exit right away
+	// This is called from Executor.Start(), our App or Service is locked and must not be used
+	TriggerStarted func(
+		process *Process,
+	)
+	// TriggerSignal is called once our process is signalled, signal 0 is never sent to our trigger
+	// If TriggerSignal is nil, our process is terminated by every signal, the same as a process without signal handlers
+	TriggerSignal func(
+		process *Process,
+		sig syscall.Signal,
+	)
+	mu        sync.Mutex
+	processes []*Process
+	pids      map[uint32]*Process
+	cmds      map[*exec.Cmd]*Process
+	// started is closed and replaced every time a process is started
+	started chan struct{}
+}
+
+func NewExecutor() *Executor {
+	return &Executor{
+		pids:    make(map[uint32]*Process),
+		cmds:    make(map[*exec.Cmd]*Process),
+		started: make(chan struct{}),
+	}
+}
+
+// Process is a process that was started by our Executor
+type Process struct {
+	PID uint32
+	// Cmd is our command that was built by Patrol, our command is never executed
+	Cmd     *exec.Cmd
+	Started time.Time
+	mu      sync.Mutex
+	signals []syscall.Signal
+	status  *patrol.ExitStatus
+	exited  chan struct{}
+	watches map[int]func()
+	watch   int
+}
+
+func (self *Executor) Start(
+	cmd *exec.Cmd,
+) (
+	uint32,
+	error,
+) {
+	if self.TriggerStart != nil {
+		if err := self.TriggerStart(cmd); err != nil {
+			return 0, err
+		}
+	}
+	self.mu.Lock()
+	p := &Process{
+		PID:     PID_FIRST + uint32(len(self.processes)),
+		Cmd:     cmd,
+		Started: time.Now(),
+		exited:  make(chan struct{}),
+		watches: make(map[int]func()),
+	}
+	self.processes = append(self.processes, p)
+	self.pids[p.PID] = p
+	self.cmds[cmd] = p
+	close(self.started)
+	self.started = make(chan struct{})
+	self.mu.Unlock()
+	if self.TriggerStarted != nil {
+		self.TriggerStarted(p)
+	}
+	return p.PID, nil
+}
+func (self *Executor) Wait(
+	cmd *exec.Cmd,
+) (
+	*patrol.ExitStatus,
+	error,
+) {
+	self.mu.Lock()
+	p, ok := self.cmds[cmd]
+	self.mu.Unlock()
+	if !ok {
+		return nil, ERR_PROCESS_NOT_FOUND
+	}
+	<-p.exited
+	return p.ExitStatus(), nil
+}
+func (self *Executor) Signal(
+	pid uint32,
+	sig syscall.Signal,
+) error {
+	p := self.Process(pid)
+	if p == nil ||
+		!p.IsRunning() {
+		return syscall.ESRCH
+	}
+	if sig == 0 {
+		return nil
+	}
+	p.mu.Lock()
+	p.signals = append(p.signals, sig)
+	p.mu.Unlock()
+	if self.TriggerSignal != nil {
+		self.TriggerSignal(p, sig)
+	} else {
+		p.Kill(sig)
+	}
+	return nil
+}
+func (self *Executor) Status(
+	pid uint32,
+) error {
+	return self.Signal(pid, 0)
+}
+func (self *Executor) Watch(
+	pid uint32,
+	exited func(),
+) func() {
+	p := self.Process(pid)
+	if p == nil {
+		// we will never know when an unknown PID exits
+		return func() {}
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	select {
+	case <-p.exited:
+		go exited()
+		return func() {}
+	default:
+	}
+	p.watch++
+	id := p.watch
+	p.watches[id] = exited
+	return func() {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		delete(p.watches, id)
+	}
+}
+
+// Processes will return every process we've started in the order they were started
+func (self *Executor) Processes() []*Process {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	processes := make([]*Process, len(self.processes))
+	copy(processes, self.processes)
+	return processes
+}
+
+// Process will return our process by its PID, or nil if our PID was never started
+func (self *Executor) Process(
+	pid uint32,
+) *Process {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	return self.pids[pid]
+}
+
+// WaitProcess will wait for our process at index i to be started, in the order our processes were started
+// nil is returned if our process isn't started before our timeout
+func (self *Executor) WaitProcess(
+	i int,
+	timeout time.Duration,
+) *Process {
+	t := time.NewTimer(timeout)
+	defer t.Stop()
+	for {
+		self.mu.Lock()
+		if i < len(self.processes) {
+			p := self.processes[i]
+			self.mu.Unlock()
+			return p
+		}
+		started := self.started
+		self.mu.Unlock()
+		select {
+		case <-started:
+		case <-t.C:
+			return nil
+		}
+	}
+}
+
+// Args will return our command's arguments, not including our binary
+func (self *Process) Args() []string {
+	if len(self.Cmd.Args) == 0 {
+		return nil
+	}
+	return self.Cmd.Args[1:]
+}
+
+// Signals will return every signal we've received in the order they were sent
+func (self *Process) Signals() []syscall.Signal {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	signals := make([]syscall.Signal, len(self.signals))
+	copy(signals, self.signals)
+	return signals
+}
+func (self *Process) IsRunning() bool {
+	select {
+	case <-self.exited:
+		return false
+	default:
+		return true
+	}
+}
+
+// Exited is closed once our process has exited
+func (self *Process) Exited() <-chan struct{} {
+	return self.exited
+}
+
+// ExitStatus will return our exit status, or nil if we're still running
+func (self *Process) ExitStatus() *patrol.ExitStatus {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	return self.status
+}
+
+// Exit will exit our process with our exit code, a process may only exit once
+func (self *Process) Exit(
+	code int,
+) {
+	self.exit(syscall.WaitStatus((code & 0xff) << 8))
+}
+
+// Kill will terminate our process with our signal, our signal is not recorded by Signals()
+func (self *Process) Kill(
+	sig syscall.Signal,
+) {
+	self.exit(syscall.WaitStatus(sig & 0x7f))
+}
+func (self *Process) exit(
+	status syscall.WaitStatus,
+) {
+	self.mu.Lock()
+	if self.status != nil {
+		// we've already exited
+		self.mu.Unlock()
+		return
+	}
+	// we never have any resource usage
+	self.status = &patrol.ExitStatus{
+		WaitStatus: status,
+	}
+	close(self.exited)
+	watches := self.watches
+	self.watches = make(map[int]func())
+	self.mu.Unlock()
+	for _, exited := range watches {
+		go exited()
+	}
+}
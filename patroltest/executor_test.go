@@ -0,0 +1,232 @@
+package patroltest
+
+import (
+	"context"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"sabey.co/patrol"
+	"sabey.co/unittest"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestExecutor(t *testing.T) {
+	log.Println("TestExecutor")
+
+	e := NewExecutor()
+	var _ patrol.Executor = e
+	var _ patrol.ExecutorWatcher = e
+
+	cmd := exec.Command("app", "-flag")
+	pid, err := e.Start(cmd)
+	unittest.IsNil(t, err)
+	unittest.Equals(t, pid, PID_FIRST)
+	p := e.Process(pid)
+	unittest.NotNil(t, p)
+	unittest.Equals(t, p.Args(), []string{"-flag"})
+	unittest.Equals(t, e.WaitProcess(0, 0), p)
+	unittest.IsNil(t, e.WaitProcess(1, time.Millisecond))
+	unittest.IsNil(t, e.Status(pid))
+	unittest.Equals(t, e.Status(pid+1), syscall.ESRCH)
+	unittest.IsNil(t, p.ExitStatus())
+
+	// our watch is called once we exit
+	watched := make(chan struct{})
+	e.Watch(pid, func() {
+		close(watched)
+	})
+	e.Watch(pid, func() {
+		t.Fatal("unwatched process was called")
+	})()
+
+	// every signal terminates our process by default
+	unittest.IsNil(t, e.Signal(pid, syscall.SIGUSR1))
+	status, err := e.Wait(cmd)
+	unittest.IsNil(t, err)
+	unittest.Equals(t, status.WaitStatus.Signaled(), true)
+	unittest.Equals(t, status.WaitStatus.Signal(), syscall.SIGUSR1)
+	unittest.Equals(t, p.Signals(), []syscall.Signal{syscall.SIGUSR1})
+	unittest.Equals(t, p.IsRunning(), false)
+	unittest.Equals(t, e.Status(pid), syscall.ESRCH)
+	select {
+	case <-watched:
+	case <-time.After(time.Second):
+		t.Fatal("watch was not called")
+	}
+
+	// our trigger may handle our signals
+	e.TriggerSignal = func(p *Process, sig syscall.Signal) {
+		if sig == syscall.SIGUSR2 {
+			p.Exit(10)
+		}
+	}
+	cmd = exec.Command("app")
+	pid, err = e.Start(cmd)
+	unittest.IsNil(t, err)
+	unittest.Equals(t, pid, PID_FIRST+1)
+	unittest.IsNil(t, e.Signal(pid, syscall.SIGUSR1))
+	unittest.IsNil(t, e.Status(pid))
+	unittest.IsNil(t, e.Signal(pid, syscall.SIGUSR2))
+	status, err = e.Wait(cmd)
+	unittest.IsNil(t, err)
+	unittest.Equals(t, status.WaitStatus.Exited(), true)
+	unittest.Equals(t, status.WaitStatus.ExitStatus(), 10)
+	// we may only exit once
+	e.Process(pid).Kill(syscall.SIGKILL)
+	unittest.Equals(t, e.Process(pid).ExitStatus().WaitStatus.ExitStatus(), 10)
+	unittest.Equals(t, len(e.Processes()), 2)
+
+	// our start may fail
+	e.TriggerStart = func(cmd *exec.Cmd) error {
+		return ERR_PROCESS_NOT_FOUND
+	}
+	_, err = e.Start(exec.Command("app"))
+	unittest.Equals(t, err, ERR_PROCESS_NOT_FOUND)
+	unittest.Equals(t, len(e.Processes()), 2)
+	_, err = e.Wait(exec.Command("app"))
+	unittest.Equals(t, err, ERR_PROCESS_NOT_FOUND)
+}
+func TestExecutorApp(t *testing.T) {
+	log.Println("TestExecutorApp")
+
+	dir, err := ioutil.TempDir("", "patroltest")
+	unittest.IsNil(t, err)
+	defer os.RemoveAll(dir)
+
+	e := NewExecutor()
+	e.TriggerSignal = func(p *Process, sig syscall.Signal) {
+		// our App will exit once it's asked to stop
+		if sig == syscall.SIGUSR1 {
+			p.Exit(10)
+		}
+	}
+	p, err := patrol.CreatePatrol(&patrol.Config{
+		Apps: map[string]*patrol.ConfigApp{
+			"app": &patrol.ConfigApp{
+				KeepAlive:        patrol.APP_KEEPALIVE_PID_PATROL,
+				Name:             "app",
+				Binary:           "app",
+				WorkingDirectory: dir,
+				LogDirectory:     "logs",
+				PIDPath:          "app.pid",
+			},
+		},
+		TickEvery: patrol.TICKEVERY_MIN,
+		Executor:  e,
+	})
+	unittest.IsNil(t, err)
+	unittest.IsNil(t, p.Start())
+	defer p.Shutdown(context.Background())
+	app := p.GetApp("app")
+
+	p0 := e.WaitProcess(0, time.Second*5)
+	unittest.NotNil(t, p0)
+	unittest.Equals(t, app.GetPID(), p0.PID)
+	unittest.Equals(t, app.IsRunning(), true)
+
+	// we're restarted as soon as we crash
+	p0.Exit(3)
+	p1 := e.WaitProcess(1, time.Second*5)
+	unittest.NotNil(t, p1)
+	unittest.Equals(t, app.GetPID(), p1.PID)
+	history := app.GetHistory()
+	unittest.Equals(t, len(history), 1)
+	unittest.Equals(t, history[0].PID, p0.PID)
+	unittest.Equals(t, history[0].ExitCode, 3)
+	unittest.Equals(t, history[0].IsUnexpected(), true)
+
+	// run once is consumed since we're already running, we're disabled once we exit
+	app.EnableRunOnce()
+	unittest.Equals(t, app.IsRunOnceConsumed(), true)
+	p1.Exit(0)
+	unittest.IsNil(t, e.WaitProcess(2, time.Second*2))
+	unittest.Equals(t, app.IsDisabled(), true)
+	unittest.Equals(t, app.IsRunning(), false)
+	history = app.GetHistory()
+	unittest.Equals(t, len(history), 2)
+	unittest.Equals(t, history[1].RunOnce, true)
+	unittest.Equals(t, history[1].IsUnexpected(), false)
+
+	// we're signalled once we're disabled
+	app.Enable()
+	p2 := e.WaitProcess(2, time.Second*10)
+	unittest.NotNil(t, p2)
+	app.Disable()
+	select {
+	case <-p2.Exited():
+	case <-time.After(time.Second * 10):
+		t.Fatal("App was not signalled")
+	}
+	unittest.Equals(t, p2.Signals(), []syscall.Signal{syscall.SIGUSR1})
+	// our history is saved once our Wait() returns
+	for i := 0; i < 50 && len(app.GetHistory()) < 3; i++ {
+		<-time.After(time.Millisecond * 20)
+	}
+	history = app.GetHistory()
+	unittest.Equals(t, len(history), 3)
+	unittest.Equals(t, history[2].Disabled, true)
+	unittest.Equals(t, history[2].ExitCode, 10)
+	unittest.Equals(t, len(e.Processes()), 3)
+}
+func TestExecutorService(t *testing.T) {
+	log.Println("TestExecutorService")
+
+	var running, starts int32
+	e := NewExecutor()
+	e.TriggerStarted = func(p *Process) {
+		switch p.Args()[1] {
+		case "status":
+			if atomic.LoadInt32(&running) == 1 {
+				p.Exit(0)
+			} else {
+				p.Exit(3)
+			}
+		case "start":
+			if atomic.AddInt32(&starts, 1) == 1 {
+				// our first start is killed, a signal is never an ignored exit code
+				p.Kill(syscall.SIGKILL)
+				return
+			}
+			atomic.StoreInt32(&running, 1)
+			p.Exit(0)
+		}
+	}
+	p, err := patrol.CreatePatrol(&patrol.Config{
+		Services: map[string]*patrol.ConfigService{
+			"ssh": &patrol.ConfigService{
+				Management:           patrol.SERVICE_MANAGEMENT_SERVICE,
+				Name:                 "SSH",
+				Service:              "ssh",
+				IgnoreExitCodesStart: []uint8{255},
+			},
+		},
+		TickEvery: patrol.TICKEVERY_MIN,
+		Executor:  e,
+	})
+	unittest.IsNil(t, err)
+	unittest.IsNil(t, p.Start())
+	defer p.Shutdown(context.Background())
+	service := p.GetService("ssh")
+
+	// status, start, status, start
+	unittest.NotNil(t, e.WaitProcess(3, time.Second*10))
+	for i := 0; i < 50 && !service.IsRunning(); i++ {
+		<-time.After(time.Millisecond * 20)
+	}
+	unittest.Equals(t, service.IsRunning(), true)
+	args := [][]string{}
+	for _, p := range e.Processes()[:4] {
+		unittest.Equals(t, p.Cmd.Args[0], "service")
+		args = append(args, p.Args())
+	}
+	unittest.Equals(t, args, [][]string{
+		{"ssh", "status"},
+		{"ssh", "start"},
+		{"ssh", "status"},
+		{"ssh", "start"},
+	})
+}
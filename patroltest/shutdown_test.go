@@ -0,0 +1,240 @@
+package patroltest
+
+import (
+	"context"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sabey.co/patrol"
+	"sabey.co/unittest"
+	"sort"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestShutdown(t *testing.T) {
+	log.Println("TestShutdown")
+
+	dir, err := ioutil.TempDir("", "patroltest")
+	unittest.IsNil(t, err)
+	defer os.RemoveAll(dir)
+
+	var p *patrol.Patrol
+	// our Services may only be stopped once our Apps have stopped
+	var mu sync.Mutex
+	stopped := []string{}
+	e := NewExecutor()
+	e.TriggerStarted = func(process *Process) {
+		if process.Cmd.Args[0] != "service" {
+			return
+		}
+		if process.Args()[1] == "stop" {
+			mu.Lock()
+			stopped = append(stopped, process.Args()[0])
+			mu.Unlock()
+			for _, id := range []string{"clean", "term", "stubborn"} {
+				unittest.Equals(t, p.GetApp(id).IsRunning(), false)
+			}
+		}
+		// our Services are always running, our mysql Service always fails to stop
+		if process.Args()[0] == "mysql" &&
+			process.Args()[1] == "stop" {
+			process.Exit(1)
+		} else {
+			process.Exit(0)
+		}
+	}
+	e.TriggerSignal = func(p *Process, sig syscall.Signal) {
+		switch filepath.Base(p.Cmd.Path) {
+		case "clean":
+			if sig == syscall.SIGUSR1 {
+				p.Exit(0)
+			}
+		case "term":
+			if sig == syscall.SIGTERM {
+				p.Exit(1)
+			}
+		case "stubborn":
+			if sig == syscall.SIGKILL {
+				p.Kill(sig)
+			}
+		}
+		// our ghost never exits
+	}
+	config := &patrol.Config{
+		Apps: map[string]*patrol.ConfigApp{},
+		Services: map[string]*patrol.ConfigService{
+			"ssh": &patrol.ConfigService{
+				Management: patrol.SERVICE_MANAGEMENT_SERVICE,
+				Name:       "SSH",
+				Service:    "ssh",
+			},
+			"nginx": &patrol.ConfigService{
+				Management:     patrol.SERVICE_MANAGEMENT_SERVICE,
+				Name:           "nginx",
+				Service:        "nginx",
+				StopOnShutdown: true,
+			},
+			"mysql": &patrol.ConfigService{
+				Management:     patrol.SERVICE_MANAGEMENT_SERVICE,
+				Name:           "MySQL",
+				Service:        "mysql",
+				StopOnShutdown: true,
+			},
+		},
+		Executor: e,
+	}
+	for _, id := range []string{"clean", "term", "stubborn", "ghost", "disabled"} {
+		config.Apps[id] = &patrol.ConfigApp{
+			KeepAlive:        patrol.APP_KEEPALIVE_PID_PATROL,
+			Name:             id,
+			Binary:           id,
+			WorkingDirectory: dir,
+			LogDirectory:     id,
+			PIDPath:          id + ".pid",
+			Disabled:         id == "disabled",
+		}
+	}
+	p, err = patrol.CreatePatrol(config)
+	unittest.IsNil(t, err)
+	unittest.IsNil(t, p.Start())
+	// 4 Apps and our Service statuses
+	unittest.NotNil(t, e.WaitProcess(6, time.Second*5))
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*400)
+	defer cancel()
+	started := time.Now()
+	err = p.Shutdown(ctx)
+	// our ghost is given SHUTDOWN_KILL_WAIT to exit once our context is done
+	unittest.Equals(t, time.Since(started) >= time.Millisecond*400+patrol.SHUTDOWN_KILL_WAIT, true)
+	unittest.NotNil(t, err)
+	unittest.Equals(t, err.Error(), "Patrol failed to stop Apps cleanly: ghost (left-running), stubborn (killed), and failed to stop Services: mysql (stop-failed)")
+	report := err.(*patrol.ShutdownError).Report
+	unittest.Equals(t, p.GetShutdownReport(), report)
+	unittest.Equals(t, report.IsClean(), false)
+
+	r := report.Apps["clean"]
+	unittest.Equals(t, r.State, patrol.SHUTDOWN_STATE_STOPPED)
+	unittest.Equals(t, r.Signals, []string{"SIGUSR1"})
+	unittest.Equals(t, r.IsClean(), true)
+	r = report.Apps["term"]
+	unittest.Equals(t, r.State, patrol.SHUTDOWN_STATE_TERMINATED)
+	unittest.Equals(t, r.Signals, []string{"SIGUSR1", "SIGTERM"})
+	unittest.Equals(t, r.IsClean(), true)
+	r = report.Apps["stubborn"]
+	unittest.Equals(t, r.State, patrol.SHUTDOWN_STATE_KILLED)
+	unittest.Equals(t, r.Signals, []string{"SIGUSR1", "SIGTERM", "SIGKILL"})
+	unittest.Equals(t, r.PID > 0, true)
+	unittest.Equals(t, r.IsClean(), false)
+	r = report.Apps["ghost"]
+	unittest.Equals(t, r.State, patrol.SHUTDOWN_STATE_LEFT_RUNNING)
+	unittest.Equals(t, r.Signals, []string{"SIGUSR1", "SIGTERM", "SIGKILL"})
+	unittest.Equals(t, report.Apps["disabled"].State, patrol.SHUTDOWN_STATE_NOT_RUNNING)
+	// our Services are only stopped with StopOnShutdown, once our Apps have stopped
+	unittest.Equals(t, report.Services["ssh"].State, patrol.SHUTDOWN_STATE_LEFT_RUNNING)
+	unittest.Equals(t, report.Services["nginx"].State, patrol.SHUTDOWN_STATE_STOPPED)
+	unittest.Equals(t, report.Services["nginx"].IsClean(), true)
+	unittest.Equals(t, report.Services["mysql"].State, patrol.SHUTDOWN_STATE_STOP_FAILED)
+	unittest.Equals(t, report.Services["mysql"].Error != "", true)
+	mu.Lock()
+	sort.Strings(stopped)
+	unittest.Equals(t, stopped, []string{"mysql", "nginx"})
+	mu.Unlock()
+	history := p.GetService("nginx").GetHistory()
+	unittest.Equals(t, len(history), 1)
+	unittest.Equals(t, history[0].Shutdown, true)
+	unittest.Equals(t, len(p.GetService("mysql").GetHistory()), 0)
+
+	// our History is saved once our Apps exit
+	history = p.GetApp("term").GetHistory()
+	unittest.Equals(t, len(history), 1)
+	unittest.Equals(t, history[0].Shutdown, true)
+	unittest.Equals(t, history[0].ExitCode, 1)
+
+	// we may only shutdown once, every Shutdown returns our first result
+	unittest.Equals(t, p.Shutdown(context.Background()), err)
+	unittest.Equals(t, p.IsRunning(), false)
+	unittest.Equals(t, p.Start(), patrol.ERR_PATROL_SHUTDOWN)
+}
+func TestRun(t *testing.T) {
+	log.Println("TestRun")
+
+	dir, err := ioutil.TempDir("", "patroltest")
+	unittest.IsNil(t, err)
+	defer os.RemoveAll(dir)
+
+	e := NewExecutor()
+	p, err := patrol.CreatePatrol(&patrol.Config{
+		Apps: map[string]*patrol.ConfigApp{
+			"app": &patrol.ConfigApp{
+				KeepAlive:        patrol.APP_KEEPALIVE_PID_PATROL,
+				Name:             "app",
+				Binary:           "app",
+				WorkingDirectory: dir,
+				LogDirectory:     "logs",
+				PIDPath:          "app.pid",
+			},
+		},
+		ShutdownTimeout: 1,
+		Executor:        e,
+	})
+	unittest.IsNil(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	run := make(chan error, 1)
+	go func() {
+		run <- p.Run(ctx)
+	}()
+	p0 := e.WaitProcess(0, time.Second*5)
+	unittest.NotNil(t, p0)
+	unittest.IsNil(t, p.GetShutdownReport())
+
+	// our App is stopped once our context is done
+	cancel()
+	select {
+	case err := <-run:
+		unittest.IsNil(t, err)
+	case <-time.After(time.Second * 5):
+		t.Fatal("Run never returned")
+	}
+	unittest.Equals(t, p0.IsRunning(), false)
+	report := p.GetShutdownReport()
+	unittest.Equals(t, report.IsClean(), true)
+	unittest.Equals(t, report.Apps["app"].State, patrol.SHUTDOWN_STATE_STOPPED)
+	unittest.Equals(t, report.Apps["app"].PID, p0.PID)
+	unittest.Equals(t, p.IsShutdown(), true)
+
+	// Run returns once we're shutdown
+	p, err = patrol.CreatePatrol(&patrol.Config{
+		Apps: map[string]*patrol.ConfigApp{
+			"app": &patrol.ConfigApp{
+				KeepAlive:        patrol.APP_KEEPALIVE_PID_PATROL,
+				Name:             "app",
+				Binary:           "app",
+				WorkingDirectory: dir,
+				LogDirectory:     "logs",
+				PIDPath:          "app.pid",
+				Disabled:         true,
+			},
+		},
+		Executor: NewExecutor(),
+	})
+	unittest.IsNil(t, err)
+	go func() {
+		run <- p.Run(context.Background())
+	}()
+	for i := 0; i < 100 && !p.IsRunning(); i++ {
+		<-time.After(time.Millisecond * 10)
+	}
+	unittest.IsNil(t, p.Shutdown(context.Background()))
+	select {
+	case err := <-run:
+		unittest.IsNil(t, err)
+	case <-time.After(time.Second * 5):
+		t.Fatal("Run never returned")
+	}
+	unittest.Equals(t, p.Run(context.Background()), patrol.ERR_PATROL_SHUTDOWN)
+}
@@ -0,0 +1,166 @@
+package patrol
+
+import (
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	// PIDWATCH_POLL_EVERY is how often we `kill -0` our PID when pidfd_open is not supported, ie: Linux < 5.3
+	PIDWATCH_POLL_EVERY = time.Second
+	// sys_pidfd_open is the same on every architecture
+	sys_pidfd_open = 434
+)
+
+var (
+	// every pidfd is watched by a single epoll, our watches are keyed by the ID in our epoll event
+	// we can't key by our pidfd, a closed pidfd may be reused by a new watch before our epoll is read
+	pidfd_once    sync.Once
+	pidfd_epoll   = -1
+	pidfd_mu      sync.Mutex
+	pidfd_watches = make(map[int32]*pidWatch)
+	pidfd_id      int32
+)
+
+// pidWatch calls exited once our PID exits
+// our PID does not have to be our child, this is how we watch our `pid-path` PIDs
+type pidWatch struct {
+	pid    uint32
+	exited func()
+	// pidfd
+	id int32
+	fd int
+	// closed is closed once we stop watching, exited will never be called once we're closed
+	closed      chan struct{}
+	closed_once sync.Once
+	exit_once   sync.Once
+}
+
+// watchPID will call exited once our PID exits
+// pidfd_open and epoll are used if they're supported, otherwise we will poll our PID every PIDWATCH_POLL_EVERY
+func watchPID(
+	pid uint32,
+	exited func(),
+) *pidWatch {
+	w := &pidWatch{
+		pid:    pid,
+		exited: exited,
+		fd:     -1,
+		closed: make(chan struct{}),
+	}
+	if !w.watchPIDFD() {
+		go w.poll()
+	}
+	return w
+}
+func (self *pidWatch) Close() {
+	self.closed_once.Do(func() {
+		close(self.closed)
+		pidfd_mu.Lock()
+		defer pidfd_mu.Unlock()
+		if w, ok := pidfd_watches[self.id]; ok && w == self {
+			self.unwatchPIDFD()
+		}
+	})
+}
+func (self *pidWatch) exit() {
+	select {
+	case <-self.closed:
+		// we've stopped watching
+		return
+	default:
+	}
+	self.exit_once.Do(self.exited)
+}
+func (self *pidWatch) poll() {
+	ticker := time.NewTicker(PIDWATCH_POLL_EVERY)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-self.closed:
+			return
+		case <-ticker.C:
+			// EPERM means our PID exists but isn't ours to signal
+			if syscall.Kill(int(self.pid), 0) == syscall.ESRCH {
+				self.exit()
+				return
+			}
+		}
+	}
+}
+
+// watchPIDFD will return false if we must poll our PID instead
+func (self *pidWatch) watchPIDFD() bool {
+	pidfd_once.Do(func() {
+		epfd, err := syscall.EpollCreate1(syscall.EPOLL_CLOEXEC)
+		if err != nil {
+			return
+		}
+		pidfd_epoll = epfd
+		go pidfdWait(epfd)
+	})
+	if pidfd_epoll < 0 {
+		return false
+	}
+	// pidfd_open always sets O_CLOEXEC, our Apps will never inherit our pidfds
+	fd, _, errno := syscall.Syscall(sys_pidfd_open, uintptr(self.pid), 0, 0)
+	if errno == syscall.ESRCH {
+		// we've already exited
+		go self.exit()
+		return true
+	} else if errno != 0 {
+		// ENOSYS: pidfd_open is not supported
+		return false
+	}
+	pidfd_mu.Lock()
+	defer pidfd_mu.Unlock()
+	pidfd_id++
+	self.id = pidfd_id
+	self.fd = int(fd)
+	pidfd_watches[self.id] = self
+	if err := syscall.EpollCtl(pidfd_epoll, syscall.EPOLL_CTL_ADD, self.fd, &syscall.EpollEvent{
+		Events: syscall.EPOLLIN,
+		Fd:     self.id,
+	}); err != nil {
+		self.unwatchPIDFD()
+		return false
+	}
+	return true
+}
+
+// unwatchPIDFD must be called while pidfd_mu is locked
+func (self *pidWatch) unwatchPIDFD() {
+	delete(pidfd_watches, self.id)
+	syscall.EpollCtl(pidfd_epoll, syscall.EPOLL_CTL_DEL, self.fd, nil)
+	syscall.Close(self.fd)
+	self.fd = -1
+}
+
+// pidfdWait will wait for our pidfds to become readable, a pidfd is readable once its PID has exited
+func pidfdWait(
+	epfd int,
+) {
+	events := make([]syscall.EpollEvent, 32)
+	for {
+		n, err := syscall.EpollWait(epfd, events, -1)
+		if err != nil {
+			if err == syscall.EINTR {
+				continue
+			}
+			return
+		}
+		for i := 0; i < n; i++ {
+			pidfd_mu.Lock()
+			w, ok := pidfd_watches[events[i].Fd]
+			if ok {
+				w.unwatchPIDFD()
+			}
+			pidfd_mu.Unlock()
+			if ok {
+				// our exited func may lock our App, we will never block our epoll
+				go w.exit()
+			}
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package patrol
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sabey.co/patrol/cas"
+	"sabey.co/unittest"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestWatchPID(t *testing.T) {
+	log.Println("TestWatchPID")
+
+	exited := make(chan uint32, 3)
+	watch := func(w func(pid uint32) *pidWatch) {
+		cmd := exec.Command("sleep", "60")
+		unittest.IsNil(t, cmd.Start())
+		pid := uint32(cmd.Process.Pid)
+		w(pid)
+		unittest.IsNil(t, cmd.Process.Kill())
+		cmd.Wait()
+		select {
+		case p := <-exited:
+			unittest.Equals(t, p, pid)
+		case <-time.After(PIDWATCH_POLL_EVERY * 3):
+			t.Fatalf("PID %d exit was not seen", pid)
+		}
+	}
+	// pidfd, or polling if pidfd is not supported
+	watch(func(pid uint32) *pidWatch {
+		return watchPID(pid, func() {
+			exited <- pid
+		})
+	})
+	// polling
+	watch(func(pid uint32) *pidWatch {
+		w := &pidWatch{
+			pid: pid,
+			exited: func() {
+				exited <- pid
+			},
+			closed: make(chan struct{}),
+		}
+		go w.poll()
+		return w
+	})
+
+	// a closed watch is never called
+	cmd := exec.Command("sleep", "60")
+	unittest.IsNil(t, cmd.Start())
+	w := watchPID(uint32(cmd.Process.Pid), func() {
+		exited <- 0
+	})
+	w.Close()
+	unittest.IsNil(t, cmd.Process.Kill())
+	cmd.Wait()
+	select {
+	case <-exited:
+		t.Fatal("closed watch was called")
+	case <-time.After(PIDWATCH_POLL_EVERY * 2):
+	}
+}
+
+func TestAppWatchPID(t *testing.T) {
+	log.Println("TestAppWatchPID")
+
+	dir, err := ioutil.TempDir("", "patrol-pidwatch")
+	unittest.IsNil(t, err)
+	defer os.RemoveAll(dir)
+
+	p := &Patrol{
+		config: &Config{
+			History: 5,
+		},
+		wake_c: make(chan *App, 1),
+	}
+	app := &App{
+		id:     "app",
+		patrol: p,
+		config: &ConfigApp{
+			KeepAlive:        APP_KEEPALIVE_PID_APP,
+			WorkingDirectory: dir,
+			PIDPath:          "app.pid",
+		},
+		o: cas.CreateApp(false),
+	}
+	// our PID was not executed by us, we've adopted it from our pid-path
+	cmd := exec.Command("sleep", "60")
+	unittest.IsNil(t, cmd.Start())
+	pid := uint32(cmd.Process.Pid)
+	unittest.IsNil(t, ioutil.WriteFile(filepath.Join(dir, "app.pid"), []byte(fmt.Sprintf("%d\n", pid)), 0644))
+	app.o.Lock()
+	unittest.IsNil(t, app.isAppRunning())
+	unittest.Equals(t, app.watch.pid, pid)
+	app.o.Unlock()
+
+	// we won't reap our PID yet, our zombie will still answer `kill -0`
+	unittest.IsNil(t, cmd.Process.Signal(syscall.SIGKILL))
+	select {
+	case woken := <-p.wake_c:
+		unittest.Equals(t, woken, app)
+	case <-time.After(PIDWATCH_POLL_EVERY * 3):
+		t.Fatal("App was not woken")
+	}
+	app.o.Lock()
+	unittest.Equals(t, app.exited, pid)
+	unittest.Equals(t, app.isAppRunning(), ERR_APP_PID_EXITED)
+	unittest.IsNil(t, app.watch)
+	unittest.Equals(t, len(app.history), 1)
+	app.o.Unlock()
+	cmd.Wait()
+}
@@ -0,0 +1,263 @@
+package patrol
+
+//go:generate sh -c "go run ./patrol -schema > patrol.schema.json"
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"reflect"
+	"strings"
+)
+
+const (
+	SCHEMA_DRAFT = "https://json-schema.org/draft/2020-12/schema"
+	// SCHEMA_PATH is our committed schema, it must be regenerated with `go generate` whenever our config or API changes
+	SCHEMA_PATH = "patrol.schema.json"
+)
+
+// JSONSchema is the subset of JSON Schema that we generate
+type JSONSchema struct {
+	Schema      string                 `json:"$schema,omitempty"`
+	Ref         string                 `json:"$ref,omitempty"`
+	Title       string                 `json:"title,omitempty"`
+	Description string                 `json:"description,omitempty"`
+	Type        string                 `json:"type,omitempty"`
+	Enum        []interface{}          `json:"enum,omitempty"`
+	Minimum     *float64               `json:"minimum,omitempty"`
+	Maximum     *float64               `json:"maximum,omitempty"`
+	Items       *JSONSchema            `json:"items,omitempty"`
+	Properties  map[string]*JSONSchema `json:"properties,omitempty"`
+	// AdditionalProperties is either false or our schema of every value of a map
+	AdditionalProperties interface{}            `json:"additionalProperties,omitempty"`
+	Defs                 map[string]*JSONSchema `json:"$defs,omitempty"`
+}
+
+// schemaEnum is a constant that is a valid value of our field
+type schemaEnum struct {
+	Name  string
+	Value interface{}
+}
+
+var (
+	schema_keepalive = []schemaEnum{
+		{"APP_KEEPALIVE_PID_PATROL", KeepAlive(APP_KEEPALIVE_PID_PATROL)},
+		{"APP_KEEPALIVE_PID_APP", KeepAlive(APP_KEEPALIVE_PID_APP)},
+		{"APP_KEEPALIVE_HTTP", KeepAlive(APP_KEEPALIVE_HTTP)},
+		{"APP_KEEPALIVE_UDP", KeepAlive(APP_KEEPALIVE_UDP)},
+	}
+	schema_management = []schemaEnum{
+		{"SERVICE_MANAGEMENT_SERVICE", Management(SERVICE_MANAGEMENT_SERVICE)},
+		{"SERVICE_MANAGEMENT_INITD", Management(SERVICE_MANAGEMENT_INITD)},
+	}
+	schema_toggle = []schemaEnum{
+		{"API_TOGGLE_STATE_ENABLE", API_TOGGLE_STATE_ENABLE},
+		{"API_TOGGLE_STATE_DISABLE", API_TOGGLE_STATE_DISABLE},
+		{"API_TOGGLE_STATE_RESTART", API_TOGGLE_STATE_RESTART},
+		{"API_TOGGLE_STATE_RUNONCE_ENABLE", API_TOGGLE_STATE_RUNONCE_ENABLE},
+		{"API_TOGGLE_STATE_RUNONCE_DISABLE", API_TOGGLE_STATE_RUNONCE_DISABLE},
+		{"API_TOGGLE_STATE_ENABLE_RUNONCE_ENABLE", API_TOGGLE_STATE_ENABLE_RUNONCE_ENABLE},
+		{"API_TOGGLE_STATE_ENABLE_RUNONCE_DISABLE", API_TOGGLE_STATE_ENABLE_RUNONCE_DISABLE},
+	}
+	schema_events = []schemaEnum{
+		{"WEBHOOK_EVENT_APP_STARTED", WEBHOOK_EVENT_APP_STARTED},
+		{"WEBHOOK_EVENT_APP_START_FAILED", WEBHOOK_EVENT_APP_START_FAILED},
+		{"WEBHOOK_EVENT_APP_CLOSED", WEBHOOK_EVENT_APP_CLOSED},
+		{"WEBHOOK_EVENT_SERVICE_STARTED", WEBHOOK_EVENT_SERVICE_STARTED},
+		{"WEBHOOK_EVENT_SERVICE_START_FAILED", WEBHOOK_EVENT_SERVICE_START_FAILED},
+		{"WEBHOOK_EVENT_SERVICE_CLOSED", WEBHOOK_EVENT_SERVICE_CLOSED},
+	}
+	schema_scopes = []schemaEnum{
+		{"TOKEN_SCOPE_READ", TOKEN_SCOPE_READ},
+		{"TOKEN_SCOPE_PING", TOKEN_SCOPE_PING},
+		{"TOKEN_SCOPE_TOGGLE", TOKEN_SCOPE_TOGGLE},
+		{"TOKEN_SCOPE_KEYVALUE_WRITE", TOKEN_SCOPE_KEYVALUE_WRITE},
+		{"TOKEN_SCOPE_ADMIN", TOKEN_SCOPE_ADMIN},
+	}
+	// these are keyed by our type name and JSON key
+	// a list of enums are the enums of our items
+	schema_enums = map[string][]schemaEnum{
+		"ConfigApp.keepalive":              schema_keepalive,
+		"API_Response.keepalive":           schema_keepalive,
+		"ConfigService.management":         schema_management,
+		"ConfigService.management-start":   schema_management,
+		"ConfigService.management-status":  schema_management,
+		"ConfigService.management-stop":    schema_management,
+		"ConfigService.management-restart": schema_management,
+		"API_Request.toggle":               schema_toggle,
+		"ConfigWebhook.events":             schema_events,
+		"ConfigToken.scopes":               schema_scopes,
+		"API_Request.group":                []schemaEnum{{"app", "app"}, {"service", "service"}},
+		"API_Response.group":               []schemaEnum{{"app", "app"}, {"service", "service"}},
+	}
+	// these types are marshalled as JSON strings
+	schema_strings = map[reflect.Type]bool{
+		reflect.TypeOf(Timestamp{}): true,
+	}
+)
+
+// Schema will return our JSON Schema of our config.json
+// Our API_Request and API_Response are included in our `$defs`, ie: `patrol.schema.json#/$defs/API_Request`
+func Schema() *JSONSchema {
+	g := &schemaGenerator{
+		defs: make(map[string]*JSONSchema),
+	}
+	root := g.schema(reflect.TypeOf(Config{}))
+	g.schema(reflect.TypeOf(API_Request{}))
+	g.schema(reflect.TypeOf(API_Response{}))
+	return &JSONSchema{
+		Schema:      SCHEMA_DRAFT,
+		Title:       "Patrol",
+		Description: "Patrol config.json, API_Request and API_Response",
+		Ref:         root.Ref,
+		Defs:        g.defs,
+	}
+}
+
+// MarshalSchema will return our JSON Schema as indented JSON, this is what is committed as SCHEMA_PATH
+func MarshalSchema() []byte {
+	// our schema only contains types that are able to be marshalled
+	bs, _ := json.MarshalIndent(Schema(), "", "  ")
+	return append(bs, '\n')
+}
+
+// ServeHTTPSchema will serve our JSON Schema
+// our schema is public, it doesn't contain any of our config values
+func (self *Patrol) ServeHTTPSchema(
+	w http.ResponseWriter,
+	r *http.Request,
+) {
+	w.Header().Set("Content-Type", "application/schema+json; charset=utf-8")
+	w.WriteHeader(200)
+	w.Write(MarshalSchema())
+}
+
+type schemaGenerator struct {
+	defs map[string]*JSONSchema
+}
+
+func (self *schemaGenerator) schema(
+	t reflect.Type,
+) *JSONSchema {
+	if t == reflect.TypeOf(json.RawMessage{}) {
+		// any value
+		return &JSONSchema{}
+	}
+	if schema_strings[t] {
+		return &JSONSchema{
+			Type: "string",
+		}
+	}
+	switch t.Kind() {
+	case reflect.Ptr:
+		return self.schema(t.Elem())
+	case reflect.Struct:
+		return self.define(t)
+	case reflect.Slice, reflect.Array:
+		return &JSONSchema{
+			Type:  "array",
+			Items: self.schema(t.Elem()),
+		}
+	case reflect.Map:
+		return &JSONSchema{
+			Type:                 "object",
+			AdditionalProperties: self.schema(t.Elem()),
+		}
+	case reflect.String:
+		return &JSONSchema{
+			Type: "string",
+		}
+	case reflect.Bool:
+		return &JSONSchema{
+			Type: "boolean",
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return &JSONSchema{
+			Type: "integer",
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		schema := &JSONSchema{
+			Type:    "integer",
+			Minimum: schemaFloat(0),
+		}
+		if t.Bits() < 64 {
+			schema.Maximum = schemaFloat(math.Pow(2, float64(t.Bits())) - 1)
+		}
+		return schema
+	case reflect.Float32, reflect.Float64:
+		return &JSONSchema{
+			Type: "number",
+		}
+	}
+	// interface{}
+	return &JSONSchema{}
+}
+
+// define will add our struct to our `$defs` and return a reference to it
+func (self *schemaGenerator) define(
+	t reflect.Type,
+) *JSONSchema {
+	ref := &JSONSchema{
+		Ref: "#/$defs/" + t.Name(),
+	}
+	if _, ok := self.defs[t.Name()]; ok {
+		return ref
+	}
+	schema := &JSONSchema{
+		Type:                 "object",
+		Properties:           make(map[string]*JSONSchema),
+		AdditionalProperties: false,
+	}
+	// we must define our struct before our fields, our structs may reference themselves
+	self.defs[t.Name()] = schema
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			// unexported
+			continue
+		}
+		name := strings.Split(f.Tag.Get("json"), ",")[0]
+		if name == "-" ||
+			f.Type.Kind() == reflect.Func {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		property := self.schema(f.Type)
+		if enums, ok := schema_enums[t.Name()+"."+name]; ok && len(enums) > 0 {
+			enum := property
+			if property.Type == "array" {
+				enum = property.Items
+			}
+			names := make([]string, 0, len(enums))
+			for _, e := range enums {
+				if v, ok := e.Value.(fmt.Stringer); ok {
+					// our KeepAlive and Management may be either their name or their number
+					i := reflect.ValueOf(v).Int()
+					enum.Type = ""
+					enum.Minimum = nil
+					enum.Maximum = nil
+					enum.Enum = append(enum.Enum, v.String(), i)
+					names = append(names, fmt.Sprintf("%s = %d = \"%s\"", e.Name, i, v))
+					continue
+				}
+				enum.Enum = append(enum.Enum, e.Value)
+				if e.Name != fmt.Sprint(e.Value) {
+					names = append(names, fmt.Sprintf("%s = %v", e.Name, e.Value))
+				}
+			}
+			if len(names) > 0 {
+				property.Description = strings.Join(names, ", ")
+			}
+		}
+		schema.Properties[name] = property
+	}
+	return ref
+}
+func schemaFloat(
+	f float64,
+) *float64 {
+	return &f
+}
@@ -0,0 +1,50 @@
+package patrol
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"net/http/httptest"
+	"sabey.co/unittest"
+	"testing"
+)
+
+func TestSchema(t *testing.T) {
+	log.Println("TestSchema")
+
+	// our committed schema must match our structs, run `go generate` if this fails
+	committed, err := ioutil.ReadFile(SCHEMA_PATH)
+	unittest.IsNil(t, err)
+	unittest.Equals(t, string(MarshalSchema()), string(committed))
+
+	schema := Schema()
+	unittest.Equals(t, schema.Ref, "#/$defs/Config")
+	for _, name := range []string{"Config", "ConfigApp", "ConfigService", "ConfigHTTP", "API_Request", "API_Response"} {
+		unittest.NotNil(t, schema.Defs[name])
+	}
+	// unexported and ignored fields are never included
+	app := schema.Defs["ConfigApp"]
+	_, ok := app.Properties["secret-file"]
+	unittest.Equals(t, ok, true)
+	_, ok = app.Properties["extended"]
+	unittest.Equals(t, ok, false)
+	_, ok = app.Properties["TriggerStart"]
+	unittest.Equals(t, ok, false)
+	unittest.Equals(t, app.AdditionalProperties, false)
+	// our enums are our constants
+	// our keepalive may be either its name or its number
+	unittest.Equals(t, app.Properties["keepalive"].Type, "")
+	unittest.Equals(t, app.Properties["keepalive"].Enum, []interface{}{"pid-patrol", int64(1), "pid-app", int64(2), "http", int64(3), "udp", int64(4)})
+	unittest.Equals(t, app.Properties["keepalive"].Description, `APP_KEEPALIVE_PID_PATROL = 1 = "pid-patrol", APP_KEEPALIVE_PID_APP = 2 = "pid-app", APP_KEEPALIVE_HTTP = 3 = "http", APP_KEEPALIVE_UDP = 4 = "udp"`)
+	unittest.Equals(t, schema.Defs["ConfigService"].Properties["management-stop"].Enum, []interface{}{"service", int64(1), "initd", int64(2)})
+	unittest.Equals(t, schema.Defs["ConfigWebhook"].Properties["events"].Items.Enum[2], WEBHOOK_EVENT_APP_CLOSED)
+	unittest.Equals(t, *schema.Defs["API_Request"].Properties["toggle"].Maximum, float64(255))
+
+	w := httptest.NewRecorder()
+	(&Patrol{}).ServeHTTPSchema(w, httptest.NewRequest("GET", "/schema/", nil))
+	unittest.Equals(t, w.Code, 200)
+	unittest.Equals(t, w.Header().Get("Content-Type"), "application/schema+json; charset=utf-8")
+	served := make(map[string]interface{})
+	unittest.IsNil(t, json.Unmarshal(w.Body.Bytes(), &served))
+	unittest.Equals(t, served["$schema"], SCHEMA_DRAFT)
+}
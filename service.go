@@ -5,7 +5,6 @@ import (
 	"fmt"
 	"os/exec"
 	"sabey.co/patrol/cas"
-	"syscall"
 	"time"
 )
 
@@ -37,6 +36,8 @@ type Service struct {
 	// history is NOT included in our cas Object because we didn't want to restructure Patrol
 	history []*History
 	o       *cas.Service
+	// triggers calls our triggers, see ConfigService.TriggerOptions
+	triggers triggers
 }
 
 func (self *Service) IsValid() bool {
@@ -57,8 +58,26 @@ func (self *Service) GetPatrol() *Patrol {
 	return self.patrol
 }
 func (self *Service) GetConfig() *ConfigService {
+	self.patrol.reload_mu.RLock()
+	defer self.patrol.reload_mu.RUnlock()
 	return self.config.Clone()
 }
+
+// getSecret will return our resolved Secret, our Secret may be modified by Patrol.Reload()
+func (self *Service) getSecret() string {
+	self.patrol.reload_mu.RLock()
+	defer self.patrol.reload_mu.RUnlock()
+	return self.config.getSecret()
+}
+
+// IsAuthorized will compare our Secret and the identities of a verified client certificate
+// See ClientIdentities()
+func (self *Service) IsAuthorized(
+	secret string,
+	identities []string,
+) bool {
+	return isAuthorized(self.getSecret(), self.config.ClientIdentities, self.config.ClientIdentityRequired, secret, identities)
+}
 func (self *Service) GetCAS() uint64 {
 	self.o.RLock()
 	defer self.o.RUnlock()
@@ -134,7 +153,10 @@ func (self *Service) DisableRunOnce() {
 func (self *Service) GetKeyValue() map[string]interface{} {
 	self.o.RLock()
 	defer self.o.RUnlock()
-	return self.o.GetKeyValue()
+	kv := self.o.GetKeyValue()
+	// our expired keys may not have been deleted yet
+	unexpiredKeyValue(self.patrol.now(), kv, nil, self.o.GetKeyExpires())
+	return kv
 }
 func (self *Service) SetKeyValue(
 	kv map[string]interface{},
@@ -165,6 +187,8 @@ func (self *Service) getHistory() []*History {
 }
 func (self *Service) close() {
 	if !self.o.GetStarted().IsZero() {
+		// our History must never snapshot a key that has expired
+		self.o.ExpireKeyValue(self.patrol.now())
 		// save history
 		self.o.Increment() // we have to increment for modifying History
 		if len(self.history) >= self.patrol.config.History {
@@ -173,7 +197,7 @@ func (self *Service) close() {
 		h := &History{
 			InstanceID: self.instance_id,
 			Stopped: &Timestamp{
-				Time:            time.Now(),
+				Time:            self.patrol.now(),
 				TimestampFormat: self.patrol.config.Timestamp,
 			},
 			Disabled: self.o.IsDisabled(),
@@ -196,6 +220,8 @@ func (self *Service) close() {
 			}
 		}
 		self.history = append(self.history, h)
+		// send webhooks
+		self.patrol.webhook(WEBHOOK_EVENT_SERVICE_CLOSED, "service", self.id, self.config.Name, h, nil)
 		// reset values
 		self.instance_id = ""
 		self.o.SetStarted(time.Time{})
@@ -213,13 +239,15 @@ func (self *Service) close() {
 		// we're going to unlock and then relock so that we can call our trigger
 		if self.config.TriggerClosed != nil {
 			self.o.Unlock()
-			self.config.TriggerClosed(self, h)
+			self.trigger(TRIGGER_CLOSED, func() {
+				self.config.TriggerClosed(self, h)
+			})
 			self.o.Lock()
 		}
 	}
 }
 func (self *Service) startService() error {
-	now := time.Now()
+	now := self.patrol.now()
 	// consume restart
 	self.o.SetRestart(false)
 	// consume runonce
@@ -237,14 +265,12 @@ func (self *Service) startService() error {
 		cmd = exec.CommandContext(ctx, fmt.Sprintf("/etc/init.d/%s", self.config.Service), p)
 	}
 	// check exit code
-	if err := cmd.Run(); err != nil {
+	if err := self.patrol.runCommand(cmd); err != nil {
 		f := false
-		if exiterr, ok := err.(*exec.ExitError); ok {
+		if exiterr, ok := err.(*ExitError); ok {
 			// The program has exited with an exit code != 0
-			// This works on both Unix and Windows.
-			// Although package syscall is generally platform dependent,
-			// WaitStatus is defined for both Unix and Windows and in both cases has an ExitStatus() method with the same signature.
-			if status, ok := exiterr.Sys().(syscall.WaitStatus); ok {
+			// a program that was terminated by a signal has no exit code to ignore
+			if status := exiterr.WaitStatus; status.Exited() {
 				exit_code := uint8(status.ExitStatus())
 				for _, i := range self.config.IgnoreExitCodesStart {
 					if i == exit_code {
@@ -279,14 +305,12 @@ func (self *Service) isServiceRunning() error {
 		cmd = exec.CommandContext(ctx, fmt.Sprintf("/etc/init.d/%s", self.config.Service), p)
 	}
 	// check exit code
-	if err := cmd.Run(); err != nil {
+	if err := self.patrol.runCommand(cmd); err != nil {
 		f := false
-		if exiterr, ok := err.(*exec.ExitError); ok {
+		if exiterr, ok := err.(*ExitError); ok {
 			// The program has exited with an exit code != 0
-			// This works on both Unix and Windows.
-			// Although package syscall is generally platform dependent,
-			// WaitStatus is defined for both Unix and Windows and in both cases has an ExitStatus() method with the same signature.
-			if status, ok := exiterr.Sys().(syscall.WaitStatus); ok {
+			// a program that was terminated by a signal has no exit code to ignore
+			if status := exiterr.WaitStatus; status.Exited() {
 				exit_code := uint8(status.ExitStatus())
 				for _, i := range self.config.IgnoreExitCodesStatus {
 					if i == exit_code {
@@ -305,7 +329,7 @@ func (self *Service) isServiceRunning() error {
 		}
 	}
 	// running!
-	now := time.Now()
+	now := self.patrol.now()
 	if self.o.GetStarted().IsZero() {
 		// Service was not running
 		self.instance_id = uuidMust(uuidV4())
@@ -313,7 +337,9 @@ func (self *Service) isServiceRunning() error {
 		// we need to call our started trigger
 		if self.config.TriggerStarted != nil {
 			self.o.Unlock()
-			self.config.TriggerStarted(self)
+			self.trigger(TRIGGER_STARTED, func() {
+				self.config.TriggerStarted(self)
+			})
 			self.o.Lock()
 		}
 	} else {
@@ -334,14 +360,12 @@ func (self *Service) stopService() error {
 		cmd = exec.CommandContext(ctx, fmt.Sprintf("/etc/init.d/%s", self.config.Service), p)
 	}
 	// check exit code
-	if err := cmd.Run(); err != nil {
+	if err := self.patrol.runCommand(cmd); err != nil {
 		f := false
-		if exiterr, ok := err.(*exec.ExitError); ok {
+		if exiterr, ok := err.(*ExitError); ok {
 			// The program has exited with an exit code != 0
-			// This works on both Unix and Windows.
-			// Although package syscall is generally platform dependent,
-			// WaitStatus is defined for both Unix and Windows and in both cases has an ExitStatus() method with the same signature.
-			if status, ok := exiterr.Sys().(syscall.WaitStatus); ok {
+			// a program that was terminated by a signal has no exit code to ignore
+			if status := exiterr.WaitStatus; status.Exited() {
 				exit_code := uint8(status.ExitStatus())
 				for _, i := range self.config.IgnoreExitCodesStop {
 					if i == exit_code {
@@ -375,14 +399,12 @@ func (self *Service) restartService() error {
 		cmd = exec.CommandContext(ctx, fmt.Sprintf("/etc/init.d/%s", self.config.Service), p)
 	}
 	// check exit code
-	if err := cmd.Run(); err != nil {
+	if err := self.patrol.runCommand(cmd); err != nil {
 		f := false
-		if exiterr, ok := err.(*exec.ExitError); ok {
+		if exiterr, ok := err.(*ExitError); ok {
 			// The program has exited with an exit code != 0
-			// This works on both Unix and Windows.
-			// Although package syscall is generally platform dependent,
-			// WaitStatus is defined for both Unix and Windows and in both cases has an ExitStatus() method with the same signature.
-			if status, ok := exiterr.Sys().(syscall.WaitStatus); ok {
+			// a program that was terminated by a signal has no exit code to ignore
+			if status := exiterr.WaitStatus; status.Exited() {
 				exit_code := uint8(status.ExitStatus())
 				for _, i := range self.config.IgnoreExitCodesRestart {
 					if i == exit_code {
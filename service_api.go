@@ -81,7 +81,8 @@ func (self *Service) apiResponse(
 		Disabled:   self.o.IsDisabled(),
 		Restart:    self.o.IsRestart(),
 		RunOnce:    self.o.IsRunOnce(),
-		Secret:     self.config.Secret != "",
+		Secret:     self.getSecret() != "",
+		Token:      self.patrol.isTokenAccepted("service", self.id),
 		CAS:        self.o.GetCAS(),
 	}
 	if endpoint != api_endpoint_status {
@@ -101,7 +102,16 @@ func (self *Service) apiResponse(
 		if endpoint != api_endpoint_snapshot {
 			result.History = self.getHistory()
 		}
-		result.KeyValue = self.o.GetKeyValue()
+		kv := self.o.GetKeyValue()
+		versions := self.o.GetKeyVersions()
+		expires := self.o.GetKeyExpires()
+		// we may only be read locked, so our expired keys are filtered instead of deleted
+		unexpiredKeyValue(self.patrol.now(), kv, versions, expires)
+		result.KeyValue = kv
+		if len(versions) > 0 {
+			result.KeyValueVersions = versions
+		}
+		result.KeyValueExpires = self.patrol.apiKeyValueExpires(expires)
 	}
 	if !self.o.GetStarted().IsZero() {
 		result.Started = &Timestamp{
@@ -6,6 +6,21 @@ import (
 	"time"
 )
 
+// when our TimestampFormat is unknown we will attempt each of these layouts in order
+// this allows a remote client to unmarshal a response without knowing our Config.Timestamp
+var timestamp_formats = []string{
+	time.RFC3339,
+	time.RFC3339Nano,
+	time.RFC1123Z,
+	time.RFC1123,
+	time.RFC822Z,
+	time.RFC822,
+	time.RFC850,
+	time.UnixDate,
+	time.RubyDate,
+	time.ANSIC,
+}
+
 type Timestamp struct {
 	time.Time
 	TimestampFormat string
@@ -15,23 +30,33 @@ func (self *Timestamp) UnmarshalJSON(
 	data []byte,
 ) error {
 	// if our object is nil, we're going to end up using Parse(time.RFC3339) since UnmarshalJSON by default uses this!!!
-	f := ""
-	if self.TimestampFormat == "" {
-		f = time.RFC3339
-	} else {
-		f = self.TimestampFormat
-	}
 	s := strings.Trim(string(data), "\"")
 	if s == "" || s == "null" {
 		self.Time = time.Time{}
 		return nil
 	}
-	t, err := time.Parse(f, s)
-	if err != nil {
-		return err
+	if self.TimestampFormat != "" {
+		t, err := time.Parse(self.TimestampFormat, s)
+		if err != nil {
+			return err
+		}
+		self.Time = t
+		return nil
+	}
+	// our format is unknown
+	// we will return our RFC3339 error if none of our layouts match
+	var err error
+	for i, f := range timestamp_formats {
+		t, e := time.Parse(f, s)
+		if e == nil {
+			self.Time = t
+			return nil
+		}
+		if i == 0 {
+			err = e
+		}
 	}
-	self.Time = t
-	return nil
+	return err
 }
 func (self Timestamp) MarshalJSON() ([]byte, error) {
 	// if our object is nil, we're going to end up using Format(time.RFC3339) since UnmarshalJSON by default uses this!!!
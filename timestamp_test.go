@@ -28,6 +28,14 @@ func TestTimestamp(t *testing.T) {
 	unittest.IsNil(t, json.Unmarshal([]byte("\""+now.Format(time.RFC3339)+"\""), ts))
 	unittest.Equals(t, ts.Time.Format(time.RFC3339), now.Format(time.RFC3339))
 
+	// our format is unknown, we will fall back to our known layouts
+	ts = &Timestamp{}
+	now = time.Now()
+	unittest.IsNil(t, json.Unmarshal([]byte("\""+now.Format(time.RFC1123Z)+"\""), ts))
+	unittest.Equals(t, ts.Time.Format(time.RFC1123Z), now.Format(time.RFC1123Z))
+	ts = &Timestamp{}
+	unittest.NotNil(t, json.Unmarshal([]byte("\"yesterday\""), ts))
+
 	ts = &Timestamp{
 		TimestampFormat: time.UnixDate,
 	}
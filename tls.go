@@ -0,0 +1,199 @@
+package patrol
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+)
+
+var (
+	ERR_TLS_CLIENTCA_INVALID      = fmt.Errorf("TLS Client CA did not contain any PEM Certificates")
+	ERR_CLIENT_IDENTITY_EMPTY     = fmt.Errorf("Client Identity was empty")
+	ERR_CLIENT_IDENTITY_DUPLICATE = fmt.Errorf("Duplicate Client Identity")
+	ERR_CLIENT_IDENTITY_REQUIRED  = fmt.Errorf("Client Identity Required but Client Identities were empty")
+)
+
+// TLSConfig will create a tls.Config from ConfigHTTP
+// Our Certificate, Key and Client CA are reloaded whenever one of their files is modified
+// If our Client CA is set, we will require and verify client certificates unless TLSClientOptional is true
+func TLSConfig(
+	config *ConfigHTTP,
+) (
+	*tls.Config,
+	error,
+) {
+	r := &tls_reloader{
+		cert:            config.TLSCert,
+		key:             config.TLSKey,
+		client_ca:       config.TLSClientCA,
+		client_optional: config.TLSClientOptional,
+	}
+	// we want to fail immediately if our files are invalid
+	if err := r.reload(); err != nil {
+		return nil, err
+	}
+	return &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		GetConfigForClient: r.getConfigForClient,
+	}, nil
+}
+
+type tls_reloader struct {
+	cert            string
+	key             string
+	client_ca       string
+	client_optional bool
+	// unsafe
+	// modified is a signature of the modification time and size of our files
+	modified string
+	config   *tls.Config
+	mu       sync.Mutex
+}
+
+func (self *tls_reloader) signature() string {
+	s := ""
+	for _, path := range []string{self.cert, self.key, self.client_ca} {
+		if path == "" {
+			continue
+		}
+		if fi, err := os.Stat(path); err == nil {
+			s += fmt.Sprintf("%d:%d;", fi.ModTime().UnixNano(), fi.Size())
+		}
+	}
+	return s
+}
+func (self *tls_reloader) reload() error {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	modified := self.signature()
+	if self.config != nil &&
+		modified == self.modified {
+		// unchanged
+		return nil
+	}
+	certificate, err := tls.LoadX509KeyPair(self.cert, self.key)
+	if err != nil {
+		return err
+	}
+	config := &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{certificate},
+	}
+	if self.client_ca != "" {
+		bs, err := ioutil.ReadFile(self.client_ca)
+		if err != nil {
+			return err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(bs) {
+			return ERR_TLS_CLIENTCA_INVALID
+		}
+		config.ClientCAs = pool
+		if self.client_optional {
+			config.ClientAuth = tls.VerifyClientCertIfGiven
+		} else {
+			config.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+	}
+	self.config = config
+	self.modified = modified
+	return nil
+}
+func (self *tls_reloader) getConfigForClient(
+	hello *tls.ClientHelloInfo,
+) (
+	*tls.Config,
+	error,
+) {
+	// if we fail to reload, we're going to continue to serve our previous config
+	// our files may be in the middle of being replaced
+	if err := self.reload(); err != nil {
+		log.Printf("./patrol.tls_reloader.getConfigForClient(): failed to reload: \"%s\"\n", err)
+	}
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	return self.config, nil
+}
+
+// ClientIdentities will return the Common Name and Subject Alternative Names of a verified client certificate
+// If our request was not served with TLS or a client certificate was not verified, nil will be returned
+func ClientIdentities(
+	r *http.Request,
+) []string {
+	if r.TLS == nil ||
+		len(r.TLS.VerifiedChains) == 0 ||
+		len(r.TLS.VerifiedChains[0]) == 0 {
+		return nil
+	}
+	leaf := r.TLS.VerifiedChains[0][0]
+	identities := make([]string, 0, 1+len(leaf.DNSNames)+len(leaf.EmailAddresses)+len(leaf.URIs))
+	if leaf.Subject.CommonName != "" {
+		identities = append(identities, leaf.Subject.CommonName)
+	}
+	identities = append(identities, leaf.DNSNames...)
+	identities = append(identities, leaf.EmailAddresses...)
+	for _, u := range leaf.URIs {
+		identities = append(identities, u.String())
+	}
+	return identities
+}
+
+// isAuthorized compares our secret and client identities
+//
+// If no client identities are allowed, only our secret is compared
+// If ClientIdentityRequired is false, either a matching secret or an allowed identity is accepted
+// If ClientIdentityRequired is true, both a matching secret and an allowed identity are required
+func isAuthorized(
+	secret string,
+	allowed []string,
+	required bool,
+	request_secret string,
+	identities []string,
+) bool {
+	secret_valid := secret == "" || secret == request_secret
+	if len(allowed) == 0 {
+		return secret_valid
+	}
+	identity_valid := false
+	for _, a := range allowed {
+		for _, i := range identities {
+			if a == i {
+				identity_valid = true
+				break
+			}
+		}
+	}
+	if required {
+		return secret_valid && identity_valid
+	}
+	if identity_valid {
+		return true
+	}
+	// we're going to require our secret to exist, an empty secret would allow anyone without an identity
+	return secret != "" && secret_valid
+}
+func validateClientIdentities(
+	identities []string,
+	required bool,
+) error {
+	if required &&
+		len(identities) == 0 {
+		return ERR_CLIENT_IDENTITY_REQUIRED
+	}
+	exists := make(map[string]struct{})
+	for _, i := range identities {
+		if i == "" {
+			return ERR_CLIENT_IDENTITY_EMPTY
+		}
+		if _, ok := exists[i]; ok {
+			return ERR_CLIENT_IDENTITY_DUPLICATE
+		}
+		exists[i] = struct{}{}
+	}
+	return nil
+}
@@ -0,0 +1,309 @@
+package patrol
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"sabey.co/unittest"
+	"testing"
+	"time"
+)
+
+func testCertificate(
+	t *testing.T,
+	cn string,
+	dns []string,
+	ca *x509.Certificate,
+	ca_key *ecdsa.PrivateKey,
+) (
+	*x509.Certificate,
+	*ecdsa.PrivateKey,
+	[]byte,
+	[]byte,
+) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	unittest.IsNil(t, err)
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	unittest.IsNil(t, err)
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject: pkix.Name{
+			CommonName: cn,
+		},
+		DNSNames:    dns,
+		NotBefore:   time.Now().Add(-time.Hour),
+		NotAfter:    time.Now().Add(time.Hour),
+		KeyUsage:    x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	if ca == nil {
+		// self signed CA
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		ca = template
+		ca_key = key
+	} else {
+		template.IPAddresses = []net.IP{net.ParseIP("127.0.0.1")}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca, &key.PublicKey, ca_key)
+	unittest.IsNil(t, err)
+	cert, err := x509.ParseCertificate(der)
+	unittest.IsNil(t, err)
+	key_der, err := x509.MarshalECPrivateKey(key)
+	unittest.IsNil(t, err)
+	return cert, key,
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: key_der})
+}
+func TestTLSConfig(t *testing.T) {
+	log.Println("TestTLSConfig")
+
+	config := &ConfigHTTP{
+		TLSCert: "/etc/patrol/cert.pem",
+	}
+	unittest.Equals(t, config.Validate(), ERR_HTTP_TLS_KEYPAIR)
+	config.TLSKey = "/etc/patrol/../key.pem"
+	unittest.Equals(t, config.Validate(), ERR_HTTP_TLS_UNCLEAN)
+	config.TLSKey = "/etc/patrol/key.pem"
+	unittest.IsNil(t, config.Validate())
+	unittest.Equals(t, config.IsTLS(), true)
+	config.TLSClientCA = "/etc/patrol/ca.pem"
+	unittest.IsNil(t, config.Validate())
+	config.TLSCert = ""
+	config.TLSKey = ""
+	unittest.Equals(t, config.Validate(), ERR_HTTP_TLS_CLIENTCA_NOTLS)
+	unittest.Equals(t, config.IsTLS(), false)
+
+	// client identities
+	app := &ConfigApp{
+		KeepAlive:        APP_KEEPALIVE_HTTP,
+		Name:             "http",
+		Binary:           "testapp",
+		WorkingDirectory: "/testapp",
+		LogDirectory:     "logs",
+	}
+	app.ClientIdentityRequired = true
+	unittest.Equals(t, app.Validate(), ERR_CLIENT_IDENTITY_REQUIRED)
+	app.ClientIdentities = []string{"client", ""}
+	unittest.Equals(t, app.Validate(), ERR_CLIENT_IDENTITY_EMPTY)
+	app.ClientIdentities = []string{"client", "client"}
+	unittest.Equals(t, app.Validate(), ERR_CLIENT_IDENTITY_DUPLICATE)
+	app.ClientIdentities = []string{"client"}
+	unittest.IsNil(t, app.Validate())
+	clone := app.Clone()
+	unittest.Equals(t, clone.ClientIdentities, app.ClientIdentities)
+	unittest.Equals(t, clone.ClientIdentityRequired, true)
+	clone.ClientIdentities[0] = "other"
+	unittest.Equals(t, app.ClientIdentities[0], "client")
+
+	// authorization
+	// no identities
+	unittest.Equals(t, isAuthorized("", nil, false, "", nil), true)
+	unittest.Equals(t, isAuthorized("secret", nil, false, "", []string{"client"}), false)
+	unittest.Equals(t, isAuthorized("secret", nil, false, "secret", nil), true)
+	// identity in place of secret
+	unittest.Equals(t, isAuthorized("secret", []string{"client"}, false, "", []string{"client"}), true)
+	unittest.Equals(t, isAuthorized("secret", []string{"client"}, false, "secret", nil), true)
+	unittest.Equals(t, isAuthorized("secret", []string{"client"}, false, "", []string{"other"}), false)
+	unittest.Equals(t, isAuthorized("", []string{"client"}, false, "", nil), false)
+	// identity in addition to secret
+	unittest.Equals(t, isAuthorized("secret", []string{"client"}, true, "", []string{"client"}), false)
+	unittest.Equals(t, isAuthorized("secret", []string{"client"}, true, "secret", nil), false)
+	unittest.Equals(t, isAuthorized("secret", []string{"client"}, true, "secret", []string{"client"}), true)
+	unittest.Equals(t, isAuthorized("", []string{"client"}, true, "", []string{"client"}), true)
+}
+func TestTLSListen(t *testing.T) {
+	log.Println("TestTLSListen")
+
+	dir, err := ioutil.TempDir("", "patrol-tls")
+	unittest.IsNil(t, err)
+	defer os.RemoveAll(dir)
+
+	ca, ca_key, ca_pem, _ := testCertificate(t, "ca", nil, nil, nil)
+	_, _, server_pem, server_key_pem := testCertificate(t, "server", nil, ca, ca_key)
+	_, _, client_pem, client_key_pem := testCertificate(t, "client", []string{"client.example"}, ca, ca_key)
+	unittest.IsNil(t, ioutil.WriteFile(dir+"/ca.pem", ca_pem, 0600))
+	unittest.IsNil(t, ioutil.WriteFile(dir+"/cert.pem", server_pem, 0600))
+	unittest.IsNil(t, ioutil.WriteFile(dir+"/key.pem", server_key_pem, 0600))
+
+	config := &Config{
+		Apps: map[string]*ConfigApp{
+			"http": &ConfigApp{
+				KeepAlive:        APP_KEEPALIVE_HTTP,
+				Name:             "http",
+				Binary:           "testapp",
+				WorkingDirectory: "/testapp",
+				LogDirectory:     "logs",
+				Secret:           "secret",
+				ClientIdentities: []string{"client.example"},
+			},
+			"required": &ConfigApp{
+				KeepAlive:              APP_KEEPALIVE_HTTP,
+				Name:                   "required",
+				Binary:                 "testapp",
+				WorkingDirectory:       "/testapp",
+				LogDirectory:           "logs",
+				Secret:                 "secret",
+				ClientIdentities:       []string{"client"},
+				ClientIdentityRequired: true,
+			},
+		},
+		ListenHTTP: []string{"127.0.0.1:8421"},
+		HTTP: &ConfigHTTP{
+			Listen:            "127.0.0.1:0",
+			TLSCert:           dir + "/cert.pem",
+			TLSKey:            dir + "/key.pem",
+			TLSClientCA:       dir + "/ca.pem",
+			TLSClientOptional: true,
+		},
+	}
+	patrol, err := CreatePatrol(config)
+	unittest.IsNil(t, err)
+
+	l, err := ListenHTTP(patrol.GetConfig().HTTP)
+	unittest.IsNil(t, err)
+	defer l.Close()
+	server := &http.Server{
+		Handler:     http.HandlerFunc(patrol.ServeHTTPAPI),
+		ConnContext: ConnContext,
+	}
+	go server.Serve(l)
+	defer server.Close()
+
+	pool := x509.NewCertPool()
+	pool.AddCert(ca)
+	client_cert, err := tls.X509KeyPair(client_pem, client_key_pem)
+	unittest.IsNil(t, err)
+	newClient := func(certificates []tls.Certificate) *http.Client {
+		return &http.Client{
+			Transport: &http.Transport{
+				DisableKeepAlives: true,
+				TLSClientConfig: &tls.Config{
+					RootCAs:      pool,
+					Certificates: certificates,
+				},
+			},
+		}
+	}
+	ping := func(client *http.Client, id string, secret string) (*http.Response, *API_Response) {
+		bs, _ := json.Marshal(&API_Request{
+			ID:     id,
+			Group:  "app",
+			Ping:   true,
+			PID:    1234,
+			Secret: secret,
+		})
+		resp, err := client.Post("https://"+l.Addr().String()+"/api/", "application/json", bytes.NewReader(bs))
+		unittest.IsNil(t, err)
+		defer resp.Body.Close()
+		response := patrol.NewAPIResponse()
+		unittest.IsNil(t, json.NewDecoder(resp.Body).Decode(response))
+		return resp, response
+	}
+
+	// our client identity is accepted in place of our secret
+	mtls := newClient([]tls.Certificate{client_cert})
+	resp, response := ping(mtls, "http", "")
+	unittest.Equals(t, resp.StatusCode, 200)
+	unittest.Equals(t, response.CASInvalid, false)
+	unittest.Equals(t, resp.TLS.PeerCertificates[0].Subject.CommonName, "server")
+	unittest.Equals(t, patrol.GetApp("http").GetPID(), uint32(1234))
+
+	// our client identity is required in addition to our secret
+	_, response = ping(mtls, "required", "")
+	unittest.Equals(t, response.CASInvalid, true)
+	unittest.Equals(t, patrol.GetApp("required").GetPID(), uint32(0))
+	_, response = ping(mtls, "required", "secret")
+	unittest.Equals(t, response.CASInvalid, false)
+	unittest.Equals(t, patrol.GetApp("required").GetPID(), uint32(1234))
+
+	// without a client certificate we must use our secret
+	anonymous := newClient(nil)
+	resp, response = ping(anonymous, "http", "wrong")
+	unittest.Equals(t, resp.StatusCode, 400)
+	unittest.Equals(t, response.Errors, []string{"Secret Invalid"})
+	resp, _ = ping(anonymous, "http", "secret")
+	unittest.Equals(t, resp.StatusCode, 200)
+	resp, response = ping(anonymous, "required", "secret")
+	unittest.Equals(t, resp.StatusCode, 400)
+	unittest.Equals(t, response.Errors, []string{"Secret Invalid"})
+
+	// a client certificate from an unknown CA is never presented as an identity
+	other_ca, other_ca_key, _, _ := testCertificate(t, "other", nil, nil, nil)
+	_, _, other_pem, other_key_pem := testCertificate(t, "client.example", []string{"client.example"}, other_ca, other_ca_key)
+	other_cert, err := tls.X509KeyPair(other_pem, other_key_pem)
+	unittest.IsNil(t, err)
+	_, response = ping(newClient([]tls.Certificate{other_cert}), "http", "")
+	unittest.Equals(t, response.CASInvalid, true)
+
+	// reload our certificate
+	_, _, server_pem, server_key_pem = testCertificate(t, "reloaded", nil, ca, ca_key)
+	unittest.IsNil(t, ioutil.WriteFile(dir+"/cert.pem", server_pem, 0600))
+	unittest.IsNil(t, ioutil.WriteFile(dir+"/key.pem", server_key_pem, 0600))
+	// our filesystem may not have a fine enough mtime resolution
+	future := time.Now().Add(time.Minute)
+	unittest.IsNil(t, os.Chtimes(dir+"/cert.pem", future, future))
+	unittest.IsNil(t, os.Chtimes(dir+"/key.pem", future, future))
+	resp, _ = ping(mtls, "http", "")
+	unittest.Equals(t, resp.StatusCode, 200)
+	unittest.Equals(t, resp.TLS.PeerCertificates[0].Subject.CommonName, "reloaded")
+}
+func TestTLSListenClientRequired(t *testing.T) {
+	log.Println("TestTLSListenClientRequired")
+
+	dir, err := ioutil.TempDir("", "patrol-tls")
+	unittest.IsNil(t, err)
+	defer os.RemoveAll(dir)
+
+	ca, ca_key, ca_pem, _ := testCertificate(t, "ca", nil, nil, nil)
+	_, _, server_pem, server_key_pem := testCertificate(t, "server", nil, ca, ca_key)
+	unittest.IsNil(t, ioutil.WriteFile(dir+"/ca.pem", ca_pem, 0600))
+	unittest.IsNil(t, ioutil.WriteFile(dir+"/cert.pem", server_pem, 0600))
+	unittest.IsNil(t, ioutil.WriteFile(dir+"/key.pem", server_key_pem, 0600))
+
+	// invalid client ca
+	_, err = ListenHTTP(&ConfigHTTP{
+		Listen:      "127.0.0.1:0",
+		TLSCert:     dir + "/cert.pem",
+		TLSKey:      dir + "/key.pem",
+		TLSClientCA: dir + "/key.pem",
+	})
+	unittest.Equals(t, err, ERR_TLS_CLIENTCA_INVALID)
+
+	l, err := ListenHTTP(&ConfigHTTP{
+		Listen:      "127.0.0.1:0",
+		TLSCert:     dir + "/cert.pem",
+		TLSKey:      dir + "/key.pem",
+		TLSClientCA: dir + "/ca.pem",
+	})
+	unittest.IsNil(t, err)
+	defer l.Close()
+	go http.Serve(l, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(200)
+	}))
+
+	pool := x509.NewCertPool()
+	pool.AddCert(ca)
+	client := &http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{
+				RootCAs: pool,
+			},
+		},
+	}
+	// our handshake will fail without a client certificate
+	_, err = client.Get("https://" + l.Addr().String() + "/")
+	unittest.NotNil(t, err)
+}
@@ -0,0 +1,286 @@
+package patrol
+
+import (
+	"fmt"
+	"log"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+const (
+	// TRIGGER_QUEUE_MAX is how many async triggers may be waiting to be called for a single Patrol, App or Service
+	// once our queue is full our triggers are dropped and recorded, see TriggerOptions.Async
+	TRIGGER_QUEUE_MAX = 100
+	// TRIGGER_ERRORS_MAX is how many of our most recent trigger errors we will keep
+	TRIGGER_ERRORS_MAX = 100
+)
+
+// our trigger names are the names of our Config, ConfigApp and ConfigService fields
+// these are the keys of our TriggerOptions
+const (
+	TRIGGER_START          = "TriggerStart"
+	TRIGGER_STARTED        = "TriggerStarted"
+	TRIGGER_STARTED_PINGED = "TriggerStartedPinged"
+	TRIGGER_START_FAILED   = "TriggerStartFailed"
+	TRIGGER_RUNNING        = "TriggerRunning"
+	TRIGGER_DISABLED       = "TriggerDisabled"
+	TRIGGER_CLOSED         = "TriggerClosed"
+	TRIGGER_PINGED         = "TriggerPinged"
+	TRIGGER_SHUTDOWN       = "TriggerShutdown"
+	TRIGGER_TICK           = "TriggerTick"
+	TRIGGER_STOPPED        = "TriggerStopped"
+)
+
+// TriggerOptions are how a single trigger will be called
+// every trigger is recovered if it panics, regardless of our options
+type TriggerOptions struct {
+	// Timeout is how long we will wait for our trigger to return, a Timeout of 0 will wait forever
+	// once our Timeout has passed we stop waiting and our timeout is recorded
+	// our trigger is NOT cancelled, it will continue to run without our App or Service being locked!
+	Timeout time.Duration
+	// If Async is true we will never wait for our trigger, our trigger is added to our queue instead
+	// our queue is called in order, one trigger at a time, our Timeout still applies to each trigger in our queue
+	// if our queue is full our trigger is dropped, see TRIGGER_QUEUE_MAX
+	// our trigger may be called after our App or Service state has already changed again!
+	Async bool
+}
+
+// TriggerError is a trigger that panicked, timed out, or was dropped
+type TriggerError struct {
+	Trigger string    `json:"trigger"`
+	Time    time.Time `json:"time"`
+	// Panic is the value our trigger panicked with, Stack is where our trigger panicked
+	Panic string `json:"panic,omitempty"`
+	Stack string `json:"stack,omitempty"`
+	// Timeout is true if we stopped waiting for our trigger, see TriggerOptions.Timeout
+	Timeout bool `json:"timeout,omitempty"`
+	// Dropped is true if our trigger was never called because our queue was full, see TriggerOptions.Async
+	Dropped bool `json:"dropped,omitempty"`
+}
+
+func (self *TriggerError) Error() string {
+	if self.Timeout {
+		return fmt.Sprintf("%s timed out", self.Trigger)
+	}
+	if self.Dropped {
+		return fmt.Sprintf("%s was dropped", self.Trigger)
+	}
+	return fmt.Sprintf("%s panicked: %s", self.Trigger, self.Panic)
+}
+func (self *TriggerError) clone() *TriggerError {
+	if self == nil {
+		return nil
+	}
+	e := *self
+	return &e
+}
+
+func cloneTriggerOptions(
+	options map[string]*TriggerOptions,
+) map[string]*TriggerOptions {
+	if options == nil {
+		return nil
+	}
+	o := make(map[string]*TriggerOptions)
+	for k, v := range options {
+		if v != nil {
+			c := *v
+			v = &c
+		}
+		o[k] = v
+	}
+	return o
+}
+
+type triggerCall struct {
+	name    string
+	timeout time.Duration
+	f       func()
+}
+
+// triggers will call the triggers of a single Patrol, App or Service
+// our zero value is ready to use
+type triggers struct {
+	// now is the Clock of our Patrol, our errors are recorded at time.Now() if now is nil
+	now func() time.Time
+	mu  sync.Mutex
+	// queue is our async triggers waiting to be called, running is true while our queue is being called
+	queue   []*triggerCall
+	running bool
+	errors  []*TriggerError
+}
+
+// call will call our trigger using our options, options may be nil
+// our caller is never locked while our trigger is called
+func (self *triggers) call(
+	options *TriggerOptions,
+	owner string,
+	name string,
+	f func(),
+) {
+	c := &triggerCall{
+		name: name,
+		f:    f,
+	}
+	if options == nil {
+		self.run(owner, c)
+		return
+	}
+	c.timeout = options.Timeout
+	if !options.Async {
+		self.wait(owner, c)
+		return
+	}
+	self.mu.Lock()
+	if len(self.queue) >= TRIGGER_QUEUE_MAX {
+		self.mu.Unlock()
+		log.Printf("./patrol.trigger(): %s %s queue is full - Dropping!\n", owner, name)
+		self.record(&TriggerError{
+			Trigger: name,
+			Dropped: true,
+		})
+		return
+	}
+	self.queue = append(self.queue, c)
+	if !self.running {
+		self.running = true
+		go self.drain(owner)
+	}
+	self.mu.Unlock()
+}
+
+// drain will call our queue until it's empty
+func (self *triggers) drain(
+	owner string,
+) {
+	for {
+		self.mu.Lock()
+		if len(self.queue) == 0 {
+			self.running = false
+			self.mu.Unlock()
+			return
+		}
+		c := self.queue[0]
+		self.queue[0] = nil
+		self.queue = self.queue[1:]
+		self.mu.Unlock()
+		self.wait(owner, c)
+	}
+}
+
+// wait will call our trigger and wait for it to return or for our timeout
+func (self *triggers) wait(
+	owner string,
+	c *triggerCall,
+) {
+	if c.timeout <= 0 {
+		self.run(owner, c)
+		return
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		self.run(owner, c)
+	}()
+	t := time.NewTimer(c.timeout)
+	defer t.Stop()
+	select {
+	case <-done:
+	case <-t.C:
+		log.Printf("./patrol.trigger(): %s %s timed out after %s - No longer waiting!\n", owner, c.name, c.timeout)
+		self.record(&TriggerError{
+			Trigger: c.name,
+			Timeout: true,
+		})
+	}
+}
+
+// run will call our trigger and recover if it panics, our recovered panic is returned
+func (self *triggers) run(
+	owner string,
+	c *triggerCall,
+) (
+	err *TriggerError,
+) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = &TriggerError{
+				Trigger: c.name,
+				Panic:   fmt.Sprint(r),
+				Stack:   string(debug.Stack()),
+			}
+			log.Printf("./patrol.trigger(): %s %s panicked: \"%s\"\n%s", owner, c.name, err.Panic, err.Stack)
+			self.record(err)
+		}
+	}()
+	c.f()
+	return nil
+}
+func (self *triggers) record(
+	err *TriggerError,
+) {
+	if self.now != nil {
+		err.Time = self.now()
+	} else {
+		err.Time = time.Now()
+	}
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	self.errors = append(self.errors, err)
+	if len(self.errors) > TRIGGER_ERRORS_MAX {
+		self.errors = self.errors[len(self.errors)-TRIGGER_ERRORS_MAX:]
+	}
+}
+
+// getErrors will return a copy of our most recent trigger errors, oldest first
+func (self *triggers) getErrors() []*TriggerError {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	errors := make([]*TriggerError, 0, len(self.errors))
+	for _, err := range self.errors {
+		errors = append(errors, err.clone())
+	}
+	return errors
+}
+
+// trigger will call our Patrol trigger, see Config.TriggerOptions
+func (self *Patrol) trigger(
+	name string,
+	f func(),
+) {
+	self.triggers.call(self.config.TriggerOptions[name], "Patrol", name, f)
+}
+
+// GetTriggerErrors will return our most recent Patrol triggers that panicked, timed out, or were dropped
+func (self *Patrol) GetTriggerErrors() []*TriggerError {
+	return self.triggers.getErrors()
+}
+
+// trigger will call our App trigger, see ConfigApp.TriggerOptions
+// our App must NOT be locked
+func (self *App) trigger(
+	name string,
+	f func(),
+) {
+	self.triggers.call(self.config.TriggerOptions[name], fmt.Sprintf("App ID: %s", self.id), name, f)
+}
+
+// GetTriggerErrors will return our most recent App triggers that panicked, timed out, or were dropped
+func (self *App) GetTriggerErrors() []*TriggerError {
+	return self.triggers.getErrors()
+}
+
+// trigger will call our Service trigger, see ConfigService.TriggerOptions
+// our Service must NOT be locked
+func (self *Service) trigger(
+	name string,
+	f func(),
+) {
+	self.triggers.call(self.config.TriggerOptions[name], fmt.Sprintf("Service ID: %s", self.id), name, f)
+}
+
+// GetTriggerErrors will return our most recent Service triggers that panicked, timed out, or were dropped
+func (self *Service) GetTriggerErrors() []*TriggerError {
+	return self.triggers.getErrors()
+}
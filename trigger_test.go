@@ -0,0 +1,244 @@
+package patrol
+
+import (
+	"log"
+	"sabey.co/patrol/cas"
+	"sabey.co/unittest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestTriggers(t *testing.T) {
+	log.Println("TestTriggers")
+
+	tr := &triggers{}
+
+	// panic
+	called := false
+	tr.call(nil, "Patrol", TRIGGER_TICK, func() {
+		called = true
+		panic("tick")
+	})
+	unittest.Equals(t, called, true)
+	errors := tr.getErrors()
+	unittest.Equals(t, len(errors), 1)
+	unittest.Equals(t, errors[0].Trigger, TRIGGER_TICK)
+	unittest.Equals(t, errors[0].Panic, "tick")
+	unittest.Equals(t, strings.Contains(errors[0].Stack, "TestTriggers"), true)
+	unittest.Equals(t, errors[0].Time.IsZero(), false)
+	unittest.Equals(t, errors[0].Error(), "TriggerTick panicked: tick")
+
+	// timeout
+	release := make(chan struct{})
+	started := time.Now()
+	tr.call(&TriggerOptions{
+		Timeout: time.Millisecond * 50,
+	}, "Patrol", TRIGGER_TICK, func() {
+		<-release
+	})
+	unittest.Equals(t, time.Since(started) < time.Second, true)
+	errors = tr.getErrors()
+	unittest.Equals(t, len(errors), 2)
+	unittest.Equals(t, errors[1].Timeout, true)
+	unittest.Equals(t, errors[1].Error(), "TriggerTick timed out")
+	close(release)
+
+	// our timeout is never recorded if our trigger returns in time
+	tr.call(&TriggerOptions{
+		Timeout: time.Second,
+	}, "Patrol", TRIGGER_TICK, func() {})
+	unittest.Equals(t, len(tr.getErrors()), 2)
+
+	// async triggers are called in order and are never waited on
+	block := make(chan struct{})
+	var mu sync.Mutex
+	order := []int{}
+	var wg sync.WaitGroup
+	async := &TriggerOptions{
+		Async: true,
+	}
+	wg.Add(1)
+	tr.call(async, "Patrol", TRIGGER_TICK, func() {
+		defer wg.Done()
+		<-block
+	})
+	for i := 0; i < TRIGGER_QUEUE_MAX; i++ {
+		i := i
+		if i < TRIGGER_QUEUE_MAX-1 {
+			wg.Add(1)
+		}
+		tr.call(async, "Patrol", TRIGGER_TICK, func() {
+			defer wg.Done()
+			mu.Lock()
+			order = append(order, i)
+			mu.Unlock()
+		})
+	}
+	// our queue is full, our first trigger is still blocked and our last trigger was dropped
+	errors = tr.getErrors()
+	unittest.Equals(t, len(errors), 3)
+	unittest.Equals(t, errors[2].Dropped, true)
+	close(block)
+	wg.Wait()
+	unittest.Equals(t, len(order), TRIGGER_QUEUE_MAX-1)
+	for i, v := range order {
+		unittest.Equals(t, v, i)
+	}
+
+	// our queue is restarted once it has drained
+	done := make(chan struct{})
+	for {
+		tr.mu.Lock()
+		running := tr.running
+		tr.mu.Unlock()
+		if !running {
+			break
+		}
+		<-time.After(time.Millisecond)
+	}
+	tr.call(async, "Patrol", TRIGGER_TICK, func() {
+		close(done)
+	})
+	<-done
+
+	// our errors are limited
+	for i := 0; i < TRIGGER_ERRORS_MAX; i++ {
+		tr.call(nil, "Patrol", TRIGGER_TICK, func() {
+			panic("again")
+		})
+	}
+	errors = tr.getErrors()
+	unittest.Equals(t, len(errors), TRIGGER_ERRORS_MAX)
+	unittest.Equals(t, errors[0].Panic, "again")
+}
+func TestTriggerClosedPanic(t *testing.T) {
+	log.Println("TestTriggerClosedPanic")
+
+	closed := 0
+	app := &App{
+		id: "panic",
+		patrol: &Patrol{
+			config: &Config{
+				History: 5,
+			},
+		},
+		config: &ConfigApp{
+			Name:      "panic",
+			KeepAlive: APP_KEEPALIVE_HTTP,
+			TriggerClosed: func(
+				app *App,
+				history *History,
+			) {
+				closed++
+				panic("closed")
+			},
+		},
+		o: cas.CreateApp(false),
+	}
+	for i := 0; i < 2; i++ {
+		// a new App is pinged, our previous App is closed
+		app.o.Lock()
+		cas_before := app.o.GetCAS()
+		unittest.Equals(t, app.apiRequest(&API_Request{
+			CAS:  cas_before,
+			PID:  uint32(1000 + i),
+			Ping: true,
+		}), true)
+		// our lock must still be held once our trigger has panicked
+		app.o.Unlock()
+		unittest.Equals(t, app.GetPID(), uint32(1000+i))
+		unittest.Equals(t, app.GetCAS() > cas_before, true)
+	}
+	unittest.Equals(t, closed, 1)
+	unittest.Equals(t, len(app.GetHistory()), 1)
+	unittest.Equals(t, app.GetHistory()[0].PID, uint32(1000))
+
+	// our CAS is still enforced
+	cas_now := app.GetCAS()
+	app.o.Lock()
+	unittest.Equals(t, app.apiRequest(&API_Request{
+		CAS:    cas_now + 1,
+		Toggle: API_TOGGLE_STATE_DISABLE,
+	}), false)
+	unittest.Equals(t, app.apiRequest(&API_Request{
+		CAS:    cas_now,
+		Toggle: API_TOGGLE_STATE_DISABLE,
+	}), true)
+	app.o.Unlock()
+	unittest.Equals(t, app.IsDisabled(), true)
+
+	errors := app.GetTriggerErrors()
+	unittest.Equals(t, len(errors), 1)
+	unittest.Equals(t, errors[0].Trigger, TRIGGER_CLOSED)
+	unittest.Equals(t, errors[0].Panic, "closed")
+}
+func TestTriggerStartPanic(t *testing.T) {
+	log.Println("TestTriggerStartPanic")
+
+	config := &Config{
+		Apps: map[string]*ConfigApp{
+			"app": &ConfigApp{
+				KeepAlive:        APP_KEEPALIVE_PID_APP,
+				Name:             "app",
+				Binary:           "app",
+				WorkingDirectory: "/tmp",
+				LogDirectory:     "logs",
+				PIDPath:          "app.pid",
+			},
+		},
+		TriggerStart: func(
+			patrol *Patrol,
+		) error {
+			panic("start")
+		},
+	}
+	p, err := CreatePatrol(config)
+	unittest.Equals(t, p == nil, true)
+	unittest.NotNil(t, err)
+	unittest.Equals(t, err.(*TriggerError).Panic, "start")
+	unittest.Equals(t, err.Error(), "TriggerStart panicked: start")
+}
+func TestTriggerClock(t *testing.T) {
+	log.Println("TestTriggerClock")
+
+	clock := &keyValueClock{
+		now: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+	}
+	p, err := CreatePatrol(&Config{
+		Apps: map[string]*ConfigApp{
+			"app": &ConfigApp{
+				KeepAlive:        APP_KEEPALIVE_PID_APP,
+				Name:             "app",
+				Binary:           "app",
+				WorkingDirectory: "/tmp",
+				LogDirectory:     "logs",
+				PIDPath:          "app.pid",
+			},
+		},
+		Services: map[string]*ConfigService{
+			"ssh": &ConfigService{
+				Management: SERVICE_MANAGEMENT_SERVICE,
+				Name:       "SSH",
+				Service:    "ssh",
+			},
+		},
+		Clock: clock,
+	})
+	unittest.IsNil(t, err)
+
+	// our trigger errors are recorded by our Clock, not our wall clock
+	p.trigger(TRIGGER_TICK, func() {
+		panic("tick")
+	})
+	p.apps["app"].trigger(TRIGGER_STARTED, func() {
+		panic("started")
+	})
+	p.services["ssh"].trigger(TRIGGER_STARTED, func() {
+		panic("started")
+	})
+	unittest.Equals(t, p.GetTriggerErrors()[0].Time, clock.now)
+	unittest.Equals(t, p.apps["app"].GetTriggerErrors()[0].Time, clock.now)
+	unittest.Equals(t, p.services["ssh"].GetTriggerErrors()[0].Time, clock.now)
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"sabey.co/patrol"
+	"time"
+)
+
+const (
+	// CLOCK_SCALE is how much faster our clock runs than real time
+	// our TickEvery of 20 seconds becomes 2 seconds and our default PingTimeout of 30 seconds becomes 3 seconds
+	CLOCK_SCALE = 10
+)
+
+// scaledClock is a patrol.Clock that runs CLOCK_SCALE times faster than real time, so that we don't have to wait ages for unittests
+type scaledClock struct {
+	started time.Time
+}
+
+func newScaledClock() *scaledClock {
+	return &scaledClock{
+		started: time.Now(),
+	}
+}
+func (self *scaledClock) Now() time.Time {
+	return self.started.Add(time.Since(self.started) * CLOCK_SCALE)
+}
+func (self *scaledClock) NewTimer(
+	d time.Duration,
+) patrol.Timer {
+	return patrol.SystemClock{}.NewTimer(d / CLOCK_SCALE)
+}
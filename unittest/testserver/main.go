@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"log"
@@ -55,6 +56,8 @@ func main() {
 		return
 	}
 	// fix listeners
+	// we will only advertise our unix listeners if none were configured
+	listen_unix := len(config.ListenUnix) == 0
 	// http
 	if config.HTTP == nil {
 		config.HTTP = &patrol.ConfigHTTP{
@@ -64,7 +67,12 @@ func main() {
 	if config.HTTP.Listen == "" {
 		config.HTTP.Listen = httpListen()
 	}
-	if len(config.ListenHTTP) == 0 {
+	if patrol.IsListenUnix(config.HTTP.Listen) {
+		// unix domain sockets are advertised to our Apps with PATROL_UNIX
+		if listen_unix {
+			config.ListenUnix = append(config.ListenUnix, config.HTTP.Listen)
+		}
+	} else if len(config.ListenHTTP) == 0 {
 		config.ListenHTTP = []string{config.HTTP.Listen}
 	}
 	// udp
@@ -76,11 +84,18 @@ func main() {
 	if config.UDP.Listen == "" {
 		config.UDP.Listen = udpListen()
 	}
-	if len(config.ListenUDP) == 0 {
+	if patrol.IsListenUnix(config.UDP.Listen) {
+		// unix datagram sockets are advertised to our Apps with PATROL_UNIX
+		if listen_unix {
+			config.ListenUnix = append(config.ListenUnix, config.UDP.Listen)
+		}
+	} else if len(config.ListenUDP) == 0 {
 		config.ListenUDP = []string{config.UDP.Listen}
 	}
 	// WE HAVE TO SET OUR TIMESTAMP TO THE DEFAULT TIMESTAMP TYPE!!!
 	config.Timestamp = time.RFC3339
+	// our TickEvery and PingTimeout are scaled by our clock
+	config.Clock = newScaledClock()
 	// we're going to override all of our triggers so that we can test for race conditions
 	config.TriggerStart = func(
 		p *patrol.Patrol,
@@ -343,19 +358,12 @@ func main() {
 		}
 	}
 	log.Println("./patrol/unittest/testserver.main(): Stopping Patrol")
-	p.Shutdown()
-	// wait for patrol to stop
+	// wait for patrol to stop, our Apps are never signalled while unittesting
 	log.Println("./patrol/unittest/testserver.main(): Waiting for Patrol to stop!")
-	for {
-		// we're going to add a saftey measure incase we fail to stop
-		go func() {
-			<-time.After(time.Minute * 3)
-			log.Fatalln("./patrol/unittest/testserver.main(): Failed to Stop Patrol, Dying!")
-		}()
-		if !p.IsRunning() {
-			// we're done!
-			break
-		}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute*3)
+	defer cancel()
+	if err := p.Shutdown(ctx); err != nil {
+		log.Printf("./patrol/unittest/testserver.main(): %s\n", err)
 	}
 	log.Printf("./patrol/unittest/testserver.main(): Patrol ran for: %s\n", time.Now().Sub(start))
 	log.Println("good bye!")
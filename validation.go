@@ -0,0 +1,229 @@
+package patrol
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const (
+	VALIDATION_GROUP_CONFIG  = ""
+	VALIDATION_GROUP_APP     = "app"
+	VALIDATION_GROUP_SERVICE = "service"
+	VALIDATION_GROUP_HTTP    = "http"
+	VALIDATION_GROUP_UDP     = "udp"
+	VALIDATION_GROUP_WEBHOOK = "webhook"
+	VALIDATION_GROUP_TOKEN   = "token"
+)
+
+// these Validate() errors are mapped to the JSON key of the field that caused them
+// this is only used for our configs that don't implement ValidateAll()
+var validation_fields = map[error]string{
+	ERR_LISTEN_UNIX_INVALID:        "listen",
+	ERR_SOCKET_MODE_INVALID:        "socket-mode",
+	ERR_HTTP_TLS_KEYPAIR:           "tls-cert",
+	ERR_HTTP_TLS_UNCLEAN:           "tls-cert",
+	ERR_HTTP_TLS_CLIENTCA_NOTLS:    "tls-client-ca",
+	ERR_SECRET_TOOLONG:             "secret",
+	ERR_SECRET_FILE_CONFLICT:       "secret-file",
+	ERR_SECRET_FILE_UNLOADED:       "secret-file",
+	ERR_WEBHOOK_URL_EMPTY:          "url",
+	ERR_WEBHOOK_URL_INVALID:        "url",
+	ERR_WEBHOOK_EVENTS_EMPTY:       "events",
+	ERR_WEBHOOK_EVENT_INVALID:      "events",
+	ERR_WEBHOOK_EVENT_DUPLICATE:    "events",
+	ERR_WEBHOOK_APP_INVALID:        "apps",
+	ERR_WEBHOOK_SERVICE_INVALID:    "services",
+	ERR_WEBHOOK_RETRIES_INVALID:    "retries",
+	ERR_WEBHOOK_BACKOFF_INVALID:    "backoff",
+	ERR_WEBHOOK_TIMEOUT_INVALID:    "timeout",
+	ERR_WEBHOOK_DEADLETTER_UNCLEAN: "dead-letter",
+	ERR_TOKEN_HASH_INVALID:         "hash",
+	ERR_TOKEN_SCOPES_EMPTY:         "scopes",
+	ERR_TOKEN_SCOPE_INVALID:        "scopes",
+	ERR_TOKEN_SCOPE_DUPLICATE:      "scopes",
+	ERR_TOKEN_IDS_EMPTY:            "apps",
+	ERR_TOKEN_GLOB_INVALID:         "apps",
+	ERR_TOKEN_ID_INVALID:           "id",
+	ERR_TOKEN_ID_DUPLICATE:         "id",
+}
+
+// ValidationError describes a single field that failed validation
+// Rule is one of our sentinel errors, ie: ERR_APP_PIDPATH_UNCLEAN, errors.Is() will match our Rule
+type ValidationError struct {
+	// Group is one of our VALIDATION_GROUP_* values
+	Group string
+	// ID is our App or Service ID, or the index of our Webhook or Token
+	// ID is empty when ConfigApp.ValidateAll() or ConfigService.ValidateAll() are called directly
+	ID string
+	// Field is the JSON key of our field, ie: `pid-path`
+	// Field is empty if our error isn't caused by a single field, ie: ERR_APP_LABEL_DUPLICATE
+	Field string
+	// Value is the value of our field
+	// Secrets are never included
+	Value interface{}
+	Rule  error
+}
+
+func (self *ValidationError) Error() string {
+	if path := self.Path(); path != "" {
+		return fmt.Sprintf("%s: %s", path, self.Rule)
+	}
+	return self.Rule.Error()
+}
+func (self *ValidationError) Unwrap() error {
+	return self.Rule
+}
+
+// Path will return the JSON path of our field, ie: `apps.testapp.pid-path`
+func (self *ValidationError) Path() string {
+	path := ""
+	switch self.Group {
+	case VALIDATION_GROUP_APP:
+		path = "apps"
+		if self.ID != "" {
+			path += "." + self.ID
+		}
+	case VALIDATION_GROUP_SERVICE:
+		path = "services"
+		if self.ID != "" {
+			path += "." + self.ID
+		}
+	case VALIDATION_GROUP_WEBHOOK:
+		path = fmt.Sprintf("webhooks[%s]", self.ID)
+	case VALIDATION_GROUP_TOKEN:
+		path = fmt.Sprintf("tokens[%s]", self.ID)
+	default:
+		path = self.Group
+	}
+	if self.Field == "" {
+		return path
+	}
+	if path == "" {
+		return self.Field
+	}
+	return path + "." + self.Field
+}
+func (self *ValidationError) MarshalJSON() ([]byte, error) {
+	return json.Marshal(&struct {
+		Group string      `json:"group,omitempty"`
+		ID    string      `json:"id,omitempty"`
+		Field string      `json:"field,omitempty"`
+		Value interface{} `json:"value,omitempty"`
+		Path  string      `json:"path,omitempty"`
+		Rule  string      `json:"rule,omitempty"`
+	}{
+		Group: self.Group,
+		ID:    self.ID,
+		Field: self.Field,
+		Value: self.Value,
+		Path:  self.Path(),
+		Rule:  self.Rule.Error(),
+	})
+}
+
+// ValidationErrors is every ValidationError found by ValidateAll()
+type ValidationErrors []*ValidationError
+
+func (self ValidationErrors) Error() string {
+	errs := make([]string, 0, len(self))
+	for _, e := range self {
+		errs = append(errs, e.Error())
+	}
+	return strings.Join(errs, "; ")
+}
+
+// Is will return true if any of our errors match our target
+func (self ValidationErrors) Is(
+	target error,
+) bool {
+	for _, e := range self {
+		if e.Rule == target {
+			return true
+		}
+	}
+	return false
+}
+
+// first will return the Rule of our first error
+// our Validate() functions return our sentinel errors so that they behave as they always have
+func (self ValidationErrors) first() error {
+	if len(self) == 0 {
+		return nil
+	}
+	return self[0].Rule
+}
+
+type validation struct {
+	group  string
+	id     string
+	errors ValidationErrors
+}
+
+func (self *validation) add(
+	field string,
+	value interface{},
+	rule error,
+) {
+	self.errors = append(self.errors, &ValidationError{
+		Group: self.group,
+		ID:    self.id,
+		Field: field,
+		Value: value,
+		Rule:  rule,
+	})
+}
+
+// addAll will add errors from a nested ValidateAll(), our group and ID are set if they were empty
+func (self *validation) addAll(
+	group string,
+	id string,
+	errors ValidationErrors,
+) {
+	for _, e := range errors {
+		if e.Group == "" {
+			e.Group = group
+		}
+		if e.ID == "" {
+			e.ID = id
+		}
+		self.errors = append(self.errors, e)
+	}
+}
+
+// addValidate will add an error from a config that only implements Validate()
+func (self *validation) addValidate(
+	group string,
+	id string,
+	err error,
+) {
+	if err == nil {
+		return
+	}
+	self.errors = append(self.errors, &ValidationError{
+		Group: group,
+		ID:    id,
+		Field: validation_fields[err],
+		Rule:  err,
+	})
+}
+
+// sortedKeys will return the keys of our Apps or Services in order, so that our errors are always returned in the same order
+func sortedKeys(
+	m interface{},
+) []string {
+	keys := []string{}
+	switch v := m.(type) {
+	case map[string]*ConfigApp:
+		for k := range v {
+			keys = append(keys, k)
+		}
+	case map[string]*ConfigService:
+		for k := range v {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
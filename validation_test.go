@@ -0,0 +1,135 @@
+package patrol
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"sabey.co/unittest"
+	"testing"
+)
+
+func TestValidateAll(t *testing.T) {
+	log.Println("TestValidateAll")
+
+	app := &ConfigApp{
+		KeepAlive:        APP_KEEPALIVE_PID_APP,
+		Name:             "testapp",
+		WorkingDirectory: "relative",
+		LogDirectory:     "logs",
+		PIDPath:          "logs/../app.pid",
+		Secret:           string(make([]byte, SECRET_MAX_LENGTH+1)),
+		UDPKeys: map[string]string{
+			"key-1": "",
+		},
+	}
+	errs := app.ValidateAll()
+	unittest.Equals(t, len(errs), 5)
+	// Validate() still returns our first sentinel
+	unittest.Equals(t, app.Validate(), ERR_APP_WORKINGDIRECTORY_RELATIVE)
+	unittest.Equals(t, errs[0].Field, "working-directory")
+	unittest.Equals(t, errs[0].Value, "relative")
+	unittest.Equals(t, errs[1].Rule, ERR_APP_BINARY_EMPTY)
+	unittest.Equals(t, errs[2].Rule, ERR_APP_PIDPATH_UNCLEAN)
+	// secrets are never returned
+	unittest.Equals(t, errs[3].Field, "secret")
+	unittest.IsNil(t, errs[3].Value)
+	unittest.Equals(t, errs[4].Value, "key-1")
+	unittest.Equals(t, errors.Is(errs, ERR_APP_PIDPATH_UNCLEAN), true)
+	unittest.Equals(t, errors.Is(errs, ERR_APP_NAME_EMPTY), false)
+	unittest.Equals(t, errors.Is(errs[2], ERR_APP_PIDPATH_UNCLEAN), true)
+	// our check interval and ping timeout may not be negative
+	app.CheckEvery = -1
+	app.PingTimeout = -1
+	app.CrashTail = APP_CRASH_TAIL_MAX + 1
+	errs = app.ValidateAll()
+	unittest.Equals(t, errs[5].Rule, ERR_APP_CHECKEVERY_INVALID)
+	unittest.Equals(t, errs[6].Rule, ERR_APP_PINGTIMEOUT_INVALID)
+	unittest.Equals(t, errs[7].Rule, ERR_APP_CRASHTAIL_INVALID)
+	app.CheckEvery = 0
+	app.PingTimeout = 0
+	app.CrashTail = APP_CRASH_TAIL_MAX
+	unittest.Equals(t, len(app.ValidateAll()), 5)
+	app.CrashTail = 0
+
+	service := &ConfigService{
+		ManagementStart:      SERVICE_MANAGEMENT_SERVICE,
+		IgnoreExitCodesStart: []uint8{1, 1},
+		CheckEvery:           -1,
+	}
+	errs = service.ValidateAll()
+	unittest.Equals(t, service.Validate(), ERR_SERVICE_MANAGEMENT_STATUS_INVALID)
+	fields := []string{}
+	for _, e := range errs {
+		fields = append(fields, e.Field)
+	}
+	unittest.Equals(t, fields, []string{"management-status", "management-stop", "management-restart", "service", "name", "check-every", "ignore-exit-codes-start"})
+	unittest.Equals(t, errs[5].Rule, ERR_SERVICE_CHECKEVERY_INVALID)
+	unittest.Equals(t, errs[6].Rule, ERR_SERVICE_DUPLICATE_EXITCODE)
+	service.CheckEvery = 0
+
+	config := &Config{
+		Apps: map[string]*ConfigApp{
+			"testapp": app,
+			"http": &ConfigApp{
+				KeepAlive:        APP_KEEPALIVE_HTTP,
+				Name:             "http",
+				Binary:           "testapp",
+				WorkingDirectory: "/testapp",
+				LogDirectory:     "logs",
+			},
+			"-invalid": &ConfigApp{},
+		},
+		Services: map[string]*ConfigService{
+			"ssh": service,
+		},
+		Webhooks: []*ConfigWebhook{
+			&ConfigWebhook{},
+		},
+		TokenRequired: true,
+	}
+	errs = config.ValidateAll()
+	paths := []string{}
+	for _, e := range errs {
+		paths = append(paths, e.Path())
+	}
+	unittest.Equals(t, paths, []string{
+		"apps.-invalid",
+		"apps.testapp.working-directory",
+		"apps.testapp.binary",
+		"apps.testapp.pid-path",
+		"apps.testapp.secret",
+		"apps.testapp.udp-keys",
+		"listen-http",
+		"services.ssh.management-status",
+		"services.ssh.management-stop",
+		"services.ssh.management-restart",
+		"services.ssh.service",
+		"services.ssh.name",
+		"services.ssh.ignore-exit-codes-start",
+		"webhooks[0].url",
+		"tokens",
+	})
+	unittest.Equals(t, errs[1].Group, VALIDATION_GROUP_APP)
+	unittest.Equals(t, errs[1].ID, "testapp")
+	unittest.Equals(t, errs[1].Error(), "apps.testapp.working-directory: "+ERR_APP_WORKINGDIRECTORY_RELATIVE.Error())
+	unittest.Equals(t, errors.Is(errs, ERR_TOKEN_REQUIRED_EMPTY), true)
+	// our config was not modified
+	_, ok := config.Apps["testapp"]
+	unittest.Equals(t, ok, true)
+
+	// json
+	bs, err := json.Marshal(errs[1])
+	unittest.IsNil(t, err)
+	unittest.Equals(t, string(bs), `{"group":"app","id":"testapp","field":"working-directory","value":"relative","path":"apps.testapp.working-directory","rule":"App WorkingDirectory was relative"}`)
+
+	// valid
+	config.Apps = map[string]*ConfigApp{
+		"http": config.Apps["http"],
+	}
+	config.Services = nil
+	config.Webhooks = nil
+	config.TokenRequired = false
+	config.ListenHTTP = []string{"127.0.0.1:8421"}
+	unittest.Equals(t, len(config.ValidateAll()), 0)
+	unittest.IsNil(t, config.Validate())
+}